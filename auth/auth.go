@@ -0,0 +1,268 @@
+// Package auth validates the bearer tokens accepted by the Prism services.
+package auth
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Scopes understood by the Prism services.
+const (
+	// ScopeTasksRead allows reading tasks, settings and boards and opening
+	// the update stream.
+	ScopeTasksRead = "tasks:read"
+	// ScopeTasksWrite allows task commands.
+	ScopeTasksWrite = "tasks:write"
+	// ScopeSettingsWrite allows user profile and settings commands.
+	ScopeSettingsWrite = "settings:write"
+	// ScopeBoardsWrite allows creating boards and managing their members.
+	ScopeBoardsWrite = "boards:write"
+)
+
+var prismScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeSettingsWrite, ScopeBoardsWrite}
+
+// IsPrismScope reports whether scope is one of the scopes above.
+func IsPrismScope(scope string) bool {
+	for _, s := range prismScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// expiryLeeway rejects tokens that expire within the next minute so they do
+// not lapse while a request is being handled.
+const expiryLeeway = time.Minute
+
+// Principal is the caller identified by a validated token.
+type Principal struct {
+	UserID string
+	// Scopes lists the granted scopes and permissions. It is nil when the token
+	// carries no scope claim at all.
+	Scopes []string
+	// ExpiresAt is when the token stops being accepted. It is zero for tokens
+	// without an expiry.
+	ExpiresAt time.Time
+	// Unrestricted is set for tokens granting none of the Prism scopes while
+	// scopes are not required, such as interactive logins from the web app.
+	Unrestricted bool
+	// TokenID identifies the personal access token the caller used. It is
+	// empty for JWTs.
+	TokenID string
+}
+
+// HasScope reports whether the token granted scope.
+func (p Principal) HasScope(scope string) bool {
+	if p.Unrestricted {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator validates incoming JWT tokens.
+type Authenticator struct {
+	audience   string
+	testSecret []byte
+	// issuers maps every trusted issuer to the key set its tokens are
+	// verified with.
+	issuers map[string]*keyfunc.JWKS
+	parser  *jwt.Parser
+	cache   *tokenCache
+	// requireScopes denies tokens without Prism scopes instead of treating
+	// them as unrestricted.
+	requireScopes bool
+	tokens        TokenStore
+	// rejected remembers personal access tokens the store did not know, and
+	// lookups limits how often the store is asked per user.
+	rejected *tokenCache
+	lookups  *lookupLimiters
+}
+
+// New creates an Authenticator accepting tokens signed with one of algorithms
+// by the given issuers. With AUTH0_TEST_MODE=1 tokens are instead verified with
+// the HMAC secret in TEST_JWT_SECRET.
+func New(audience string, issuers map[string]*keyfunc.JWKS, algorithms []string) *Authenticator {
+	a := &Authenticator{audience: audience, issuers: issuers, parser: jwt.NewParser(jwt.WithValidMethods(algorithms))}
+	if os.Getenv("AUTH0_TEST_MODE") == "1" {
+		secret := os.Getenv("TEST_JWT_SECRET")
+		if secret == "" {
+			panic("TEST_JWT_SECRET must be set when AUTH0_TEST_MODE=1")
+		}
+		a.testSecret = []byte(secret)
+		a.parser = jwt.NewParser(jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	}
+	return a
+}
+
+// Close stops the background refresh of the issuers' key sets.
+func (a *Authenticator) Close() {
+	for _, jwks := range a.issuers {
+		jwks.EndBackground()
+	}
+}
+
+// UserIDFromAuthHeader extracts the user identifier from the Authorization header.
+func (a *Authenticator) UserIDFromAuthHeader(h string) (string, error) {
+	p, err := a.Authenticate(h)
+	if err != nil {
+		return "", err
+	}
+	return p.UserID, nil
+}
+
+// Authenticate validates the bearer token in the Authorization header and
+// returns the caller it identifies. Validated tokens are cached until they
+// expire, so repeated requests skip signature verification.
+func (a *Authenticator) Authenticate(h string) (Principal, error) {
+	if h == "" {
+		return Principal{}, errors.New("missing authorization header")
+	}
+	parts := strings.SplitN(h, " ", 2)
+	if len(parts) != 2 {
+		return Principal{}, errors.New("bad auth header")
+	}
+
+	tokenStr := parts[1]
+	if strings.Count(tokenStr, ".") != 2 {
+		return Principal{}, errors.New("bad auth header")
+	}
+
+	if p, ok := a.cache.get(tokenStr); ok {
+		return p, nil
+	}
+	if strings.HasPrefix(tokenStr, PersonalTokenPrefix) {
+		p, err := a.validatePersonal(tokenStr)
+		if err != nil {
+			return Principal{}, err
+		}
+		// Revocations only reach other instances once their entry lapses.
+		until := time.Now().Add(personalTokenCacheTTL)
+		if p.ExpiresAt.Before(until) {
+			until = p.ExpiresAt
+		}
+		a.cache.put(tokenStr, p, until)
+		return p, nil
+	}
+	p, err := a.validate(tokenStr)
+	if err != nil {
+		return Principal{}, err
+	}
+	p.Unrestricted = !a.requireScopes && !grantsPrismScope(p)
+	if !p.ExpiresAt.IsZero() {
+		a.cache.put(tokenStr, p, p.ExpiresAt.Add(-expiryLeeway))
+	}
+	return p, nil
+}
+
+func (a *Authenticator) validate(tokenStr string) (Principal, error) {
+	if a.testSecret != nil {
+		token, err := a.parser.Parse(tokenStr, func(*jwt.Token) (any, error) {
+			return a.testSecret, nil
+		})
+		if err != nil {
+			return Principal{}, err
+		}
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return Principal{}, errors.New("invalid claims")
+		}
+		return principal(claims)
+	}
+
+	token, err := a.parser.Parse(tokenStr, a.keyfunc)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return Principal{}, errors.New("invalid claims")
+	}
+
+	now := time.Now().Add(expiryLeeway).Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return Principal{}, errors.New("token expired")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return Principal{}, errors.New("token not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now, false) {
+		return Principal{}, errors.New("token used before issued")
+	}
+	if !claims.VerifyAudience(a.audience, false) {
+		return Principal{}, errors.New("invalid audience")
+	}
+	return principal(claims)
+}
+
+// keyfunc selects the key set of the token's issuer. Tokens from issuers that
+// are not configured are rejected before any key lookup.
+func (a *Authenticator) keyfunc(token *jwt.Token) (any, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims")
+	}
+	iss, _ := claims["iss"].(string)
+	jwks, ok := a.issuers[iss]
+	if !ok {
+		return nil, errors.New("invalid issuer")
+	}
+	return jwks.Keyfunc(token)
+}
+
+func principal(claims jwt.MapClaims) (Principal, error) {
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return Principal{}, errors.New("missing sub")
+	}
+	p := Principal{UserID: sub, Scopes: scopes(claims)}
+	if exp, ok := claims["exp"].(float64); ok {
+		p.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return p, nil
+}
+
+// scopes merges the OAuth scope claim with the permissions claim Auth0 adds
+// when RBAC is enabled and the scp claim used by Microsoft Entra ID.
+func scopes(claims jwt.MapClaims) []string {
+	var out []string
+	found := false
+	for _, name := range []string{"scope", "scp", "permissions"} {
+		switch v := claims[name].(type) {
+		case string:
+			found = true
+			out = append(out, strings.Fields(v)...)
+		case []any:
+			found = true
+			for _, s := range v {
+				if s, ok := s.(string); ok && s != "" {
+					out = append(out, s)
+				}
+			}
+		}
+	}
+	if found && out == nil {
+		out = []string{}
+	}
+	return out
+}
+
+func grantsPrismScope(p Principal) bool {
+	for _, s := range prismScopes {
+		if p.HasScope(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestUserIDFromAuthHeaderManyPeriods(t *testing.T) {
+	a := &Authenticator{}
+	header := "Bearer " + strings.Repeat(".", 10000)
+	if _, err := a.UserIDFromAuthHeader(header); err == nil || err.Error() != "bad auth header" {
+		t.Fatalf("expected bad auth header error, got %v", err)
+	}
+}
+
+func signHMAC(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + s
+}
+
+func TestAuthenticateParsesScopes(t *testing.T) {
+	t.Setenv("AUTH0_TEST_MODE", "1")
+	t.Setenv("TEST_JWT_SECRET", "secret")
+	a := New("", nil, nil)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{"none", jwt.MapClaims{"sub": "u1", "exp": exp}, nil},
+		{"scope", jwt.MapClaims{"sub": "u1", "exp": exp, "scope": "openid tasks:read"}, []string{"openid", "tasks:read"}},
+		{"permissions", jwt.MapClaims{"sub": "u1", "exp": exp, "permissions": []string{"tasks:write"}}, []string{"tasks:write"}},
+		{"empty", jwt.MapClaims{"sub": "u1", "exp": exp, "scope": ""}, []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := a.Authenticate(signHMAC(t, "secret", tc.claims))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.UserID != "u1" || p.ExpiresAt.Unix() != exp {
+				t.Fatalf("unexpected principal %+v", p)
+			}
+			if (p.Scopes == nil) != (tc.want == nil) || strings.Join(p.Scopes, " ") != strings.Join(tc.want, " ") {
+				t.Fatalf("expected scopes %#v, got %#v", tc.want, p.Scopes)
+			}
+		})
+	}
+	p, _ := a.Authenticate(signHMAC(t, "secret", cases[1].claims))
+	if !p.HasScope(ScopeTasksRead) || p.HasScope(ScopeTasksWrite) {
+		t.Fatalf("unexpected HasScope results for %v", p.Scopes)
+	}
+}
+
+func TestAuthenticateCachesTokensUntilExpiry(t *testing.T) {
+	t.Setenv("AUTH0_TEST_MODE", "1")
+	t.Setenv("TEST_JWT_SECRET", "secret")
+	a := New("", nil, nil)
+	a.cache = newTokenCache(2)
+	now := time.Now()
+	a.cache.now = func() time.Time { return now }
+
+	header := signHMAC(t, "secret", jwt.MapClaims{"sub": "u1", "exp": now.Add(10 * time.Minute).Unix()})
+	if _, err := a.Authenticate(header); err != nil {
+		t.Fatal(err)
+	}
+	// A cached token is accepted without verifying its signature again.
+	a.testSecret = []byte("rotated")
+	if sub, err := a.UserIDFromAuthHeader(header); err != nil || sub != "u1" {
+		t.Fatalf("expected cached token to be accepted, sub=%q err=%v", sub, err)
+	}
+	if _, err := a.Authenticate(signHMAC(t, "secret", jwt.MapClaims{"sub": "u2", "exp": now.Add(time.Hour).Unix()})); err == nil {
+		t.Fatal("expected uncached token to be verified")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if _, err := a.Authenticate(header); err == nil {
+		t.Fatal("expected cached token to lapse at expiry")
+	}
+	if len(a.cache.entries) != 0 {
+		t.Fatalf("expected expired entry to be evicted, have %d", len(a.cache.entries))
+	}
+}
+
+func TestTokenCacheIsBounded(t *testing.T) {
+	c := newTokenCache(2)
+	until := time.Now().Add(time.Hour)
+	for _, tok := range []string{"a", "b", "c"} {
+		c.put(tok, Principal{UserID: tok}, until)
+	}
+	if len(c.entries) != 2 {
+		t.Fatalf("expected 2 entries, have %d", len(c.entries))
+	}
+	if _, ok := c.get("c"); !ok {
+		t.Fatal("expected latest token to be cached")
+	}
+	if _, ok := c.get("a"); ok {
+		t.Fatal("expected least recently used token to be evicted")
+	}
+
+	c.get("b")
+	c.put("d", Principal{UserID: "d"}, until)
+	if _, ok := c.get("b"); !ok {
+		t.Fatal("expected recently read token to be kept")
+	}
+	if _, ok := c.get("c"); ok {
+		t.Fatal("expected least recently used token to be evicted")
+	}
+}
+
+func TestAuthenticateRestrictsScopedTokens(t *testing.T) {
+	t.Setenv("AUTH0_TEST_MODE", "1")
+	t.Setenv("TEST_JWT_SECRET", "secret")
+	a := New("", nil, nil)
+	exp := time.Now().Add(time.Hour).Unix()
+	login := signHMAC(t, "secret", jwt.MapClaims{"sub": "u1", "exp": exp, "scope": "openid profile"})
+	widget := signHMAC(t, "secret", jwt.MapClaims{"sub": "u1", "exp": exp, "scope": "openid tasks:read"})
+
+	p, err := a.Authenticate(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Unrestricted || !p.HasScope(ScopeTasksWrite) {
+		t.Fatalf("expected token without Prism scopes to be unrestricted, got %+v", p)
+	}
+	p, err = a.Authenticate(widget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Unrestricted || !p.HasScope(ScopeTasksRead) || p.HasScope(ScopeTasksWrite) {
+		t.Fatalf("expected token to be limited to tasks:read, got %+v", p)
+	}
+
+	a.requireScopes = true
+	if p, _ := a.Authenticate(login); p.Unrestricted || p.HasScope(ScopeTasksRead) {
+		t.Fatalf("expected required scopes to deny unscoped token, got %+v", p)
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize bounds the number of validated tokens kept in memory.
+const DefaultCacheSize = 10000
+
+// tokenCache remembers validated tokens by their SHA-256 hash until they
+// expire. When full it evicts the least recently used token. A nil *tokenCache
+// caches nothing.
+type tokenCache struct {
+	mu      sync.Mutex
+	max     int
+	now     func() time.Time
+	entries map[[sha256.Size]byte]*list.Element
+	// lru holds the *cachedToken values, most recently used first.
+	lru *list.List
+}
+
+type cachedToken struct {
+	key       [sha256.Size]byte
+	principal Principal
+	until     time.Time
+}
+
+func newTokenCache(size int) *tokenCache {
+	if size <= 0 {
+		return nil
+	}
+	return &tokenCache{max: size, now: time.Now, entries: make(map[[sha256.Size]byte]*list.Element, size), lru: list.New()}
+}
+
+func (c *tokenCache) get(token string) (Principal, bool) {
+	if c == nil {
+		return Principal{}, false
+	}
+	key := sha256.Sum256([]byte(token))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return Principal{}, false
+	}
+	e := el.Value.(*cachedToken)
+	if !c.now().Before(e.until) {
+		c.remove(el)
+		return Principal{}, false
+	}
+	c.lru.MoveToFront(el)
+	return e.principal, true
+}
+
+// put stores p until the given time, evicting the least recently used token
+// when the cache is full.
+func (c *tokenCache) put(token string, p Principal, until time.Time) {
+	if c == nil {
+		return
+	}
+	key := sha256.Sum256([]byte(token))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cachedToken)
+		e.principal, e.until = p, until
+		c.lru.MoveToFront(el)
+		return
+	}
+	if len(c.entries) >= c.max {
+		c.remove(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(&cachedToken{key: key, principal: p, until: until})
+}
+
+func (c *tokenCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cachedToken).key)
+}
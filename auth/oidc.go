@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	discoveryPath           = "/.well-known/openid-configuration"
+	defaultRefreshInterval  = time.Hour
+	defaultRefreshRateLimit = 5 * time.Minute
+	defaultRefreshTimeout   = 10 * time.Second
+)
+
+// supportedAlgorithms lists the asymmetric signing algorithms accepted in
+// OIDC_ALGORITHMS.
+var supportedAlgorithms = map[string]bool{"RS256": true, "ES256": true, "EdDSA": true}
+
+// Config describes the identity providers whose access tokens are trusted.
+type Config struct {
+	// Issuers are the trusted issuer identifiers. Their keys are located
+	// through OpenID Connect discovery unless JWKSFile is set.
+	Issuers []string
+	// Audience is the API identifier tokens must be issued for.
+	Audience string
+	// Algorithms restricts the accepted signing algorithms. Defaults to RS256.
+	Algorithms []string
+	// JWKSFile loads the signing keys of every issuer from a local JWKS
+	// document instead of fetching them, for offline testing.
+	JWKSFile string
+	// RefreshInterval is how often the key sets are fetched in the background.
+	RefreshInterval time.Duration
+	// RefreshRateLimit bounds refetches triggered by tokens with an unknown kid.
+	RefreshRateLimit time.Duration
+	// RequireScopes rejects tokens that grant none of the Prism scopes. When
+	// unset such tokens are allowed everywhere.
+	RequireScopes bool
+	// CacheSize bounds the number of validated tokens remembered until they
+	// expire. Zero disables the cache.
+	CacheSize int
+	// Client is used for discovery and key fetches. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// ConfigFromEnv reads the identity provider configuration. The AUTH0_*
+// variables are still honoured when their OIDC_* counterparts are unset.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Audience:         os.Getenv("OIDC_AUDIENCE"),
+		JWKSFile:         os.Getenv("OIDC_JWKS_FILE"),
+		Algorithms:       []string{"RS256"},
+		RefreshInterval:  defaultRefreshInterval,
+		RefreshRateLimit: defaultRefreshRateLimit,
+		CacheSize:        DefaultCacheSize,
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = os.Getenv("AUTH0_AUDIENCE")
+	}
+	cfg.Issuers = splitList(os.Getenv("OIDC_ISSUERS"))
+	if len(cfg.Issuers) == 0 {
+		if domain := os.Getenv("AUTH0_DOMAIN"); domain != "" {
+			cfg.Issuers = []string{"https://" + domain + "/"}
+		}
+	}
+	if algs := splitList(os.Getenv("OIDC_ALGORITHMS")); len(algs) > 0 {
+		cfg.Algorithms = algs
+	}
+	for _, v := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"OIDC_JWKS_REFRESH_INTERVAL", &cfg.RefreshInterval},
+		{"OIDC_JWKS_REFRESH_RATE_LIMIT", &cfg.RefreshRateLimit},
+	} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return Config{}, fmt.Errorf("invalid %s: %q", v.name, raw)
+		}
+		*v.dst = d
+	}
+	if v := os.Getenv("AUTH_REQUIRE_SCOPES"); v != "" {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid AUTH_REQUIRE_SCOPES: %q", v)
+		}
+		cfg.RequireScopes = required
+	}
+	if v := os.Getenv("AUTH_TOKEN_CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Config{}, fmt.Errorf("invalid AUTH_TOKEN_CACHE_SIZE: %q", v)
+		}
+		cfg.CacheSize = n
+	}
+	if len(cfg.Issuers) == 0 || cfg.Audience == "" {
+		return Config{}, errors.New("OIDC_ISSUERS and OIDC_AUDIENCE are required")
+	}
+	return cfg, nil
+}
+
+// NewOIDC resolves the key sets of every configured issuer and returns an
+// Authenticator accepting their tokens. Remote key sets are refreshed in the background
+// until Close is called.
+func NewOIDC(ctx context.Context, cfg Config) (*Authenticator, error) {
+	if len(cfg.Issuers) == 0 {
+		return nil, errors.New("no issuers configured")
+	}
+	algs := cfg.Algorithms
+	if len(algs) == 0 {
+		algs = []string{"RS256"}
+	}
+	for _, alg := range algs {
+		if !supportedAlgorithms[alg] {
+			return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	keys := make(map[string]*keyfunc.JWKS, len(cfg.Issuers))
+	if cfg.JWKSFile != "" {
+		raw, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("read jwks file: %w", err)
+		}
+		jwks, err := keyfunc.NewJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse jwks file: %w", err)
+		}
+		for _, iss := range cfg.Issuers {
+			keys[iss] = jwks
+		}
+		return newOIDC(cfg, keys, algs), nil
+	}
+
+	closeAll := func() {
+		for _, jwks := range keys {
+			jwks.EndBackground()
+		}
+	}
+	for _, configured := range cfg.Issuers {
+		iss, jwksURI, err := discover(ctx, client, configured)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		jwks, err := keyfunc.Get(jwksURI, keyfunc.Options{
+			Client:            client,
+			RefreshInterval:   cfg.RefreshInterval,
+			RefreshRateLimit:  cfg.RefreshRateLimit,
+			RefreshTimeout:    defaultRefreshTimeout,
+			RefreshUnknownKID: true,
+			RefreshErrorHandler: func(err error) {
+				log.WithError(err).WithField("issuer", iss).Warn("jwks refresh failed")
+			},
+		})
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("jwks %s: %w", iss, err)
+		}
+		keys[iss] = jwks
+	}
+	return newOIDC(cfg, keys, algs), nil
+}
+
+func newOIDC(cfg Config, keys map[string]*keyfunc.JWKS, algs []string) *Authenticator {
+	a := New(cfg.Audience, keys, algs)
+	a.cache = newTokenCache(cfg.CacheSize)
+	a.requireScopes = cfg.RequireScopes
+	return a
+}
+
+// discover fetches the issuer's OpenID configuration and returns the issuer
+// identifier it declares together with its jwks_uri.
+func discover(ctx context.Context, client *http.Client, issuer string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultRefreshTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(issuer, "/") + discoveryPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("discover %s: %w", issuer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("discover %s: status %d", issuer, resp.StatusCode)
+	}
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", "", fmt.Errorf("discover %s: %w", issuer, err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return "", "", fmt.Errorf("discover %s: document declares issuer %q", issuer, doc.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", "", fmt.Errorf("discover %s: missing jwks_uri", issuer)
+	}
+	return doc.Issuer, doc.JWKSURI, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type testKey struct {
+	kid    string
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+func newES256Key(t *testing.T, kid string) testKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodES256, signer: k}
+}
+
+func newEdDSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodEdDSA, signer: k}
+}
+
+func (k testKey) jwk() map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch pub := k.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "crv": "P-256", "kid": k.kid, "alg": "ES256", "use": "sig",
+			"x": enc(pub.X.FillBytes(make([]byte, 32))), "y": enc(pub.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": k.kid, "alg": "EdDSA", "use": "sig", "x": enc(pub)}
+	}
+	panic("unsupported key")
+}
+
+func (k testKey) sign(t *testing.T, iss, aud, sub string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, jwt.MapClaims{
+		"iss": iss,
+		"aud": aud,
+		"sub": sub,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = k.kid
+	s, err := token.SignedString(k.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + s
+}
+
+func jwksDocument(keys ...testKey) []byte {
+	doc := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		doc.Keys = append(doc.Keys, k.jwk())
+	}
+	b, _ := json.Marshal(doc)
+	return b
+}
+
+// oidcProvider serves discovery and a JWKS document that tests can rotate.
+type oidcProvider struct {
+	*httptest.Server
+	mu        sync.Mutex
+	keys      []testKey
+	jwksFetch atomic.Int32
+}
+
+func newOIDCProvider(t *testing.T, keys ...testKey) *oidcProvider {
+	t.Helper()
+	p := &oidcProvider{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   p.URL + "/",
+			"jwks_uri": p.URL + "/jwks.json",
+		})
+	})
+	mux.HandleFunc("/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		p.jwksFetch.Add(1)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		_, _ = w.Write(jwksDocument(p.keys...))
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *oidcProvider) rotate(keys ...testKey) {
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+}
+
+func TestOIDCAuthAcceptsConfiguredIssuers(t *testing.T) {
+	t.Setenv("AUTH0_TEST_MODE", "")
+	first := newES256Key(t, "first")
+	second := newEdDSAKey(t, "second")
+	p1 := newOIDCProvider(t, first)
+	p2 := newOIDCProvider(t, second)
+	untrusted := newOIDCProvider(t, newES256Key(t, "other"))
+
+	auth, err := NewOIDC(context.Background(), Config{
+		Issuers:    []string{p1.URL, p2.URL + "/"},
+		Audience:   "api",
+		Algorithms: []string{"ES256", "EdDSA"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+
+	if sub, err := auth.UserIDFromAuthHeader(first.sign(t, p1.URL+"/", "api", "u1")); err != nil || sub != "u1" {
+		t.Fatalf("ES256 token: sub=%q err=%v", sub, err)
+	}
+	if sub, err := auth.UserIDFromAuthHeader(second.sign(t, p2.URL+"/", "api", "u2")); err != nil || sub != "u2" {
+		t.Fatalf("EdDSA token: sub=%q err=%v", sub, err)
+	}
+	// A key of one issuer must not validate tokens claiming another.
+	if _, err := auth.UserIDFromAuthHeader(first.sign(t, p2.URL+"/", "api", "u1")); err == nil {
+		t.Fatal("expected token signed with another issuer's key to be rejected")
+	}
+	if _, err := auth.UserIDFromAuthHeader(untrusted.keys[0].sign(t, untrusted.URL+"/", "api", "u3")); err == nil {
+		t.Fatal("expected token from untrusted issuer to be rejected")
+	}
+	if _, err := auth.UserIDFromAuthHeader(first.sign(t, p1.URL+"/", "other", "u1")); err == nil {
+		t.Fatal("expected token for another audience to be rejected")
+	}
+}
+
+func TestOIDCAuthRejectsUnconfiguredAlgorithm(t *testing.T) {
+	t.Setenv("AUTH0_TEST_MODE", "")
+	key := newEdDSAKey(t, "k")
+	p := newOIDCProvider(t, key)
+	auth, err := NewOIDC(context.Background(), Config{Issuers: []string{p.URL}, Audience: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+	if _, err := auth.UserIDFromAuthHeader(key.sign(t, p.URL+"/", "api", "u1")); err == nil {
+		t.Fatal("expected EdDSA token to be rejected when only RS256 is allowed")
+	}
+	if _, err := NewOIDC(context.Background(), Config{Issuers: []string{p.URL}, Algorithms: []string{"HS256"}}); err == nil {
+		t.Fatal("expected symmetric algorithm to be refused")
+	}
+}
+
+func TestOIDCAuthRefetchesKeysForUnknownKid(t *testing.T) {
+	t.Setenv("AUTH0_TEST_MODE", "")
+	old := newES256Key(t, "old")
+	rotated := newES256Key(t, "new")
+	p := newOIDCProvider(t, old)
+	auth, err := NewOIDC(context.Background(), Config{
+		Issuers:          []string{p.URL},
+		Audience:         "api",
+		Algorithms:       []string{"ES256"},
+		RefreshRateLimit: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+
+	p.rotate(old, rotated)
+	if _, err := auth.UserIDFromAuthHeader(rotated.sign(t, p.URL+"/", "api", "u1")); err != nil {
+		t.Fatalf("expected rotated key to be fetched: %v", err)
+	}
+	fetches := p.jwksFetch.Load()
+
+	// Further unknown kids within the rate limit must not hit the provider.
+	for i := 0; i < 5; i++ {
+		stranger := newES256Key(t, "unknown")
+		if _, err := auth.UserIDFromAuthHeader(stranger.sign(t, p.URL+"/", "api", "u1")); err == nil {
+			t.Fatal("expected unknown kid to be rejected")
+		}
+	}
+	if got := p.jwksFetch.Load(); got != fetches {
+		t.Fatalf("expected no refetch within rate limit, got %d fetches after %d", got, fetches)
+	}
+}
+
+func TestOIDCAuthLoadsLocalJWKSFile(t *testing.T) {
+	t.Setenv("AUTH0_TEST_MODE", "")
+	key := newEdDSAKey(t, "local")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksDocument(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewOIDC(context.Background(), Config{
+		Issuers:    []string{"https://issuer.test/"},
+		Audience:   "api",
+		Algorithms: []string{"EdDSA"},
+		JWKSFile:   path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+	if sub, err := auth.UserIDFromAuthHeader(key.sign(t, "https://issuer.test/", "api", "u1")); err != nil || sub != "u1" {
+		t.Fatalf("sub=%q err=%v", sub, err)
+	}
+	if _, err := auth.UserIDFromAuthHeader(key.sign(t, "https://elsewhere.test/", "api", "u1")); err == nil {
+		t.Fatal("expected token from unconfigured issuer to be rejected")
+	}
+}
+
+func TestConfigFromEnvFallsBackToAuth0(t *testing.T) {
+	t.Setenv("OIDC_ISSUERS", "")
+	t.Setenv("OIDC_AUDIENCE", "")
+	t.Setenv("AUTH0_DOMAIN", "tenant.example.com")
+	t.Setenv("AUTH0_AUDIENCE", "api")
+	t.Setenv("OIDC_ALGORITHMS", "RS256, ES256")
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Issuers) != 1 || cfg.Issuers[0] != "https://tenant.example.com/" || cfg.Audience != "api" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if len(cfg.Algorithms) != 2 || cfg.Algorithms[1] != "ES256" {
+		t.Fatalf("unexpected algorithms %v", cfg.Algorithms)
+	}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// PersonalTokenPrefix marks personal access tokens so they are told apart
+// from JWTs.
+const PersonalTokenPrefix = "prism_pat_"
+
+const (
+	// personalTokenCacheTTL bounds how long an instance keeps accepting a
+	// token after it was revoked.
+	personalTokenCacheTTL = 30 * time.Second
+	personalTokenTimeout  = 5 * time.Second
+
+	// Unknown tokens are remembered so repeating one does not reach the store,
+	// and store lookups are rate limited per user ID embedded in the token, so
+	// a stream of made-up tokens neither floods the store for one user nor
+	// locks out the tokens of others. Limiters of the most recently seen
+	// lookupLimiterCacheSize users are kept.
+	rejectedTokenCacheSize   = 1000
+	personalTokenLookupRate  = 5
+	personalTokenLookupBurst = 20
+	lookupLimiterCacheSize   = 10000
+)
+
+var errInvalidPersonalToken = errors.New("invalid personal access token")
+
+// ErrTooManyTokenLookups is returned for a personal access token whose user
+// had too many uncached tokens looked up recently. The token may be valid, so
+// callers should answer with 429 Too Many Requests rather than 401.
+var ErrTooManyTokenLookups = errors.New("too many personal access token lookups, retry later")
+
+// PersonalToken is a long-lived token a user created for scripts and
+// integrations. Only the hash of the token is stored.
+type PersonalToken struct {
+	ID        string
+	UserID    string
+	Name      string
+	Scopes    []string
+	Hash      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// TokenStore looks up personal access tokens.
+type TokenStore interface {
+	// PersonalToken returns the token or nil when it does not exist or was
+	// revoked.
+	PersonalToken(ctx context.Context, userID, id string) (*PersonalToken, error)
+}
+
+// NewPersonalToken generates a token for userID. The secret is returned once
+// and never stored; the PersonalToken only carries its hash.
+func NewPersonalToken(userID, name string, scopes []string, createdAt, expiresAt time.Time) (string, PersonalToken, error) {
+	var id [8]byte
+	var secret [32]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", PersonalToken{}, err
+	}
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", PersonalToken{}, err
+	}
+	tok := PersonalToken{
+		ID:        hex.EncodeToString(id[:]),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}
+	// The user ID is embedded so the token can be looked up by its partition.
+	raw := PersonalTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(userID)) +
+		"." + tok.ID + "." + base64.RawURLEncoding.EncodeToString(secret[:])
+	tok.Hash = HashPersonalToken(raw)
+	return raw, tok, nil
+}
+
+// HashPersonalToken returns the hex encoded SHA-256 of token. The secret has
+// 256 bits of entropy, so a fast hash is sufficient.
+func HashPersonalToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func parsePersonalToken(token string) (userID, id string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(token, PersonalTokenPrefix), ".")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	user, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(user) == 0 {
+		return "", "", false
+	}
+	return string(user), parts[1], true
+}
+
+// AcceptPersonalTokens makes the Authenticator accept personal access tokens
+// found in store alongside JWTs.
+func (a *Authenticator) AcceptPersonalTokens(store TokenStore) {
+	a.tokens = store
+	a.rejected = newTokenCache(rejectedTokenCacheSize)
+	a.lookups = newLookupLimiters(lookupLimiterCacheSize)
+}
+
+// lookupLimiters rate limits token store lookups per user ID. When full it
+// drops the limiter of the least recently seen user.
+type lookupLimiters struct {
+	mu       sync.Mutex
+	max      int
+	limiters map[string]*list.Element
+	// lru holds the *userLimiter values, most recently used first.
+	lru *list.List
+}
+
+type userLimiter struct {
+	userID  string
+	limiter *rate.Limiter
+}
+
+func newLookupLimiters(size int) *lookupLimiters {
+	return &lookupLimiters{max: size, limiters: make(map[string]*list.Element, size), lru: list.New()}
+}
+
+func (l *lookupLimiters) allow(userID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.limiters[userID]; ok {
+		l.lru.MoveToFront(el)
+		return el.Value.(*userLimiter).limiter.Allow()
+	}
+	if len(l.limiters) >= l.max {
+		back := l.lru.Back()
+		l.lru.Remove(back)
+		delete(l.limiters, back.Value.(*userLimiter).userID)
+	}
+	u := &userLimiter{userID: userID, limiter: rate.NewLimiter(personalTokenLookupRate, personalTokenLookupBurst)}
+	l.limiters[userID] = l.lru.PushFront(u)
+	return u.limiter.Allow()
+}
+
+func (a *Authenticator) validatePersonal(token string) (Principal, error) {
+	if a.tokens == nil {
+		return Principal{}, errors.New("personal access tokens are not accepted")
+	}
+	userID, id, ok := parsePersonalToken(token)
+	if !ok {
+		return Principal{}, errInvalidPersonalToken
+	}
+	if _, rejected := a.rejected.get(token); rejected {
+		return Principal{}, errInvalidPersonalToken
+	}
+	if !a.lookups.allow(userID) {
+		return Principal{}, ErrTooManyTokenLookups
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), personalTokenTimeout)
+	defer cancel()
+	stored, err := a.tokens.PersonalToken(ctx, userID, id)
+	if err != nil {
+		return Principal{}, err
+	}
+	if stored == nil || subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(HashPersonalToken(token))) != 1 {
+		a.rejected.put(token, Principal{}, time.Now().Add(personalTokenCacheTTL))
+		return Principal{}, errInvalidPersonalToken
+	}
+	if !time.Now().Before(stored.ExpiresAt) {
+		return Principal{}, errors.New("token expired")
+	}
+	return Principal{UserID: userID, Scopes: stored.Scopes, ExpiresAt: stored.ExpiresAt, TokenID: id}, nil
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryTokens map[string]PersonalToken
+
+type countingTokens struct {
+	memoryTokens
+	lookups int
+}
+
+func (c *countingTokens) PersonalToken(ctx context.Context, userID, id string) (*PersonalToken, error) {
+	c.lookups++
+	return c.memoryTokens.PersonalToken(ctx, userID, id)
+}
+
+func (m memoryTokens) PersonalToken(_ context.Context, userID, id string) (*PersonalToken, error) {
+	tok, ok := m[id]
+	if !ok || tok.UserID != userID {
+		return nil, nil
+	}
+	return &tok, nil
+}
+
+func TestAuthenticateAcceptsPersonalTokens(t *testing.T) {
+	now := time.Now()
+	raw, tok, err := NewPersonalToken("auth0|user.1", "ci", []string{ScopeTasksRead}, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, PersonalTokenPrefix) || strings.Contains(tok.Hash, raw) {
+		t.Fatalf("unexpected token %q", raw)
+	}
+	expired, expiredTok, _ := NewPersonalToken("u2", "old", []string{ScopeTasksRead}, now, now.Add(-time.Second))
+	store := memoryTokens{tok.ID: tok, expiredTok.ID: expiredTok}
+
+	a := &Authenticator{}
+	if _, err := a.Authenticate("Bearer " + raw); err == nil {
+		t.Fatal("expected personal tokens to be refused without a store")
+	}
+	a.AcceptPersonalTokens(store)
+	p, err := a.Authenticate("Bearer " + raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.UserID != "auth0|user.1" || p.TokenID != tok.ID || p.Unrestricted || !p.HasScope(ScopeTasksRead) || p.HasScope(ScopeTasksWrite) {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+
+	for name, header := range map[string]string{
+		"wrong secret": "Bearer " + raw[:len(raw)-2] + "xx",
+		"expired":      "Bearer " + expired,
+		"garbage":      "Bearer " + PersonalTokenPrefix + "a.b",
+	} {
+		if _, err := a.Authenticate(header); err == nil {
+			t.Fatalf("%s: expected token to be rejected", name)
+		}
+	}
+
+	delete(store, tok.ID)
+	if _, err := a.Authenticate("Bearer " + raw); err == nil {
+		t.Fatal("expected revoked token to be rejected")
+	}
+}
+
+func TestPersonalTokensAreCachedBriefly(t *testing.T) {
+	now := time.Now()
+	raw, tok, _ := NewPersonalToken("u1", "ci", []string{ScopeTasksWrite}, now, now.Add(24*time.Hour))
+	store := memoryTokens{tok.ID: tok}
+	a := &Authenticator{cache: newTokenCache(10)}
+	a.AcceptPersonalTokens(store)
+	if _, err := a.Authenticate("Bearer " + raw); err != nil {
+		t.Fatal(err)
+	}
+	delete(store, tok.ID)
+	if _, err := a.Authenticate("Bearer " + raw); err != nil {
+		t.Fatalf("expected cached token within TTL: %v", err)
+	}
+	a.cache.now = func() time.Time { return now.Add(personalTokenCacheTTL + time.Second) }
+	if _, err := a.Authenticate("Bearer " + raw); err == nil {
+		t.Fatal("expected revocation to apply once the cache entry lapsed")
+	}
+}
+
+func TestUnknownPersonalTokensAreNotLookedUpAgain(t *testing.T) {
+	store := &countingTokens{memoryTokens: memoryTokens{}}
+	a := &Authenticator{}
+	a.AcceptPersonalTokens(store)
+	raw, _, _ := NewPersonalToken("u1", "ci", []string{ScopeTasksRead}, time.Now(), time.Now().Add(time.Hour))
+	for i := 0; i < 3; i++ {
+		if _, err := a.Authenticate("Bearer " + raw); err == nil {
+			t.Fatal("expected unknown token to be rejected")
+		}
+	}
+	if store.lookups != 1 {
+		t.Fatalf("expected one store lookup, got %d", store.lookups)
+	}
+}
+
+func TestPersonalTokenLookupsAreRateLimitedPerUser(t *testing.T) {
+	store := &countingTokens{memoryTokens: memoryTokens{}}
+	a := &Authenticator{}
+	a.AcceptPersonalTokens(store)
+	var err error
+	for i := 0; i < personalTokenLookupBurst+10; i++ {
+		raw, _, _ := NewPersonalToken("u1", "ci", []string{ScopeTasksRead}, time.Now(), time.Now().Add(time.Hour))
+		_, err = a.Authenticate("Bearer " + raw)
+	}
+	if !errors.Is(err, ErrTooManyTokenLookups) {
+		t.Fatalf("expected lookups to be limited, got %v", err)
+	}
+	if store.lookups > personalTokenLookupBurst+1 {
+		t.Fatalf("expected at most %d lookups, got %d", personalTokenLookupBurst+1, store.lookups)
+	}
+
+	// Made-up tokens of u1 do not lock out the tokens of other users.
+	raw, tok, err := NewPersonalToken("u2", "ci", []string{ScopeTasksRead}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.memoryTokens[tok.ID] = tok
+	if p, err := a.Authenticate("Bearer " + raw); err != nil || p.UserID != "u2" {
+		t.Fatalf("expected u2's token to be accepted, got %+v %v", p, err)
+	}
+}
+
+func TestLookupLimitersAreBounded(t *testing.T) {
+	l := newLookupLimiters(2)
+	for _, user := range []string{"u1", "u2", "u3"} {
+		if !l.allow(user) {
+			t.Fatalf("expected the first lookup of %s to be allowed", user)
+		}
+	}
+	if len(l.limiters) != 2 {
+		t.Fatalf("expected 2 limiters, got %d", len(l.limiters))
+	}
+	if _, ok := l.limiters["u1"]; ok {
+		t.Fatal("expected the least recently seen user to be dropped")
+	}
+}
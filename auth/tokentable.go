@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+// TableTokenStore keeps personal access tokens in an Azure table: the user ID
+// is the partition key, the token ID the row key. Only the token hash is
+// stored. The Prism API writes the table; every service authenticating
+// requests reads it.
+type TableTokenStore struct {
+	client *aztables.Client
+}
+
+// NewTableTokenStore stores tokens through client.
+func NewTableTokenStore(client *aztables.Client) *TableTokenStore {
+	return &TableTokenStore{client: client}
+}
+
+type tokenEntity struct {
+	PartitionKey string    `json:"PartitionKey"`
+	RowKey       string    `json:"RowKey"`
+	Name         string    `json:"Name"`
+	Scopes       string    `json:"Scopes"`
+	Hash         string    `json:"Hash"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+	ExpiresAt    time.Time `json:"ExpiresAt"`
+}
+
+func (e tokenEntity) token() PersonalToken {
+	return PersonalToken{
+		ID:        e.RowKey,
+		UserID:    e.PartitionKey,
+		Name:      e.Name,
+		Scopes:    strings.Fields(e.Scopes),
+		Hash:      e.Hash,
+		CreatedAt: e.CreatedAt,
+		ExpiresAt: e.ExpiresAt,
+	}
+}
+
+// CreateToken stores a newly issued personal access token.
+func (s *TableTokenStore) CreateToken(ctx context.Context, tok PersonalToken) error {
+	data, err := json.Marshal(tokenEntity{
+		PartitionKey: tok.UserID,
+		RowKey:       tok.ID,
+		Name:         tok.Name,
+		Scopes:       strings.Join(tok.Scopes, " "),
+		Hash:         tok.Hash,
+		CreatedAt:    tok.CreatedAt.UTC(),
+		ExpiresAt:    tok.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.AddEntity(ctx, data, nil)
+	return err
+}
+
+// ListTokens returns the user's personal access tokens, including expired ones.
+func (s *TableTokenStore) ListTokens(ctx context.Context, userID string) ([]PersonalToken, error) {
+	filter := "PartitionKey eq '" + strings.ReplaceAll(userID, "'", "''") + "'"
+	pager := s.client.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: &filter,
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	})
+	tokens := []PersonalToken{}
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range resp.Entities {
+			var e tokenEntity
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, e.token())
+		}
+	}
+	return tokens, nil
+}
+
+// RevokeToken deletes the token and reports whether it existed.
+func (s *TableTokenStore) RevokeToken(ctx context.Context, userID, id string) (bool, error) {
+	if _, err := s.client.DeleteEntity(ctx, userID, id, nil); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// PersonalToken returns the token or nil when it does not exist or was revoked.
+func (s *TableTokenStore) PersonalToken(ctx context.Context, userID, id string) (*PersonalToken, error) {
+	resp, err := s.client.GetEntity(ctx, userID, id, &aztables.GetEntityOptions{Format: to.Ptr(aztables.MetadataFormatNone)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var e tokenEntity
+	if err := json.Unmarshal(resp.Value, &e); err != nil {
+		return nil, err
+	}
+	tok := e.token()
+	return &tok, nil
+}
+
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
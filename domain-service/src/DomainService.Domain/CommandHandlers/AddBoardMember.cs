@@ -0,0 +1,68 @@
+using DomainService.Domain.Commands;
+using DomainService.Interfaces;
+using MediatR;
+using System.Text.Json;
+
+namespace DomainService.Domain.CommandHandlers;
+
+internal sealed class AddBoardMember(IUserEventRepository userRepo, IEventDispatcher dispatcher) : ICommandHandler<AddBoardMemberCommand>
+{
+    private readonly IUserEventRepository _userRepo = userRepo;
+    private readonly IEventDispatcher _dispatcher = dispatcher;
+
+    public async Task<Unit> Handle(AddBoardMemberCommand request, CancellationToken ct)
+    {
+        var start = await _userRepo.TryStartProcessing(request.IdempotencyKey, ct);
+        if (start == IdempotencyResult.AlreadyProcessed)
+        {
+            await _userRepo.ReplayStoredEvents(_dispatcher, request.IdempotencyKey, ct);
+            return Unit.Value;
+        }
+
+        if (start == IdempotencyResult.InProgress)
+        {
+            return Unit.Value;
+        }
+
+        try
+        {
+            if (await _userRepo.ReplayStoredEvents(_dispatcher, request.IdempotencyKey, ct))
+            {
+                await _userRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+                return Unit.Value;
+            }
+
+            // Ownership is fixed at creation; members join as editors or viewers.
+            if (string.IsNullOrEmpty(request.BoardId) ||
+                string.IsNullOrEmpty(request.MemberId) ||
+                request.MemberId == request.UserId ||
+                request.Role is not (BoardRoles.Editor or BoardRoles.Viewer))
+            {
+                await _userRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+                return Unit.Value;
+            }
+
+            var ev = new Event(
+                Guid.NewGuid().ToString(),
+                request.BoardId,
+                EntityTypes.Board,
+                BoardEventTypes.MemberAdded,
+                JsonSerializer.SerializeToElement(new BoardMemberData(request.MemberId, request.Role)),
+                request.Timestamp,
+                request.UserId,
+                request.IdempotencyKey,
+                BoardId: request.BoardId,
+                Sequence: request.Sequence);
+            await _userRepo.Add(ev, ct);
+            await _dispatcher.Dispatch(ev, ct);
+            await _userRepo.MarkAsDispatched(ev, ct);
+            await _userRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+            return Unit.Value;
+        }
+        catch
+        {
+            await _userRepo.MarkProcessingFailed(request.IdempotencyKey, ct);
+            throw;
+        }
+    }
+}
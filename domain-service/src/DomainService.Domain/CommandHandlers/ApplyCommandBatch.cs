@@ -0,0 +1,34 @@
+using DomainService.Domain.Commands;
+using DomainService.Interfaces;
+using MediatR;
+using Microsoft.Extensions.Logging;
+
+namespace DomainService.Domain.CommandHandlers;
+
+// Applies the commands of a batch part in their original order. The message is the
+// unit of retry: a failure aborts the remaining commands and rethrows so the whole part
+// is redelivered, and commands that already succeeded are skipped through their
+// idempotency keys, so the part is never left applied out of order. The part is not
+// applied atomically, and parts of one batch are handled independently of each other.
+internal sealed class ApplyCommandBatch(ISender sender, ILogger<ApplyCommandBatch> logger) : ICommandHandler<CommandBatch>
+{
+    private readonly ISender _sender = sender;
+    private readonly ILogger<ApplyCommandBatch> _logger = logger;
+
+    public async Task<Unit> Handle(CommandBatch request, CancellationToken ct)
+    {
+        for (var i = 0; i < request.Commands.Count; i++)
+        {
+            try
+            {
+                await _sender.Send(request.Commands[i], ct);
+            }
+            catch (Exception ex)
+            {
+                _logger.LogError(ex, "Batch {batch} part {part}/{parts} failed at command {index}", request.BatchId, request.Part + 1, request.Parts, i);
+                throw;
+            }
+        }
+        return Unit.Value;
+    }
+}
@@ -0,0 +1,61 @@
+using DomainService.Domain.Commands;
+using DomainService.Interfaces;
+using MediatR;
+using System.Text.Json;
+
+namespace DomainService.Domain.CommandHandlers;
+
+// Board events live in the user events table: a board is owned by the user who
+// created it and membership changes are issued by its owner.
+internal sealed class CreateBoard(IUserEventRepository userRepo, IEventDispatcher dispatcher) : ICommandHandler<CreateBoardCommand>
+{
+    private readonly IUserEventRepository _userRepo = userRepo;
+    private readonly IEventDispatcher _dispatcher = dispatcher;
+
+    public async Task<Unit> Handle(CreateBoardCommand request, CancellationToken ct)
+    {
+        var start = await _userRepo.TryStartProcessing(request.IdempotencyKey, ct);
+        if (start == IdempotencyResult.AlreadyProcessed)
+        {
+            await _userRepo.ReplayStoredEvents(_dispatcher, request.IdempotencyKey, ct);
+            return Unit.Value;
+        }
+
+        if (start == IdempotencyResult.InProgress)
+        {
+            return Unit.Value;
+        }
+
+        try
+        {
+            if (await _userRepo.ReplayStoredEvents(_dispatcher, request.IdempotencyKey, ct))
+            {
+                await _userRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+                return Unit.Value;
+            }
+
+            var boardId = Guid.NewGuid().ToString();
+            var ev = new Event(
+                Guid.NewGuid().ToString(),
+                boardId,
+                EntityTypes.Board,
+                BoardEventTypes.Created,
+                JsonSerializer.SerializeToElement(new BoardData(request.Name)),
+                request.Timestamp,
+                request.UserId,
+                request.IdempotencyKey,
+                BoardId: boardId,
+                Sequence: request.Sequence);
+            await _userRepo.Add(ev, ct);
+            await _dispatcher.Dispatch(ev, ct);
+            await _userRepo.MarkAsDispatched(ev, ct);
+            await _userRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+            return Unit.Value;
+        }
+        catch
+        {
+            await _userRepo.MarkProcessingFailed(request.IdempotencyKey, ct);
+            throw;
+        }
+    }
+}
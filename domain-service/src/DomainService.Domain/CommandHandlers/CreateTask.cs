@@ -32,7 +32,7 @@ internal sealed class CreateTask(ITaskEventRepository taskRepo, IEventDispatcher
             }
 
             var taskId = Guid.NewGuid().ToString();
-            var ev = new Event(Guid.NewGuid().ToString(), taskId, EntityTypes.Task, TaskEventTypes.Created, request.Data, request.Timestamp, request.UserId, request.IdempotencyKey);
+            var ev = new Event(Guid.NewGuid().ToString(), taskId, EntityTypes.Task, TaskEventTypes.Created, request.Data, request.Timestamp, request.UserId, request.IdempotencyKey, BoardId: request.BoardId, Sequence: request.Sequence);
             await _taskRepo.Add(ev, ct);
             await _dispatcher.Dispatch(ev, ct);
             await _taskRepo.MarkAsDispatched(ev, ct);
@@ -47,7 +47,8 @@ internal sealed class LoginUser(IUserEventRepository userRepo, IEventDispatcher
                 data,
                 request.Timestamp,
                 request.UserId,
-                request.IdempotencyKey);
+                request.IdempotencyKey,
+                Sequence: request.Sequence);
             await _userRepo.Add(ev, ct);
             await _dispatcher.Dispatch(ev, ct);
             await _userRepo.MarkAsDispatched(ev, ct);
@@ -62,7 +63,8 @@ internal sealed class LoginUser(IUserEventRepository userRepo, IEventDispatcher
                     settingsData,
                     request.Timestamp,
                     request.UserId,
-                    request.IdempotencyKey);
+                    request.IdempotencyKey,
+                    Sequence: request.Sequence);
                 await _userRepo.Add(settingsEv, ct);
                 await _dispatcher.Dispatch(settingsEv, ct);
                 await _userRepo.MarkAsDispatched(settingsEv, ct);
@@ -31,7 +31,7 @@ internal sealed class LogoutUser(IUserEventRepository userRepo, IEventDispatcher
                 return Unit.Value;
             }
 
-            var ev = new Event(Guid.NewGuid().ToString(), request.UserId, EntityTypes.User, UserEventTypes.Logout, null, request.Timestamp, request.UserId, request.IdempotencyKey);
+            var ev = new Event(Guid.NewGuid().ToString(), request.UserId, EntityTypes.User, UserEventTypes.Logout, null, request.Timestamp, request.UserId, request.IdempotencyKey, Sequence: request.Sequence);
             await _userRepo.Add(ev, ct);
             await _dispatcher.Dispatch(ev, ct);
             await _userRepo.MarkAsDispatched(ev, ct);
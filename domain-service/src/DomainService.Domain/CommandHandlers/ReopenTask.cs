@@ -33,13 +33,13 @@ internal sealed class ReopenTask(ITaskEventRepository taskRepo, IEventDispatcher
 
             var events = await _taskRepo.Get(request.TaskId, ct);
             var state = TaskStateBuilder.From(events);
-            if (state.Title == null || !state.Done)
+            if (state.Title == null || !state.Done || !state.AcceptsCommandFrom(request.UserId, request.BoardId))
             {
                 await _taskRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
                 return Unit.Value;
             }
 
-            var ev = new Event(Guid.NewGuid().ToString(), request.TaskId, EntityTypes.Task, TaskEventTypes.Reopened, null, request.Timestamp, request.UserId, request.IdempotencyKey);
+            var ev = new Event(Guid.NewGuid().ToString(), request.TaskId, EntityTypes.Task, TaskEventTypes.Reopened, null, request.Timestamp, request.UserId, request.IdempotencyKey, BoardId: state.BoardId, Sequence: request.Sequence);
             await _taskRepo.Add(ev, ct);
             await _dispatcher.Dispatch(ev, ct);
             await _taskRepo.MarkAsDispatched(ev, ct);
@@ -0,0 +1,100 @@
+using DomainService.Domain.Commands;
+using DomainService.Interfaces;
+using MediatR;
+using System.Text.Json;
+
+namespace DomainService.Domain.CommandHandlers;
+
+// A reorder assigns the listed tasks the category and their position in the
+// list as order in one event, so a move can no longer leave two tasks with the
+// same order. The event belongs to the read model partition rather than a single
+// task: it is stored under the board, or the user for personal tasks.
+internal sealed class ReorderTasks(ITaskEventRepository taskRepo, IEventDispatcher dispatcher) : ICommandHandler<ReorderTasksCommand>
+{
+    // read-model-updater applies the event as one entity group transaction,
+    // which holds at most 100 operations.
+    internal const int MaxTasks = 100;
+
+    private readonly ITaskEventRepository _taskRepo = taskRepo;
+    private readonly IEventDispatcher _dispatcher = dispatcher;
+
+    public async Task<Unit> Handle(ReorderTasksCommand request, CancellationToken ct)
+    {
+        var start = await _taskRepo.TryStartProcessing(request.IdempotencyKey, ct);
+        if (start == IdempotencyResult.AlreadyProcessed)
+        {
+            await _taskRepo.ReplayStoredEvents(_dispatcher, request.IdempotencyKey, ct);
+            return Unit.Value;
+        }
+
+        if (start == IdempotencyResult.InProgress)
+        {
+            return Unit.Value;
+        }
+
+        try
+        {
+            if (await _taskRepo.ReplayStoredEvents(_dispatcher, request.IdempotencyKey, ct))
+            {
+                await _taskRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+                return Unit.Value;
+            }
+
+            if (!await IsValid(request, ct))
+            {
+                await _taskRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+                return Unit.Value;
+            }
+
+            var ev = new Event(
+                Guid.NewGuid().ToString(),
+                request.BoardId ?? request.UserId,
+                EntityTypes.Task,
+                TaskEventTypes.Reordered,
+                JsonSerializer.SerializeToElement(new TasksReorderedData(request.Category, request.TaskIds, request.Offset, request.Total, request.Expected)),
+                request.Timestamp,
+                request.UserId,
+                request.IdempotencyKey,
+                BoardId: request.BoardId,
+                Sequence: request.Sequence);
+            await _taskRepo.Add(ev, ct);
+            await _dispatcher.Dispatch(ev, ct);
+            await _taskRepo.MarkAsDispatched(ev, ct);
+            await _taskRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
+            return Unit.Value;
+        }
+        catch
+        {
+            await _taskRepo.MarkProcessingFailed(request.IdempotencyKey, ct);
+            throw;
+        }
+    }
+
+    // The whole command is ignored unless every listed task exists once and may
+    // be changed by the caller through the command's board, and the tasks fit
+    // the positions from Offset on out of Total when the command reorders part
+    // of a category.
+    private async Task<bool> IsValid(ReorderTasksCommand request, CancellationToken ct)
+    {
+        if (string.IsNullOrEmpty(request.Category) || request.TaskIds.Count == 0 || request.TaskIds.Count > MaxTasks ||
+            request.TaskIds.Distinct().Count() != request.TaskIds.Count)
+        {
+            return false;
+        }
+
+        if (request.Offset < 0 || (request.Total == 0 ? request.Offset != 0 : request.Offset + request.TaskIds.Count > request.Total))
+        {
+            return false;
+        }
+
+        foreach (var taskId in request.TaskIds)
+        {
+            var state = TaskStateBuilder.From(await _taskRepo.Get(taskId, ct));
+            if (state.Title == null || !state.AcceptsCommandFrom(request.UserId, request.BoardId))
+            {
+                return false;
+            }
+        }
+        return true;
+    }
+}
@@ -35,7 +35,7 @@ internal sealed class UpdateTask(ITaskEventRepository taskRepo, IEventDispatcher
 
             var events = await _taskRepo.Get(request.TaskId, ct);
             var state = TaskStateBuilder.From(events);
-            if (state.Title == null)
+            if (state.Title == null || !state.AcceptsCommandFrom(request.UserId, request.BoardId))
             {
                 await _taskRepo.MarkProcessingSucceeded(request.IdempotencyKey, ct);
                 return Unit.Value;
@@ -61,7 +61,7 @@ internal sealed class UpdateTask(ITaskEventRepository taskRepo, IEventDispatcher
                 }
             }
 
-            var ev = new Event(Guid.NewGuid().ToString(), request.TaskId, EntityTypes.Task, TaskEventTypes.Updated, data, request.Timestamp, request.UserId, request.IdempotencyKey);
+            var ev = new Event(Guid.NewGuid().ToString(), request.TaskId, EntityTypes.Task, TaskEventTypes.Updated, data, request.Timestamp, request.UserId, request.IdempotencyKey, BoardId: state.BoardId, Sequence: request.Sequence);
             await _taskRepo.Add(ev, ct);
             await _dispatcher.Dispatch(ev, ct);
             await _taskRepo.MarkAsDispatched(ev, ct);
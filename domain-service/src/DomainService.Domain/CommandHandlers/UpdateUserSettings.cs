@@ -39,7 +39,8 @@ internal sealed class UpdateUserSettings(IUserEventRepository userRepo, IEventDi
                 request.Data,
                 request.Timestamp,
                 request.UserId,
-                request.IdempotencyKey);
+                request.IdempotencyKey,
+                Sequence: request.Sequence);
             await _userRepo.Add(ev, ct);
             await _dispatcher.Dispatch(ev, ct);
             await _userRepo.MarkAsDispatched(ev, ct);
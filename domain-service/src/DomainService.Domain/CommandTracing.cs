@@ -0,0 +1,67 @@
+using DomainService.Interfaces;
+using System.Diagnostics;
+using System.Text;
+using System.Text.Json;
+
+namespace DomainService.Domain;
+
+// Continues the trace started by prism-api: command messages carry the W3C
+// traceparent of the enqueue span, and events dispatched while a command is being
+// processed carry the traceparent of the processing activity.
+public static class CommandTracing
+{
+    public const string SourceName = "DomainService";
+    private const string TraceParentProperty = "traceparent";
+
+    private static readonly ActivitySource Source = new(SourceName);
+
+    // Starts the activity covering the processing of a command message. Without a
+    // listener the activity is still created when the message is traced, so the
+    // trace context reaches the events even if this service exports nothing.
+    public static Activity? StartProcessing(string queueMessage)
+    {
+        var traceParent = ReadTraceParent(queueMessage);
+        if (traceParent != null && ActivityContext.TryParse(traceParent, null, out var parent))
+        {
+            return Source.StartActivity("process command", ActivityKind.Consumer, parent)
+                ?? new Activity("process command").SetParentId(traceParent).Start();
+        }
+        return Source.StartActivity("process command", ActivityKind.Consumer);
+    }
+
+    // Stamps the current activity onto an event that does not carry a trace yet.
+    public static IEvent WithTraceParent(IEvent ev)
+    {
+        if (ev.TraceParent != null || ev is not Event e || Activity.Current is not { IdFormat: ActivityIdFormat.W3C } activity)
+        {
+            return ev;
+        }
+        return e with { TraceParent = activity.Id };
+    }
+
+    internal static string? ReadTraceParent(string queueMessage)
+    {
+        try
+        {
+            var reader = new Utf8JsonReader(Encoding.UTF8.GetBytes(queueMessage));
+            if (!reader.Read() || reader.TokenType != JsonTokenType.StartObject)
+            {
+                return null;
+            }
+            while (reader.Read() && reader.TokenType == JsonTokenType.PropertyName)
+            {
+                if (reader.ValueTextEquals(TraceParentProperty))
+                {
+                    reader.Read();
+                    return reader.TokenType == JsonTokenType.String ? reader.GetString() : null;
+                }
+                reader.Read();
+                reader.Skip();
+            }
+        }
+        catch (JsonException)
+        {
+        }
+        return null;
+    }
+}
@@ -13,52 +13,21 @@ namespace DomainService.Domain.Commands
         {
             try
             {
-                var envelope = JsonSerializer.Deserialize<CommandEnvelope>(queueMessage, _jsonSerializerOptions) ?? throw new ArgumentNullException(nameof(queueMessage), "Invalid queueMessage! JSON content is null");
-                ICommand cmd = envelope.Command.EntityType switch
+                using var doc = JsonDocument.Parse(queueMessage);
+                if (doc.RootElement.ValueKind == JsonValueKind.Object && doc.RootElement.TryGetProperty("commands", out _))
                 {
-                    EntityTypes.Task => envelope.Command.Type switch
+                    var batch = doc.RootElement.Deserialize<CommandBatchEnvelope>(_jsonSerializerOptions) ?? throw new ArgumentNullException(nameof(queueMessage), "Invalid queueMessage! JSON content is null");
+                    var commands = new List<ICommand>(batch.Commands.Count);
+                    foreach (var command in batch.Commands)
                     {
-                        CommandTypes.CreateTask => new CreateTaskCommand(
-                            envelope.Command.Data,
-                            envelope.UserId,
-                            envelope.Command.Timestamp,
-                            envelope.Command.Id),
-                        CommandTypes.UpdateTask => new UpdateTaskCommand(
-                            envelope.Command.Data?.GetProperty("id").GetString() ?? string.Empty,
-                            envelope.Command.Data,
-                            envelope.UserId,
-                            envelope.Command.Timestamp,
-                            envelope.Command.Id),
-                        CommandTypes.CompleteTask => new CompleteTaskCommand(
-                            envelope.Command.Data?.GetProperty("id").GetString() ?? string.Empty,
-                            envelope.UserId,
-                            envelope.Command.Timestamp,
-                            envelope.Command.Id),
-                        CommandTypes.ReopenTask => new ReopenTaskCommand(
-                            envelope.Command.Data?.GetProperty("id").GetString() ?? string.Empty,
-                            envelope.UserId,
-                            envelope.Command.Timestamp,
-                            envelope.Command.Id),
-                        _ => throw new ArgumentException("Unknown command type!", nameof(queueMessage))
-                    },
-                    EntityTypes.User => envelope.Command.Type switch
-                    {
-                        CommandTypes.LoginUser => new LoginUserCommand(
-                            envelope.UserId,
-                            envelope.Command.Data?.GetProperty("name").GetString() ?? string.Empty,
-                            envelope.Command.Data?.GetProperty("email").GetString() ?? string.Empty,
-                            envelope.Command.Timestamp,
-                            envelope.Command.Id),
-                        CommandTypes.LogoutUser => new LogoutUserCommand(envelope.UserId, envelope.Command.Timestamp, envelope.Command.Id),
-                        _ => throw new ArgumentException("Unknown Command.Type!", nameof(queueMessage))
-                    },
-                    EntityTypes.UserSettings => envelope.Command.Type switch
-                    {
-                        CommandTypes.UpdateUserSettings => new UpdateUserSettingsCommand(envelope.Command.Data, envelope.UserId, envelope.Command.Timestamp, envelope.Command.Id),
-                        _ => throw new ArgumentException("Unknown Command.Type!", nameof(queueMessage))
-                    },
-                    _ => throw new ArgumentException("Unknown Command.EntityType!", nameof(queueMessage))
-                };
+                        commands.Add(Create(batch.UserId, command));
+                    }
+                    _logger.LogDebug("Created batch {batch} part {part}/{parts} with {count} commands", batch.BatchId, batch.Part + 1, batch.Parts, commands.Count);
+                    return new CommandBatch(batch.BatchId, batch.Part, batch.Parts, batch.UserId, commands);
+                }
+
+                var envelope = doc.RootElement.Deserialize<CommandEnvelope>(_jsonSerializerOptions) ?? throw new ArgumentNullException(nameof(queueMessage), "Invalid queueMessage! JSON content is null");
+                var cmd = Create(envelope.UserId, envelope.Command);
                 _logger.LogDebug("Created {cmd} command", envelope.Command.Type);
                 return cmd;
             }
@@ -68,5 +37,98 @@ namespace DomainService.Domain.Commands
                 throw;
             }
         }
+
+        private static ICommand Create(string userId, Command command) => command.EntityType switch
+        {
+            EntityTypes.Task => command.Type switch
+            {
+                CommandTypes.CreateTask => new CreateTaskCommand(
+                    command.Data,
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    command.BoardId,
+                    command.Sequence),
+                CommandTypes.UpdateTask => new UpdateTaskCommand(
+                    command.Data?.GetProperty("id").GetString() ?? string.Empty,
+                    command.Data,
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    command.BoardId,
+                    command.Sequence),
+                CommandTypes.CompleteTask => new CompleteTaskCommand(
+                    command.Data?.GetProperty("id").GetString() ?? string.Empty,
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    command.BoardId,
+                    command.Sequence),
+                CommandTypes.ReopenTask => new ReopenTaskCommand(
+                    command.Data?.GetProperty("id").GetString() ?? string.Empty,
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    command.BoardId,
+                    command.Sequence),
+                CommandTypes.ReorderTasks => new ReorderTasksCommand(
+                    command.Data?.GetProperty("category").GetString() ?? string.Empty,
+                    command.Data?.GetProperty("ids").EnumerateArray().Select(id => id.GetString() ?? string.Empty).ToList() ?? [],
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    command.BoardId,
+                    command.Sequence,
+                    command.Data?.TryGetProperty("offset", out var offset) == true ? offset.GetInt32() : 0,
+                    command.Data?.TryGetProperty("total", out var total) == true ? total.GetInt32() : 0,
+                    command.Data?.TryGetProperty("expected", out var expected) == true
+                        ? expected.EnumerateObject().ToDictionary(p => p.Name, p => p.Value.GetInt64())
+                        : null),
+                _ => throw new ArgumentException("Unknown command type!", nameof(command))
+            },
+            EntityTypes.User => command.Type switch
+            {
+                CommandTypes.LoginUser => new LoginUserCommand(
+                    userId,
+                    command.Data?.GetProperty("name").GetString() ?? string.Empty,
+                    command.Data?.GetProperty("email").GetString() ?? string.Empty,
+                    command.Timestamp,
+                    command.Id,
+                    Sequence: command.Sequence),
+                CommandTypes.LogoutUser => new LogoutUserCommand(userId, command.Timestamp, command.Id, command.Sequence),
+                _ => throw new ArgumentException("Unknown Command.Type!", nameof(command))
+            },
+            EntityTypes.UserSettings => command.Type switch
+            {
+                CommandTypes.UpdateUserSettings => new UpdateUserSettingsCommand(command.Data, userId, command.Timestamp, command.Id, command.Sequence),
+                _ => throw new ArgumentException("Unknown Command.Type!", nameof(command))
+            },
+            EntityTypes.Board => command.Type switch
+            {
+                CommandTypes.CreateBoard => new CreateBoardCommand(
+                    command.Data?.GetProperty("name").GetString() ?? string.Empty,
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    Sequence: command.Sequence),
+                CommandTypes.AddBoardMember => new AddBoardMemberCommand(
+                    command.BoardId ?? string.Empty,
+                    command.Data?.GetProperty("userId").GetString() ?? string.Empty,
+                    command.Data?.GetProperty("role").GetString() ?? string.Empty,
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    Sequence: command.Sequence),
+                CommandTypes.RemoveBoardMember => new RemoveBoardMemberCommand(
+                    command.BoardId ?? string.Empty,
+                    command.Data?.GetProperty("userId").GetString() ?? string.Empty,
+                    userId,
+                    command.Timestamp,
+                    command.Id,
+                    Sequence: command.Sequence),
+                _ => throw new ArgumentException("Unknown Command.Type!", nameof(command))
+            },
+            _ => throw new ArgumentException("Unknown Command.EntityType!", nameof(command))
+        };
     }
 }
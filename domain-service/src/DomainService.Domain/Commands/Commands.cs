@@ -4,17 +4,27 @@ using System.Text.Json;
 
 namespace DomainService.Domain.Commands
 {
-    public sealed record CompleteTaskCommand(string TaskId, string UserId, long Timestamp, string IdempotencyKey) : ICommand<Unit>;
-    public sealed record ReopenTaskCommand(string TaskId, string UserId, long Timestamp, string IdempotencyKey) : ICommand<Unit>;
+    public sealed record CompleteTaskCommand(string TaskId, string UserId, long Timestamp, string IdempotencyKey, string? BoardId = null, long Sequence = 0) : ICommand<Unit>;
+    public sealed record ReopenTaskCommand(string TaskId, string UserId, long Timestamp, string IdempotencyKey, string? BoardId = null, long Sequence = 0) : ICommand<Unit>;
 
-    public sealed record CreateTaskCommand(JsonElement? Data, string UserId, long Timestamp, string IdempotencyKey) : ICommand<Unit>;
+    public sealed record CreateTaskCommand(JsonElement? Data, string UserId, long Timestamp, string IdempotencyKey, string? BoardId = null, long Sequence = 0) : ICommand<Unit>;
 
-    public sealed record LoginUserCommand(string UserId, string Name, string Email, long Timestamp, string IdempotencyKey) : ICommand<Unit>;
+    public sealed record LoginUserCommand(string UserId, string Name, string Email, long Timestamp, string IdempotencyKey, long Sequence = 0) : ICommand<Unit>;
 
-    public sealed record LogoutUserCommand(string UserId, long Timestamp, string IdempotencyKey) : ICommand<Unit>;
+    public sealed record LogoutUserCommand(string UserId, long Timestamp, string IdempotencyKey, long Sequence = 0) : ICommand<Unit>;
 
-    public sealed record UpdateTaskCommand(string TaskId, JsonElement? Data, string UserId, long Timestamp, string IdempotencyKey) : ICommand<Unit>;
+    public sealed record UpdateTaskCommand(string TaskId, JsonElement? Data, string UserId, long Timestamp, string IdempotencyKey, string? BoardId = null, long Sequence = 0) : ICommand<Unit>;
 
-    public sealed record UpdateUserSettingsCommand(JsonElement? Data, string UserId, long Timestamp, string IdempotencyKey) : ICommand<Unit>;
+    public sealed record ReorderTasksCommand(string Category, IReadOnlyList<string> TaskIds, string UserId, long Timestamp, string IdempotencyKey, string? BoardId = null, long Sequence = 0, int Offset = 0, int Total = 0, IReadOnlyDictionary<string, long>? Expected = null) : ICommand<Unit>;
+
+    public sealed record UpdateUserSettingsCommand(JsonElement? Data, string UserId, long Timestamp, string IdempotencyKey, long Sequence = 0) : ICommand<Unit>;
+
+    public sealed record CreateBoardCommand(string Name, string UserId, long Timestamp, string IdempotencyKey, long Sequence = 0) : ICommand<Unit>;
+
+    public sealed record AddBoardMemberCommand(string BoardId, string MemberId, string Role, string UserId, long Timestamp, string IdempotencyKey, long Sequence = 0) : ICommand<Unit>;
+
+    public sealed record RemoveBoardMemberCommand(string BoardId, string MemberId, string UserId, long Timestamp, string IdempotencyKey, long Sequence = 0) : ICommand<Unit>;
+
+    public sealed record CommandBatch(string BatchId, int Part, int Parts, string UserId, IReadOnlyList<ICommand> Commands) : ICommand<Unit>;
 
 }
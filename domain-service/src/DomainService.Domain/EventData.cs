@@ -5,11 +5,48 @@ using System.Text.Json.Serialization;
 public sealed record TaskStatusData(
     [property: JsonPropertyName("done")] bool Done);
 
+// A category too large for one event is reordered by several, each listing the
+// tasks from Offset on out of Total. Expected holds the event timestamp each task
+// had when the reorder was planned; the read model drops the event when one of
+// them changed since.
+public sealed record TasksReorderedData(
+    [property: JsonPropertyName("category")] string Category,
+    [property: JsonPropertyName("ids")] IReadOnlyList<string> Ids,
+    [property: JsonPropertyName("offset"), JsonIgnore(Condition = JsonIgnoreCondition.WhenWritingDefault)] int Offset = 0,
+    [property: JsonPropertyName("total"), JsonIgnore(Condition = JsonIgnoreCondition.WhenWritingDefault)] int Total = 0,
+    [property: JsonPropertyName("expected"), JsonIgnore(Condition = JsonIgnoreCondition.WhenWritingNull)] IReadOnlyDictionary<string, long>? Expected = null);
+
 public sealed record UserProfileData(
     [property: JsonPropertyName("name")] string Name,
     [property: JsonPropertyName("email")] string Email);
 
+// Version 2 of the settings document; version 1 only had the first two fields.
 public sealed record UserSettingsData(
     [property: JsonPropertyName("tasksPerCategory")] int TasksPerCategory,
-    [property: JsonPropertyName("showDoneTasks")] bool ShowDoneTasks);
+    [property: JsonPropertyName("showDoneTasks")] bool ShowDoneTasks,
+    [property: JsonPropertyName("theme")] string Theme = "system",
+    [property: JsonPropertyName("defaultCategory")] string DefaultCategory = "normal",
+    [property: JsonPropertyName("timezone")] string Timezone = "UTC",
+    [property: JsonPropertyName("weekStart")] string WeekStart = "monday")
+{
+    [JsonPropertyName("version")]
+    public int Version { get; init; } = 2;
+
+    [JsonPropertyName("categories")]
+    public IReadOnlyList<UserCategoryData> Categories { get; init; } = Array.Empty<UserCategoryData>();
+}
+
+public sealed record UserCategoryData(
+    [property: JsonPropertyName("name")] string Name,
+    [property: JsonPropertyName("color")] string Color);
+
+
+public sealed record BoardData(
+    [property: JsonPropertyName("name")] string Name);
+
+public sealed record BoardMemberData(
+    [property: JsonPropertyName("userId")] string UserId,
+    [property: JsonPropertyName("role")] string Role);
 
+public sealed record BoardMemberRemovedData(
+    [property: JsonPropertyName("userId")] string UserId);
@@ -11,6 +11,7 @@ public sealed class ResilientEventDispatcher(IEventQueue queue, IReadModelUpdate
 
     public async Task Dispatch(IEvent ev, CancellationToken ct)
     {
+        ev = CommandTracing.WithTraceParent(ev);
         try
         {
             await _queue.Add(ev, ct);
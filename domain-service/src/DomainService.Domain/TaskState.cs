@@ -9,6 +9,15 @@ internal sealed class TaskState
     public string? Category { get; set; }
     public int Order { get; set; }
     public bool Done { get; set; }
+    public string? BoardId { get; set; }
+    public string? CreatedBy { get; set; }
+
+    // Board tasks may only be changed through commands targeting their board, and
+    // personal tasks only by the user who created them. prism-api checks the
+    // caller's board role; this guards against a command naming another board.
+    public bool AcceptsCommandFrom(string userId, string? boardId) => BoardId is null
+        ? boardId is null && CreatedBy == userId
+        : BoardId == boardId;
 }
 
 internal static class TaskStateBuilder
@@ -28,6 +37,8 @@ internal static class TaskStateBuilder
         switch (ev.Type)
         {
             case TaskEventTypes.Created:
+                state.BoardId = ev.BoardId;
+                state.CreatedBy = ev.UserId;
                 if (ev.Data.HasValue) {
                     var data = ev.Data.Value;
                     state.Title = data.GetProperty("title").GetString();
@@ -1,3 +1,4 @@
+using DomainService.Domain;
 using DomainService.Interfaces;
 using MediatR;
 using Microsoft.Azure.Functions.Worker;
@@ -14,6 +15,7 @@ internal sealed class CommandQueueFunction(ISender sender, ILoggerFactory logger
     [Function("CommandQueueFunction")]
     public async Task Run([QueueTrigger("%COMMAND_QUEUE%", Connection = "STORAGE_CONNECTION_STRING")] string msg, FunctionContext context)
     {
+        using var activity = CommandTracing.StartProcessing(msg);
         try
         {
             var command = _commandFactory.Create(msg);
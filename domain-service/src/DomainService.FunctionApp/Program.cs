@@ -7,6 +7,9 @@ using DomainService.Repositories;
 using Microsoft.Extensions.DependencyInjection;
 using Microsoft.Extensions.Hosting;
 using DomainService.Services;
+using OpenTelemetry.Resources;
+using OpenTelemetry.Trace;
+using StackExchange.Redis;
 
 var connStr = Environment.GetEnvironmentVariable("STORAGE_CONNECTION_STRING")
     ?? throw new InvalidOperationException("missing STORAGE_CONNECTION_STRING");
@@ -18,6 +21,20 @@ var userEventTableName = Environment.GetEnvironmentVariable("USER_EVENTS_TABLE")
     ?? throw new InvalidOperationException("missing USER_EVENTS_TABLE");
 var readModelUpdaterUrl = Environment.GetEnvironmentVariable("READ_MODEL_UPDATER_URL")
     ?? throw new InvalidOperationException("missing READ_MODEL_UPDATER_URL");
+var commandQueueName = Environment.GetEnvironmentVariable("COMMAND_QUEUE")
+    ?? throw new InvalidOperationException("missing COMMAND_QUEUE");
+var commandTransport = Environment.GetEnvironmentVariable("COMMAND_TRANSPORT") ?? "azure";
+var domainEventsTransport = Environment.GetEnvironmentVariable("DOMAIN_EVENTS_TRANSPORT") ?? "azure";
+var useRedisCommands = ParseTransport("COMMAND_TRANSPORT", commandTransport);
+var useRedisEvents = ParseTransport("DOMAIN_EVENTS_TRANSPORT", domainEventsTransport);
+var redisConnStr = Environment.GetEnvironmentVariable("REDIS_CONNECTION_STRING");
+// The OTLP exporter reads its endpoint and protocol from the standard OTEL_EXPORTER_OTLP_* variables.
+var otlpEnabled = !string.IsNullOrEmpty(Environment.GetEnvironmentVariable("OTEL_EXPORTER_OTLP_ENDPOINT"))
+    || !string.IsNullOrEmpty(Environment.GetEnvironmentVariable("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"));
+if ((useRedisCommands || useRedisEvents) && string.IsNullOrEmpty(redisConnStr))
+{
+    throw new InvalidOperationException("missing REDIS_CONNECTION_STRING");
+}
 
 var host = new HostBuilder()
     .ConfigureFunctionsWorkerDefaults()
@@ -33,7 +50,29 @@ var host = new HostBuilder()
                 NetworkTimeout = TimeSpan.FromSeconds(60)
             },
         };
-        services.AddSingleton<IEventQueue>(_ => new StorageQueueEventQueue(new QueueClient(connStr, domainEventsQueueName, queueClientOptions)));
+        if (useRedisCommands || useRedisEvents)
+        {
+            services.AddSingleton<IConnectionMultiplexer>(_ => ConnectionMultiplexer.Connect(RedisConnection.Parse(redisConnStr!)));
+        }
+        if (useRedisEvents)
+        {
+            // DOMAIN_EVENTS_QUEUE names the stream read by the read-model-updater consumer group.
+            services.AddSingleton<IEventQueue>(sp => new RedisStreamEventQueue(sp.GetRequiredService<IConnectionMultiplexer>().GetDatabase(), domainEventsQueueName));
+        }
+        else
+        {
+            services.AddSingleton<IEventQueue>(_ => new StorageQueueEventQueue(new QueueClient(connStr, domainEventsQueueName, queueClientOptions)));
+        }
+        if (useRedisCommands)
+        {
+            services.AddHostedService(sp => new RedisCommandStreamWorker(
+                sp.GetRequiredService<IConnectionMultiplexer>(),
+                sp.GetRequiredService<IServiceScopeFactory>(),
+                sp.GetRequiredService<ICommandFactory>(),
+                sp.GetRequiredService<Microsoft.Extensions.Logging.ILogger<RedisCommandStreamWorker>>(),
+                commandQueueName,
+                Environment.GetEnvironmentVariable("COMMAND_GROUP") ?? "domain-service"));
+        }
         var tableClientOptions = new TableClientOptions
         {
             Retry = {
@@ -55,9 +94,24 @@ var host = new HostBuilder()
             sp.GetRequiredService<IEventQueue>(),
             sp.GetRequiredService<IReadModelUpdaterClient>(),
             sp.GetRequiredService<Microsoft.Extensions.Logging.ILogger<ResilientEventDispatcher>>()));
+        if (otlpEnabled)
+        {
+            services.AddOpenTelemetry()
+                .ConfigureResource(resource => resource.AddService("domain-service"))
+                .WithTracing(tracing => tracing
+                    .AddSource(CommandTracing.SourceName)
+                    .AddOtlpExporter());
+        }
         services.AddMediatR(cfg => cfg.RegisterServicesFromAssembly(typeof(Program).Assembly));
         services.AddCommands();
     })
     .Build();
 
 host.Run();
+
+static bool ParseTransport(string name, string value) => value switch
+{
+    "" or "azure" => false,
+    "redis" => true,
+    _ => throw new InvalidOperationException($"invalid {name}: {value}"),
+};
@@ -0,0 +1,16 @@
+using DomainService.Interfaces;
+using StackExchange.Redis;
+using System.Text.Json;
+
+namespace DomainService.Repositories;
+
+internal sealed class RedisStreamEventQueue(IDatabase db, string stream) : IEventQueue
+{
+    internal const string PayloadField = "payload";
+
+    private readonly IDatabase _db = db;
+    private readonly RedisKey _stream = stream;
+
+    public Task Add(IEvent ev, CancellationToken ct)
+        => _db.StreamAddAsync(_stream, PayloadField, JsonSerializer.Serialize(ev));
+}
@@ -32,7 +32,8 @@ internal sealed class TableTaskEventRepository(TableClient table) : ITaskEventRe
                 list.Add(ev);
             }
         }
-        return [.. list.OrderBy(e => e.Timestamp)];
+        // Unsequenced events predate the sequencer, so they sort first.
+        return [.. list.OrderBy(e => e.Sequence).ThenBy(e => e.Timestamp)];
     }
 
     public async Task Add(IEvent ev, CancellationToken ct)
@@ -55,6 +56,16 @@ internal sealed class TableTaskEventRepository(TableClient table) : ITaskEventRe
             entity.Add("Data", ev.Data.Value.GetRawText());
         }
 
+        if (ev.BoardId != null)
+        {
+            entity.Add("BoardId", ev.BoardId);
+        }
+
+        if (ev.Sequence > 0)
+        {
+            entity.Add("EventSequence", ev.Sequence);
+        }
+
         await _table.AddEntityAsync(entity, ct);
     }
 
@@ -252,6 +263,7 @@ internal sealed class TableTaskEventRepository(TableClient table) : ITaskEventRe
         }
 
         var timestamp = ExtractInt64(entity, "EventTimestamp");
+        var sequence = ExtractInt64(entity, "EventSequence");
         var userId = entity.TryGetValue("UserId", out var userIdObj) && userIdObj is string uid ? uid : string.Empty;
         var idempotencyKey = entity.TryGetValue("IdempotencyKey", out var keyObj) && keyObj is string key ? key : string.Empty;
         var entityType = entity.TryGetValue("EntityType", out var entityTypeObj) && entityTypeObj is string et ? et : EntityTypes.Task;
@@ -263,7 +275,8 @@ internal sealed class TableTaskEventRepository(TableClient table) : ITaskEventRe
             data = doc.RootElement.Clone();
         }
 
-        ev = new Event(entity.RowKey, entity.PartitionKey, entityType, type, data, timestamp, userId, idempotencyKey);
+        var boardId = entity.TryGetValue("BoardId", out var boardIdObj) && boardIdObj is string bid ? bid : null;
+        ev = new Event(entity.RowKey, entity.PartitionKey, entityType, type, data, timestamp, userId, idempotencyKey, BoardId: boardId, Sequence: sequence);
         return true;
     }
 
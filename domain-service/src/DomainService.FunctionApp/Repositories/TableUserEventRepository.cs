@@ -30,6 +30,16 @@ internal sealed class TableUserEventRepository(TableClient table) : IUserEventRe
         return false;
     }
 
+    public async Task<string?> BoardOwner(string boardId, CancellationToken ct)
+    {
+        var filter = $"PartitionKey eq '{EscapeFilterValue(boardId)}' and Type eq '{BoardEventTypes.Created}'";
+        await foreach (var entity in _table.QueryAsync<TableEntity>(filter: filter, maxPerPage: 1, select: ["UserId"], cancellationToken: ct))
+        {
+            return entity.GetString("UserId");
+        }
+        return null;
+    }
+
     public async Task Add(IEvent ev, CancellationToken ct)
     {
         var insertedAt = DateTimeOffset.UtcNow;
@@ -50,6 +60,16 @@ internal sealed class TableUserEventRepository(TableClient table) : IUserEventRe
             entity.Add("Data", ev.Data.Value.GetRawText());
         }
 
+        if (ev.BoardId != null)
+        {
+            entity.Add("BoardId", ev.BoardId);
+        }
+
+        if (ev.Sequence > 0)
+        {
+            entity.Add("EventSequence", ev.Sequence);
+        }
+
         await _table.AddEntityAsync(entity, ct);
     }
 
@@ -236,6 +256,7 @@ internal sealed class TableUserEventRepository(TableClient table) : IUserEventRe
         }
 
         var timestamp = ExtractInt64(entity, "EventTimestamp");
+        var sequence = ExtractInt64(entity, "EventSequence");
         var userId = entity.TryGetValue("UserId", out var userIdObj) && userIdObj is string uid ? uid : string.Empty;
         var idempotencyKey = entity.TryGetValue("IdempotencyKey", out var keyObj) && keyObj is string key ? key : string.Empty;
         var entityType = entity.TryGetValue("EntityType", out var entityTypeObj) && entityTypeObj is string et ? et : EntityTypes.User;
@@ -247,7 +268,8 @@ internal sealed class TableUserEventRepository(TableClient table) : IUserEventRe
             data = doc.RootElement.Clone();
         }
 
-        ev = new Event(entity.RowKey, entity.PartitionKey, entityType, type, data, timestamp, userId, idempotencyKey);
+        var boardId = entity.TryGetValue("BoardId", out var boardIdObj) && boardIdObj is string bid ? bid : null;
+        ev = new Event(entity.RowKey, entity.PartitionKey, entityType, type, data, timestamp, userId, idempotencyKey, BoardId: boardId, Sequence: sequence);
         return true;
     }
 
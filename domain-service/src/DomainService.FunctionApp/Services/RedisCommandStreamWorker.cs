@@ -0,0 +1,163 @@
+using DomainService.Domain;
+using DomainService.Interfaces;
+using MediatR;
+using Microsoft.Extensions.DependencyInjection;
+using Microsoft.Extensions.Hosting;
+using Microsoft.Extensions.Logging;
+using StackExchange.Redis;
+
+namespace DomainService.Services;
+
+// Consumes commands from a Redis stream through a consumer group. A message is
+// acknowledged only after its command was handled; failures stay pending and are
+// reclaimed after ClaimIdle, the stream equivalent of a queue visibility timeout.
+// After MaxDeliveries attempts a message is moved to the <stream>:dead-letter
+// stream, like the read-model updater does with events. Acknowledged messages
+// are deleted, so the stream only holds unhandled ones.
+internal sealed class RedisCommandStreamWorker(
+    IConnectionMultiplexer redis,
+    IServiceScopeFactory scopeFactory,
+    ICommandFactory commandFactory,
+    ILogger<RedisCommandStreamWorker> logger,
+    string stream,
+    string group) : BackgroundService
+{
+    private const string PayloadField = "payload";
+    private const int BatchSize = 32;
+    private const int MaxDeliveries = 5;
+    private const string DeadLetterSuffix = ":dead-letter";
+    // Caps the dead-letter stream, which nothing consumes.
+    private const int DeadLetterMaxLength = 10000;
+    private static readonly TimeSpan PollDelay = TimeSpan.FromMilliseconds(250);
+    private static readonly TimeSpan ClaimIdle = TimeSpan.FromSeconds(30);
+
+    private readonly IConnectionMultiplexer _redis = redis;
+    private readonly IServiceScopeFactory _scopeFactory = scopeFactory;
+    private readonly ICommandFactory _commandFactory = commandFactory;
+    private readonly ILogger<RedisCommandStreamWorker> _logger = logger;
+    private readonly RedisKey _stream = stream;
+    private readonly RedisKey _deadLetterStream = stream + DeadLetterSuffix;
+    private readonly RedisValue _group = group;
+    private readonly RedisValue _consumer = Environment.MachineName;
+
+    protected override async Task ExecuteAsync(CancellationToken stoppingToken)
+    {
+        var db = _redis.GetDatabase();
+        await EnsureGroup(db);
+        var lastReclaim = DateTimeOffset.MinValue;
+
+        while (!stoppingToken.IsCancellationRequested)
+        {
+            try
+            {
+                if (DateTimeOffset.UtcNow - lastReclaim >= ClaimIdle / 2)
+                {
+                    await Reclaim(db, stoppingToken);
+                    lastReclaim = DateTimeOffset.UtcNow;
+                }
+
+                var entries = await db.StreamReadGroupAsync(_stream, _group, _consumer, ">", BatchSize);
+                if (entries.Length == 0)
+                {
+                    await Task.Delay(PollDelay, stoppingToken);
+                    continue;
+                }
+
+                foreach (var entry in entries)
+                {
+                    await Process(db, entry, stoppingToken);
+                }
+            }
+            catch (OperationCanceledException) when (stoppingToken.IsCancellationRequested)
+            {
+                return;
+            }
+            catch (Exception ex)
+            {
+                _logger.LogError(ex, "reading command stream {Stream}", (string?)_stream);
+                await Task.Delay(TimeSpan.FromSeconds(1), stoppingToken);
+            }
+        }
+    }
+
+    private async Task EnsureGroup(IDatabase db)
+    {
+        try
+        {
+            await db.StreamCreateConsumerGroupAsync(_stream, _group, "0", createStream: true);
+        }
+        catch (RedisServerException ex) when (ex.Message.StartsWith("BUSYGROUP", StringComparison.Ordinal))
+        {
+        }
+    }
+
+    private async Task Reclaim(IDatabase db, CancellationToken ct)
+    {
+        RedisValue start = "0-0";
+        while (!ct.IsCancellationRequested)
+        {
+            var claimed = await db.StreamAutoClaimAsync(_stream, _group, _consumer, (long)ClaimIdle.TotalMilliseconds, start, BatchSize);
+            foreach (var entry in claimed.ClaimedEntries)
+            {
+                var pending = await db.StreamPendingMessagesAsync(_stream, _group, 1, RedisValue.Null, entry.Id, entry.Id);
+                if (pending.Length > 0 && pending[0].DeliveryCount > MaxDeliveries)
+                {
+                    _logger.LogError("Dead-lettering command stream message {Id} after {Count} deliveries", (string?)entry.Id, pending[0].DeliveryCount);
+                    await DeadLetter(db, entry);
+                    continue;
+                }
+                await Process(db, entry, ct);
+            }
+
+            if (claimed.ClaimedEntries.Length == 0 || claimed.NextStartId == "0-0")
+            {
+                return;
+            }
+            start = claimed.NextStartId;
+        }
+    }
+
+    private async Task Process(IDatabase db, StreamEntry entry, CancellationToken ct)
+    {
+        var payload = entry[PayloadField];
+        if (payload.IsNullOrEmpty)
+        {
+            _logger.LogError("Command stream message {Id} has no payload", (string?)entry.Id);
+            await DeadLetter(db, entry);
+            return;
+        }
+
+        using var activity = CommandTracing.StartProcessing(payload!);
+        try
+        {
+            var command = _commandFactory.Create(payload!);
+            using var scope = _scopeFactory.CreateScope();
+            var sender = scope.ServiceProvider.GetRequiredService<ISender>();
+            await sender.Send(command, ct);
+            await Acknowledge(db, entry.Id);
+        }
+        catch (Exception ex) when (!ct.IsCancellationRequested)
+        {
+            _logger.LogError(ex, "processing command stream message {Id}", (string?)entry.Id);
+        }
+    }
+
+    // Copies the entry to the dead-letter stream before acknowledging it, so a
+    // failed copy leaves the message pending instead of losing it.
+    private async Task DeadLetter(IDatabase db, StreamEntry entry)
+    {
+        var values = entry.Values
+            .Append(new NameValueEntry("sourceId", entry.Id))
+            .ToArray();
+        await db.StreamAddAsync(_deadLetterStream, values, maxLength: DeadLetterMaxLength, useApproximateMaxLength: true);
+        await Acknowledge(db, entry.Id);
+    }
+
+    // The stream has a single consumer group, so no other reader still needs an
+    // acknowledged entry.
+    private async Task Acknowledge(IDatabase db, RedisValue id)
+    {
+        await db.StreamAcknowledgeAsync(_stream, _group, id);
+        await db.StreamDeleteAsync(_stream, [id]);
+    }
+}
@@ -0,0 +1,43 @@
+using StackExchange.Redis;
+
+namespace DomainService.Services;
+
+internal static class RedisConnection
+{
+    // Accepts both redis://[:password@]host:port URLs used by the Go services and
+    // StackExchange.Redis style "host:port,password=...,ssl=true" strings.
+    public static ConfigurationOptions Parse(string connectionString)
+    {
+        if (Uri.TryCreate(connectionString, UriKind.Absolute, out var uri) &&
+            (uri.Scheme == "redis" || uri.Scheme == "rediss"))
+        {
+            var options = new ConfigurationOptions
+            {
+                Ssl = uri.Scheme == "rediss",
+                AbortOnConnectFail = false,
+            };
+            options.EndPoints.Add(uri.Host, uri.IsDefaultPort ? 6379 : uri.Port);
+            if (!string.IsNullOrEmpty(uri.UserInfo))
+            {
+                var parts = uri.UserInfo.Split(':', 2);
+                if (parts.Length == 2)
+                {
+                    if (!string.IsNullOrEmpty(parts[0]))
+                    {
+                        options.User = Uri.UnescapeDataString(parts[0]);
+                    }
+                    options.Password = Uri.UnescapeDataString(parts[1]);
+                }
+                else
+                {
+                    options.Password = Uri.UnescapeDataString(parts[0]);
+                }
+            }
+            return options;
+        }
+
+        var parsed = ConfigurationOptions.Parse(connectionString);
+        parsed.AbortOnConnectFail = false;
+        return parsed;
+    }
+}
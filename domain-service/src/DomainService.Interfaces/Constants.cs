@@ -5,6 +5,7 @@ public static class EntityTypes
     public const string Task = "task";
     public const string User = "user";
     public const string UserSettings = "user-settings";
+    public const string Board = "board";
 }
 
 public static class TaskEventTypes
@@ -13,6 +14,7 @@ public static class TaskEventTypes
     public const string Updated = "task-updated";
     public const string Completed = "task-completed";
     public const string Reopened = "task-reopened";
+    public const string Reordered = "tasks-reordered";
 }
 
 public static class UserEventTypes
@@ -24,13 +26,31 @@ public static class UserEventTypes
     public const string SettingsCreated = "user-settings-created";
 }
 
+public static class BoardEventTypes
+{
+    public const string Created = "board-created";
+    public const string MemberAdded = "board-member-added";
+    public const string MemberRemoved = "board-member-removed";
+}
+
+public static class BoardRoles
+{
+    public const string Owner = "owner";
+    public const string Editor = "editor";
+    public const string Viewer = "viewer";
+}
+
 public static class CommandTypes
 {
     public const string CompleteTask = "complete-task";
     public const string CreateTask = "create-task";
     public const string UpdateTask = "update-task";
     public const string ReopenTask = "reopen-task";
+    public const string ReorderTasks = "reorder-tasks";
     public const string LoginUser = "login-user";
     public const string LogoutUser = "logout-user";
     public const string UpdateUserSettings = "update-user-settings";
+    public const string CreateBoard = "create-board";
+    public const string AddBoardMember = "add-board-member";
+    public const string RemoveBoardMember = "remove-board-member";
 }
@@ -12,4 +12,11 @@ public interface IEvent
     long Timestamp { get; }
     string UserId { get; }
     string IdempotencyKey { get; }
+    // W3C traceparent of the command processing that produced the event, if traced.
+    string? TraceParent { get; }
+    // Board whose read model partition the event belongs to; null for personal tasks.
+    string? BoardId { get; }
+    // Per-partition sequence prism-api stamped on the command; 0 when it was not
+    // sequenced. Read models order events by it instead of Timestamp.
+    long Sequence { get; }
 }
@@ -3,4 +3,7 @@ namespace DomainService.Interfaces;
 public interface IUserEventRepository : IDispatchAwareEventRepository
 {
     Task<bool> Exists(string userId, CancellationToken ct);
+
+    // BoardOwner returns the user who created the board, or null when no board has the ID.
+    Task<string?> BoardOwner(string boardId, CancellationToken ct);
 }
@@ -2,9 +2,10 @@ using System.Text.Json;
 
 namespace DomainService.Interfaces;
 
-public sealed record Command(string Id, string EntityType, string Type, JsonElement? Data, long Timestamp);
-public sealed record CommandEnvelope(string UserId, Command Command);
-public sealed record Event(string Id, string EntityId, string EntityType, string Type, JsonElement? Data, long Timestamp, string UserId, string IdempotencyKey) : IEvent;
+public sealed record Command(string Id, string EntityType, string Type, JsonElement? Data, long Timestamp, string? BoardId = null, long Sequence = 0);
+public sealed record CommandEnvelope(string UserId, Command Command, string? TraceParent = null);
+public sealed record CommandBatchEnvelope(string UserId, string BatchId, int Part, int Parts, IReadOnlyList<Command> Commands, string? TraceParent = null);
+public sealed record Event(string Id, string EntityId, string EntityType, string Type, JsonElement? Data, long Timestamp, string UserId, string IdempotencyKey, string? TraceParent = null, string? BoardId = null, long Sequence = 0) : IEvent;
 public sealed record StoredEvent(IEvent Event, bool Dispatched);
 
 public enum IdempotencyResult
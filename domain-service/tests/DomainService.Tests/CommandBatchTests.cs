@@ -0,0 +1,73 @@
+using DomainService.Domain.CommandHandlers;
+using DomainService.Domain.Commands;
+using DomainService.Interfaces;
+using MediatR;
+using Microsoft.Extensions.Logging.Abstractions;
+using Xunit;
+
+namespace DomainService.Tests
+{
+    public class CommandBatchTests
+    {
+        [Fact]
+        public void CommandFactory_creates_batch_in_order()
+        {
+            var factory = new CommandFactory(NullLoggerFactory.Instance);
+            const string msg = "{\"userId\":\"u1\",\"batchId\":\"b1\",\"part\":0,\"parts\":1,\"commands\":[" +
+                "{\"id\":\"k1\",\"entityType\":\"task\",\"type\":\"update-task\",\"data\":{\"id\":\"t1\",\"order\":1},\"timestamp\":1}," +
+                "{\"id\":\"k2\",\"entityType\":\"task\",\"type\":\"update-task\",\"data\":{\"id\":\"t2\",\"order\":0},\"timestamp\":2}]}";
+
+            var batch = Assert.IsType<CommandBatch>(factory.Create(msg));
+
+            Assert.Equal("b1", batch.BatchId);
+            Assert.Equal(2, batch.Commands.Count);
+            Assert.Equal("t1", Assert.IsType<UpdateTaskCommand>(batch.Commands[0]).TaskId);
+            Assert.Equal("t2", Assert.IsType<UpdateTaskCommand>(batch.Commands[1]).TaskId);
+            Assert.Equal("u1", ((UpdateTaskCommand)batch.Commands[1]).UserId);
+        }
+
+        [Fact]
+        public async Task ApplyCommandBatch_stops_at_first_failure()
+        {
+            var sender = new RecordingSender(failAt: "k2");
+            var handler = new ApplyCommandBatch(sender, NullLogger<ApplyCommandBatch>.Instance);
+            var batch = new CommandBatch("b1", 0, 1, "u1",
+            [
+                new CompleteTaskCommand("t1", "u1", 1, "k1"),
+                new CompleteTaskCommand("t2", "u1", 2, "k2"),
+                new CompleteTaskCommand("t3", "u1", 3, "k3"),
+            ]);
+
+            await Assert.ThrowsAsync<InvalidOperationException>(() => handler.Handle(batch, CancellationToken.None));
+
+            Assert.Equal(["k1", "k2"], sender.Sent);
+        }
+
+        private sealed class RecordingSender(string failAt) : ISender
+        {
+            public List<string> Sent { get; } = [];
+
+            public Task<object?> Send(object request, CancellationToken cancellationToken)
+            {
+                var key = ((CompleteTaskCommand)request).IdempotencyKey;
+                Sent.Add(key);
+                if (key == failAt)
+                {
+                    throw new InvalidOperationException("Command handler failed.");
+                }
+                return Task.FromResult<object?>(Unit.Value);
+            }
+
+            Task ISender.Send<TRequest>(TRequest request, CancellationToken cancellationToken) => Send(request!, cancellationToken);
+
+            public Task<TResponse> Send<TResponse>(IRequest<TResponse> request, CancellationToken cancellationToken) =>
+                throw new NotSupportedException();
+
+            public IAsyncEnumerable<TResponse> CreateStream<TResponse>(IStreamRequest<TResponse> request, CancellationToken cancellationToken) =>
+                throw new NotSupportedException();
+
+            public IAsyncEnumerable<object?> CreateStream(object request, CancellationToken cancellationToken) =>
+                throw new NotSupportedException();
+        }
+    }
+}
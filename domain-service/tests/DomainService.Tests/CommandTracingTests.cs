@@ -0,0 +1,42 @@
+using DomainService.Domain;
+using DomainService.Interfaces;
+using Xunit;
+
+namespace DomainService.Tests
+{
+    public class CommandTracingTests
+    {
+        private const string TraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01";
+
+        [Fact]
+        public void ReadTraceParent_finds_property_after_commands()
+        {
+            var msg = "{\"userId\":\"u1\",\"batchId\":\"b1\",\"part\":0,\"parts\":1,\"commands\":[" +
+                "{\"id\":\"k1\",\"entityType\":\"task\",\"type\":\"complete-task\",\"data\":{\"id\":\"t1\"},\"timestamp\":1}]," +
+                "\"traceparent\":\"" + TraceParent + "\"}";
+
+            Assert.Equal(TraceParent, CommandTracing.ReadTraceParent(msg));
+            Assert.Null(CommandTracing.ReadTraceParent("{\"userId\":\"u1\",\"command\":{}}"));
+            Assert.Null(CommandTracing.ReadTraceParent("not json"));
+        }
+
+        [Fact]
+        public void Events_dispatched_while_processing_carry_the_command_trace()
+        {
+            var msg = "{\"userId\":\"u1\",\"command\":{},\"traceparent\":\"" + TraceParent + "\"}";
+            var ev = new Event("e1", "t1", EntityTypes.Task, TaskEventTypes.Completed, null, 1, "u1", "k1");
+
+            using (var activity = CommandTracing.StartProcessing(msg))
+            {
+                Assert.NotNull(activity);
+                var stamped = CommandTracing.WithTraceParent(ev);
+
+                Assert.NotNull(stamped.TraceParent);
+                Assert.StartsWith("00-4bf92f3577b34da6a3ce929d0e0e4736-", stamped.TraceParent);
+                Assert.NotEqual(TraceParent, stamped.TraceParent);
+            }
+
+            Assert.Null(CommandTracing.WithTraceParent(ev).TraceParent);
+        }
+    }
+}
@@ -312,6 +312,144 @@ namespace DomainService.Tests
             JsonElement queuedData = queued.Data ?? throw new InvalidOperationException();
             Assert.False(queuedData.TryGetProperty("id", out _));
         }
+
+        [Fact]
+        public async Task CreateTask_assigns_board()
+        {
+            var repo = new InMemoryTaskRepo();
+            var dispatcher = new RecordingDispatcher();
+            ICommandHandler<CreateTaskCommand> handler = new CreateTask(repo, dispatcher);
+            var cmd = new CreateTaskCommand(JsonDocument.Parse("{\"title\":\"t\"}").RootElement, "u1", 1, "ik-board-create", "b1");
+
+            await handler.Handle(cmd, CancellationToken.None);
+
+            Assert.Equal("b1", repo.Events[0].BoardId);
+            Assert.Equal("b1", dispatcher.Events[0].BoardId);
+        }
+
+        [Fact]
+        public async Task UpdateTask_keeps_board_of_task_for_other_members()
+        {
+            var repo = new InMemoryTaskRepo();
+            var dispatcher = new RecordingDispatcher();
+            var created = new Event("e1", "t1", "task", "task-created", JsonDocument.Parse("{\"title\":\"t\"}").RootElement, 0, "u1", "ik-seed1", BoardId: "b1");
+            await repo.Add(created, CancellationToken.None);
+            ICommandHandler<UpdateTaskCommand> handler = new UpdateTask(repo, dispatcher);
+            var cmd = new UpdateTaskCommand("t1", JsonDocument.Parse("{\"notes\":\"n\"}").RootElement, "u2", 1, "ik-board-update", "b1");
+
+            await handler.Handle(cmd, CancellationToken.None);
+
+            Assert.Equal(2, repo.Events.Count);
+            Assert.Equal("b1", repo.Events[1].BoardId);
+            Assert.Equal("u2", repo.Events[1].UserId);
+        }
+
+        [Fact]
+        public async Task CompleteTask_ignores_command_targeting_another_board()
+        {
+            var repo = new InMemoryTaskRepo();
+            var dispatcher = new RecordingDispatcher();
+            var created = new Event("e1", "t1", "task", "task-created", JsonDocument.Parse("{\"title\":\"t\"}").RootElement, 0, "u1", "ik-seed1", BoardId: "b1");
+            await repo.Add(created, CancellationToken.None);
+            ICommandHandler<CompleteTaskCommand> handler = new CompleteTask(repo, dispatcher);
+
+            await handler.Handle(new CompleteTaskCommand("t1", "u2", 1, "ik-other-board", "b2"), CancellationToken.None);
+            await handler.Handle(new CompleteTaskCommand("t1", "u2", 1, "ik-personal", null), CancellationToken.None);
+
+            Assert.Single(repo.Events);
+            Assert.Empty(dispatcher.Events);
+        }
+
+        [Fact]
+        public async Task ReorderTasks_adds_single_event_for_partition()
+        {
+            var repo = new InMemoryTaskRepo();
+            var dispatcher = new RecordingDispatcher();
+            await repo.Add(new Event("e1", "t1", "task", "task-created", JsonDocument.Parse("{\"title\":\"a\"}").RootElement, 0, "u1", "ik-seed1"), CancellationToken.None);
+            await repo.Add(new Event("e2", "t2", "task", "task-created", JsonDocument.Parse("{\"title\":\"b\"}").RootElement, 0, "u1", "ik-seed2"), CancellationToken.None);
+            ICommandHandler<ReorderTasksCommand> handler = new ReorderTasks(repo, dispatcher);
+
+            await handler.Handle(new ReorderTasksCommand("urgent", ["t2", "t1"], "u1", 1, "ik-reorder"), CancellationToken.None);
+
+            Assert.Equal(3, repo.Events.Count);
+            var ev = Assert.Single(dispatcher.Events);
+            Assert.Equal(TaskEventTypes.Reordered, ev.Type);
+            Assert.Equal("u1", ev.EntityId);
+            JsonElement data = ev.Data ?? throw new InvalidOperationException();
+            Assert.Equal("urgent", data.GetProperty("category").GetString());
+            Assert.Equal(new[] { "t2", "t1" }, data.GetProperty("ids").EnumerateArray().Select(id => id.GetString()));
+        }
+
+        [Fact]
+        public async Task ReorderTasks_keeps_part_and_expected_timestamps()
+        {
+            var repo = new InMemoryTaskRepo();
+            var dispatcher = new RecordingDispatcher();
+            await repo.Add(new Event("e1", "t1", "task", "task-created", JsonDocument.Parse("{\"title\":\"a\"}").RootElement, 0, "u1", "ik-seed1"), CancellationToken.None);
+            ICommandHandler<ReorderTasksCommand> handler = new ReorderTasks(repo, dispatcher);
+
+            await handler.Handle(new ReorderTasksCommand("normal", ["t1"], "u1", 1, "ik-out-of-range", Offset: 1, Total: 1), CancellationToken.None);
+            await handler.Handle(new ReorderTasksCommand("normal", ["t1"], "u1", 2, "ik-part", Offset: 100, Total: 101, Expected: new Dictionary<string, long> { ["t1"] = 7 }), CancellationToken.None);
+
+            var ev = Assert.Single(dispatcher.Events);
+            JsonElement data = ev.Data ?? throw new InvalidOperationException();
+            Assert.Equal(100, data.GetProperty("offset").GetInt32());
+            Assert.Equal(101, data.GetProperty("total").GetInt32());
+            Assert.Equal(7, data.GetProperty("expected").GetProperty("t1").GetInt64());
+        }
+
+        [Fact]
+        public async Task ReorderTasks_ignores_command_with_foreign_or_unknown_tasks()
+        {
+            var repo = new InMemoryTaskRepo();
+            var dispatcher = new RecordingDispatcher();
+            await repo.Add(new Event("e1", "t1", "task", "task-created", JsonDocument.Parse("{\"title\":\"a\"}").RootElement, 0, "u1", "ik-seed1"), CancellationToken.None);
+            await repo.Add(new Event("e2", "t2", "task", "task-created", JsonDocument.Parse("{\"title\":\"b\"}").RootElement, 0, "u2", "ik-seed2"), CancellationToken.None);
+            ICommandHandler<ReorderTasksCommand> handler = new ReorderTasks(repo, dispatcher);
+
+            await handler.Handle(new ReorderTasksCommand("normal", ["t1", "t2"], "u1", 1, "ik-foreign"), CancellationToken.None);
+            await handler.Handle(new ReorderTasksCommand("normal", ["t1", "t3"], "u1", 2, "ik-unknown"), CancellationToken.None);
+            await handler.Handle(new ReorderTasksCommand("normal", ["t1", "t1"], "u1", 3, "ik-duplicate"), CancellationToken.None);
+
+            Assert.Equal(2, repo.Events.Count);
+            Assert.Empty(dispatcher.Events);
+        }
+
+        [Fact]
+        public async Task AddBoardMember_rejects_owner_role()
+        {
+            var repo = new InMemoryUserRepo();
+            var dispatcher = new RecordingDispatcher();
+            ICommandHandler<AddBoardMemberCommand> handler = new AddBoardMember(repo, dispatcher);
+
+            await handler.Handle(new AddBoardMemberCommand("b1", "u2", BoardRoles.Owner, "u1", 1, "ik-owner"), CancellationToken.None);
+            await handler.Handle(new AddBoardMemberCommand("b1", "u2", BoardRoles.Editor, "u1", 2, "ik-editor"), CancellationToken.None);
+
+            Assert.Single(repo.Events);
+            Assert.Equal(BoardEventTypes.MemberAdded, repo.Events[0].Type);
+            Assert.Equal("b1", repo.Events[0].EntityId);
+            JsonElement data = repo.Events[0].Data ?? throw new InvalidOperationException();
+            Assert.Equal("u2", data.GetProperty("userId").GetString());
+            Assert.Equal(BoardRoles.Editor, data.GetProperty("role").GetString());
+        }
+
+        [Fact]
+        public async Task RemoveBoardMember_ignores_owner_and_unknown_board()
+        {
+            var repo = new InMemoryUserRepo();
+            var dispatcher = new RecordingDispatcher();
+            await repo.Add(new Event("e1", "b1", EntityTypes.Board, BoardEventTypes.Created, JsonDocument.Parse("{\"name\":\"b\"}").RootElement, 0, "u1", "ik-seed"), CancellationToken.None);
+            ICommandHandler<RemoveBoardMemberCommand> handler = new RemoveBoardMember(repo, dispatcher);
+
+            await handler.Handle(new RemoveBoardMemberCommand("b1", "u1", "u1", 1, "ik-owner"), CancellationToken.None);
+            await handler.Handle(new RemoveBoardMemberCommand("b2", "u2", "u1", 2, "ik-unknown"), CancellationToken.None);
+            await handler.Handle(new RemoveBoardMemberCommand("b1", "u2", "u1", 3, "ik-member"), CancellationToken.None);
+
+            Assert.Equal(2, repo.Events.Count);
+            Assert.Equal(BoardEventTypes.MemberRemoved, repo.Events[1].Type);
+            JsonElement data = repo.Events[1].Data ?? throw new InvalidOperationException();
+            Assert.Equal("u2", data.GetProperty("userId").GetString());
+        }
     }
 
     class TransientFailureQueue : IEventQueue
@@ -423,6 +561,11 @@ namespace DomainService.Tests
             return Task.FromResult(Events.Any(e => e.EntityId == userId));
         }
 
+        public Task<string?> BoardOwner(string boardId, CancellationToken ct)
+        {
+            return Task.FromResult(Events.FirstOrDefault(e => e.EntityId == boardId && e.Type == BoardEventTypes.Created)?.UserId);
+        }
+
         public Task<IReadOnlyList<StoredEvent>> FindByIdempotencyKey(string idempotencyKey, CancellationToken ct)
         {
             var matches = Events
@@ -27,6 +27,12 @@ namespace DomainService.Tests
             var el = JsonSerializer.SerializeToElement(new UserSettingsData(3, false));
             Assert.Equal(3, el.GetProperty("tasksPerCategory").GetInt32());
             Assert.False(el.GetProperty("showDoneTasks").GetBoolean());
+            Assert.Equal(2, el.GetProperty("version").GetInt32());
+            Assert.Equal("system", el.GetProperty("theme").GetString());
+            Assert.Equal("normal", el.GetProperty("defaultCategory").GetString());
+            Assert.Equal(0, el.GetProperty("categories").GetArrayLength());
+            Assert.Equal("UTC", el.GetProperty("timezone").GetString());
+            Assert.Equal("monday", el.GetProperty("weekStart").GetString());
         }
     }
 }
@@ -1,6 +1,7 @@
 using System;
 using System.Collections.Generic;
 using System.IO;
+using System.Linq;
 using System.Threading;
 using System.Threading.Tasks;
 using Azure;
@@ -79,6 +80,25 @@ public class TableEventRepositoryTests
             });
     }
 
+    [Fact]
+    public async Task Task_repository_orders_sequenced_events_by_sequence()
+    {
+        var entities = new[]
+        {
+            CreateEntity("task-1", "evt-c", "ik-c", EntityTypes.Task, TaskEventTypes.Completed, timestamp: 3, sequence: 8),
+            CreateEntity("task-1", "evt-b", "ik-b", EntityTypes.Task, TaskEventTypes.Updated, timestamp: 9, sequence: 7),
+            CreateEntity("task-1", "evt-a", "ik-a", EntityTypes.Task, TaskEventTypes.Created, timestamp: 5),
+        };
+
+        var client = CreateTableClientMock(entities);
+        var repository = new TableTaskEventRepository(client.Object);
+
+        var events = await repository.Get("task-1", CancellationToken.None);
+
+        Assert.Equal(new[] { "evt-a", "evt-b", "evt-c" }, events.Select(e => e.Id));
+        Assert.Equal(new[] { 0L, 7L, 8L }, events.Select(e => e.Sequence));
+    }
+
     [Fact]
     public async Task TryStartProcessing_reclaims_stale_processing_entry()
     {
@@ -129,7 +149,8 @@ public class TableEventRepositoryTests
         long timestamp,
         bool dispatched = false,
         long? insertedAt = null,
-        long? tableTimestamp = null)
+        long? tableTimestamp = null,
+        long? sequence = null)
     {
         var entity = new TableEntity(partitionKey, rowKey)
         {
@@ -152,6 +173,11 @@ public class TableEventRepositoryTests
             entity.Timestamp = DateTimeOffset.FromUnixTimeMilliseconds(tableTimestamp.Value);
         }
 
+        if (sequence.HasValue)
+        {
+            entity["EventSequence"] = sequence.Value;
+        }
+
         return entity;
     }
 
@@ -8,7 +8,8 @@ vi.mock('@hooks', () => ({
     addTask: vi.fn(),
     updateTask: vi.fn(),
     completeTask: vi.fn(),
-    reopenTask: vi.fn()
+    reopenTask: vi.fn(),
+    reorderTasks: vi.fn()
   }),
   useLoginUser: () => {},
   useSettings: () => ({
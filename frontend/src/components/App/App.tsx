@@ -10,7 +10,7 @@ import { fetchWithAccessTokenRetry } from '@utils';
 import { aria } from '.';
 
 export default function App() {
-  const { tasks, addTask, updateTask, completeTask, reopenTask } = useTasks();
+  const { tasks, addTask, updateTask, completeTask, reopenTask, reorderTasks } = useTasks();
   const { settings, updateSettings } = useSettings();
   const [isModalOpen, setIsModalOpen] = useState(false);
   const [search, setSearch] = useState('');
@@ -84,6 +84,7 @@ export default function App() {
           updateTask={updateTask}
           completeTask={completeTask}
           reopenTask={reopenTask}
+          reorderTasks={reorderTasks}
         />
       </main>
 
@@ -13,6 +13,7 @@ describe('Board', () => {
         updateTask={() => {}}
         completeTask={() => {}}
         reopenTask={() => {}}
+        reorderTasks={() => {}}
       />
     );
     const board = screen.getByRole('region', { name: aria.root['aria-label'] });
@@ -33,6 +34,7 @@ describe('Board', () => {
         updateTask={() => {}}
         completeTask={completeTask}
         reopenTask={() => {}}
+        reorderTasks={() => {}}
       />
     );
     const card = getByText('Sample').parentElement as HTMLElement;
@@ -56,6 +58,7 @@ describe('Board', () => {
     expect(updateTask).toHaveBeenCalledWith('1', {
       category: 'normal',
       order: 0,
+      rank: 'i',
       done: false,
     });
   });
@@ -96,6 +99,25 @@ describe('Board', () => {
     });
   });
 
+  it('ranks a moved task after the last task of a ranked lane', () => {
+    const tasks: Task[] = [
+      { id: '1', title: 'Task A', category: 'normal', order: 0, rank: 'i' },
+      { id: '2', title: 'Task B', category: 'normal', order: 1, rank: 'r' },
+      { id: '3', title: 'Task C', category: 'fun', order: 0, rank: 'i' },
+    ];
+    const updateTask = vi.fn();
+    const ev: any = {
+      active: { id: '3' },
+      over: { id: '1', data: { current: { category: 'normal' } } }
+    };
+    handleDragEnd(ev, tasks, updateTask, vi.fn());
+    expect(updateTask).toHaveBeenCalledWith('3', {
+      category: 'normal',
+      order: 2,
+      rank: 'v',
+    });
+  });
+
   it('ignores drag and drop within the same category', () => {
     const tasks: Task[] = [
       { id: '1', title: 'Task A', category: 'normal', order: 0 },
@@ -123,6 +145,7 @@ describe('Board', () => {
         updateTask={() => {}}
         completeTask={() => {}}
         reopenTask={reopenTask}
+        reorderTasks={() => {}}
       />
     );
     const cardTitle = getAllByText('Done').find((el) => el.tagName === 'DIV') as HTMLElement;
@@ -134,13 +157,14 @@ describe('Board', () => {
     vi.useRealTimers();
   });
 
-  it('uses arrow controls to swap tasks within a lane', () => {
+  it('uses arrow controls to reorder tasks within a lane', () => {
     const tasks: Task[] = [
       { id: '1', title: 'First', category: 'normal', order: 0 },
       { id: '2', title: 'Second', category: 'normal', order: 1 },
       { id: '3', title: 'Third', category: 'normal', order: 2 }
     ];
     const updateTask = vi.fn();
+    const reorderTasks = vi.fn();
     render(
       <Board
         tasks={tasks}
@@ -148,13 +172,36 @@ describe('Board', () => {
         updateTask={updateTask}
         completeTask={() => {}}
         reopenTask={() => {}}
+        reorderTasks={reorderTasks}
       />
     );
     const moveDown = screen.getByRole('button', { name: 'Move First down' });
     fireEvent.click(moveDown);
-    expect(updateTask).toHaveBeenCalledTimes(2);
-    expect(updateTask).toHaveBeenNthCalledWith(1, '1', { order: 1 });
-    expect(updateTask).toHaveBeenNthCalledWith(2, '2', { order: 0 });
+    expect(updateTask).not.toHaveBeenCalled();
+    expect(reorderTasks).toHaveBeenCalledWith('normal', ['2', '1', '3']);
+  });
+
+  it('moves a ranked task by re-ranking only that task', () => {
+    const tasks: Task[] = [
+      { id: '1', title: 'First', category: 'normal', order: 0, rank: '9' },
+      { id: '2', title: 'Second', category: 'normal', order: 1, rank: 'i' },
+      { id: '3', title: 'Third', category: 'normal', order: 2, rank: 'r' }
+    ];
+    const updateTask = vi.fn();
+    const reorderTasks = vi.fn();
+    render(
+      <Board
+        tasks={tasks}
+        settings={{ tasksPerCategory: 5, showDoneTasks: false }}
+        updateTask={updateTask}
+        completeTask={() => {}}
+        reopenTask={() => {}}
+        reorderTasks={reorderTasks}
+      />
+    );
+    fireEvent.click(screen.getByRole('button', { name: 'Move First down' }));
+    expect(reorderTasks).not.toHaveBeenCalled();
+    expect(updateTask).toHaveBeenCalledWith('1', { rank: 'm' });
   });
 });
 
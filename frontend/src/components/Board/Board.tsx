@@ -10,6 +10,7 @@ import { SortableContext, horizontalListSortingStrategy } from '@dnd-kit/sortabl
 import { useState } from 'react';
 import Lane from '@components/Lane';
 import TaskDetails from '@components/TaskDetails';
+import { compareTasks, rankBetween } from '@modules/rank';
 import type { Category, Task, Settings } from '@modules/types';
 import { aria } from '.';
 
@@ -19,6 +20,7 @@ interface Props {
   updateTask: (id: string, changes: Partial<Task>) => void;
   completeTask: (id: string) => void;
   reopenTask: (id: string) => void;
+  reorderTasks: (category: Category, ids: string[]) => void;
 }
 
 const categories: Category[] = ['critical', 'fun', 'important', 'normal'];
@@ -27,6 +29,16 @@ function getNextOrder(tasks: Task[]) {
   return tasks.reduce((max, task) => Math.max(max, task.order ?? 0), -1) + 1;
 }
 
+// Ranks the task after the lane's last one. Lanes whose tasks are not all
+// ranked yet keep ordering by order until the server migrates them.
+function getNextRank(tasks: Task[]): Pick<Task, 'rank'> {
+  if (!tasks.every((t) => t.rank)) {
+    return {};
+  }
+  const last = tasks.reduce((max, task) => (task.rank! > max ? task.rank! : max), '');
+  return { rank: rankBetween(last, '') };
+}
+
 export function handleDragEnd(
   ev: DragEndEvent,
   tasks: Task[],
@@ -57,7 +69,7 @@ export function handleDragEnd(
     }
     const targetLane = tasks.filter((t) => t.category === toCat && !t.done);
     const order = getNextOrder(targetLane);
-    updateTask(active.id as string, { category: toCat, order, done: false });
+    updateTask(active.id as string, { category: toCat, order, ...getNextRank(targetLane), done: false });
     return;
   }
 
@@ -65,12 +77,12 @@ export function handleDragEnd(
     // move to another lane; place at end if dropped on lane itself
     const targetLane = tasks.filter((t) => t.category === toCat && !t.done);
     const order = getNextOrder(targetLane);
-    updateTask(active.id as string, { category: toCat, order });
+    updateTask(active.id as string, { category: toCat, order, ...getNextRank(targetLane) });
     return;
   }
 }
 
-export default function Board({ tasks, settings, updateTask, completeTask, reopenTask }: Props) {
+export default function Board({ tasks, settings, updateTask, completeTask, reopenTask, reorderTasks }: Props) {
   const sensors = useSensors(
     useSensor(MouseSensor, { activationConstraint: { distance: 5 } }),
     useSensor(TouchSensor, { activationConstraint: { distance: 5 } })
@@ -86,7 +98,7 @@ export default function Board({ tasks, settings, updateTask, completeTask, reope
     }
     const laneTasks = tasks
       .filter((t) => t.category === task.category && !t.done)
-      .sort((a, b) => (a.order ?? 0) - (b.order ?? 0));
+      .sort(compareTasks);
     const currentIndex = laneTasks.findIndex((t) => t.id === task.id);
     if (currentIndex === -1) {
       return;
@@ -97,13 +109,22 @@ export default function Board({ tasks, settings, updateTask, completeTask, reope
       return;
     }
 
-    const currentTask = laneTasks[currentIndex];
-    const targetTask = laneTasks[targetIndex];
-    const currentOrder = currentTask.order ?? currentIndex;
-    const targetOrder = targetTask.order ?? targetIndex;
+    // In a ranked lane only the moved task changes: it gets a rank between
+    // its new neighbours.
+    if (laneTasks.every((t) => t.rank)) {
+      const [before, after] =
+        direction === 'up'
+          ? [laneTasks[targetIndex - 1]?.rank, laneTasks[targetIndex].rank]
+          : [laneTasks[targetIndex].rank, laneTasks[targetIndex + 1]?.rank];
+      updateTask(task.id, { rank: rankBetween(before, after) });
+      return;
+    }
 
-    updateTask(currentTask.id, { order: targetOrder });
-    updateTask(targetTask.id, { order: currentOrder });
+    // Otherwise a single reorder-tasks command renumbers and ranks the whole
+    // lane, so the swap cannot be applied halfway.
+    const ids = laneTasks.map((t) => t.id);
+    [ids[currentIndex], ids[targetIndex]] = [ids[targetIndex], ids[currentIndex]];
+    reorderTasks(task.category, ids);
   };
 
   if (selected) {
@@ -114,7 +135,7 @@ export default function Board({ tasks, settings, updateTask, completeTask, reope
     const laneTasks = (expanded === 'done'
       ? tasks.filter((t) => t.done)
       : tasks.filter((t) => t.category === expanded && !t.done)
-    ).sort((a, b) => (a.order ?? 0) - (b.order ?? 0));
+    ).sort(compareTasks);
 
     return (
       <DndContext onDragEnd={onDragEnd} sensors={sensors}>
@@ -150,7 +171,7 @@ export default function Board({ tasks, settings, updateTask, completeTask, reope
         {categories.map((cat) => {
           const laneTasks = tasks
             .filter((t) => t.category === cat && !t.done)
-            .sort((a, b) => (a.order ?? 0) - (b.order ?? 0));
+            .sort(compareTasks);
           return (
             <SortableContext
               items={laneTasks.map((t) => t.id)}
@@ -179,5 +179,9 @@ export function useTasks() {
     dispatch({ type: "reopen-task", id });
   }
 
-  return { tasks, addTask, updateTask, completeTask, reopenTask };
+  function reorderTasks(category: Task["category"], ids: string[]) {
+    dispatch({ type: "reorder-tasks", category, ids });
+  }
+
+  return { tasks, addTask, updateTask, completeTask, reopenTask, reorderTasks };
 }
@@ -1,3 +1,4 @@
 export * from './palette';
+export * from './rank';
 export * from './stream';
 export * from './types';
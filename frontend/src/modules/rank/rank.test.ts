@@ -0,0 +1,22 @@
+import { describe, it, expect } from 'vitest';
+import { compareTasks, rankBetween, spreadRanks } from '.';
+
+describe('ranks', () => {
+  it('finds a rank between two others', () => {
+    expect(rankBetween('', '')).toBe('i');
+    expect(rankBetween('a', 'b')).toBe('ai');
+    expect(rankBetween('', '1')).toBe('0i');
+    const rank = rankBetween('ab', 'ac');
+    expect(rank > 'ab' && rank < 'ac').toBe(true);
+  });
+
+  it('spreads ranks like the services', () => {
+    expect(spreadRanks(3)).toEqual(['9', 'i', 'r']);
+  });
+
+  it('sorts ranked tasks by rank ahead of unranked ones', () => {
+    expect(compareTasks({ order: 0, rank: 'r' }, { order: 1, rank: 'i' })).toBeGreaterThan(0);
+    expect(compareTasks({ order: 5, rank: 'r' }, { order: 1 })).toBeLessThan(0);
+    expect(compareTasks({ order: 2 }, { order: 1 })).toBeGreaterThan(0);
+  });
+});
@@ -0,0 +1,65 @@
+// Mirrors taskstate/rank.go: ranks are strings over digits and lowercase
+// letters compared character by character, and never end in "0".
+const digits = '0123456789abcdefghijklmnopqrstuvwxyz';
+const base = digits.length;
+
+export const maxRankLength = 12;
+
+function digitAt(rank: string, i: number) {
+  return i < rank.length ? digits.indexOf(rank[i]) : 0;
+}
+
+function midpoint(a: string, b: string): string {
+  if (b) {
+    let n = 0;
+    while (n < b.length && digitAt(a, n) === digits.indexOf(b[n])) n++;
+    if (n > 0) return b.slice(0, n) + midpoint(a.slice(n), b.slice(n));
+  }
+  const lo = digitAt(a, 0);
+  const hi = b ? digits.indexOf(b[0]) : base;
+  if (hi - lo > 1) return digits[Math.floor((lo + hi) / 2)];
+  if (b.length > 1) return b[0];
+  return digits[lo] + midpoint(a.slice(1), '');
+}
+
+// Returns a rank sorting after `a` and before `b`; empty bounds are open.
+export function rankBetween(a = '', b = ''): string {
+  if (b && a >= b) {
+    throw new Error(`rank ${a} is not before ${b}`);
+  }
+  return midpoint(a, b);
+}
+
+// The ranks a reorder of n tasks assigns, identical to the services'.
+export function spreadRanks(n: number): string[] {
+  let width = 1;
+  let space = base;
+  while (space < (n + 1) * base) {
+    width++;
+    space *= base;
+  }
+  return Array.from({ length: n }, (_, i) => {
+    let v = Math.floor(((i + 1) * space) / (n + 1));
+    let rank = '';
+    for (let j = 0; j < width; j++) {
+      rank = digits[v % base] + rank;
+      v = Math.floor(v / base);
+    }
+    return rank.replace(/0+$/, '');
+  });
+}
+
+// Sorts tasks within a lane like taskstate.Before: ranked tasks by rank ahead
+// of unranked ones, which sort by order.
+export function compareTasks(
+  a: { order?: number; rank?: string },
+  b: { order?: number; rank?: string },
+) {
+  if (a.rank && b.rank) {
+    return a.rank < b.rank ? -1 : a.rank > b.rank ? 1 : 0;
+  }
+  if (a.rank || b.rank) {
+    return a.rank ? -1 : 1;
+  }
+  return (a.order ?? 0) - (b.order ?? 0);
+}
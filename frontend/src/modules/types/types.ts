@@ -6,6 +6,7 @@ export interface Task {
   notes?: string;
   category: Category;
   order?: number;
+  rank?: string;
   done?: boolean;
 }
 
@@ -16,7 +17,22 @@ export interface Command {
   idempotencyKey?: string;
 }
 
+export type Theme = 'system' | 'light' | 'dark';
+
+export type WeekStart = 'monday' | 'sunday' | 'saturday';
+
+export interface CustomCategory {
+  name: string;
+  color: string;
+}
+
 export interface Settings {
+  version?: number;
   tasksPerCategory: number;
   showDoneTasks: boolean;
+  theme?: Theme;
+  defaultCategory?: string;
+  categories?: CustomCategory[];
+  timezone?: string;
+  weekStart?: WeekStart;
 }
\ No newline at end of file
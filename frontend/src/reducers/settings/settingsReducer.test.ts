@@ -35,4 +35,15 @@ describe("settingsReducer", () => {
     expect(s1.commands).toHaveLength(1);
     expect(s1.commands[0].data).toEqual({ showDoneTasks: true });
   });
+
+  it("sends only the changed preferences", () => {
+    const categories = [{ name: "work", color: "#112233" }];
+    const s1 = settingsReducer(settingsInitialState, {
+      type: "update-settings",
+      userId: "u1",
+      settings: { theme: "dark", categories },
+    });
+    expect(s1.settings).toEqual({ ...settingsInitialState.settings, theme: "dark", categories });
+    expect(s1.commands[0].data).toEqual({ theme: "dark", categories });
+  });
 });
@@ -6,7 +6,16 @@ interface State {
 }
 
 export const initialState: State = {
-  settings: { tasksPerCategory: 3, showDoneTasks: false },
+  settings: {
+    version: 2,
+    tasksPerCategory: 3,
+    showDoneTasks: false,
+    theme: 'system',
+    defaultCategory: 'normal',
+    categories: [],
+    timezone: 'UTC',
+    weekStart: 'monday',
+  },
   commands: [],
 };
 
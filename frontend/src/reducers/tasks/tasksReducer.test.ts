@@ -131,6 +131,30 @@ describe("tasksReducer", () => {
     });
   });
 
+  it("reorders a lane with a single command", () => {
+    const s1 = tasksReducer(initialState, {
+      type: "set-tasks",
+      tasks: [
+        { id: "t1", title: "a", notes: "", category: "normal", order: 0 },
+        { id: "t2", title: "b", notes: "", category: "normal", order: 1 },
+      ],
+    });
+    const s2 = tasksReducer(s1, {
+      type: "reorder-tasks",
+      category: "normal",
+      ids: ["t2", "t1"],
+    });
+    expect(s2.tasks.map((t) => [t.id, t.order, t.rank])).toEqual([
+      ["t1", 1, "o"],
+      ["t2", 0, "c"],
+    ]);
+    expect(s2.commands).toHaveLength(1);
+    expect(s2.commands[0]).toMatchObject({
+      type: "reorder-tasks",
+      data: { category: "normal", ids: ["t2", "t1"] },
+    });
+  });
+
   it("preserves index alignment when applying idempotency keys", () => {
     const s1 = tasksReducer(initialState, {
       type: "add-task",
@@ -1,3 +1,4 @@
+import { spreadRanks } from '@modules/rank';
 import type { Task, Command } from '@modules/types';
 
 type Counters = Record<Task["category"], number>;
@@ -35,6 +36,12 @@ type ReopenTaskAction = {
   id: string;
 };
 
+type ReorderTasksAction = {
+  type: "reorder-tasks";
+  category: Task["category"];
+  ids: string[];
+};
+
 type SetTasksAction = { type: "set-tasks"; tasks: Task[] };
 
 type MergeTasksAction = { type: "merge-tasks"; tasks: Task[] };
@@ -47,6 +54,7 @@ type Action =
   | UpdateTaskAction
   | CompleteTaskAction
   | ReopenTaskAction
+  | ReorderTasksAction
   | SetTasksAction
   | MergeTasksAction
   | ClearCommandsAction
@@ -141,6 +149,24 @@ export function tasksReducer(state: State = initialState, action: Action): State
       };
       return { tasks, commands: [...state.commands, cmd], nextOrder: state.nextOrder };
     }
+    case "reorder-tasks": {
+      const { category, ids } = action;
+      const ranks = spreadRanks(ids.length);
+      const tasks = state.tasks.map((t) => {
+        const order = ids.indexOf(t.id);
+        return order >= 0 ? { ...t, category, order, rank: ranks[order] } : t;
+      });
+      const cmd: Command = {
+        entityType: "task",
+        type: "reorder-tasks",
+        data: { category, ids },
+      };
+      return {
+        tasks,
+        commands: [...state.commands, cmd],
+        nextOrder: deriveCounters(tasks, state.nextOrder),
+      };
+    }
     case "clear-commands":
       return { ...state, commands: [] };
     case "set-idempotency-keys": {
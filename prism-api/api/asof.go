@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"prism-api/domain"
+)
+
+// TaskSnapshotStore replays the event store to list tasks at a point in time.
+type TaskSnapshotStore interface {
+	// TasksAsOf returns the tasks of a user, or of a board when board is set,
+	// after every event with a timestamp up to and including asOf.
+	TasksAsOf(ctx context.Context, partition string, board bool, asOf int64) ([]domain.Task, error)
+}
+
+// WithTaskSnapshots serves GET /api/tasks?asOf= from store.
+func WithTaskSnapshots(store TaskSnapshotStore) Option {
+	return func(o *options) {
+		o.snapshots = store
+	}
+}
+
+var errInvalidAsOf = errors.New("asOf must be an RFC 3339 timestamp or an event timestamp")
+
+// parseAsOf accepts an RFC 3339 timestamp or an event timestamp in Unix
+// nanoseconds, as returned by the task history.
+func parseAsOf(v string) (int64, error) {
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if ts <= 0 {
+			return 0, errInvalidAsOf
+		}
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return 0, errInvalidAsOf
+	}
+	return t.UnixNano(), nil
+}
+
+// tasksAsOf routes requests carrying asOf to the point-in-time view and all
+// others to next.
+func tasksAsOf(next echo.HandlerFunc, store TaskSnapshotStore, authn Authenticator, limiter *rateLimiter, boards *boardAccess) echo.HandlerFunc {
+	asOf := getTasksAsOf(store, authn, limiter, boards)
+	return func(c echo.Context) error {
+		if c.QueryParam("asOf") != "" {
+			return asOf(c)
+		}
+		return next(c)
+	}
+}
+
+// getTasksAsOf lists the caller's tasks, or a board's tasks with ?boardId=, as
+// they were at the given moment. The whole list is returned in one response.
+func getTasksAsOf(store TaskSnapshotStore, authn Authenticator, limiter *rateLimiter, boards *boardAccess) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, err := authn.Authenticate(c.Request().Header.Get("Authorization"))
+		if err != nil {
+			return unauthenticated(c, err)
+		}
+		if err := requireReadScope(principal); err != nil {
+			return c.String(http.StatusForbidden, err.Error())
+		}
+		userID := principal.UserID
+		if !limiter.allowQuery(c, userID) {
+			return rateLimited(c)
+		}
+		asOf, err := parseAsOf(strings.TrimSpace(c.QueryParam("asOf")))
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		ctx := c.Request().Context()
+		partition, board := userID, false
+		if boardID := c.QueryParam("boardId"); boardID != "" {
+			if err := boards.authorizeQuery(ctx, boardID, userID); err != nil {
+				if errors.Is(err, errBoardForbidden) {
+					return c.String(http.StatusForbidden, err.Error())
+				}
+				c.Logger().Error(err)
+				return c.String(http.StatusInternalServerError, "failed to check board access")
+			}
+			partition, board = boardID, true
+		}
+		tasks, err := store.TasksAsOf(ctx, partition, board, asOf)
+		if err != nil {
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to replay tasks")
+		}
+		return respondJSON(c, http.StatusOK, tasksResponse{Tasks: tasks})
+	}
+}
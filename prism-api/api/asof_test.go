@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"prism-api/domain"
+)
+
+type stubSnapshots struct {
+	partition string
+	board     bool
+	asOf      int64
+}
+
+func (s *stubSnapshots) TasksAsOf(_ context.Context, partition string, board bool, asOf int64) ([]domain.Task, error) {
+	s.partition, s.board, s.asOf = partition, board, asOf
+	return []domain.Task{{ID: "t1"}}, nil
+}
+
+func TestGetTasksAsOf(t *testing.T) {
+	boards := newBoardAccess(stubBoards{"b1": domain.BoardRoleViewer})
+	cases := []struct {
+		query     string
+		status    int
+		partition string
+		board     bool
+		asOf      int64
+	}{
+		{query: "?asOf=2026-03-10T12:00:00Z", status: http.StatusOK, partition: "user", asOf: 1773144000000000000},
+		{query: "?asOf=1773144000000000123&boardId=b1", status: http.StatusOK, partition: "b1", board: true, asOf: 1773144000000000123},
+		{query: "?asOf=2026-03-10T12:00:00Z&boardId=b2", status: http.StatusForbidden},
+		{query: "?asOf=yesterday", status: http.StatusBadRequest},
+		{query: "?asOf=-5", status: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		snapshots := &stubSnapshots{}
+		store := &mockStore{}
+		handler := tasksAsOf(getTasks(store, mockAuth{}, log.New(), nil, boards), snapshots, mockAuth{}, nil, boards)
+		rec := httptest.NewRecorder()
+		if err := handler(echo.New().NewContext(httptest.NewRequest(http.MethodGet, tasksRoute+tc.query, nil), rec)); err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		if rec.Code != tc.status {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.query, tc.status, rec.Code, rec.Body.String())
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		if snapshots.partition != tc.partition || snapshots.board != tc.board || snapshots.asOf != tc.asOf {
+			t.Fatalf("%s: unexpected replay %+v", tc.query, snapshots)
+		}
+		if store.lastOwner != "" {
+			t.Fatalf("%s: asOf queries must not read the read model", tc.query)
+		}
+	}
+}
+
+func TestGetTasksWithoutAsOfReadsReadModel(t *testing.T) {
+	snapshots := &stubSnapshots{}
+	store := &mockStore{}
+	handler := tasksAsOf(getTasks(store, mockAuth{}, log.New(), nil, nil), snapshots, mockAuth{}, nil, nil)
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(httptest.NewRequest(http.MethodGet, tasksRoute, nil), rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || store.lastOwner != "user" || snapshots.partition != "" {
+		t.Fatalf("expected the read model to serve the request, got %d", rec.Code)
+	}
+}
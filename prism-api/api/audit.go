@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"auth"
+	"prism-api/domain"
+)
+
+const auditRoute = "/api/audit"
+
+const (
+	auditBuffer       = 1024
+	auditWriteTimeout = 10 * time.Second
+	defaultAuditRange = 7 * 24 * time.Hour
+	maxAuditRange     = 31 * 24 * time.Hour
+	defaultAuditPage  = 100
+	maxAuditPage      = 1000
+)
+
+// AuditStore keeps the append-only audit log of accepted commands.
+type AuditStore interface {
+	AppendAudit(ctx context.Context, entries []domain.AuditEntry) error
+	// FetchAudit returns the user's entries in [from, to) in chronological order.
+	FetchAudit(ctx context.Context, userID string, from, to time.Time, continuationToken string, limit int) ([]domain.AuditEntry, string, error)
+}
+
+// WithAuditLog records every accepted command in audit and serves the log on
+// /api/audit.
+func WithAuditLog(audit *AuditLog) Option {
+	return func(o *options) {
+		o.audit = audit
+	}
+}
+
+// AuditLog appends audit entries in the background so the command path does
+// not wait for the table. Entries are dropped with a warning when the buffer is
+// full. A nil *AuditLog records nothing.
+type AuditLog struct {
+	store   AuditStore
+	log     *log.Logger
+	entries chan []domain.AuditEntry
+	done    chan struct{}
+	// mu guards closed so no entry is queued once Close has begun.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAuditLog starts writing audit entries to store. Close flushes the entries
+// still queued.
+func NewAuditLog(store AuditStore, logger *log.Logger) *AuditLog {
+	w := &AuditLog{store: store, log: logger, entries: make(chan []domain.AuditEntry, auditBuffer), done: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+func (w *AuditLog) run() {
+	defer close(w.done)
+	for entries := range w.entries {
+		ctx, cancel := context.WithTimeout(bg, auditWriteTimeout)
+		if err := w.store.AppendAudit(ctx, entries); err != nil && w.log != nil {
+			w.log.WithError(err).WithField("user", entries[0].UserID).Warnf("failed to write %d audit entries", len(entries))
+		}
+		cancel()
+	}
+}
+
+// Close stops accepting entries and waits until the queued ones are written
+// or ctx is done.
+func (w *AuditLog) Close(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("audit log not flushed: %d batches left: %w", len(w.entries), ctx.Err())
+	}
+}
+
+// record queues an entry per accepted command. It must be called after
+// finalizeCommands so every command carries its idempotency key and timestamp.
+func (w *AuditLog) record(c echo.Context, p auth.Principal, cmds []domain.Command) {
+	if w == nil || len(cmds) == 0 {
+		return
+	}
+	ip, agent := c.RealIP(), c.Request().UserAgent()
+	entries := make([]domain.AuditEntry, len(cmds))
+	for i := range cmds {
+		entries[i] = domain.AuditEntry{
+			UserID:         p.UserID,
+			Type:           cmds[i].Type,
+			EntityType:     cmds[i].EntityType,
+			IdempotencyKey: cmds[i].IdempotencyKey,
+			Timestamp:      time.Unix(0, cmds[i].Timestamp).UTC(),
+			BoardID:        cmds[i].BoardID,
+			SourceIP:       ip,
+			UserAgent:      agent,
+			TokenID:        p.TokenID,
+		}
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		if w.log != nil {
+			w.log.WithField("user", p.UserID).Warnf("audit log closed; dropped %d entries", len(entries))
+		}
+		return
+	}
+	select {
+	case w.entries <- entries:
+	default:
+		if w.log != nil {
+			w.log.WithField("user", p.UserID).Warnf("audit buffer full; dropped %d entries", len(entries))
+		}
+	}
+}
+
+type auditResponse struct {
+	Entries       []domain.AuditEntry `json:"entries"`
+	NextPageToken string              `json:"nextPageToken,omitempty"`
+}
+
+// parseAuditRange reads the optional from and to query parameters. The range
+// defaults to the last seven days and may span at most 31 days.
+func parseAuditRange(c echo.Context, now time.Time) (from, to time.Time, err error) {
+	to = now
+	if v := strings.TrimSpace(c.QueryParam("to")); v != "" {
+		if to, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return from, to, errors.New("to must be an RFC 3339 timestamp")
+		}
+	}
+	from = to.Add(-defaultAuditRange)
+	if v := strings.TrimSpace(c.QueryParam("from")); v != "" {
+		if from, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return from, to, errors.New("from must be an RFC 3339 timestamp")
+		}
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	if to.Sub(from) > maxAuditRange {
+		return from, to, errors.New("time range must not exceed 31 days")
+	}
+	return from.UTC(), to.UTC(), nil
+}
+
+func getAudit(store AuditStore, authn Authenticator, limiter *rateLimiter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, err := authn.Authenticate(c.Request().Header.Get("Authorization"))
+		if err != nil {
+			return unauthenticated(c, err)
+		}
+		if err := requireReadScope(principal); err != nil {
+			return c.String(http.StatusForbidden, err.Error())
+		}
+		if !limiter.allowQuery(c, principal.UserID) {
+			return rateLimited(c)
+		}
+		from, to, err := parseAuditRange(c, time.Now())
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		pageSize := defaultAuditPage
+		if v := strings.TrimSpace(c.QueryParam("pageSize")); v != "" {
+			pageSize, err = strconv.Atoi(v)
+			if err != nil || pageSize <= 0 {
+				return c.String(http.StatusBadRequest, "invalid page size")
+			}
+			if pageSize > maxAuditPage {
+				pageSize = maxAuditPage
+			}
+		}
+		entries, next, err := store.FetchAudit(c.Request().Context(), principal.UserID, from, to, c.QueryParam("pageToken"), pageSize)
+		if err != nil {
+			var invalidTokenErr InvalidContinuationTokenError
+			if errors.As(err, &invalidTokenErr) {
+				return c.String(http.StatusBadRequest, "invalid page token")
+			}
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to read audit log")
+		}
+		if entries == nil {
+			entries = []domain.AuditEntry{}
+		}
+		return respondJSON(c, http.StatusOK, auditResponse{Entries: entries, NextPageToken: next})
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"auth"
+	"prism-api/domain"
+)
+
+type memoryAuditStore struct {
+	entries  []domain.AuditEntry
+	next     string
+	from, to time.Time
+	lastUser string
+}
+
+func (m *memoryAuditStore) AppendAudit(_ context.Context, entries []domain.AuditEntry) error {
+	m.entries = append(m.entries, entries...)
+	return nil
+}
+
+func (m *memoryAuditStore) FetchAudit(_ context.Context, userID string, from, to time.Time, _ string, _ int) ([]domain.AuditEntry, string, error) {
+	m.lastUser, m.from, m.to = userID, from, to
+	return m.entries, m.next, nil
+}
+
+// newTestAuditLog returns a log whose queue the test drains itself.
+func newTestAuditLog() *AuditLog {
+	return &AuditLog{store: &memoryAuditStore{}, entries: make(chan []domain.AuditEntry, 4)}
+}
+
+func TestPostCommandsRecordsAcceptedCommands(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	store := &mockStore{}
+	initCommandSender(store, log.New())
+	w := newTestAuditLog()
+
+	body := `[{"entityType":"task","type":"create-task"},{"idempotencyKey":"k2","entityType":"user-settings","type":"update-user-settings","data":{"theme":"dark"}}]`
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(body))
+	req.Header.Set(echo.HeaderXRealIP, "203.0.113.7")
+	req.Header.Set("User-Agent", "prism-cli/1.0")
+	rec := httptest.NewRecorder()
+	if err := postCommands(store, mockAuth{}, nil, nil, nil, w)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+	var resp postCommandResponse
+	if err := sonic.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case entries := <-w.entries:
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(entries))
+		}
+		for i, e := range entries {
+			if e.UserID != "user" || e.IdempotencyKey != resp.IdempotencyKeys[i] || e.SourceIP != "203.0.113.7" || e.UserAgent != "prism-cli/1.0" || e.Timestamp.IsZero() {
+				t.Fatalf("unexpected entry %d: %+v", i, e)
+			}
+		}
+		if entries[1].Type != "update-user-settings" || entries[1].EntityType != "user-settings" {
+			t.Fatalf("unexpected entry %+v", entries[1])
+		}
+	default:
+		t.Fatal("expected accepted commands to be audited")
+	}
+}
+
+func TestPostCommandsDoesNotAuditRejectedCommands(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	store := &mockStore{}
+	initCommandSender(store, log.New())
+	w := newTestAuditLog()
+
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(`[{"entityType":"task","type":"create-task"}]`))
+	rec := httptest.NewRecorder()
+	if err := postCommands(store, scopedAuth{auth.ScopeTasksRead}, nil, nil, nil, w)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if len(w.entries) != 0 {
+		t.Fatal("rejected commands must not be audited")
+	}
+}
+
+func TestGetAudit(t *testing.T) {
+	to := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		query  string
+		status int
+		from   time.Time
+	}{
+		{"explicit range", "?from=2026-03-09T00:00:00Z&to=2026-03-10T12:00:00Z&pageSize=5&pageToken=abc", http.StatusOK, time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{"default from", "?to=2026-03-10T12:00:00Z", http.StatusOK, to.Add(-defaultAuditRange)},
+		{"invalid time", "?from=yesterday", http.StatusBadRequest, time.Time{}},
+		{"reversed range", "?from=2026-03-11T00:00:00Z&to=2026-03-10T12:00:00Z", http.StatusBadRequest, time.Time{}},
+		{"range too long", "?from=2026-01-01T00:00:00Z&to=2026-03-10T12:00:00Z", http.StatusBadRequest, time.Time{}},
+		{"invalid page size", "?to=2026-03-10T12:00:00Z&pageSize=0", http.StatusBadRequest, time.Time{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &memoryAuditStore{entries: []domain.AuditEntry{{UserID: "user", Type: "create-task"}}, next: "next"}
+			req := httptest.NewRequest(http.MethodGet, auditRoute+tc.query, nil)
+			rec := httptest.NewRecorder()
+			if err := getAudit(store, mockAuth{}, nil)(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			if store.lastUser != "user" || !store.from.Equal(tc.from) || !store.to.Equal(to) {
+				t.Fatalf("unexpected query %s [%s, %s)", store.lastUser, store.from, store.to)
+			}
+			var resp auditResponse
+			if err := sonic.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Entries) != 1 || resp.NextPageToken != "next" {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestGetAuditRequiresReadScope(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, auditRoute, nil)
+	rec := httptest.NewRecorder()
+	if err := getAudit(&memoryAuditStore{}, scopedAuth{auth.ScopeTasksWrite}, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestAuditLogCloseFlushesQueuedEntries(t *testing.T) {
+	store := &memoryAuditStore{}
+	w := NewAuditLog(store, nil)
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, commandsRoute, nil), httptest.NewRecorder())
+	for i := 0; i < 3; i++ {
+		w.record(c, auth.Principal{UserID: "user"}, []domain.Command{{Type: "create-task", EntityType: "task"}})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 3 {
+		t.Fatalf("expected 3 flushed entries, got %d", len(store.entries))
+	}
+	w.record(c, auth.Principal{UserID: "user"}, []domain.Command{{Type: "create-task", EntityType: "task"}})
+	if err := w.Close(ctx); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
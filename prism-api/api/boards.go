@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+
+	"prism-api/domain"
+)
+
+const boardsRoute = "/api/boards"
+
+const (
+	boardEntityType          = "board"
+	createBoardCommand       = "create-board"
+	addBoardMemberCommand    = "add-board-member"
+	removeBoardMemberCommand = "remove-board-member"
+)
+
+// errBoardForbidden is returned when the caller lacks the role a request needs.
+var errBoardForbidden = errors.New("forbidden")
+
+// WithBoards enables shared boards, resolving memberships through store.
+// Without it every board-scoped request is rejected.
+func WithBoards(store BoardStore) Option {
+	return func(o *options) {
+		o.boards = store
+	}
+}
+
+// boardAccess checks board roles. A nil *boardAccess treats every user as a
+// non-member, so personal tasks keep working when boards are not configured.
+type boardAccess struct {
+	store BoardStore
+}
+
+func newBoardAccess(store BoardStore) *boardAccess {
+	if store == nil {
+		return nil
+	}
+	return &boardAccess{store: store}
+}
+
+func (b *boardAccess) role(ctx context.Context, boardID, userID string) (string, error) {
+	if b == nil {
+		return "", nil
+	}
+	return b.store.BoardRole(ctx, boardID, userID)
+}
+
+// authorizeQuery allows any member to read the board.
+func (b *boardAccess) authorizeQuery(ctx context.Context, boardID, userID string) error {
+	role, err := b.role(ctx, boardID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return errBoardForbidden
+	}
+	return nil
+}
+
+// authorizeCommands checks every board-scoped command of a request against the
+// caller's role on its board. Roles are looked up once per board.
+func (b *boardAccess) authorizeCommands(ctx context.Context, userID string, cmds []domain.Command) error {
+	var roles map[string]string
+	for i := range cmds {
+		cmd := &cmds[i]
+		if cmd.BoardID == "" {
+			continue
+		}
+		role, ok := roles[cmd.BoardID]
+		if !ok {
+			var err error
+			role, err = b.role(ctx, cmd.BoardID, userID)
+			if err != nil {
+				return err
+			}
+			if roles == nil {
+				roles = make(map[string]string, 1)
+			}
+			roles[cmd.BoardID] = role
+		}
+		if !commandAllowed(cmd, role, userID) {
+			return fmt.Errorf("command %d: %w", i, errBoardForbidden)
+		}
+	}
+	return nil
+}
+
+func commandAllowed(cmd *domain.Command, role, userID string) bool {
+	switch role {
+	case domain.BoardRoleOwner:
+		return true
+	case domain.BoardRoleEditor, domain.BoardRoleViewer:
+		if cmd.EntityType == boardEntityType {
+			// Members other than the owner may only leave the board.
+			return cmd.Type == removeBoardMemberCommand && commandMemberID(cmd) == userID
+		}
+		return role == domain.BoardRoleEditor
+	default:
+		return false
+	}
+}
+
+func commandMemberID(cmd *domain.Command) string {
+	var data struct {
+		UserID string `json:"userId"`
+	}
+	if len(cmd.Data) == 0 || sonic.Unmarshal(cmd.Data, &data) != nil {
+		return ""
+	}
+	return data.UserID
+}
+
+// validateBoardCommand rejects board targets the domain service would drop.
+func validateBoardCommand(cmd *domain.Command) error {
+	switch cmd.EntityType {
+	case "task":
+		return nil
+	case boardEntityType:
+		switch cmd.Type {
+		case createBoardCommand:
+			if cmd.BoardID != "" {
+				return errors.New("create-board must not set boardId")
+			}
+			return nil
+		case addBoardMemberCommand, removeBoardMemberCommand:
+			if cmd.BoardID == "" {
+				return fmt.Errorf("%s requires boardId", cmd.Type)
+			}
+			if commandMemberID(cmd) == "" {
+				return fmt.Errorf("%s requires data.userId", cmd.Type)
+			}
+		}
+		return nil
+	default:
+		if cmd.BoardID != "" {
+			return fmt.Errorf("boardId is not supported for %s commands", cmd.EntityType)
+		}
+		return nil
+	}
+}
+
+// boardAuthorizationFailed answers 403 when the caller lacks the board role and
+// 500 when the membership lookup failed.
+func boardAuthorizationFailed(c echo.Context, metrics *requestMetrics, err error) error {
+	if errors.Is(err, errBoardForbidden) {
+		metrics.SetErrorStage("forbidden")
+		return c.String(http.StatusForbidden, err.Error())
+	}
+	metrics.SetErrorStage("authorize")
+	c.Logger().Error(err)
+	return c.String(http.StatusInternalServerError, "failed to check board access")
+}
+
+func getBoards(authn Authenticator, limiter *rateLimiter, boards *boardAccess) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, err := authn.Authenticate(c.Request().Header.Get("Authorization"))
+		if err != nil {
+			return unauthenticated(c, err)
+		}
+		if err := requireReadScope(principal); err != nil {
+			return c.String(http.StatusForbidden, err.Error())
+		}
+		userID := principal.UserID
+		if !limiter.allowQuery(c, userID) {
+			return rateLimited(c)
+		}
+		list := []domain.Board{}
+		if boards != nil {
+			list, err = boards.store.FetchBoards(c.Request().Context(), userID)
+			if err != nil {
+				c.Logger().Error(err)
+				return c.String(http.StatusInternalServerError, err.Error())
+			}
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
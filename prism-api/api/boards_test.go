@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"prism-api/domain"
+)
+
+// stubBoards maps board IDs to the role of the "user" returned by mockAuth.
+type stubBoards map[string]string
+
+func (s stubBoards) BoardRole(ctx context.Context, boardID, userID string) (string, error) {
+	return s[boardID], nil
+}
+
+func (s stubBoards) FetchBoards(ctx context.Context, userID string) ([]domain.Board, error) {
+	boards := []domain.Board{}
+	for id, role := range s {
+		boards = append(boards, domain.Board{ID: id, Role: role})
+	}
+	return boards, nil
+}
+
+func TestGetTasksForBoardRequiresMembership(t *testing.T) {
+	boards := newBoardAccess(stubBoards{"b1": domain.BoardRoleViewer})
+	cases := []struct {
+		query     string
+		status    int
+		partition string
+	}{
+		{query: "", status: http.StatusOK, partition: "user"},
+		{query: "?boardId=b1", status: http.StatusOK, partition: "b1"},
+		{query: "?boardId=b2", status: http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		store := &mockStore{}
+		req := httptest.NewRequest(http.MethodGet, tasksRoute+tc.query, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+		rec := httptest.NewRecorder()
+		if err := getTasks(store, mockAuth{}, log.New(), nil, boards)(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatalf("%q: get tasks: %v", tc.query, err)
+		}
+		if rec.Code != tc.status {
+			t.Fatalf("%q: expected status %d, got %d", tc.query, tc.status, rec.Code)
+		}
+		if store.lastOwner != tc.partition {
+			t.Fatalf("%q: expected tasks of %q, got %q", tc.query, tc.partition, store.lastOwner)
+		}
+	}
+}
+
+func TestPostCommandsAuthorizesBoardRoles(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+
+	boards := newBoardAccess(stubBoards{
+		"owned":  domain.BoardRoleOwner,
+		"edited": domain.BoardRoleEditor,
+		"viewed": domain.BoardRoleViewer,
+	})
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"personal task", `[{"entityType":"task","type":"create-task"}]`, http.StatusAccepted},
+		{"editor task", `[{"entityType":"task","type":"create-task","boardId":"edited"}]`, http.StatusAccepted},
+		{"viewer task", `[{"entityType":"task","type":"create-task","boardId":"viewed"}]`, http.StatusForbidden},
+		{"non-member task", `[{"entityType":"task","type":"create-task","boardId":"other"}]`, http.StatusForbidden},
+		{"create board", `[{"entityType":"board","type":"create-board","data":{"name":"Team"}}]`, http.StatusAccepted},
+		{"owner adds member", `[{"entityType":"board","type":"add-board-member","boardId":"owned","data":{"userId":"u2","role":"editor"}}]`, http.StatusAccepted},
+		{"editor adds member", `[{"entityType":"board","type":"add-board-member","boardId":"edited","data":{"userId":"u2","role":"editor"}}]`, http.StatusForbidden},
+		{"viewer leaves", `[{"entityType":"board","type":"remove-board-member","boardId":"viewed","data":{"userId":"user"}}]`, http.StatusAccepted},
+		{"viewer removes other", `[{"entityType":"board","type":"remove-board-member","boardId":"viewed","data":{"userId":"u2"}}]`, http.StatusForbidden},
+		{"one forbidden command rejects batch", `[{"entityType":"task","type":"create-task"},{"entityType":"task","type":"complete-task","boardId":"viewed"}]`, http.StatusForbidden},
+		{"member command without board", `[{"entityType":"board","type":"add-board-member","data":{"userId":"u2","role":"editor"}}]`, http.StatusBadRequest},
+		{"board on settings", `[{"entityType":"user-settings","type":"update-user-settings","boardId":"owned"}]`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockStore{}
+			initCommandSender(store, log.New())
+			t.Cleanup(resetCommandSenderForTests)
+			req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+			rec := httptest.NewRecorder()
+			if err := postCommands(store, mockAuth{}, nil, nil, boards, nil)(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if tc.status == http.StatusAccepted {
+				waitForCommands(t, store, strings.Count(tc.body, "entityType"))
+			} else if len(store.Commands()) != 0 {
+				t.Fatalf("rejected commands must not be enqueued")
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const eventExportScope = "prism-api/api"
+
+// WithEventExport sends the request observability events as OTel log records
+// through lp and records request and stage latencies as histograms on mp, instead
+// of writing the events to stdout. Either provider may be nil.
+func WithEventExport(lp otellog.LoggerProvider, mp metric.MeterProvider) Option {
+	return func(o *options) {
+		o.logProvider = lp
+		o.meterProvider = mp
+	}
+}
+
+// eventExport is set by Register when an exporter is configured.
+var eventExport *otelEventExporter
+
+type otelEventExporter struct {
+	logger   otellog.Logger
+	duration metric.Float64Histogram
+	stages   metric.Float64Histogram
+}
+
+func newOtelEventExporter(lp otellog.LoggerProvider, mp metric.MeterProvider) (*otelEventExporter, error) {
+	if lp == nil && mp == nil {
+		return nil, nil
+	}
+	exp := &otelEventExporter{}
+	if lp != nil {
+		exp.logger = lp.Logger(eventExportScope)
+	}
+	if mp != nil {
+		meter := mp.Meter(eventExportScope)
+		var err error
+		exp.duration, err = meter.Float64Histogram("prism.api.request.duration",
+			metric.WithUnit("ms"),
+			metric.WithDescription("Latency of requests and command jobs by event, route and status code."),
+		)
+		if err != nil {
+			return nil, err
+		}
+		exp.stages, err = meter.Float64Histogram("prism.api.request.stage.duration",
+			metric.WithUnit("ms"),
+			metric.WithDescription("Time spent in each stage of a request by route."),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return exp, nil
+}
+
+func (e *otelEventExporter) export(ev requestLogEvent) {
+	ctx := context.Background()
+	if ev.spanContext.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, ev.spanContext)
+	}
+	route := attribute.String("http.route", ev.record.kind.route)
+	event := attribute.String("event.name", ev.record.kind.eventName)
+
+	if e.duration != nil {
+		attrs := []attribute.KeyValue{route, event}
+		if ev.record.status != 0 {
+			attrs = append(attrs, attribute.Int("http.status_code", ev.record.status))
+		}
+		e.duration.Record(ctx, durationToMillis(ev.record.total), metric.WithAttributes(attrs...))
+		for _, s := range ev.record.stages {
+			e.stages.Record(ctx, durationToMillis(s.duration), metric.WithAttributes(route, event, attribute.String("stage", s.name)))
+		}
+	}
+
+	if e.logger == nil {
+		return
+	}
+	var rec otellog.Record
+	rec.SetEventName(ev.record.kind.eventName)
+	rec.SetTimestamp(ev.eventTime)
+	rec.SetObservedTimestamp(ev.eventTime)
+	rec.SetSeverity(otellog.Severity(ev.severityNumber))
+	rec.SetSeverityText(ev.severityText)
+	rec.SetBody(otellog.StringValue(ev.record.kind.eventBody))
+	kv := ev.record.keyValues()
+	attrs := make([]otellog.KeyValue, 0, len(kv)+1)
+	attrs = append(attrs, otellog.String("event.domain", tasksEventDomain))
+	for _, a := range kv {
+		attrs = append(attrs, otellog.KeyValueFromAttribute(a))
+	}
+	rec.AddAttributes(attrs...)
+	e.logger.Emit(ctx, rec)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"prism-api/domain"
+)
+
+type recordingLogExporter struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (e *recordingLogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		e.records = append(e.records, r.Clone())
+	}
+	return nil
+}
+
+func (e *recordingLogExporter) Shutdown(context.Context) error   { return nil }
+func (e *recordingLogExporter) ForceFlush(context.Context) error { return nil }
+
+func TestOtelEventExporterEmitsCommandsEvent(t *testing.T) {
+	tp, spans, restore := setupTestTracer(t)
+	defer restore()
+
+	logs := &recordingLogExporter{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logs)))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	exp, err := newOtelEventExporter(lp, mp)
+	if err != nil {
+		t.Fatalf("new exporter: %v", err)
+	}
+	eventExport = exp
+	defer func() { eventExport = nil }()
+
+	metrics, _ := newRequestMetrics(context.Background(), commandsRequest, log.New())
+	metrics.ObserveAuth(2 * time.Millisecond)
+	metrics.ObserveDecode(3 * time.Millisecond)
+	metrics.SetCommandCount(2)
+	metrics.Log(http.StatusAccepted, nil)
+
+	if err := tp.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("force flush spans: %v", err)
+	}
+
+	if len(logs.records) != 1 {
+		t.Fatalf("expected 1 log record, got %d", len(logs.records))
+	}
+	rec := logs.records[0]
+	if rec.EventName() != commandsRequest.eventName {
+		t.Fatalf("unexpected event name: %s", rec.EventName())
+	}
+	if rec.Severity() != otellog.SeverityInfo {
+		t.Fatalf("unexpected severity: %v", rec.Severity())
+	}
+	attrs := map[string]otellog.Value{}
+	rec.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	if got := attrs["http.route"].AsString(); got != commandsRoute {
+		t.Fatalf("unexpected route: %q", got)
+	}
+	if got := attrs["prism.commands.command_count"].AsInt64(); got != 2 {
+		t.Fatalf("unexpected command count: %d", got)
+	}
+	if got := attrs["prism.commands.decode_ms"].AsFloat64(); got != 3 {
+		t.Fatalf("unexpected decode_ms: %v", got)
+	}
+	if got := spans.GetSpans(); len(got) != 1 || rec.TraceID() != got[0].SpanContext.TraceID() {
+		t.Fatalf("log record not correlated with the request span")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+	counts := map[string]uint64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok {
+				t.Fatalf("%s: unexpected data type %T", m.Name, m.Data)
+			}
+			for _, dp := range hist.DataPoints {
+				counts[m.Name] += dp.Count
+			}
+		}
+	}
+	if counts["prism.api.request.duration"] != 1 {
+		t.Fatalf("expected 1 request duration sample, got %d", counts["prism.api.request.duration"])
+	}
+	if counts["prism.api.request.stage.duration"] != 2 {
+		t.Fatalf("expected 2 stage duration samples, got %d", counts["prism.api.request.stage.duration"])
+	}
+}
+
+func TestGetSettingsLogsObservabilityEvent(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	store := &mockStore{settings: domain.Settings{TasksPerCategory: 3}}
+	req := httptest.NewRequest(http.MethodGet, settingsRoute, nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+
+	if err := getSettings(store, mockAuth{}, logger, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	entry := waitForLogEntry(t, hook, time.Second)
+	if got := entry.Data["event.name"]; got != settingsRequest.eventName {
+		t.Fatalf("unexpected event name: %v", got)
+	}
+	attrs, ok := entry.Data["attributes"].(map[string]any)
+	if !ok {
+		t.Fatalf("attributes not logged as map: %#v", entry.Data["attributes"])
+	}
+	if attrs["http.route"] != settingsRoute || attrs["http.status_code"] != http.StatusOK {
+		t.Fatalf("unexpected attributes: %#v", attrs)
+	}
+	if _, ok := attrs["prism.settings.total_ms"]; !ok {
+		t.Fatalf("expected prism.settings.total_ms, got %#v", attrs)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -11,20 +12,107 @@ import (
 
 	"github.com/bytedance/sonic"
 	log "github.com/sirupsen/logrus"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/labstack/echo/v4"
 
+	"auth"
 	"prism-api/domain"
 )
 
+const (
+	tasksRoute    = "/api/tasks"
+	settingsRoute = "/api/settings"
+	commandsRoute = "/api/commands"
+)
+
+// Option configures optional API behaviors.
+type Option func(*options)
+
+type options struct {
+	limiter       RateLimiter
+	limits        RateLimits
+	spill         CommandSpill
+	logProvider   otellog.LoggerProvider
+	meterProvider metric.MeterProvider
+	boards        BoardStore
+	tokens        TokenStore
+	audit         *AuditLog
+	history       TaskHistoryStore
+	snapshots     TaskSnapshotStore
+	undo          UndoStore
+	ranks         RankStore
+	rankLock      RebalanceLock
+	rankInterval  time.Duration
+	sequencer     Sequencer
+	clockNode     int
+}
+
+// WithRateLimits enforces per-user token-bucket limits on queries and commands.
+func WithRateLimits(limiter RateLimiter, limits RateLimits) Option {
+	return func(o *options) {
+		o.limiter = limiter
+		o.limits = limits
+	}
+}
+
 // Register wires up all API routes on the provided Echo instance.
-func Register(e *echo.Echo, store Storage, auth Authenticator, log *log.Logger) {
-	e.GET("/api/tasks", getTasks(store, auth, log))
-	e.GET("/api/settings", getSettings(store, auth))
-	e.POST("/api/commands", postCommands(store, auth))
+func Register(e *echo.Echo, store Storage, authn Authenticator, log *log.Logger, opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	limiter := newRateLimiter(o.limiter, o.limits, log)
+	boards := newBoardAccess(o.boards)
+	exporter, err := newOtelEventExporter(o.logProvider, o.meterProvider)
+	if err != nil {
+		log.WithError(err).Warn("event export disabled")
+	}
+	eventExport = exporter
+	commandSequencer = o.sequencer
+	setClockNode(o.clockNode)
+
+	e.Use(observeRequests)
+	e.Use(propagateTrace)
+	tasks := getTasks(store, authn, log, limiter, boards)
+	if o.snapshots != nil {
+		tasks = tasksAsOf(tasks, o.snapshots, authn, limiter, boards)
+	}
+	e.GET(tasksRoute, tasks)
+	e.GET(settingsRoute, getSettings(store, authn, log, limiter))
+	e.GET(boardsRoute, getBoards(authn, limiter, boards))
+	e.POST(commandsRoute, postCommands(store, authn, log, limiter, boards, o.audit))
+	if o.tokens != nil {
+		e.GET(tokensRoute, listTokens(o.tokens, authn, limiter))
+		e.POST(tokensRoute, createToken(o.tokens, authn, limiter))
+		e.DELETE(tokensRoute+"/:id", revokeToken(o.tokens, authn, limiter))
+	}
+	if o.audit != nil {
+		e.GET(auditRoute, getAudit(o.audit.store, authn, limiter))
+	}
+	if o.history != nil {
+		e.GET(taskHistoryRoute, getTaskHistory(o.history, authn, limiter, boards))
+	}
+	if o.undo != nil {
+		e.POST(undoRoute, undoCommand(store, o.undo, authn, log, limiter, boards, o.audit, false))
+		e.POST(redoRoute, undoCommand(store, o.undo, authn, log, limiter, boards, o.audit, true))
+	}
 	e.GET("/healthz", healthz(store))
 
 	initCommandSender(store, log)
+	startSpillDrainers(o.spill)
+	startRankRebalance(store, o.ranks, o.rankLock, o.rankInterval, log)
+}
+
+// RegisterInternal wires up the operator endpoints, Prometheus metrics and the
+// enqueue pool state, on an Echo instance the load balancer does not route to.
+func RegisterInternal(e *echo.Echo) {
+	e.GET(metricsPath, metricsHandler())
+	e.GET(poolStatsRoute, poolStats)
 }
 
 type tasksResponse struct {
@@ -39,7 +127,9 @@ func healthz(_ Storage) echo.HandlerFunc {
 	}
 }
 
-func getTasks(store Storage, auth Authenticator, logger *log.Logger) echo.HandlerFunc {
+// getTasks lists the caller's own tasks, or with ?boardId= the tasks of a shared
+// board the caller is a member of.
+func getTasks(store Storage, authn Authenticator, logger *log.Logger, limiter *rateLimiter, boards *boardAccess) echo.HandlerFunc {
 	return func(c echo.Context) (err error) {
 		ctx := c.Request().Context()
 		metrics, spanCtx := newTaskRequestMetrics(ctx, logger)
@@ -53,13 +143,34 @@ func getTasks(store Storage, auth Authenticator, logger *log.Logger) echo.Handle
 		}()
 
 		authStart := time.Now()
-		userID, authErr := auth.UserIDFromAuthHeader(c.Request().Header.Get("Authorization"))
+		principal, authErr := authn.Authenticate(c.Request().Header.Get("Authorization"))
 		metrics.ObserveAuth(time.Since(authStart))
 		if authErr != nil {
 			metrics.SetErrorStage("auth")
-			err = c.String(http.StatusUnauthorized, authErr.Error())
+			err = unauthenticated(c, authErr)
+			return err
+		}
+		if scopeErr := requireReadScope(principal); scopeErr != nil {
+			err = scopeRejected(c, metrics, scopeErr)
+			return err
+		}
+		userID := principal.UserID
+		if !limiter.allowQuery(c, userID) {
+			metrics.SetErrorStage("rate_limit")
+			err = rateLimited(c)
 			return err
 		}
+		partition := userID
+		if boardID := c.QueryParam("boardId"); boardID != "" {
+			authzStart := time.Now()
+			authzErr := boards.authorizeQuery(ctx, boardID, userID)
+			metrics.ObserveAuthorize(time.Since(authzStart))
+			if authzErr != nil {
+				err = boardAuthorizationFailed(c, metrics, authzErr)
+				return err
+			}
+			partition = boardID
+		}
 		pageToken := c.QueryParam("pageToken")
 		metrics.SetPageTokenProvided(pageToken != "")
 
@@ -76,7 +187,7 @@ func getTasks(store Storage, auth Authenticator, logger *log.Logger) echo.Handle
 		}
 
 		fetchStart := time.Now()
-		tasks, nextToken, fetchErr := store.FetchTasks(ctx, userID, pageToken, pageSize)
+		tasks, nextToken, fetchErr := store.FetchTasks(ctx, partition, pageToken, pageSize)
 		metrics.ObserveFetch(time.Since(fetchStart))
 		if fetchErr != nil {
 			var invalidTokenErr InvalidContinuationTokenError
@@ -106,70 +217,193 @@ func getTasks(store Storage, auth Authenticator, logger *log.Logger) echo.Handle
 	}
 }
 
-func getSettings(store Storage, auth Authenticator) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		ctx := c.Request().Context()
-		userID, err := auth.UserIDFromAuthHeader(c.Request().Header.Get("Authorization"))
-		if err != nil {
-			return c.String(http.StatusUnauthorized, err.Error())
+func getSettings(store Storage, authn Authenticator, logger *log.Logger, limiter *rateLimiter) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		metrics, ctx := newRequestMetrics(c.Request().Context(), settingsRequest, logger)
+		c.SetRequest(c.Request().WithContext(ctx))
+		defer func() {
+			metrics.Log(c.Response().Status, err)
+		}()
+
+		authStart := time.Now()
+		principal, authErr := authn.Authenticate(c.Request().Header.Get("Authorization"))
+		metrics.ObserveAuth(time.Since(authStart))
+		if authErr != nil {
+			metrics.SetErrorStage("auth")
+			return unauthenticated(c, authErr)
+		}
+		if scopeErr := requireReadScope(principal); scopeErr != nil {
+			return scopeRejected(c, metrics, scopeErr)
+		}
+		userID := principal.UserID
+		if !limiter.allowQuery(c, userID) {
+			metrics.SetErrorStage("rate_limit")
+			return rateLimited(c)
+		}
+
+		fetchStart := time.Now()
+		settings, fetchErr := store.FetchSettings(ctx, userID)
+		metrics.ObserveFetch(time.Since(fetchStart))
+		if fetchErr != nil {
+			metrics.SetErrorStage("storage")
+			c.Logger().Error(fetchErr)
+			return c.String(http.StatusInternalServerError, fetchErr.Error())
 		}
-		settings, err := store.FetchSettings(ctx, userID)
+
+		encodeStart := time.Now()
+		err = c.JSON(http.StatusOK, settings)
+		metrics.ObserveEncode(time.Since(encodeStart))
 		if err != nil {
-			c.Logger().Error(err)
-			return c.String(http.StatusInternalServerError, err.Error())
+			metrics.SetErrorStage("encode_response")
 		}
-		return c.JSON(http.StatusOK, settings)
+		return err
 	}
 }
 
-func postCommands(store Storage, auth Authenticator) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		userID, err := auth.UserIDFromAuthHeader(c.Request().Header.Get("Authorization"))
-		if err != nil {
-			return c.String(http.StatusUnauthorized, err.Error())
+func postCommands(store Storage, authn Authenticator, logger *log.Logger, limiter *rateLimiter, boards *boardAccess, audit *AuditLog) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		metrics, ctx := newRequestMetrics(c.Request().Context(), commandsRequest, logger)
+		c.SetRequest(c.Request().WithContext(ctx))
+		defer func() {
+			metrics.Log(c.Response().Status, err)
+		}()
+
+		authStart := time.Now()
+		principal, authErr := authn.Authenticate(c.Request().Header.Get("Authorization"))
+		metrics.ObserveAuth(time.Since(authStart))
+		if authErr != nil {
+			metrics.SetErrorStage("auth")
+			return unauthenticated(c, authErr)
 		}
+		userID := principal.UserID
 
+		decodeStart := time.Now()
 		lr := io.LimitReader(c.Request().Body, postCommandMaxSize)
 		dec := sonic.ConfigFastest.NewDecoder(lr)
 		dec.DisallowUnknownFields()
 
 		cmds := make([]domain.Command, 0, 4)
-		if err := dec.Decode(&cmds); err != nil {
+		decodeErr := dec.Decode(&cmds)
+		metrics.ObserveDecode(time.Since(decodeStart))
+		if decodeErr != nil {
+			metrics.SetErrorStage("decode")
 			return c.String(http.StatusBadRequest, "invalid body")
 		}
+		metrics.SetCommandCount(len(cmds))
 
-		keys := finalizeCommands(cmds)
-
-		job := enqueueJob{
-			userID: userID,
-			cmds:   cmds,
+		validateStart := time.Now()
+		validateErr := validateCommands(cmds)
+		metrics.ObserveValidate(time.Since(validateStart))
+		if validateErr != nil {
+			metrics.SetErrorStage("validate")
+			return c.String(http.StatusBadRequest, validateErr.Error())
 		}
-
-		if tryEnqueueJob(job) {
-			return respondJSON(c, http.StatusAccepted, postCommandResponse{IdempotencyKeys: keys})
+		if scopeErr := authorizeCommandScopes(principal, cmds); scopeErr != nil {
+			return scopeRejected(c, metrics, scopeErr)
 		}
-
-		if globalLog != nil {
-			globalLog.Warn("enqueue buffer saturated; processing inline")
+		if categoryErr := validateSettingsCategories(ctx, store, userID, cmds); categoryErr != nil {
+			if errors.Is(categoryErr, errSettingsUnavailable) {
+				metrics.SetErrorStage("storage")
+				c.Logger().Error(categoryErr)
+				return c.String(http.StatusInternalServerError, categoryErr.Error())
+			}
+			metrics.SetErrorStage("validate")
+			return c.String(http.StatusBadRequest, categoryErr.Error())
 		}
-
-		enqueueCtx := bg
-		var cancel context.CancelFunc
-		if enqueueTimeout > 0 {
-			enqueueCtx, cancel = context.WithTimeout(bg, enqueueTimeout)
+		if !limiter.allowCommands(c, userID, cmds) {
+			metrics.SetErrorStage("rate_limit")
+			return rateLimited(c)
 		}
-		enqueueErr := store.EnqueueCommands(enqueueCtx, userID, job.cmds)
-		if cancel != nil {
-			cancel()
+		authzStart := time.Now()
+		authzErr := boards.authorizeCommands(ctx, userID, cmds)
+		metrics.ObserveAuthorize(time.Since(authzStart))
+		if authzErr != nil {
+			return boardAuthorizationFailed(c, metrics, authzErr)
 		}
 
-		if enqueueErr != nil {
-			c.Logger().Errorf("enqueue inline failed: %v", enqueueErr)
-			return c.String(http.StatusInternalServerError, "failed to enqueue commands")
-		}
+		return submitCommands(c, store, metrics, principal, cmds, audit)
+	}
+}
+
+// submitCommands stamps and sequences accepted commands and hands them to the
+// worker pool, to the overload policy when the pool is full, or enqueues them
+// inline. POST /api/commands and undo both submit through it.
+func submitCommands(c echo.Context, store Storage, metrics *requestMetrics, principal auth.Principal, cmds []domain.Command, audit *AuditLog) error {
+	ctx := c.Request().Context()
+	userID := principal.UserID
+	keys := finalizeCommands(cmds)
+	if seqErr := sequenceCommands(ctx, userID, cmds); seqErr != nil {
+		metrics.SetErrorStage("sequence")
+		c.Logger().Errorf("sequence commands failed: %v", seqErr)
+		return c.String(http.StatusServiceUnavailable, "failed to sequence commands")
+	}
 
+	job := enqueueJob{
+		userID:  userID,
+		cmds:    cmds,
+		spanCtx: trace.SpanContextFromContext(ctx),
+	}
+
+	metrics.SetQueueDepth(len(jobs))
+	handoffStart := time.Now()
+	handedOff := tryEnqueueJob(job)
+	metrics.ObserveHandoff(time.Since(handoffStart))
+	if handedOff {
+		metrics.SetEnqueuePath("handoff")
+		audit.record(c, principal, cmds)
 		return respondJSON(c, http.StatusAccepted, postCommandResponse{IdempotencyKeys: keys})
 	}
+	if handled, err := handleOverload(c, job, keys); handled {
+		if c.Response().Status == http.StatusServiceUnavailable {
+			metrics.SetEnqueuePath(overloadShed)
+		} else {
+			metrics.SetEnqueuePath(overloadSpill)
+			audit.record(c, principal, cmds)
+		}
+		return err
+	}
+	metrics.SetEnqueuePath("inline")
+
+	if globalLog != nil {
+		globalLog.Warn("enqueue buffer saturated; processing inline")
+	}
+
+	enqueueStart := time.Now()
+	enqueueCtx := job.context()
+	var cancel context.CancelFunc
+	if enqueueTimeout > 0 {
+		enqueueCtx, cancel = context.WithTimeout(enqueueCtx, enqueueTimeout)
+	}
+	enqueueErr := store.EnqueueCommands(enqueueCtx, userID, job.cmds)
+	if cancel != nil {
+		cancel()
+	}
+	metrics.ObserveEnqueue(time.Since(enqueueStart))
+
+	if enqueueErr != nil {
+		metrics.SetErrorStage("enqueue")
+		c.Logger().Errorf("enqueue inline failed: %v", enqueueErr)
+		return c.String(http.StatusInternalServerError, "failed to enqueue commands")
+	}
+
+	audit.record(c, principal, cmds)
+	return respondJSON(c, http.StatusAccepted, postCommandResponse{IdempotencyKeys: keys})
+}
+
+// validateCommands rejects commands the domain service cannot route.
+func validateCommands(cmds []domain.Command) error {
+	for i := range cmds {
+		if cmds[i].EntityType == "" || cmds[i].Type == "" {
+			return fmt.Errorf("command %d: entityType and type are required", i)
+		}
+		if err := validateBoardCommand(&cmds[i]); err != nil {
+			return fmt.Errorf("command %d: %w", i, err)
+		}
+		if err := validateSettingsCommand(&cmds[i]); err != nil {
+			return fmt.Errorf("command %d: %w", i, err)
+		}
+	}
+	return nil
 }
 
 func finalizeCommands(cmds []domain.Command) []string {
@@ -180,7 +414,7 @@ func finalizeCommands(cmds []domain.Command) []string {
 
 	start := nextTimestampRange(len(cmds))
 	for i := range cmds {
-		ts := start + int64(i)
+		ts := start + int64(i)*clockStep
 		keys[i] = applyCommandMetadata(&cmds[i], ts)
 	}
 
@@ -193,6 +427,7 @@ func applyCommandMetadata(cmd *domain.Command, ts int64) string {
 	}
 	cmd.ID = cmd.IdempotencyKey
 	cmd.Timestamp = ts
+	cmd.Sequence = 0
 	return cmd.IdempotencyKey
 }
 
@@ -26,7 +26,7 @@ func BenchmarkPostCommands(b *testing.B) {
 
 			store := noopStore{}
 			initCommandSender(store, log.New())
-			handler := postCommands(store, mockAuth{})
+			handler := postCommands(store, mockAuth{}, nil, nil, nil, nil)
 			body := buildCommandPayload(payload.commands)
 
 			runPostCommandsBenchmark(b, handler, body)
@@ -37,7 +37,7 @@ func BenchmarkPostCommands(b *testing.B) {
 			defer resetCommandSenderForTests()
 
 			store := noopStore{}
-			handler := postCommands(store, mockAuth{})
+			handler := postCommands(store, mockAuth{}, nil, nil, nil, nil)
 			body := buildCommandPayload(payload.commands)
 
 			runPostCommandsBenchmark(b, handler, body)
@@ -16,16 +16,19 @@ import (
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 
+	"auth"
 	"prism-api/domain"
 )
 
 type mockStore struct {
-	tasks     []domain.Task
-	settings  domain.Settings
-	nextToken string
-	err       error
-	lastToken string
-	lastLimit int
+	tasks       []domain.Task
+	settings    domain.Settings
+	settingsErr error
+	nextToken   string
+	err         error
+	lastToken   string
+	lastLimit   int
+	lastOwner   string
 
 	mu   sync.Mutex
 	cmds []domain.Command
@@ -34,11 +37,12 @@ type mockStore struct {
 func (m *mockStore) FetchTasks(ctx context.Context, userID, token string, limit int) ([]domain.Task, string, error) {
 	m.lastToken = token
 	m.lastLimit = limit
+	m.lastOwner = userID
 	return m.tasks, m.nextToken, m.err
 }
 
 func (m *mockStore) FetchSettings(ctx context.Context, userID string) (domain.Settings, error) {
-	return m.settings, nil
+	return m.settings, m.settingsErr
 }
 
 func (m *mockStore) EnqueueCommands(ctx context.Context, userID string, cmds []domain.Command) error {
@@ -58,7 +62,9 @@ func (m *mockStore) Commands() []domain.Command {
 
 type mockAuth struct{}
 
-func (mockAuth) UserIDFromAuthHeader(string) (string, error) { return "user", nil }
+func (mockAuth) Authenticate(string) (auth.Principal, error) {
+	return auth.Principal{UserID: "user", Unrestricted: true}, nil
+}
 
 type noopStore struct{}
 
@@ -95,8 +101,8 @@ func TestFinalizeCommandsSequentialTimestamps(t *testing.T) {
 
 	firstTS := cmds[0].Timestamp
 	secondTS := cmds[1].Timestamp
-	if secondTS-firstTS != 1 {
-		t.Fatalf("expected timestamps to increment by 1, got first=%d second=%d", firstTS, secondTS)
+	if secondTS-firstTS != clockStep {
+		t.Fatalf("expected timestamps to advance by one counter step, got first=%d second=%d", firstTS, secondTS)
 	}
 
 	expectedKey := strconv.FormatInt(firstTS, 36)
@@ -119,7 +125,7 @@ func TestGetTasks(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	if err := getTasks(store, mockAuth{}, log.New())(c); err != nil {
+	if err := getTasks(store, mockAuth{}, log.New(), nil, nil)(c); err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 	if rec.Code != http.StatusOK {
@@ -151,7 +157,7 @@ func TestGetTasksPageSizeProvided(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	if err := getTasks(store, mockAuth{}, log.New())(c); err != nil {
+	if err := getTasks(store, mockAuth{}, log.New(), nil, nil)(c); err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 	if rec.Code != http.StatusOK {
@@ -177,7 +183,7 @@ func TestGetTasksInvalidPageSize(t *testing.T) {
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
-			if err := getTasks(store, mockAuth{}, log.New())(c); err != nil {
+			if err := getTasks(store, mockAuth{}, log.New(), nil, nil)(c); err != nil {
 				t.Fatalf("handler returned error: %v", err)
 			}
 			if rec.Code != http.StatusBadRequest {
@@ -203,7 +209,7 @@ func TestGetTasksInvalidToken(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	if err := getTasks(store, mockAuth{}, log.New())(c); err != nil {
+	if err := getTasks(store, mockAuth{}, log.New(), nil, nil)(c); err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 	if rec.Code != http.StatusBadRequest {
@@ -219,7 +225,7 @@ func TestGetSettings(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	if err := getSettings(store, mockAuth{})(c); err != nil {
+	if err := getSettings(store, mockAuth{}, nil, nil)(c); err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 	if rec.Code != http.StatusOK {
@@ -256,7 +262,7 @@ func TestPostCommandsEnqueuesCommandsAndReturnsKeys(t *testing.T) {
 	e := echo.New()
 	store := &mockStore{}
 	initCommandSender(store, log.New())
-	handler := postCommands(store, mockAuth{})
+	handler := postCommands(store, mockAuth{}, nil, nil, nil, nil)
 
 	body := `[{"entityType":"task","type":"create-task"},{"idempotencyKey":"known","entityType":"task","type":"update-task"}]`
 	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(body))
@@ -303,7 +309,7 @@ func TestPostCommandsInlineFallbackSuccess(t *testing.T) {
 
 	e := echo.New()
 	store := &mockStore{}
-	handler := postCommands(store, mockAuth{})
+	handler := postCommands(store, mockAuth{}, nil, nil, nil, nil)
 
 	body := `[{"entityType":"task","type":"create-task"}]`
 	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(body))
@@ -350,7 +356,7 @@ func TestPostCommandsInlineFailure(t *testing.T) {
 
 	e := echo.New()
 	store := &failingStore{}
-	handler := postCommands(store, mockAuth{})
+	handler := postCommands(store, mockAuth{}, nil, nil, nil, nil)
 
 	body := `[{"entityType":"task","type":"create-task"}]`
 	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(body))
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"prism-api/domain"
+)
+
+const taskHistoryRoute = tasksRoute + "/:id/history"
+
+const (
+	defaultHistoryPage = 50
+	maxHistoryPage     = 200
+)
+
+// TaskHistoryStore reads the task event store.
+type TaskHistoryStore interface {
+	// TaskEvents returns the task's events sorted for replay.
+	TaskEvents(ctx context.Context, taskID string) ([]domain.TaskEvent, error)
+}
+
+// WithTaskHistory serves the change history of tasks from store.
+func WithTaskHistory(store TaskHistoryStore) Option {
+	return func(o *options) {
+		o.history = store
+	}
+}
+
+var errInvalidHistoryToken = errors.New("invalid page token")
+
+type taskHistoryResponse struct {
+	TaskID        string                    `json:"taskId"`
+	Events        []domain.TaskHistoryEntry `json:"events"`
+	NextPageToken string                    `json:"nextPageToken,omitempty"`
+}
+
+// historyCursor points after the last event of a page. It names the event's
+// place in replay order, its sequence, timestamp and ID, rather than an
+// offset so events stored late cannot shift later pages.
+type historyCursor struct {
+	sequence  int64
+	timestamp int64
+	eventID   string
+}
+
+func (c historyCursor) before(e domain.TaskHistoryEntry) bool {
+	if e.Sequence != c.sequence {
+		return e.Sequence > c.sequence
+	}
+	if e.Timestamp != c.timestamp {
+		return e.Timestamp > c.timestamp
+	}
+	return e.EventID > c.eventID
+}
+
+func encodeHistoryCursor(e domain.TaskHistoryEntry) string {
+	cursor := strconv.FormatInt(e.Sequence, 10) + "." + strconv.FormatInt(e.Timestamp, 10) + "." + e.EventID
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeHistoryCursor(token string) (historyCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return historyCursor{}, errInvalidHistoryToken
+	}
+	parts := strings.SplitN(string(data), ".", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return historyCursor{}, errInvalidHistoryToken
+	}
+	seq, seqErr := strconv.ParseInt(parts[0], 10, 64)
+	ts, tsErr := strconv.ParseInt(parts[1], 10, 64)
+	if seqErr != nil || tsErr != nil {
+		return historyCursor{}, errInvalidHistoryToken
+	}
+	return historyCursor{sequence: seq, timestamp: ts, eventID: parts[2]}, nil
+}
+
+// pageHistory returns up to size entries following the cursor and the token
+// for the next page. The entries are in replay order, which the cursor
+// compares by.
+func pageHistory(history []domain.TaskHistoryEntry, token string, size int) ([]domain.TaskHistoryEntry, string, error) {
+	start := 0
+	if token != "" {
+		cursor, err := decodeHistoryCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		start = len(history)
+		for i, e := range history {
+			if cursor.before(e) {
+				start = i
+				break
+			}
+		}
+	}
+	end := start + size
+	if end >= len(history) {
+		return history[start:], "", nil
+	}
+	return history[start:end], encodeHistoryCursor(history[end-1]), nil
+}
+
+// getTaskHistory lists a task's events with the fields each one changed.
+// Personal tasks are visible to the user who created them and board tasks to
+// the board's members; everyone else gets 404 so task IDs cannot be probed.
+func getTaskHistory(store TaskHistoryStore, authn Authenticator, limiter *rateLimiter, boards *boardAccess) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, err := authn.Authenticate(c.Request().Header.Get("Authorization"))
+		if err != nil {
+			return unauthenticated(c, err)
+		}
+		if err := requireReadScope(principal); err != nil {
+			return c.String(http.StatusForbidden, err.Error())
+		}
+		userID := principal.UserID
+		if !limiter.allowQuery(c, userID) {
+			return rateLimited(c)
+		}
+		pageSize := defaultHistoryPage
+		if v := strings.TrimSpace(c.QueryParam("pageSize")); v != "" {
+			pageSize, err = strconv.Atoi(v)
+			if err != nil || pageSize <= 0 {
+				return c.String(http.StatusBadRequest, "invalid page size")
+			}
+			if pageSize > maxHistoryPage {
+				pageSize = maxHistoryPage
+			}
+		}
+
+		ctx := c.Request().Context()
+		taskID := c.Param("id")
+		events, err := store.TaskEvents(ctx, taskID)
+		if err != nil {
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to read task history")
+		}
+		if len(events) == 0 || events[0].Type != domain.TaskCreated {
+			return c.String(http.StatusNotFound, "task not found")
+		}
+		if created := events[0]; created.BoardID != "" {
+			if err := boards.authorizeQuery(ctx, created.BoardID, userID); err != nil {
+				if errors.Is(err, errBoardForbidden) {
+					return c.String(http.StatusNotFound, "task not found")
+				}
+				c.Logger().Error(err)
+				return c.String(http.StatusInternalServerError, "failed to check board access")
+			}
+		} else if created.UserID != userID {
+			return c.String(http.StatusNotFound, "task not found")
+		}
+
+		page, next, err := pageHistory(domain.TaskHistory(taskID, events), c.QueryParam("pageToken"), pageSize)
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		return respondJSON(c, http.StatusOK, taskHistoryResponse{TaskID: taskID, Events: page, NextPageToken: next})
+	}
+}
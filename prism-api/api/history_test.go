@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+
+	"prism-api/domain"
+)
+
+type stubTaskEvents map[string][]domain.TaskEvent
+
+func (s stubTaskEvents) TaskEvents(_ context.Context, taskID string) ([]domain.TaskEvent, error) {
+	return s[taskID], nil
+}
+
+func serveTaskHistory(t *testing.T, store TaskHistoryStore, boards *boardAccess, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	e.GET(taskHistoryRoute, getTaskHistory(store, mockAuth{}, nil, boards))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestGetTaskHistoryPagesOwnTask(t *testing.T) {
+	store := stubTaskEvents{"t1": {
+		{ID: "e1", TaskID: "t1", Type: domain.TaskCreated, Timestamp: 1, UserID: "user", Data: []byte(`{"title":"a"}`)},
+		{ID: "e2", TaskID: "t1", Type: domain.TaskUpdated, Timestamp: 2, UserID: "user", Data: []byte(`{"title":"b"}`)},
+		{ID: "e3", TaskID: "t1", Type: domain.TaskCompleted, Timestamp: 3, UserID: "user"},
+	}}
+
+	var ids []string
+	target := tasksRoute + "/t1/history?pageSize=2"
+	for pages := 0; target != ""; pages++ {
+		if pages > 2 {
+			t.Fatal("paging did not terminate")
+		}
+		rec := serveTaskHistory(t, store, nil, target)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp taskHistoryResponse
+		if err := sonic.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range resp.Events {
+			ids = append(ids, e.EventID)
+		}
+		target = ""
+		if resp.NextPageToken != "" {
+			target = tasksRoute + "/t1/history?pageSize=2&pageToken=" + resp.NextPageToken
+		}
+	}
+	if len(ids) != 3 || ids[0] != "e1" || ids[2] != "e3" {
+		t.Fatalf("unexpected events %v", ids)
+	}
+
+	if rec := serveTaskHistory(t, store, nil, tasksRoute+"/t1/history?pageToken=bm90LWEtY3Vyc29y"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid token, got %d", rec.Code)
+	}
+}
+
+func TestPageHistoryFollowsReplayOrder(t *testing.T) {
+	// Sequenced events replay in sequence order even when their timestamps,
+	// stamped by different nodes, run the other way.
+	history := []domain.TaskHistoryEntry{
+		{EventID: "a", Timestamp: 100, Sequence: 1},
+		{EventID: "b", Timestamp: 300, Sequence: 2},
+		{EventID: "c", Timestamp: 200, Sequence: 3},
+		{EventID: "d", Timestamp: 400, Sequence: 4},
+	}
+	var ids []string
+	token := ""
+	for pages := 0; pages == 0 || token != ""; pages++ {
+		if pages > 2 {
+			t.Fatal("paging did not terminate")
+		}
+		page, next, err := pageHistory(history, token, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page {
+			ids = append(ids, e.EventID)
+		}
+		token = next
+	}
+	if len(ids) != 4 || ids[0] != "a" || ids[1] != "b" || ids[2] != "c" || ids[3] != "d" {
+		t.Fatalf("expected every event once in replay order, got %v", ids)
+	}
+}
+
+func TestGetTaskHistoryHidesOtherUsersTasks(t *testing.T) {
+	store := stubTaskEvents{
+		"mine":   {{ID: "e1", Type: domain.TaskCreated, UserID: "user"}},
+		"theirs": {{ID: "e1", Type: domain.TaskCreated, UserID: "someone-else"}},
+		"shared": {{ID: "e1", Type: domain.TaskCreated, UserID: "someone-else", BoardID: "b1"}},
+		"secret": {{ID: "e1", Type: domain.TaskCreated, UserID: "someone-else", BoardID: "b2"}},
+	}
+	boards := newBoardAccess(stubBoards{"b1": domain.BoardRoleViewer})
+	for id, status := range map[string]int{
+		"mine":    http.StatusOK,
+		"theirs":  http.StatusNotFound,
+		"shared":  http.StatusOK,
+		"secret":  http.StatusNotFound,
+		"missing": http.StatusNotFound,
+	} {
+		if rec := serveTaskHistory(t, store, boards, tasksRoute+"/"+id+"/history"); rec.Code != status {
+			t.Fatalf("%s: expected %d, got %d", id, status, rec.Code)
+		}
+	}
+}
@@ -21,62 +21,165 @@ const (
 	tasksEventBody   = "tasks request completed"
 )
 
-type taskRequestMetrics struct {
-	logger            *log.Logger
-	span              trace.Span
-	spanContext       trace.SpanContext
-	start             time.Time
-	authDuration      time.Duration
-	fetchDuration     time.Duration
-	encodeDuration    time.Duration
-	pageTokenProvided bool
-	tasksReturned     int
-	hasNextPage       bool
-	errorStage        string
-}
-
-type taskLogRecord struct {
-	status            int
-	total             time.Duration
-	auth              time.Duration
-	fetch             time.Duration
-	encode            time.Duration
-	requestStartNS    int64
-	tasksReturned     int
-	pageTokenProvided bool
-	hasNextPage       bool
-	errorStage        string
-	errorMessage      string
-}
-
-type taskLogEvent struct {
+// requestKind describes how the requests of one route are traced and reported.
+// Attributes specific to the route are namespaced with attrPrefix.
+type requestKind struct {
+	route      string
+	method     string
+	tracer     string
+	spanName   string
+	spanKind   trace.SpanKind
+	eventName  string
+	eventBody  string
+	attrPrefix string
+}
+
+var (
+	tasksRequest = &requestKind{
+		route:      tasksRoute,
+		method:     http.MethodGet,
+		tracer:     "prism-api/api/tasks",
+		spanName:   tasksSpanName,
+		spanKind:   trace.SpanKindServer,
+		eventName:  tasksEventName,
+		eventBody:  tasksEventBody,
+		attrPrefix: "prism.tasks",
+	}
+	settingsRequest = &requestKind{
+		route:      settingsRoute,
+		method:     http.MethodGet,
+		tracer:     "prism-api/api/settings",
+		spanName:   "GET /api/settings",
+		spanKind:   trace.SpanKindServer,
+		eventName:  "prism.api.settings.request",
+		eventBody:  "settings request completed",
+		attrPrefix: "prism.settings",
+	}
+	commandsRequest = &requestKind{
+		route:      commandsRoute,
+		method:     http.MethodPost,
+		tracer:     "prism-api/api/commands",
+		spanName:   commandsSpanName,
+		spanKind:   trace.SpanKindServer,
+		eventName:  "prism.api.commands.request",
+		eventBody:  "commands request completed",
+		attrPrefix: "prism.commands",
+	}
+	undoRequest = &requestKind{
+		route:      undoRoute,
+		method:     http.MethodPost,
+		tracer:     "prism-api/api/commands",
+		spanName:   "POST " + undoRoute,
+		spanKind:   trace.SpanKindServer,
+		eventName:  "prism.api.undo.request",
+		eventBody:  "undo request completed",
+		attrPrefix: "prism.undo",
+	}
+	redoRequest = &requestKind{
+		route:      redoRoute,
+		method:     http.MethodPost,
+		tracer:     "prism-api/api/commands",
+		spanName:   "POST " + redoRoute,
+		spanKind:   trace.SpanKindServer,
+		eventName:  "prism.api.redo.request",
+		eventBody:  "redo request completed",
+		attrPrefix: "prism.redo",
+	}
+	// commandsEnqueue reports a command job handed off to the worker pool, from the
+	// handoff until its commands are on the queue.
+	commandsEnqueue = &requestKind{
+		route:      commandsRoute,
+		tracer:     "prism-api/api/commands",
+		spanName:   "enqueue job",
+		spanKind:   trace.SpanKindInternal,
+		eventName:  "prism.api.commands.enqueue",
+		eventBody:  "commands enqueued",
+		attrPrefix: "prism.enqueue",
+	}
+)
+
+// stageDuration is the time spent in one named stage of a request, reported as <prefix>.<name>_ms.
+type stageDuration struct {
+	name     string
+	duration time.Duration
+}
+
+// requestMetrics collects the stage timings and outcome of a single request and
+// reports them as a span, an observability event and, when configured, OTel metrics.
+type requestMetrics struct {
+	kind        *requestKind
+	logger      *log.Logger
+	span        trace.Span
+	spanContext trace.SpanContext
+	start       time.Time
+	stages      []stageDuration
+	attrs       []attribute.KeyValue
+	errorStage  string
+}
+
+type requestLogRecord struct {
+	kind           *requestKind
+	status         int
+	total          time.Duration
+	stages         []stageDuration
+	attrs          []attribute.KeyValue
+	requestStartNS int64
+	errorStage     string
+	errorMessage   string
+}
+
+type requestLogEvent struct {
 	logger         *log.Logger
-	record         taskLogRecord
+	record         requestLogRecord
 	eventTime      time.Time
 	severityText   string
 	severityNumber int
-	traceID        string
-	spanID         string
+	spanContext    trace.SpanContext
 }
 
 var (
-	taskLogQueueOnce sync.Once
-	taskLogQueue     chan taskLogEvent
+	requestLogQueueOnce sync.Once
+	requestLogQueue     chan requestLogEvent
 )
 
-func newTaskRequestMetrics(ctx context.Context, logger *log.Logger) (*taskRequestMetrics, context.Context) {
+func newRequestMetrics(ctx context.Context, kind *requestKind, logger *log.Logger) (*requestMetrics, context.Context) {
+	return startRequestMetrics(ctx, kind, logger, time.Now())
+}
+
+func newTaskRequestMetrics(ctx context.Context, logger *log.Logger) (*requestMetrics, context.Context) {
+	m, spanCtx := newRequestMetrics(ctx, tasksRequest, logger)
+	m.SetPageTokenProvided(false)
+	m.SetTasksReturned(0)
+	m.SetHasNextPage(false)
+	return m, spanCtx
+}
+
+// newEnqueueJobMetrics starts reporting a job picked up by a worker. The span
+// starts at the handoff so that it covers the time the job waited in the buffer.
+func newEnqueueJobMetrics(j enqueueJob, logger *log.Logger) (*requestMetrics, context.Context) {
+	start := j.enqueuedAt
+	if start.IsZero() {
+		start = time.Now()
+	}
+	m, ctx := startRequestMetrics(j.context(), commandsEnqueue, logger, start)
+	m.observeStage("queue_wait", time.Since(start))
+	m.SetCommandCount(len(j.cmds))
+	return m, ctx
+}
+
+func startRequestMetrics(ctx context.Context, kind *requestKind, logger *log.Logger, start time.Time) (*requestMetrics, context.Context) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	start := time.Now()
-	tracer := otel.Tracer("prism-api/api/tasks")
-	spanCtx, span := tracer.Start(ctx, tasksSpanName, trace.WithSpanKind(trace.SpanKindServer), trace.WithTimestamp(start))
-	span.SetAttributes(
-		attribute.String("http.route", "/api/tasks"),
-		attribute.String("http.method", http.MethodGet),
-	)
+	tracer := otel.Tracer(kind.tracer)
+	spanCtx, span := tracer.Start(ctx, kind.spanName, trace.WithSpanKind(kind.spanKind), trace.WithTimestamp(start))
+	span.SetAttributes(attribute.String("http.route", kind.route))
+	if kind.method != "" {
+		span.SetAttributes(attribute.String("http.method", kind.method))
+	}
 
-	return &taskRequestMetrics{
+	return &requestMetrics{
+		kind:        kind,
 		logger:      logger,
 		span:        span,
 		spanContext: span.SpanContext(),
@@ -84,69 +187,122 @@ func newTaskRequestMetrics(ctx context.Context, logger *log.Logger) (*taskReques
 	}, spanCtx
 }
 
-func (m *taskRequestMetrics) ObserveAuth(duration time.Duration) {
+// observeStage records the duration of a request stage. A stage observed twice keeps the last value.
+func (m *requestMetrics) observeStage(name string, duration time.Duration) {
 	if duration <= 0 {
 		return
 	}
-	m.authDuration = duration
+	for i := range m.stages {
+		if m.stages[i].name == name {
+			m.stages[i].duration = duration
+			return
+		}
+	}
+	m.stages = append(m.stages, stageDuration{name: name, duration: duration})
 }
 
-func (m *taskRequestMetrics) ObserveFetch(duration time.Duration) {
-	if duration <= 0 {
-		return
+// setAttr sets a route specific attribute, replacing an earlier value of the same name.
+func (m *requestMetrics) setAttr(kv attribute.KeyValue) {
+	kv.Key = attribute.Key(m.kind.attrPrefix + "." + string(kv.Key))
+	for i := range m.attrs {
+		if m.attrs[i].Key == kv.Key {
+			m.attrs[i] = kv
+			return
+		}
 	}
-	m.fetchDuration = duration
+	m.attrs = append(m.attrs, kv)
 }
 
-func (m *taskRequestMetrics) ObserveEncode(duration time.Duration) {
-	if duration <= 0 {
-		return
-	}
-	m.encodeDuration = duration
+func (m *requestMetrics) ObserveAuth(duration time.Duration) {
+	m.observeStage("auth", duration)
+}
+
+func (m *requestMetrics) ObserveAuthorize(duration time.Duration) {
+	m.observeStage("authorize", duration)
+}
+
+func (m *requestMetrics) ObserveFetch(duration time.Duration) {
+	m.observeStage("fetch", duration)
+}
+
+func (m *requestMetrics) ObserveEncode(duration time.Duration) {
+	m.observeStage("encode", duration)
+}
+
+func (m *requestMetrics) ObserveDecode(duration time.Duration) {
+	m.observeStage("decode", duration)
+}
+
+func (m *requestMetrics) ObserveValidate(duration time.Duration) {
+	m.observeStage("validate", duration)
+}
+
+// ObserveHandoff records the time spent handing a job to the worker pool.
+func (m *requestMetrics) ObserveHandoff(duration time.Duration) {
+	m.observeStage("handoff", duration)
 }
 
-func (m *taskRequestMetrics) SetPageTokenProvided(provided bool) {
-	m.pageTokenProvided = provided
+func (m *requestMetrics) ObserveEnqueue(duration time.Duration) {
+	m.observeStage("enqueue", duration)
 }
 
-func (m *taskRequestMetrics) SetTasksReturned(count int) {
+func (m *requestMetrics) SetPageTokenProvided(provided bool) {
+	m.setAttr(attribute.Bool("page_token_provided", provided))
+}
+
+func (m *requestMetrics) SetTasksReturned(count int) {
 	if count < 0 {
 		count = 0
 	}
-	m.tasksReturned = count
+	m.setAttr(attribute.Int("tasks_returned", count))
+}
+
+func (m *requestMetrics) SetHasNextPage(hasNext bool) {
+	m.setAttr(attribute.Bool("has_next_page", hasNext))
 }
 
-func (m *taskRequestMetrics) SetHasNextPage(hasNext bool) {
-	m.hasNextPage = hasNext
+func (m *requestMetrics) SetCommandCount(count int) {
+	m.setAttr(attribute.Int("command_count", count))
 }
 
-func (m *taskRequestMetrics) SetErrorStage(stage string) {
+// SetEnqueuePath records how the commands of a request were enqueued: handoff,
+// inline, spill or shed.
+func (m *requestMetrics) SetEnqueuePath(path string) {
+	m.setAttr(attribute.String("enqueue_path", path))
+}
+
+// SetQueueDepth records the number of jobs waiting in the worker pool buffer.
+func (m *requestMetrics) SetQueueDepth(depth int) {
+	m.setAttr(attribute.Int("queue_depth", depth))
+}
+
+func (m *requestMetrics) SetErrorStage(stage string) {
 	if stage == "" {
 		return
 	}
 	m.errorStage = stage
 }
 
-func (m *taskRequestMetrics) Log(status int, err error) {
+func (m *requestMetrics) Log(status int, err error) {
 	if m == nil {
 		return
 	}
 
-	record := taskLogRecord{
-		status:            status,
-		total:             time.Since(m.start),
-		auth:              m.authDuration,
-		fetch:             m.fetchDuration,
-		encode:            m.encodeDuration,
-		requestStartNS:    m.start.UnixNano(),
-		tasksReturned:     m.tasksReturned,
-		pageTokenProvided: m.pageTokenProvided,
-		hasNextPage:       m.hasNextPage,
-		errorStage:        m.errorStage,
+	record := requestLogRecord{
+		kind:           m.kind,
+		status:         status,
+		total:          time.Since(m.start),
+		stages:         m.stages,
+		attrs:          m.attrs,
+		requestStartNS: m.start.UnixNano(),
+		errorStage:     m.errorStage,
 	}
 	if err != nil {
 		record.errorMessage = err.Error()
 	}
+	if record.errorStage != "" {
+		countError(m.kind.route, record.errorStage)
+	}
 
 	eventTime := time.Now()
 	severityText, severityNumber := severityForStatus(status, err)
@@ -155,9 +311,9 @@ func (m *taskRequestMetrics) Log(status int, err error) {
 		spanContext := m.span.SpanContext()
 		kv := record.keyValues()
 		eventKV := append(kv,
-			attribute.String("event.name", tasksEventName),
+			attribute.String("event.name", m.kind.eventName),
 			attribute.String("event.domain", tasksEventDomain),
-			attribute.String("body", tasksEventBody),
+			attribute.String("body", m.kind.eventBody),
 			attribute.String("severity_text", severityText),
 			attribute.Int("severity_number", severityNumber),
 		)
@@ -183,26 +339,24 @@ func (m *taskRequestMetrics) Log(status int, err error) {
 		m.span = nil
 	}
 
-	if m.logger == nil {
-		return
-	}
-
-	event := taskLogEvent{
+	event := requestLogEvent{
 		logger:         m.logger,
 		record:         record,
 		eventTime:      eventTime,
 		severityText:   severityText,
 		severityNumber: severityNumber,
+		spanContext:    m.spanContext,
 	}
 
-	if m.spanContext.HasTraceID() {
-		event.traceID = m.spanContext.TraceID().String()
+	// An OTel exporter replaces the stdout events.
+	if exp := eventExport; exp != nil {
+		exp.export(event)
+		return
 	}
-	if m.spanContext.HasSpanID() {
-		event.spanID = m.spanContext.SpanID().String()
+	if m.logger == nil {
+		return
 	}
-
-	if !enqueueTaskLogEvent(event) {
+	if !enqueueRequestLogEvent(event) {
 		event.log()
 	}
 }
@@ -229,28 +383,24 @@ func severityForStatus(status int, err error) (string, int) {
 	}
 }
 
-func (r *taskLogRecord) keyValues() []attribute.KeyValue {
-	kv := []attribute.KeyValue{
-		attribute.String("http.route", "/api/tasks"),
-		attribute.Int("http.status_code", r.status),
-		attribute.Float64("prism.tasks.total_ms", durationToMillis(r.total)),
-		attribute.Bool("prism.tasks.page_token_provided", r.pageTokenProvided),
-		attribute.Int("prism.tasks.tasks_returned", r.tasksReturned),
-		attribute.Bool("prism.tasks.has_next_page", r.hasNextPage),
-		attribute.Int64("prism.tasks.request_start_ns", r.requestStartNS),
-	}
-
-	if r.auth > 0 {
-		kv = append(kv, attribute.Float64("prism.tasks.auth_ms", durationToMillis(r.auth)))
-	}
-	if r.fetch > 0 {
-		kv = append(kv, attribute.Float64("prism.tasks.fetch_ms", durationToMillis(r.fetch)))
-	}
-	if r.encode > 0 {
-		kv = append(kv, attribute.Float64("prism.tasks.encode_ms", durationToMillis(r.encode)))
+func (r *requestLogRecord) keyValues() []attribute.KeyValue {
+	prefix := r.kind.attrPrefix
+	kv := make([]attribute.KeyValue, 0, 4+len(r.stages)+len(r.attrs)+2)
+	kv = append(kv, attribute.String("http.route", r.kind.route))
+	// Jobs processed by the worker pool have no response status.
+	if r.status != 0 {
+		kv = append(kv, attribute.Int("http.status_code", r.status))
+	}
+	kv = append(kv,
+		attribute.Float64(prefix+".total_ms", durationToMillis(r.total)),
+		attribute.Int64(prefix+".request_start_ns", r.requestStartNS),
+	)
+	for _, s := range r.stages {
+		kv = append(kv, attribute.Float64(prefix+"."+s.name+"_ms", durationToMillis(s.duration)))
 	}
+	kv = append(kv, r.attrs...)
 	if r.errorStage != "" {
-		kv = append(kv, attribute.String("prism.tasks.error_stage", r.errorStage))
+		kv = append(kv, attribute.String(prefix+".error_stage", r.errorStage))
 	}
 	if r.errorMessage != "" {
 		kv = append(kv, attribute.String("error.message", r.errorMessage))
@@ -258,79 +408,64 @@ func (r *taskLogRecord) keyValues() []attribute.KeyValue {
 	return kv
 }
 
-func (r *taskLogRecord) attributesMap() map[string]any {
-	attrs := map[string]any{
-		"http.route":                      "/api/tasks",
-		"http.status_code":                r.status,
-		"prism.tasks.total_ms":            durationToMillis(r.total),
-		"prism.tasks.page_token_provided": r.pageTokenProvided,
-		"prism.tasks.tasks_returned":      r.tasksReturned,
-		"prism.tasks.has_next_page":       r.hasNextPage,
-		"prism.tasks.request_start_ns":    r.requestStartNS,
-	}
-	if r.auth > 0 {
-		attrs["prism.tasks.auth_ms"] = durationToMillis(r.auth)
-	}
-	if r.fetch > 0 {
-		attrs["prism.tasks.fetch_ms"] = durationToMillis(r.fetch)
-	}
-	if r.encode > 0 {
-		attrs["prism.tasks.encode_ms"] = durationToMillis(r.encode)
-	}
-	if r.errorStage != "" {
-		attrs["prism.tasks.error_stage"] = r.errorStage
-	}
-	if r.errorMessage != "" {
-		attrs["error.message"] = r.errorMessage
+func (r *requestLogRecord) attributesMap() map[string]any {
+	kv := r.keyValues()
+	attrs := make(map[string]any, len(kv))
+	for _, a := range kv {
+		if a.Value.Type() == attribute.INT64 {
+			attrs[string(a.Key)] = int(a.Value.AsInt64())
+			continue
+		}
+		attrs[string(a.Key)] = a.Value.AsInterface()
 	}
 	return attrs
 }
 
-func (e *taskLogEvent) log() {
+func (e *requestLogEvent) log() {
 	if e.logger == nil {
 		return
 	}
 	e.logger.WithFields(e.fields()).Info("observability.event")
 }
 
-func (e *taskLogEvent) fields() log.Fields {
+func (e *requestLogEvent) fields() log.Fields {
 	fields := log.Fields{
 		"time_unix_nano":          e.eventTime.UnixNano(),
 		"observed_time_unix_nano": e.eventTime.UnixNano(),
 		"severity_text":           e.severityText,
 		"severity_number":         e.severityNumber,
-		"body":                    tasksEventBody,
-		"event.name":              tasksEventName,
+		"body":                    e.record.kind.eventBody,
+		"event.name":              e.record.kind.eventName,
 		"event.domain":            tasksEventDomain,
 		"attributes":              e.record.attributesMap(),
 	}
 
-	if e.traceID != "" {
-		fields["trace_id"] = e.traceID
+	if e.spanContext.HasTraceID() {
+		fields["trace_id"] = e.spanContext.TraceID().String()
 	}
-	if e.spanID != "" {
-		fields["span_id"] = e.spanID
+	if e.spanContext.HasSpanID() {
+		fields["span_id"] = e.spanContext.SpanID().String()
 	}
 
 	return fields
 }
 
-func enqueueTaskLogEvent(event taskLogEvent) bool {
+func enqueueRequestLogEvent(event requestLogEvent) bool {
 	if event.logger == nil {
 		return true
 	}
 
-	taskLogQueueOnce.Do(initTaskLogQueue)
+	requestLogQueueOnce.Do(initRequestLogQueue)
 
 	select {
-	case taskLogQueue <- event:
+	case requestLogQueue <- event:
 		return true
 	default:
 		return false
 	}
 }
 
-func initTaskLogQueue() {
+func initRequestLogQueue() {
 	workers := envInt("TASK_METRICS_LOG_WORKERS", runtime.NumCPU())
 	if workers < 1 {
 		workers = 1
@@ -340,10 +475,10 @@ func initTaskLogQueue() {
 		buffer = workers * 1024
 	}
 
-	taskLogQueue = make(chan taskLogEvent, buffer)
+	requestLogQueue = make(chan requestLogEvent, buffer)
 	for i := 0; i < workers; i++ {
 		go func() {
-			for event := range taskLogQueue {
+			for event := range requestLogQueue {
 				event.log()
 			}
 		}()
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"go.opentelemetry.io/otel"
@@ -253,3 +256,97 @@ func waitForLogEntry(t *testing.T, hook *test.Hook, timeout time.Duration) *log.
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+func TestPostCommandsReportsRequestAndJobEvents(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+
+	logger, hook := test.NewNullLogger()
+	store := &mockStore{}
+	initCommandSender(store, logger)
+	handler := postCommands(store, mockAuth{}, logger, nil, nil, nil)
+
+	body := `[{"entityType":"task","type":"create-task"},{"entityType":"task","type":"update-task"}]`
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d", rec.Code)
+	}
+
+	events := waitForEvents(t, hook, commandsRequest.eventName, commandsEnqueue.eventName)
+	reqAttrs := events[commandsRequest.eventName]
+	for _, key := range []string{"prism.commands.auth_ms", "prism.commands.decode_ms", "prism.commands.validate_ms", "prism.commands.handoff_ms"} {
+		if _, ok := reqAttrs[key]; !ok {
+			t.Fatalf("expected %s in request event, got %#v", key, reqAttrs)
+		}
+	}
+	if reqAttrs["prism.commands.enqueue_path"] != "handoff" {
+		t.Fatalf("unexpected enqueue path: %#v", reqAttrs["prism.commands.enqueue_path"])
+	}
+	if reqAttrs["prism.commands.command_count"] != 2 {
+		t.Fatalf("unexpected command count: %#v", reqAttrs["prism.commands.command_count"])
+	}
+
+	jobAttrs := events[commandsEnqueue.eventName]
+	if _, ok := jobAttrs["prism.enqueue.queue_wait_ms"]; !ok {
+		t.Fatalf("expected queue wait in job event, got %#v", jobAttrs)
+	}
+	if jobAttrs["prism.enqueue.command_count"] != 2 {
+		t.Fatalf("unexpected job command count: %#v", jobAttrs["prism.enqueue.command_count"])
+	}
+	if _, ok := jobAttrs["http.status_code"]; ok {
+		t.Fatalf("job event should not carry a status code")
+	}
+}
+
+func TestPostCommandsRejectsInvalidCommands(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+
+	store := &mockStore{}
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(`[{"entityType":"task"}]`))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+	if err := postCommands(store, mockAuth{}, nil, nil, nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d", rec.Code)
+	}
+	if cmds := store.Commands(); len(cmds) != 0 {
+		t.Fatalf("expected no commands enqueued, got %d", len(cmds))
+	}
+}
+
+// waitForEvents returns the attributes of the first event logged under each name.
+func waitForEvents(t *testing.T, hook *test.Hook, names ...string) map[string]map[string]any {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		found := make(map[string]map[string]any, len(names))
+		for _, entry := range hook.AllEntries() {
+			name, _ := entry.Data["event.name"].(string)
+			if attrs, ok := entry.Data["attributes"].(map[string]any); ok && found[name] == nil {
+				found[name] = attrs
+			}
+		}
+		missing := false
+		for _, name := range names {
+			if found[name] == nil {
+				missing = true
+			}
+		}
+		if !missing {
+			return found
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected events %v, got %v", names, found)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"prism-api/domain"
+)
+
+// Overload policies applied when a command batch cannot be handed to the worker pool.
+const (
+	overloadInline = "inline"
+	overloadShed   = "shed"
+	overloadSpill  = "spill"
+)
+
+const (
+	defaultOverloadRetryAfter = time.Second
+	spillDrainers             = 4
+	spillPopTimeout           = time.Second
+	spillErrorBackoff         = time.Second
+	spillRetryBackoff         = time.Second
+	spillMaxRetryBackoff      = 30 * time.Second
+	limitDecreaseFactor       = 0.9
+)
+
+// CommandSpill is a durable buffer used by the spill policy. Popped batches stay
+// reserved until they are acknowledged, requeued or retried; receipt is empty when
+// Pop timed out. Retry counts a failed enqueue and reports whether the batch was
+// requeued rather than dead-lettered after too many attempts.
+type CommandSpill interface {
+	Push(ctx context.Context, userID string, cmds []domain.Command) error
+	Pop(ctx context.Context, timeout time.Duration) (batch domain.CommandBatchEnvelope, receipt string, err error)
+	Ack(ctx context.Context, receipt string) error
+	Requeue(ctx context.Context, receipt string) error
+	Retry(ctx context.Context, receipt string) (requeued bool, err error)
+}
+
+// WithCommandSpill configures the durable buffer used by the spill overload policy.
+func WithCommandSpill(spill CommandSpill) Option {
+	return func(o *options) {
+		o.spill = spill
+	}
+}
+
+var (
+	overloadPolicy     = overloadInline
+	overloadRetryAfter = defaultOverloadRetryAfter
+	poolLimit          *adaptiveLimit
+	globalSpill        CommandSpill
+	spillCancel        context.CancelFunc
+	spillWG            sync.WaitGroup
+
+	handoffCount atomic.Uint64
+	inlineCount  atomic.Uint64
+	shedCount    atomic.Uint64
+	spillCount   atomic.Uint64
+)
+
+func parseOverloadPolicy(v string) (string, bool) {
+	switch v {
+	case "", overloadInline:
+		return overloadInline, true
+	case overloadShed, overloadSpill:
+		return v, true
+	default:
+		return overloadInline, false
+	}
+}
+
+// adaptiveLimit bounds the number of command batches queued or being sent. With a
+// target latency configured it follows an AIMD scheme: every batch that spent longer
+// than target between hand-off and completion shrinks the limit by 10%, faster ones
+// grow it by roughly one batch per limit completions. Without a target the limit stays at max.
+type adaptiveLimit struct {
+	mu       sync.Mutex
+	limit    float64
+	min      float64
+	max      float64
+	target   time.Duration
+	inFlight atomic.Int64
+}
+
+func newAdaptiveLimit(min, max int, target time.Duration) *adaptiveLimit {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return &adaptiveLimit{limit: float64(max), min: float64(min), max: float64(max), target: target}
+}
+
+func (a *adaptiveLimit) tryAcquire() bool {
+	if a == nil {
+		return true
+	}
+	limit := int64(a.current())
+	if a.inFlight.Add(1) > limit {
+		a.inFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+// cancel returns a slot acquired for a batch that never reached a worker.
+func (a *adaptiveLimit) cancel() {
+	if a != nil {
+		a.inFlight.Add(-1)
+	}
+}
+
+func (a *adaptiveLimit) release(latency time.Duration, failed bool) {
+	if a == nil {
+		return
+	}
+	a.inFlight.Add(-1)
+	if a.target <= 0 {
+		return
+	}
+	a.mu.Lock()
+	if failed || latency > a.target {
+		a.limit = math.Max(a.min, a.limit*limitDecreaseFactor)
+	} else {
+		a.limit = math.Min(a.max, a.limit+1/a.limit)
+	}
+	a.mu.Unlock()
+}
+
+func (a *adaptiveLimit) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.limit)
+}
+
+func initOverloadPolicy() {
+	policy, ok := parseOverloadPolicy(os.Getenv("OVERLOAD_POLICY"))
+	if !ok {
+		globalLog.Warnf("unknown OVERLOAD_POLICY %q; using %s", os.Getenv("OVERLOAD_POLICY"), overloadInline)
+	}
+	overloadPolicy = policy
+	overloadRetryAfter = envDur("OVERLOAD_RETRY_AFTER", defaultOverloadRetryAfter)
+	poolLimit = newAdaptiveLimit(workerCount, workerCount+jobBuf, envDur("ENQUEUE_TARGET_LATENCY", 0))
+}
+
+func resetOverloadPolicy() {
+	if spillCancel != nil {
+		spillCancel()
+		spillCancel = nil
+	}
+	spillWG.Wait()
+	overloadPolicy = overloadInline
+	overloadRetryAfter = defaultOverloadRetryAfter
+	poolLimit = nil
+	globalSpill = nil
+	spillWG = sync.WaitGroup{}
+	handoffCount.Store(0)
+	inlineCount.Store(0)
+	shedCount.Store(0)
+	spillCount.Store(0)
+}
+
+// startSpillDrainers moves spilled batches back through the store once the
+// adaptive limit has room again.
+func startSpillDrainers(spill CommandSpill) {
+	if overloadPolicy != overloadSpill {
+		return
+	}
+	if spill == nil {
+		globalLog.Warnf("OVERLOAD_POLICY %s requires a command spill; using %s", overloadSpill, overloadInline)
+		overloadPolicy = overloadInline
+		return
+	}
+	globalSpill = spill
+	ctx, cancel := context.WithCancel(bg)
+	spillCancel = cancel
+	for i := 0; i < spillDrainers; i++ {
+		spillWG.Add(1)
+		go drainSpill(ctx, spill)
+	}
+}
+
+func drainSpill(ctx context.Context, spill CommandSpill) {
+	defer spillWG.Done()
+	failures := 0
+	for ctx.Err() == nil {
+		// Pop before taking a slot, so an idle drainer does not hold one while
+		// it blocks on an empty buffer.
+		batch, receipt, err := spill.Pop(ctx, spillPopTimeout)
+		if err != nil || receipt == "" {
+			if err != nil && ctx.Err() == nil {
+				globalLog.Errorf("spill pop failed: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(spillErrorBackoff):
+				}
+			}
+			continue
+		}
+		if !acquireSpillSlot(ctx) {
+			// Shutting down: put the batch back at the head so it stays first.
+			if err := spill.Requeue(bg, receipt); err != nil {
+				globalLog.Errorf("spill requeue failed: %v", err)
+			}
+			return
+		}
+
+		// The latency sample starts once a slot is held, like batches handed to
+		// the pool, so time spent waiting in the buffer does not shrink the limit.
+		start := time.Now()
+		sendCtx, cancel := context.WithTimeout(domain.ContextWithTraceParent(bg, batch.TraceParent), enqueueTimeout)
+		err = globalStore.EnqueueCommands(sendCtx, batch.UserID, batch.Commands)
+		cancel()
+		poolLimit.release(time.Since(start), err != nil)
+		if err != nil {
+			globalLog.Errorf("spilled enqueue failed, err: %v, user: %s, count: %d", err, batch.UserID, len(batch.Commands))
+			// Wait before the batch goes back, so a batch that keeps failing
+			// neither spins nor keeps shrinking the limit for all traffic.
+			failures++
+			select {
+			case <-ctx.Done():
+			case <-time.After(spillRetryDelay(failures)):
+			}
+			requeued, err := spill.Retry(bg, receipt)
+			if err != nil {
+				globalLog.Errorf("spill retry failed: %v", err)
+			} else if !requeued {
+				globalLog.Errorf("spilled batch moved to the dead-letter list, user: %s, count: %d", batch.UserID, len(batch.Commands))
+			}
+			continue
+		}
+		failures = 0
+		if err := spill.Ack(bg, receipt); err != nil {
+			globalLog.Errorf("spill ack failed: %v", err)
+		}
+	}
+}
+
+// spillRetryDelay doubles spillRetryBackoff with each consecutive failure of a
+// drainer, up to spillMaxRetryBackoff.
+func spillRetryDelay(failures int) time.Duration {
+	delay := spillRetryBackoff
+	for i := 1; i < failures && delay < spillMaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, spillMaxRetryBackoff)
+}
+
+// acquireSpillSlot waits until the adaptive limit has room for a spilled batch.
+// It returns false when ctx ends first.
+func acquireSpillSlot(ctx context.Context) bool {
+	for !poolLimit.tryAcquire() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(handoffTimeout + time.Millisecond):
+		}
+	}
+	return true
+}
+
+// handleOverload applies the overload policy to a job the pool could not accept.
+// It returns false when the caller should fall back to enqueueing inline.
+func handleOverload(c echo.Context, job enqueueJob, keys []string) (bool, error) {
+	switch overloadPolicy {
+	case overloadShed:
+		shedCount.Add(1)
+		countError(commandsRoute, "shed")
+		return true, shedRequest(c)
+	case overloadSpill:
+		if err := globalSpill.Push(c.Request().Context(), job.userID, job.cmds); err != nil {
+			c.Logger().Errorf("spill failed: %v", err)
+			shedCount.Add(1)
+			countError(commandsRoute, "spill")
+			return true, shedRequest(c)
+		}
+		spillCount.Add(1)
+		return true, respondJSON(c, http.StatusAccepted, postCommandResponse{IdempotencyKeys: keys})
+	default:
+		inlineCount.Add(1)
+		return false, nil
+	}
+}
+
+func shedRequest(c echo.Context) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(overloadRetryAfter.Seconds()))))
+	return c.String(http.StatusServiceUnavailable, "server overloaded")
+}
+
+// PoolStats is a snapshot of the command worker pool occupancy.
+type PoolStats struct {
+	Policy   string `json:"policy"`
+	Workers  int    `json:"workers"`
+	Buffer   int    `json:"buffer"`
+	Queued   int    `json:"queued"`
+	InFlight int64  `json:"inFlight"`
+	Limit    int    `json:"limit"`
+	Handoffs uint64 `json:"handoffs"`
+	Inline   uint64 `json:"inline"`
+	Shed     uint64 `json:"shed"`
+	Spilled  uint64 `json:"spilled"`
+}
+
+// CurrentPoolStats reports the current worker pool occupancy and overload counters.
+func CurrentPoolStats() PoolStats {
+	stats := PoolStats{
+		Policy:   overloadPolicy,
+		Workers:  workerCount,
+		Buffer:   jobBuf,
+		Handoffs: handoffCount.Load(),
+		Inline:   inlineCount.Load(),
+		Shed:     shedCount.Load(),
+		Spilled:  spillCount.Load(),
+	}
+	if ch := jobs; ch != nil {
+		stats.Queued = len(ch)
+	}
+	if poolLimit != nil {
+		stats.InFlight = poolLimit.inFlight.Load()
+		stats.Limit = poolLimit.current()
+	}
+	return stats
+}
+
+const poolStatsRoute = "/healthz/pool"
+
+func poolStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, CurrentPoolStats())
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"prism-api/domain"
+)
+
+type fakeSpill struct {
+	mu      sync.Mutex
+	pushed  []domain.CommandBatchEnvelope
+	pushErr error
+}
+
+func (f *fakeSpill) Push(ctx context.Context, userID string, cmds []domain.Command) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pushErr != nil {
+		return f.pushErr
+	}
+	f.pushed = append(f.pushed, domain.CommandBatchEnvelope{UserID: userID, Commands: cmds})
+	return nil
+}
+
+func (f *fakeSpill) Pop(ctx context.Context, timeout time.Duration) (domain.CommandBatchEnvelope, string, error) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(timeout):
+	}
+	return domain.CommandBatchEnvelope{}, "", nil
+}
+
+func (f *fakeSpill) Ack(context.Context, string) error     { return nil }
+func (f *fakeSpill) Requeue(context.Context, string) error { return nil }
+func (f *fakeSpill) Retry(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+// saturatePool starts the sender and swaps its job channel for one nobody reads, so
+// every hand-off fails and the overload policy decides the outcome.
+func saturatePool(t *testing.T, store Storage, policy string) {
+	t.Helper()
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	t.Setenv("OVERLOAD_POLICY", policy)
+	t.Setenv("OVERLOAD_RETRY_AFTER", "3s")
+	t.Setenv("ENQUEUE_HANDOFF_TIMEOUT", "1ms")
+	initCommandSender(store, log.New())
+	workers := jobs
+	jobs = make(chan enqueueJob)
+	t.Cleanup(func() { jobs = workers })
+}
+
+func postOneCommand(t *testing.T, store Storage) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(`[{"entityType":"task","type":"create-task"}]`))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+	if err := postCommands(store, mockAuth{}, nil, nil, nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	return rec
+}
+
+func TestPostCommandsShedsWhenPoolSaturated(t *testing.T) {
+	store := &mockStore{}
+	saturatePool(t, store, overloadShed)
+
+	rec := postOneCommand(t, store)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3" {
+		t.Fatalf("expected Retry-After 3, got %q", got)
+	}
+	if len(store.Commands()) != 0 {
+		t.Fatalf("shed commands must not be enqueued inline")
+	}
+	if stats := CurrentPoolStats(); stats.Shed != 1 || stats.Policy != overloadShed {
+		t.Fatalf("unexpected pool stats: %+v", stats)
+	}
+}
+
+func TestPostCommandsSpillsWhenPoolSaturated(t *testing.T) {
+	store := &mockStore{}
+	saturatePool(t, store, overloadSpill)
+	spill := &fakeSpill{}
+	startSpillDrainers(spill)
+
+	rec := postOneCommand(t, store)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+	spill.mu.Lock()
+	pushed := len(spill.pushed)
+	spill.mu.Unlock()
+	if pushed != 1 || len(store.Commands()) != 0 {
+		t.Fatalf("expected batch to be spilled, spilled %d inline %d", pushed, len(store.Commands()))
+	}
+
+	spill.pushErr = errors.New("redis down")
+	if rec := postOneCommand(t, store); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when spill fails, got %d", rec.Code)
+	}
+}
+
+func TestIdleSpillDrainersHoldNoSlots(t *testing.T) {
+	saturatePool(t, &mockStore{}, overloadSpill)
+	if poolLimit == nil {
+		t.Fatal("expected an adaptive limit")
+	}
+	startSpillDrainers(&fakeSpill{})
+
+	// Every drainer is blocked popping an empty buffer.
+	time.Sleep(20 * time.Millisecond)
+	if n := poolLimit.inFlight.Load(); n != 0 {
+		t.Fatalf("expected idle drainers to hold no slots, got %d", n)
+	}
+}
+
+func TestPostCommandsInlineWhenPoolSaturated(t *testing.T) {
+	store := &mockStore{}
+	saturatePool(t, store, "")
+
+	if rec := postOneCommand(t, store); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+	if len(store.Commands()) != 1 {
+		t.Fatalf("expected inline enqueue")
+	}
+	if stats := CurrentPoolStats(); stats.Inline != 1 {
+		t.Fatalf("unexpected pool stats: %+v", stats)
+	}
+}
+
+func TestAdaptiveLimitFollowsLatency(t *testing.T) {
+	l := newAdaptiveLimit(2, 10, 100*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		if !l.tryAcquire() {
+			t.Fatalf("acquire %d should succeed", i)
+		}
+	}
+	if l.tryAcquire() {
+		t.Fatalf("expected limit of 10 to be enforced")
+	}
+	for i := 0; i < 10; i++ {
+		l.release(time.Second, false)
+	}
+	if got := l.current(); got != 3 {
+		t.Fatalf("expected slow batches to shrink the limit to 3, got %d", got)
+	}
+	for i := 0; i < 50; i++ {
+		l.release(time.Millisecond, false)
+		l.inFlight.Add(1)
+	}
+	if got := l.current(); got <= 3 {
+		t.Fatalf("expected fast batches to grow the limit, got %d", got)
+	}
+
+	fixed := newAdaptiveLimit(2, 10, 0)
+	fixed.tryAcquire()
+	fixed.release(time.Minute, true)
+	if got := fixed.current(); got != 10 {
+		t.Fatalf("expected limit to stay at max without a target, got %d", got)
+	}
+}
+
+func TestSpillRetryDelayBacksOffUpToTheMaximum(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  spillRetryBackoff,
+		2:  2 * spillRetryBackoff,
+		3:  4 * spillRetryBackoff,
+		10: spillMaxRetryBackoff,
+	}
+	for failures, want := range cases {
+		if got := spillRetryDelay(failures); got != want {
+			t.Fatalf("failures %d: expected %s, got %s", failures, want, got)
+		}
+	}
+}
@@ -10,11 +10,20 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type enqueueJob struct {
-	userID string
-	cmds   []domain.Command
+	userID     string
+	cmds       []domain.Command
+	enqueuedAt time.Time
+	// spanCtx is the span of the request that submitted the job; the enqueue span
+	// is started as its child even though the request has completed by then.
+	spanCtx trace.SpanContext
+}
+
+func (j enqueueJob) context() context.Context {
+	return trace.ContextWithSpanContext(bg, j.spanCtx)
 }
 
 const (
@@ -59,6 +68,7 @@ func shutdownCommandSender() {
 	}
 
 	workerWG.Wait()
+	resetOverloadPolicy()
 
 	globalStore = nil
 	globalLog = nil
@@ -89,26 +99,34 @@ func initCommandSender(store Storage, log *log.Logger) {
 
 		enqueueTimeout = envDur("ENQUEUE_TIMEOUT", 60*time.Second)
 		handoffTimeout = envDur("ENQUEUE_HANDOFF_TIMEOUT", defaultHandoffTimeout)
+		initOverloadPolicy()
 
 		jobs = make(chan enqueueJob, jobBuf)
 		for i := 0; i < workerCount; i++ {
 			workerWG.Add(1)
 			go worker(i, jobs)
 		}
-		globalLog.Infof("command sender started, workers: %d, buffer: %d, timeout: %v, handoff: %v", workerCount, jobBuf, enqueueTimeout, handoffTimeout)
+		globalLog.Infof("command sender started, workers: %d, buffer: %d, timeout: %v, handoff: %v, overload policy: %s", workerCount, jobBuf, enqueueTimeout, handoffTimeout, overloadPolicy)
 	})
 }
 
 func worker(id int, jobCh <-chan enqueueJob) {
 	defer workerWG.Done()
 	for j := range jobCh {
-		ctx, cancel := context.WithTimeout(bg, enqueueTimeout)
+		metrics, ctx := newEnqueueJobMetrics(j, globalLog)
+		ctx, cancel := context.WithTimeout(ctx, enqueueTimeout)
+		enqueueStart := time.Now()
 		err := globalStore.EnqueueCommands(ctx, j.userID, j.cmds)
+		metrics.ObserveEnqueue(time.Since(enqueueStart))
 		cancel()
+		poolLimit.release(time.Since(j.enqueuedAt), err != nil)
 
 		if err != nil {
+			metrics.SetErrorStage("enqueue")
+			enqueueFailures.Inc()
 			globalLog.Errorf("enqueue failed, err: %v, user: %s, count: %d, worker: %d", err, j.userID, len(j.cmds), id)
 		}
+		metrics.Log(0, err)
 	}
 }
 
@@ -116,7 +134,19 @@ func tryEnqueueJob(job enqueueJob) bool {
 	if jobs == nil {
 		return false
 	}
+	if !poolLimit.tryAcquire() {
+		return false
+	}
+	job.enqueuedAt = time.Now()
+	if handOff(job) {
+		handoffCount.Add(1)
+		return true
+	}
+	poolLimit.cancel()
+	return false
+}
 
+func handOff(job enqueueJob) bool {
 	if ok, closed := trySendNonBlocking(jobs, job); closed {
 		return false
 	} else if ok {
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "prism_api"
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"route", "method", "status"})
+
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_errors_total",
+		Help:      "Failed requests by route and the stage that failed.",
+	}, []string{"route", "stage"})
+
+	enqueueFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "enqueue_failures_total",
+		Help:      "Command batches dropped because a pool worker failed to enqueue them.",
+	})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "enqueue_pool_queued",
+		Help:      "Command batches waiting in the enqueue pool buffer.",
+	}, func() float64 { return float64(CurrentPoolStats().Queued) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "enqueue_pool_in_flight",
+		Help:      "Command batches queued or being sent by the enqueue pool.",
+	}, func() float64 { return float64(CurrentPoolStats().InFlight) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "enqueue_pool_limit",
+		Help:      "Current adaptive limit of command batches admitted to the enqueue pool.",
+	}, func() float64 { return float64(CurrentPoolStats().Limit) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "enqueue_pool_capacity",
+		Help:      "Size of the enqueue pool buffer.",
+	}, func() float64 { return float64(CurrentPoolStats().Buffer) })
+
+	outcomes := map[string]func() uint64{
+		"handoff": handoffCount.Load,
+		"inline":  inlineCount.Load,
+		"shed":    shedCount.Load,
+		"spilled": spillCount.Load,
+	}
+	for outcome, load := range outcomes {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "enqueue_batches_total",
+			Help:        "Command batches handled by postCommands by outcome: handed to the pool, enqueued inline, shed or spilled.",
+			ConstLabels: prometheus.Labels{"outcome": outcome},
+		}, func() float64 { return float64(load()) })
+	}
+}
+
+// observeRequests records the latency of every routed request except the metrics endpoint itself.
+func observeRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		route := c.Path()
+		if route == metricsPath {
+			return err
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Response().Status
+		if he, ok := err.(*echo.HTTPError); ok && !c.Response().Committed {
+			status = he.Code
+		}
+		requestDuration.WithLabelValues(route, c.Request().Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+const metricsPath = "/metrics"
+
+func countError(route, stage string) {
+	requestErrors.WithLabelValues(route, stage).Inc()
+}
+
+func metricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMetricsEndpointExposesRouteLatency(t *testing.T) {
+	e := echo.New()
+	e.Use(observeRequests)
+	e.GET(metricsPath, metricsHandler())
+	e.GET("/ping/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping/42", nil))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from metrics endpoint, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`prism_api_http_request_duration_seconds_count{method="GET",route="/ping/:id",status="204"} 1`,
+		`prism_api_enqueue_batches_total{outcome="shed"}`,
+		`prism_api_enqueue_pool_queued`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics output missing %q", want)
+		}
+	}
+	if strings.Contains(body, `route="/metrics"`) {
+		t.Fatalf("metrics endpoint must not observe itself")
+	}
+}
+
+func TestOperatorEndpointsOnlyServedInternally(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+
+	public := echo.New()
+	Register(public, &mockStore{}, mockAuth{}, log.New())
+	internal := echo.New()
+	RegisterInternal(internal)
+
+	for _, path := range []string{metricsPath, poolStatsRoute} {
+		rec := httptest.NewRecorder()
+		public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected %s to be absent from the public server, got %d", path, rec.Code)
+		}
+		rec = httptest.NewRecorder()
+		internal.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected %s on the internal server, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	"prism-api/domain"
+)
+
+// RateLimit describes a token bucket refilled at Rate tokens per second up to Burst tokens.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit should be enforced.
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// RateBucket is a single bucket charged by a request.
+type RateBucket struct {
+	Key   string
+	Limit RateLimit
+	Cost  int
+}
+
+// RateLimiter takes tokens from all buckets atomically. When any bucket lacks tokens
+// nothing is taken and the returned duration tells how long the caller must wait.
+type RateLimiter interface {
+	Take(ctx context.Context, buckets []RateBucket) (retryAfter time.Duration, err error)
+}
+
+// RateLimits configures the per-user limits enforced by the API.
+type RateLimits struct {
+	Queries      RateLimit
+	Commands     RateLimit
+	CommandTypes map[string]RateLimit
+}
+
+// rateLimiter applies RateLimits to requests. A nil *rateLimiter allows everything.
+type rateLimiter struct {
+	limiter RateLimiter
+	limits  RateLimits
+	log     *log.Logger
+}
+
+func newRateLimiter(limiter RateLimiter, limits RateLimits, logger *log.Logger) *rateLimiter {
+	if limiter == nil {
+		return nil
+	}
+	return &rateLimiter{limiter: limiter, limits: limits, log: logger}
+}
+
+// allowQuery charges one token from the user's query bucket.
+func (r *rateLimiter) allowQuery(c echo.Context, userID string) bool {
+	if r == nil || !r.limits.Queries.Enabled() {
+		return true
+	}
+	return r.take(c, []RateBucket{{Key: userID + ":rl:queries", Limit: r.limits.Queries, Cost: 1}})
+}
+
+// allowCommands charges the user's command bucket with the batch size and every
+// configured command-type bucket with the number of commands of that type.
+func (r *rateLimiter) allowCommands(c echo.Context, userID string, cmds []domain.Command) bool {
+	if r == nil || len(cmds) == 0 {
+		return true
+	}
+	buckets := make([]RateBucket, 0, 2)
+	if r.limits.Commands.Enabled() {
+		buckets = append(buckets, RateBucket{Key: userID + ":rl:commands", Limit: r.limits.Commands, Cost: len(cmds)})
+	}
+	for _, cmd := range cmds {
+		limit, ok := r.limits.CommandTypes[cmd.Type]
+		if !ok || !limit.Enabled() {
+			continue
+		}
+		key := userID + ":rl:cmd:" + cmd.Type
+		found := false
+		for i := range buckets {
+			if buckets[i].Key == key {
+				buckets[i].Cost++
+				found = true
+				break
+			}
+		}
+		if !found {
+			buckets = append(buckets, RateBucket{Key: key, Limit: limit, Cost: 1})
+		}
+	}
+	if len(buckets) == 0 {
+		return true
+	}
+	return r.take(c, buckets)
+}
+
+func (r *rateLimiter) take(c echo.Context, buckets []RateBucket) bool {
+	// A request costing more than a bucket holds can never be admitted. It is
+	// rejected without Retry-After instead of being charged a smaller cost.
+	for _, b := range buckets {
+		if b.Cost > b.Limit.Burst {
+			if r.log != nil {
+				r.log.WithFields(log.Fields{"bucket": b.Key, "cost": b.Cost, "burst": b.Limit.Burst}).Debug("request exceeds rate limit burst")
+			}
+			return false
+		}
+	}
+	retryAfter, err := r.limiter.Take(c.Request().Context(), buckets)
+	if err != nil {
+		// Fail open: the limiter protects capacity but must not become a single point of failure.
+		if r.log != nil {
+			r.log.WithError(err).Warn("rate limiter unavailable; allowing request")
+		}
+		return true
+	}
+	if retryAfter <= 0 {
+		return true
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return false
+}
+
+// ParseRateLimit parses "<rate>:<burst>", where rate is the sustained number of
+// requests per second and burst the bucket size. An empty string disables the limit.
+func ParseRateLimit(s string) (RateLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return RateLimit{}, nil
+	}
+	rateStr, burstStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: expected <rate>:<burst>", s)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+	if err != nil || rate <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: rate must be a positive number", s)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(burstStr))
+	if err != nil || burst <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", s)
+	}
+	return RateLimit{Rate: rate, Burst: burst}, nil
+}
+
+// ParseCommandTypeLimits parses a comma-separated list of "<command-type>=<rate>:<burst>" entries.
+func ParseCommandTypeLimits(s string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cmdType, spec, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(cmdType) == "" {
+			return nil, fmt.Errorf("invalid command rate limit %q: expected <command-type>=<rate>:<burst>", entry)
+		}
+		limit, err := ParseRateLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(cmdType)] = limit
+	}
+	return limits, nil
+}
+
+func rateLimited(c echo.Context) error {
+	return c.String(http.StatusTooManyRequests, "rate limit exceeded")
+}
+
+// tokenBucketScript refills and charges every bucket in KEYS atomically using the
+// Redis server clock, so all API instances share the same view of each bucket.
+// ARGV holds rate (tokens per ms), burst and cost per key. It returns 0 when the
+// tokens were taken, otherwise the number of milliseconds until they would be available.
+var tokenBucketScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local wait = 0
+local tokens = {}
+for i = 1, #KEYS do
+  local rate = tonumber(ARGV[i * 3 - 2])
+  local burst = tonumber(ARGV[i * 3 - 1])
+  local cost = tonumber(ARGV[i * 3])
+  local state = redis.call('HMGET', KEYS[i], 'tokens', 'ts')
+  local available = tonumber(state[1]) or burst
+  local last = tonumber(state[2]) or now
+  if now > last then
+    available = math.min(burst, available + (now - last) * rate)
+  end
+  tokens[i] = available
+  if available < cost then
+    wait = math.max(wait, math.ceil((cost - available) / rate))
+  end
+end
+if wait > 0 then
+  return wait
+end
+for i = 1, #KEYS do
+  local rate = tonumber(ARGV[i * 3 - 2])
+  local burst = tonumber(ARGV[i * 3 - 1])
+  local cost = tonumber(ARGV[i * 3])
+  redis.call('HSET', KEYS[i], 'tokens', tostring(tokens[i] - cost), 'ts', now)
+  redis.call('PEXPIRE', KEYS[i], math.ceil(burst / rate) + 1000)
+end
+return 0
+`)
+
+// RedisRateLimiter stores token buckets in Redis hashes.
+type RedisRateLimiter struct {
+	client redis.Scripter
+}
+
+// NewRedisRateLimiter creates a RateLimiter backed by the given Redis client.
+func NewRedisRateLimiter(client redis.Scripter) *RedisRateLimiter {
+	return &RedisRateLimiter{client: client}
+}
+
+func (r *RedisRateLimiter) Take(ctx context.Context, buckets []RateBucket) (time.Duration, error) {
+	if len(buckets) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, len(buckets))
+	args := make([]any, 0, len(buckets)*3)
+	for i, b := range buckets {
+		keys[i] = b.Key
+		args = append(args, strconv.FormatFloat(b.Limit.Rate/1000, 'g', -1, 64), b.Limit.Burst, b.Cost)
+	}
+	wait, err := tokenBucketScript.Run(ctx, r.client, keys, args...).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+func newTestRedisLimiter(t *testing.T) *RedisRateLimiter {
+	t.Helper()
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		rc.Close()
+		m.Close()
+	})
+	return NewRedisRateLimiter(rc)
+}
+
+func TestRedisRateLimiterEnforcesBurst(t *testing.T) {
+	limiter := newTestRedisLimiter(t)
+	ctx := context.Background()
+	bucket := []RateBucket{{Key: "user:rl:commands", Limit: RateLimit{Rate: 1, Burst: 2}, Cost: 1}}
+
+	for i := 0; i < 2; i++ {
+		wait, err := limiter.Take(ctx, bucket)
+		if err != nil || wait != 0 {
+			t.Fatalf("take %d: wait %v err %v", i, wait, err)
+		}
+	}
+	wait, err := limiter.Take(ctx, bucket)
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("expected wait within one refill interval, got %v", wait)
+	}
+}
+
+func TestRedisRateLimiterTakesNothingWhenAnyBucketIsEmpty(t *testing.T) {
+	limiter := newTestRedisLimiter(t)
+	ctx := context.Background()
+	general := RateBucket{Key: "user:rl:commands", Limit: RateLimit{Rate: 1, Burst: 10}, Cost: 1}
+	perType := RateBucket{Key: "user:rl:cmd:create-task", Limit: RateLimit{Rate: 1, Burst: 1}, Cost: 1}
+
+	if wait, err := limiter.Take(ctx, []RateBucket{general, perType}); err != nil || wait != 0 {
+		t.Fatalf("first take: wait %v err %v", wait, err)
+	}
+	if wait, err := limiter.Take(ctx, []RateBucket{general, perType}); err != nil || wait == 0 {
+		t.Fatalf("expected rejection from per-type bucket: wait %v err %v", wait, err)
+	}
+	// Only the first request may have been charged against the general bucket.
+	general.Cost = 9
+	if wait, err := limiter.Take(ctx, []RateBucket{general}); err != nil || wait != 0 {
+		t.Fatalf("expected 9 remaining tokens: wait %v err %v", wait, err)
+	}
+}
+
+type stubLimiter struct {
+	wait    time.Duration
+	err     error
+	buckets []RateBucket
+}
+
+func (s *stubLimiter) Take(ctx context.Context, buckets []RateBucket) (time.Duration, error) {
+	s.buckets = buckets
+	return s.wait, s.err
+}
+
+func TestPostCommandsRateLimited(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+
+	store := &mockStore{}
+	stub := &stubLimiter{wait: 1500 * time.Millisecond}
+	limits := RateLimits{
+		Commands:     RateLimit{Rate: 5, Burst: 10},
+		CommandTypes: map[string]RateLimit{"create-task": {Rate: 1, Burst: 2}},
+	}
+	handler := postCommands(store, mockAuth{}, nil, newRateLimiter(stub, limits, log.New()), nil, nil)
+
+	body := `[{"entityType":"task","type":"create-task"},{"entityType":"task","type":"create-task"},{"entityType":"task","type":"update-task"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", got)
+	}
+	if len(store.Commands()) != 0 {
+		t.Fatalf("rate limited commands must not be enqueued")
+	}
+	if len(stub.buckets) != 2 {
+		t.Fatalf("expected general and per-type buckets, got %+v", stub.buckets)
+	}
+	if stub.buckets[0].Key != "user:rl:commands" || stub.buckets[0].Cost != 3 {
+		t.Fatalf("unexpected general bucket: %+v", stub.buckets[0])
+	}
+	if stub.buckets[1].Key != "user:rl:cmd:create-task" || stub.buckets[1].Cost != 2 {
+		t.Fatalf("unexpected per-type bucket: %+v", stub.buckets[1])
+	}
+}
+
+func TestPostCommandsRejectsBatchLargerThanBurst(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+
+	store := &mockStore{}
+	stub := &stubLimiter{}
+	limits := RateLimits{
+		Commands:     RateLimit{Rate: 5, Burst: 10},
+		CommandTypes: map[string]RateLimit{"create-task": {Rate: 1, Burst: 1}},
+	}
+	handler := postCommands(store, mockAuth{}, nil, newRateLimiter(stub, limits, log.New()), nil, nil)
+
+	// Two create-task commands cost more than the per-type burst of one.
+	body := `[{"entityType":"task","type":"create-task"},{"entityType":"task","type":"create-task"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Fatalf("expected no Retry-After for a batch that can never be admitted, got %q", got)
+	}
+	if stub.buckets != nil {
+		t.Fatalf("no tokens must be taken, got %+v", stub.buckets)
+	}
+	if len(store.Commands()) != 0 {
+		t.Fatalf("rate limited commands must not be enqueued")
+	}
+}
+
+func TestGetSettingsRateLimiterFailsOpen(t *testing.T) {
+	stub := &stubLimiter{err: errors.New("redis down")}
+	limiter := newRateLimiter(stub, RateLimits{Queries: RateLimit{Rate: 1, Burst: 1}}, log.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/settings", nil)
+	rec := httptest.NewRecorder()
+	if err := getSettings(&mockStore{}, mockAuth{}, nil, limiter)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("get settings: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 when limiter fails, got %d", rec.Code)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    RateLimit
+		wantErr bool
+	}{
+		{in: "", want: RateLimit{}},
+		{in: "2.5:10", want: RateLimit{Rate: 2.5, Burst: 10}},
+		{in: "10", wantErr: true},
+		{in: "0:10", wantErr: true},
+		{in: "1:0", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := ParseRateLimit(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%q: unexpected error %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q: got %+v want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	types, err := ParseCommandTypeLimits("create-task=1:5, update-task=10:20")
+	if err != nil {
+		t.Fatalf("parse command types: %v", err)
+	}
+	if types["create-task"] != (RateLimit{Rate: 1, Burst: 5}) || types["update-task"] != (RateLimit{Rate: 10, Burst: 20}) {
+		t.Fatalf("unexpected command type limits: %+v", types)
+	}
+	if _, err := ParseCommandTypeLimits("create-task"); err == nil {
+		t.Fatalf("expected error for entry without limit")
+	}
+}
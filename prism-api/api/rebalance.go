@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	"prism-api/domain"
+)
+
+// RankStore lists the tasks the rank rebalancer checks.
+type RankStore interface {
+	// ScanTasks calls fn with the tasks of each read model partition after
+	// the given one, in partition order.
+	ScanTasks(ctx context.Context, after string, fn func(partition string, tasks []domain.Task) error) error
+	// BoardOwner returns the board's owner or "" when the ID names no board.
+	BoardOwner(ctx context.Context, boardID string) (string, error)
+}
+
+// RebalanceLock lets one API node at a time run the rank rebalancer and
+// remembers how far the previous run got, so a table taking longer than one
+// interval to scan is covered over several runs.
+type RebalanceLock interface {
+	// TryLock takes the lock for ttl and reports whether it was free.
+	TryLock(ctx context.Context, ttl time.Duration) (bool, error)
+	// Cursor returns the last partition a run finished, or "" when the next
+	// run starts from the first partition.
+	Cursor(ctx context.Context) (string, error)
+	// SetCursor records the last finished partition; "" starts over.
+	SetCursor(ctx context.Context, partition string) error
+}
+
+// RedisRebalanceLock is a RebalanceLock kept in Redis keys sharing a prefix.
+type RedisRebalanceLock struct {
+	client redis.Cmdable
+	lock   string
+	cursor string
+}
+
+// NewRedisRebalanceLock creates a RebalanceLock stored under prefix+"lock"
+// and prefix+"cursor".
+func NewRedisRebalanceLock(client redis.Cmdable, prefix string) *RedisRebalanceLock {
+	return &RedisRebalanceLock{client: client, lock: prefix + "lock", cursor: prefix + "cursor"}
+}
+
+func (l *RedisRebalanceLock) TryLock(ctx context.Context, ttl time.Duration) (bool, error) {
+	return l.client.SetNX(ctx, l.lock, "1", ttl).Result()
+}
+
+func (l *RedisRebalanceLock) Cursor(ctx context.Context) (string, error) {
+	partition, err := l.client.Get(ctx, l.cursor).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return partition, err
+}
+
+func (l *RedisRebalanceLock) SetCursor(ctx context.Context, partition string) error {
+	if partition == "" {
+		return l.client.Del(ctx, l.cursor).Err()
+	}
+	return l.client.Set(ctx, l.cursor, partition, 0).Err()
+}
+
+// WithRankRebalance checks the tasks in store every interval and reorders the
+// categories whose tasks lack ranks or hold overly long ones; see
+// domain.PlanRebalance. Runs scan the tasks table, so only the node holding
+// lock runs them, and the lock is kept for the interval. A run that does not
+// finish within the interval leaves a cursor the next one resumes from.
+func WithRankRebalance(store RankStore, lock RebalanceLock, interval time.Duration) Option {
+	return func(o *options) {
+		o.ranks = store
+		o.rankLock = lock
+		o.rankInterval = interval
+	}
+}
+
+func startRankRebalance(store Storage, ranks RankStore, lock RebalanceLock, interval time.Duration, logger *log.Logger) {
+	if ranks == nil || lock == nil || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(bg, interval)
+			locked, err := lock.TryLock(ctx, interval)
+			n := 0
+			if err == nil && locked {
+				n, err = rebalanceRanks(ctx, store, ranks, lock)
+			}
+			cancel()
+			if err != nil {
+				logger.WithError(err).Warn("rank rebalance failed")
+			} else if n > 0 {
+				logger.Infof("rank rebalance reordered %d categories", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// rebalanceRanks enqueues a reorder-tasks command for every category, or part
+// of one, that needs new ranks and returns how many it sent. Board tasks are
+// reordered on behalf of the board's owner. It starts after the partition the
+// cursor of lock names and moves the cursor past every partition it finished,
+// back to the start once it reached the last one. The idempotency keys derive
+// from the plan and the task states it expects, so a run repeating an earlier
+// one before the read model applied it sends the same keys and the domain
+// service applies each reorder once.
+func rebalanceRanks(ctx context.Context, store Storage, ranks RankStore, lock RebalanceLock) (int, error) {
+	after, err := lock.Cursor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	err = ranks.ScanTasks(ctx, after, func(partition string, tasks []domain.Task) error {
+		n, err := rebalancePartition(ctx, store, ranks, partition, tasks)
+		if err != nil {
+			return err
+		}
+		sent += n
+		return lock.SetCursor(ctx, partition)
+	})
+	if err != nil {
+		return sent, err
+	}
+	return sent, lock.SetCursor(ctx, "")
+}
+
+// rebalancePartition enqueues the reorders of one partition's tasks and
+// returns how many it sent.
+func rebalancePartition(ctx context.Context, store Storage, ranks RankStore, partition string, tasks []domain.Task) (int, error) {
+	plans := domain.PlanRebalance(tasks)
+	if len(plans) == 0 {
+		return 0, nil
+	}
+	owner, err := ranks.BoardOwner(ctx, partition)
+	if err != nil {
+		return 0, err
+	}
+	userID, boardID := partition, ""
+	if owner != "" {
+		userID, boardID = owner, partition
+	}
+	cmds := make([]domain.Command, 0, len(plans))
+	for _, plan := range plans {
+		data, err := sonic.Marshal(plan)
+		if err != nil {
+			return 0, err
+		}
+		cmds = append(cmds, domain.Command{
+			IdempotencyKey: rebalanceKey(partition, plan),
+			EntityType:     "task",
+			Type:           domain.ReorderTasksCommand,
+			Data:           data,
+			BoardID:        boardID,
+		})
+	}
+	finalizeCommands(cmds)
+	if err := sequenceCommands(ctx, userID, cmds); err != nil {
+		return 0, err
+	}
+	if err := store.EnqueueCommands(ctx, userID, cmds); err != nil {
+		return 0, err
+	}
+	return len(cmds), nil
+}
+
+func rebalanceKey(partition string, plan domain.Reorder) string {
+	h := sha256.New()
+	for _, s := range []string{partition, plan.Category, strconv.Itoa(plan.Offset), strconv.Itoa(plan.Total)} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	for _, id := range plan.TaskIDs {
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(plan.Expected[id], 10)))
+		h.Write([]byte{0})
+	}
+	return "rebalance:" + hex.EncodeToString(h.Sum(nil)[:16])
+}
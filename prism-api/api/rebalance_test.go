@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+
+	"prism-api/domain"
+)
+
+type stubRanks struct {
+	partitions map[string][]domain.Task
+	owners     map[string]string
+}
+
+func (s stubRanks) ScanTasks(_ context.Context, after string, fn func(string, []domain.Task) error) error {
+	names := make([]string, 0, len(s.partitions))
+	for partition := range s.partitions {
+		if partition > after {
+			names = append(names, partition)
+		}
+	}
+	sort.Strings(names)
+	for _, partition := range names {
+		if err := fn(partition, s.partitions[partition]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s stubRanks) BoardOwner(_ context.Context, boardID string) (string, error) {
+	return s.owners[boardID], nil
+}
+
+type userCommandStore struct {
+	noopStore
+	byUser map[string][]domain.Command
+	fail   string
+}
+
+func (s *userCommandStore) EnqueueCommands(_ context.Context, userID string, cmds []domain.Command) error {
+	if userID == s.fail {
+		return errors.New("enqueue failed")
+	}
+	s.byUser[userID] = append(s.byUser[userID], cmds...)
+	return nil
+}
+
+func TestRebalanceRanksReordersUnrankedCategories(t *testing.T) {
+	ranks := stubRanks{
+		partitions: map[string][]domain.Task{
+			"u1": {{ID: "t1", Category: "normal", Order: 1, EventTimestamp: 3}, {ID: "t2", Category: "normal", Order: 0, EventTimestamp: 4}},
+			"b1": {{ID: "t3", Category: "urgent", Order: 0}},
+			"u2": {{ID: "t4", Category: "normal", Rank: "i"}},
+		},
+		owners: map[string]string{"b1": "owner"},
+	}
+	lock := newTestRebalanceLock(t)
+	store := &userCommandStore{byUser: map[string][]domain.Command{}}
+	n, err := rebalanceRanks(context.Background(), store, ranks, lock)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 commands, got %d (%v)", n, err)
+	}
+
+	personal := store.byUser["u1"]
+	if len(personal) != 1 || personal[0].Type != domain.ReorderTasksCommand || personal[0].BoardID != "" {
+		t.Fatalf("unexpected personal commands %+v", personal)
+	}
+	var data domain.Reorder
+	if err := sonic.Unmarshal(personal[0].Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Category != "normal" || len(data.TaskIDs) != 2 || data.TaskIDs[0] != "t2" || data.Expected["t1"] != 3 {
+		t.Fatalf("unexpected reorder %+v", data)
+	}
+	if board := store.byUser["owner"]; len(board) != 1 || board[0].BoardID != "b1" {
+		t.Fatalf("expected the board reorder on behalf of its owner, got %+v", store.byUser)
+	}
+
+	again := &userCommandStore{byUser: map[string][]domain.Command{}}
+	if _, err := rebalanceRanks(context.Background(), again, ranks, lock); err != nil {
+		t.Fatal(err)
+	}
+	if again.byUser["u1"][0].IdempotencyKey != personal[0].IdempotencyKey {
+		t.Fatal("expected runs over the same tasks to reuse idempotency keys")
+	}
+
+	// A task changed since: the new plan expects other states and gets a new key.
+	ranks.partitions["u1"][0].EventTimestamp = 5
+	moved := &userCommandStore{byUser: map[string][]domain.Command{}}
+	if _, err := rebalanceRanks(context.Background(), moved, ranks, lock); err != nil {
+		t.Fatal(err)
+	}
+	if moved.byUser["u1"][0].IdempotencyKey == personal[0].IdempotencyKey {
+		t.Fatal("expected a plan over changed tasks to get a new idempotency key")
+	}
+}
+
+func TestRebalanceRanksResumesAfterTheLastFinishedPartition(t *testing.T) {
+	ranks := stubRanks{
+		partitions: map[string][]domain.Task{
+			"u1": {{ID: "t1", Category: "normal", Order: 0}},
+			"u2": {{ID: "t2", Category: "normal", Order: 0}},
+			"u3": {{ID: "t3", Category: "normal", Order: 0}},
+		},
+	}
+	lock := newTestRebalanceLock(t)
+	ctx := context.Background()
+
+	// The run stops at u2, as one cut off by the interval would.
+	stopped := &userCommandStore{byUser: map[string][]domain.Command{}, fail: "u2"}
+	if _, err := rebalanceRanks(ctx, stopped, ranks, lock); err == nil {
+		t.Fatal("expected the failing partition to stop the run")
+	}
+	if cursor, err := lock.Cursor(ctx); err != nil || cursor != "u1" {
+		t.Fatalf("expected the cursor after u1, got %q (%v)", cursor, err)
+	}
+
+	resumed := &userCommandStore{byUser: map[string][]domain.Command{}}
+	n, err := rebalanceRanks(ctx, resumed, ranks, lock)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 commands, got %d (%v)", n, err)
+	}
+	if len(resumed.byUser["u1"]) != 0 || len(resumed.byUser["u2"]) != 1 || len(resumed.byUser["u3"]) != 1 {
+		t.Fatalf("expected the run to resume after u1, got %+v", resumed.byUser)
+	}
+	if cursor, err := lock.Cursor(ctx); err != nil || cursor != "" {
+		t.Fatalf("expected a finished scan to clear the cursor, got %q (%v)", cursor, err)
+	}
+
+	again := &userCommandStore{byUser: map[string][]domain.Command{}}
+	if _, err := rebalanceRanks(ctx, again, ranks, lock); err != nil {
+		t.Fatal(err)
+	}
+	if len(again.byUser["u1"]) != 1 {
+		t.Fatalf("expected the next run to start over, got %+v", again.byUser)
+	}
+}
+
+func newTestRebalanceRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		rc.Close()
+		m.Close()
+	})
+	return m, rc
+}
+
+func newTestRebalanceLock(t *testing.T) *RedisRebalanceLock {
+	t.Helper()
+	_, rc := newTestRebalanceRedis(t)
+	return NewRedisRebalanceLock(rc, "ranks:rebalance:")
+}
+
+func TestRedisRebalanceLockAdmitsOneNodePerInterval(t *testing.T) {
+	m, rc := newTestRebalanceRedis(t)
+	ctx := context.Background()
+	first, second := NewRedisRebalanceLock(rc, "ranks:rebalance:"), NewRedisRebalanceLock(rc, "ranks:rebalance:")
+	if ok, err := first.TryLock(ctx, time.Hour); err != nil || !ok {
+		t.Fatalf("expected the first node to take the lock, got %v (%v)", ok, err)
+	}
+	if ok, err := second.TryLock(ctx, time.Hour); err != nil || ok {
+		t.Fatalf("expected the second node to be turned away, got %v (%v)", ok, err)
+	}
+	m.FastForward(time.Hour)
+	if ok, err := second.TryLock(ctx, time.Hour); err != nil || !ok {
+		t.Fatalf("expected the lock to be free after the interval, got %v (%v)", ok, err)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"auth"
+	"prism-api/domain"
+)
+
+// errMissingScope is returned when the token lacks the scope a route needs.
+var errMissingScope = errors.New("missing scope")
+
+// requireScope rejects principals whose token does not grant scope.
+func requireScope(p auth.Principal, scope string) error {
+	if p.HasScope(scope) {
+		return nil
+	}
+	return fmt.Errorf("%w %s", errMissingScope, scope)
+}
+
+// requireReadScope guards the query routes.
+func requireReadScope(p auth.Principal) error {
+	return requireScope(p, auth.ScopeTasksRead)
+}
+
+// commandScope returns the scope needed to issue cmd.
+func commandScope(cmd *domain.Command) string {
+	switch cmd.EntityType {
+	case "user", settingsEntityType:
+		return auth.ScopeSettingsWrite
+	case boardEntityType:
+		return auth.ScopeBoardsWrite
+	default:
+		return auth.ScopeTasksWrite
+	}
+}
+
+// authorizeCommandScopes checks every command of a request against the scopes
+// of the token. A single missing scope rejects the whole batch.
+func authorizeCommandScopes(p auth.Principal, cmds []domain.Command) error {
+	for i := range cmds {
+		if err := requireScope(p, commandScope(&cmds[i])); err != nil {
+			return fmt.Errorf("command %d (%s): %w", i, cmds[i].Type, err)
+		}
+	}
+	return nil
+}
+
+// scopeRejected answers 403 for tokens lacking a required scope.
+func scopeRejected(c echo.Context, metrics *requestMetrics, err error) error {
+	metrics.SetErrorStage("scope")
+	return c.String(http.StatusForbidden, err.Error())
+}
+
+// unauthenticated answers a failed authentication with 401, or with 429 when
+// the token could not be checked because its user had too many token lookups,
+// so clients retry instead of discarding a token that may be valid.
+func unauthenticated(c echo.Context, err error) error {
+	if errors.Is(err, auth.ErrTooManyTokenLookups) {
+		c.Response().Header().Set("Retry-After", "1")
+		return c.String(http.StatusTooManyRequests, err.Error())
+	}
+	return c.String(http.StatusUnauthorized, err.Error())
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"auth"
+)
+
+// scopedAuth authenticates every request as "user" holding the given scopes.
+type scopedAuth []string
+
+func (s scopedAuth) Authenticate(string) (auth.Principal, error) {
+	return auth.Principal{UserID: "user", Scopes: s}, nil
+}
+
+// failingAuth rejects every request with its error.
+type failingAuth struct{ err error }
+
+func (f failingAuth) Authenticate(string) (auth.Principal, error) {
+	return auth.Principal{}, f.err
+}
+
+func TestLimitedTokenLookupsAreRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"invalid token", errors.New("invalid personal access token"), http.StatusUnauthorized},
+		{"lookups limited", auth.ErrTooManyTokenLookups, http.StatusTooManyRequests},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tasksRoute, nil)
+			rec := httptest.NewRecorder()
+			if err := getTasks(&mockStore{}, failingAuth{tc.err}, log.New(), nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestQueriesRequireReadScope(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		scopes scopedAuth
+		status int
+	}{
+		{"read", scopedAuth{auth.ScopeTasksRead}, http.StatusOK},
+		{"write only", scopedAuth{auth.ScopeTasksWrite}, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for route, handler := range map[string]echo.HandlerFunc{
+				tasksRoute:    getTasks(&mockStore{}, tc.scopes, log.New(), nil, nil),
+				settingsRoute: getSettings(&mockStore{}, tc.scopes, nil, nil),
+				boardsRoute:   getBoards(tc.scopes, nil, nil),
+			} {
+				req := httptest.NewRequest(http.MethodGet, route, nil)
+				rec := httptest.NewRecorder()
+				if err := handler(echo.New().NewContext(req, rec)); err != nil {
+					t.Fatalf("%s: %v", route, err)
+				}
+				if rec.Code != tc.status {
+					t.Fatalf("%s: expected status %d, got %d", route, tc.status, rec.Code)
+				}
+				if tc.status == http.StatusForbidden && !strings.Contains(rec.Body.String(), "missing scope tasks:read") {
+					t.Fatalf("%s: unexpected error %q", route, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestPostCommandsRequiresScopePerCommandType(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+
+	task := `{"entityType":"task","type":"create-task"}`
+	settings := `{"entityType":"user-settings","type":"update-user-settings","data":{"showDoneTasks":true}}`
+	board := `{"entityType":"board","type":"create-board","data":{"name":"Team"}}`
+	cases := []struct {
+		name   string
+		scopes scopedAuth
+		body   string
+		status int
+	}{
+		{"task with tasks:write", scopedAuth{auth.ScopeTasksWrite}, "[" + task + "]", http.StatusAccepted},
+		{"task with read only", scopedAuth{auth.ScopeTasksRead}, "[" + task + "]", http.StatusForbidden},
+		{"settings with tasks:write", scopedAuth{auth.ScopeTasksWrite}, "[" + settings + "]", http.StatusForbidden},
+		{"settings with settings:write", scopedAuth{auth.ScopeSettingsWrite}, "[" + settings + "]", http.StatusAccepted},
+		{"board with boards:write", scopedAuth{auth.ScopeBoardsWrite}, "[" + board + "]", http.StatusAccepted},
+		{"mixed batch missing one scope", scopedAuth{auth.ScopeTasksWrite}, "[" + task + "," + board + "]", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockStore{}
+			initCommandSender(store, log.New())
+			t.Cleanup(resetCommandSenderForTests)
+			req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			if err := postCommands(store, tc.scopes, nil, nil, nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if tc.status == http.StatusAccepted {
+				waitForCommands(t, store, strings.Count(tc.body, "entityType"))
+			} else if len(store.Commands()) != 0 {
+				t.Fatalf("rejected commands must not be enqueued")
+			}
+		})
+	}
+}
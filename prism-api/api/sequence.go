@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+
+	"prism-api/domain"
+)
+
+// Sequencer hands out monotonic sequence numbers shared by all API nodes.
+type Sequencer interface {
+	// Reserve reserves n consecutive numbers of the key's sequence and returns
+	// the first one. Sequences start at 1.
+	Reserve(ctx context.Context, key string, n int) (int64, error)
+}
+
+// WithSequencer stamps every command with the next number of its read model
+// partition's sequence: the board for board commands and the user otherwise.
+// The read model then orders a partition's events by sequence instead of by
+// the timestamps of API nodes whose clocks may drift apart.
+func WithSequencer(s Sequencer) Option {
+	return func(o *options) {
+		o.sequencer = s
+	}
+}
+
+// commandSequencer is the sequencer used for accepted commands; nil leaves
+// them ordered by timestamp.
+var commandSequencer Sequencer
+
+// sequenceCommands stamps finalized commands with sequence numbers, in request
+// order within each partition. It is a no-op without a sequencer.
+func sequenceCommands(ctx context.Context, userID string, cmds []domain.Command) error {
+	if commandSequencer == nil || len(cmds) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	var keys []string
+	for i := range cmds {
+		key := sequenceKey(userID, cmds[i])
+		if counts[key] == 0 {
+			keys = append(keys, key)
+		}
+		counts[key]++
+	}
+	next := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		start, err := commandSequencer.Reserve(ctx, key, counts[key])
+		if err != nil {
+			return err
+		}
+		next[key] = start
+	}
+	for i := range cmds {
+		key := sequenceKey(userID, cmds[i])
+		cmds[i].Sequence = next[key]
+		next[key]++
+	}
+	return nil
+}
+
+func sequenceKey(userID string, cmd domain.Command) string {
+	if cmd.BoardID != "" {
+		return cmd.BoardID
+	}
+	return userID
+}
+
+// SequenceFloor reads the highest sequence already stored for a partition.
+type SequenceFloor interface {
+	// LastSequence returns the highest sequence the read model holds for the
+	// partition, 0 when it holds none.
+	LastSequence(ctx context.Context, partition string) (int64, error)
+}
+
+// sequenceSeedGap is added to the stored sequence when a counter is seeded.
+// Commands still queued carry numbers above the stored ones; the gap keeps
+// new numbers above theirs as well.
+const sequenceSeedGap = 1000
+
+// reserveScript increments an existing counter and returns nil for a missing
+// one, so a counter lost with Redis is seeded instead of restarting at 1.
+var reserveScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return false
+`)
+
+// RedisSequencer keeps each sequence in a Redis counter. A missing counter is
+// seeded from floor, as a counter lost with the Redis data would otherwise
+// restart below the sequences the read model holds and every later command of
+// the partition would be dropped as stale.
+type RedisSequencer struct {
+	client redis.Cmdable
+	prefix string
+	floor  SequenceFloor
+}
+
+// NewRedisSequencer creates a Sequencer storing counters under prefix+key and
+// seeding missing ones from floor.
+func NewRedisSequencer(client redis.Cmdable, prefix string, floor SequenceFloor) *RedisSequencer {
+	return &RedisSequencer{client: client, prefix: prefix, floor: floor}
+}
+
+func (s *RedisSequencer) Reserve(ctx context.Context, key string, n int) (int64, error) {
+	keys := []string{s.prefix + key}
+	end, err := reserveScript.Run(ctx, s.client, keys, n).Int64()
+	if errors.Is(err, redis.Nil) {
+		last, floorErr := s.floor.LastSequence(ctx, key)
+		if floorErr != nil {
+			return 0, floorErr
+		}
+		if last > 0 {
+			last += sequenceSeedGap
+		}
+		// Another node may seed the counter first; NX keeps its value.
+		if err := s.client.SetNX(ctx, keys[0], last, 0).Err(); err != nil {
+			return 0, err
+		}
+		end, err = reserveScript.Run(ctx, s.client, keys, n).Int64()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return end - int64(n) + 1, nil
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	"prism-api/domain"
+)
+
+// stubFloor serves the sequences stored per partition.
+type stubFloor map[string]int64
+
+func (f stubFloor) LastSequence(_ context.Context, partition string) (int64, error) {
+	return f[partition], nil
+}
+
+func newTestRedisSequencer(t *testing.T) *RedisSequencer {
+	t.Helper()
+	seq, _ := newSeededRedisSequencer(t, stubFloor{})
+	return seq
+}
+
+func newSeededRedisSequencer(t *testing.T, floor SequenceFloor) (*RedisSequencer, *miniredis.Miniredis) {
+	t.Helper()
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		rc.Close()
+		m.Close()
+	})
+	return NewRedisSequencer(rc, "seq:", floor), m
+}
+
+func TestRedisSequencerReservesConsecutiveRanges(t *testing.T) {
+	seq := newTestRedisSequencer(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		key  string
+		n    int
+		want int64
+	}{
+		{"u1", 3, 1},
+		{"u1", 1, 4},
+		{"u2", 2, 1},
+		{"u1", 2, 5},
+	} {
+		got, err := seq.Reserve(ctx, tc.key, tc.n)
+		if err != nil {
+			t.Fatalf("reserve %s: %v", tc.key, err)
+		}
+		if got != tc.want {
+			t.Fatalf("reserve %d of %s: expected start %d, got %d", tc.n, tc.key, tc.want, got)
+		}
+	}
+}
+
+func TestRedisSequencerSeedsLostCountersFromStoredSequences(t *testing.T) {
+	floor := stubFloor{"u1": 41}
+	seq, m := newSeededRedisSequencer(t, floor)
+	ctx := context.Background()
+
+	if got, err := seq.Reserve(ctx, "u1", 2); err != nil || got != 41+sequenceSeedGap+1 {
+		t.Fatalf("expected the counter to continue above the stored sequence, got %d (%v)", got, err)
+	}
+	if got, err := seq.Reserve(ctx, "u1", 1); err != nil || got != 41+sequenceSeedGap+3 {
+		t.Fatalf("expected the seeded counter to be reused, got %d (%v)", got, err)
+	}
+
+	// Redis restarted without its data after the read model applied them.
+	floor["u1"] = 41 + sequenceSeedGap + 3
+	m.FlushAll()
+	if got, err := seq.Reserve(ctx, "u1", 1); err != nil || got != 41+2*sequenceSeedGap+4 {
+		t.Fatalf("expected the lost counter to be seeded again, got %d (%v)", got, err)
+	}
+}
+
+func TestSequenceCommandsNumbersEachPartition(t *testing.T) {
+	commandSequencer = newTestRedisSequencer(t)
+	t.Cleanup(func() { commandSequencer = nil })
+
+	cmds := []domain.Command{
+		{Type: "update-task"},
+		{Type: "update-task", BoardID: "b1"},
+		{Type: "complete-task"},
+		{Type: "reopen-task", BoardID: "b1"},
+	}
+	if err := sequenceCommands(context.Background(), "u1", cmds); err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{1, 1, 2, 2}
+	for i, cmd := range cmds {
+		if cmd.Sequence != want[i] {
+			t.Fatalf("command %d: expected sequence %d, got %d", i, want[i], cmd.Sequence)
+		}
+	}
+}
+
+type failingSequencer struct{}
+
+func (failingSequencer) Reserve(context.Context, string, int) (int64, error) {
+	return 0, errors.New("redis down")
+}
+
+func TestPostCommandsSequencesCommands(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	commandSequencer = newTestRedisSequencer(t)
+	t.Cleanup(func() { commandSequencer = nil })
+
+	e := echo.New()
+	store := &mockStore{}
+	initCommandSender(store, log.New())
+	handler := postCommands(store, mockAuth{}, nil, nil, nil, nil)
+
+	// A sequence sent by the client is replaced.
+	body := `[{"entityType":"task","type":"create-task","sequence":99},{"entityType":"task","type":"update-task"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d", rec.Code)
+	}
+	cmds := waitForCommands(t, store, 2)
+	if cmds[0].Sequence != 1 || cmds[1].Sequence != 2 {
+		t.Fatalf("expected sequences 1 and 2, got %d and %d", cmds[0].Sequence, cmds[1].Sequence)
+	}
+}
+
+func TestPostCommandsRejectsWhenSequencerFails(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	commandSequencer = failingSequencer{}
+	t.Cleanup(func() { commandSequencer = nil })
+
+	e := echo.New()
+	store := &mockStore{}
+	initCommandSender(store, log.New())
+	handler := postCommands(store, mockAuth{}, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/commands", strings.NewReader(`[{"entityType":"task","type":"create-task"}]`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 got %d", rec.Code)
+	}
+	if n := len(store.Commands()); n != 0 {
+		t.Fatalf("expected nothing enqueued, got %d commands", n)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"prism-api/domain"
+	"settings"
+)
+
+const (
+	settingsEntityType        = "user-settings"
+	updateUserSettingsCommand = "update-user-settings"
+)
+
+//go:embed settings.schema.json
+var settingsSchemaJSON string
+
+// settingsSchema validates the data of update-user-settings commands.
+var settingsSchema = compileSettingsSchema()
+
+func compileSettingsSchema() *jsonschema.Schema {
+	c := jsonschema.NewCompiler()
+	c.AssertFormat = true
+	c.Formats["timezone"] = isTimezone
+	if err := c.AddResource("settings.schema.json", strings.NewReader(settingsSchemaJSON)); err != nil {
+		panic(err)
+	}
+	return c.MustCompile("settings.schema.json")
+}
+
+// isTimezone accepts IANA time zone names such as "Europe/Berlin" or "UTC".
+func isTimezone(v any) bool {
+	name, ok := v.(string)
+	if !ok {
+		return true
+	}
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// validateSettingsCommand checks the data of settings commands against the
+// settings schema; other commands pass.
+func validateSettingsCommand(cmd *domain.Command) error {
+	if cmd.EntityType != settingsEntityType || cmd.Type != updateUserSettingsCommand {
+		return nil
+	}
+	if len(cmd.Data) == 0 {
+		return fmt.Errorf("%s requires data", cmd.Type)
+	}
+	var data any
+	if err := json.Unmarshal(cmd.Data, &data); err != nil {
+		return fmt.Errorf("%s data: %w", cmd.Type, err)
+	}
+	if err := settingsSchema.Validate(data); err != nil {
+		var verr *jsonschema.ValidationError
+		if !errors.As(err, &verr) {
+			return fmt.Errorf("%s data: %w", cmd.Type, err)
+		}
+		for len(verr.Causes) > 0 {
+			verr = verr.Causes[0]
+		}
+		loc := verr.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		return fmt.Errorf("%s data %s: %s", cmd.Type, loc, verr.Message)
+	}
+	update, err := decodeCategoryUpdate(cmd)
+	if err != nil {
+		return err
+	}
+	if update.DefaultCategory != nil && update.Categories != nil {
+		return checkDefaultCategory(cmd.Type, *update.DefaultCategory, *update.Categories, false)
+	}
+	return nil
+}
+
+// categoryUpdate holds the fields of a settings command that decide which
+// categories may be the default one; nil fields are left unchanged.
+type categoryUpdate struct {
+	DefaultCategory *string              `json:"defaultCategory"`
+	Categories      *[]settings.Category `json:"categories"`
+}
+
+func decodeCategoryUpdate(cmd *domain.Command) (categoryUpdate, error) {
+	var update categoryUpdate
+	if err := json.Unmarshal(cmd.Data, &update); err != nil {
+		return categoryUpdate{}, fmt.Errorf("%s data: %w", cmd.Type, err)
+	}
+	return update, nil
+}
+
+// checkDefaultCategory rejects a default category that is neither built in
+// nor one of categories. replaced reports whether the command replaced the
+// categories rather than the default, which is then the field at fault.
+func checkDefaultCategory(cmdType, defaultCategory string, categories []settings.Category, replaced bool) error {
+	if settings.IsCategory(defaultCategory, categories) {
+		return nil
+	}
+	if replaced {
+		return fmt.Errorf("%s data /categories: removes default category %q", cmdType, defaultCategory)
+	}
+	return fmt.Errorf("%s data /defaultCategory: %q is not a built-in category or one of categories", cmdType, defaultCategory)
+}
+
+// errSettingsUnavailable marks validation failures caused by stored settings
+// that could not be read rather than by the commands.
+var errSettingsUnavailable = errors.New("settings unavailable")
+
+// validateSettingsCategories checks the default category of validated
+// settings commands that change only one of defaultCategory and categories
+// against the user's stored settings and the commands before them.
+func validateSettingsCategories(ctx context.Context, store Storage, userID string, cmds []domain.Command) error {
+	var current *domain.Settings
+	for i := range cmds {
+		cmd := &cmds[i]
+		if cmd.EntityType != settingsEntityType || cmd.Type != updateUserSettingsCommand {
+			continue
+		}
+		update, err := decodeCategoryUpdate(cmd)
+		if err != nil {
+			return fmt.Errorf("command %d: %w", i, err)
+		}
+		if update.DefaultCategory == nil && update.Categories == nil {
+			continue
+		}
+		if current == nil {
+			stored, fetchErr := store.FetchSettings(ctx, userID)
+			if fetchErr != nil && !errors.Is(fetchErr, domain.ErrSettingsNotFound) {
+				return fmt.Errorf("%w: %w", errSettingsUnavailable, fetchErr)
+			}
+			stored.Upgrade()
+			current = &stored
+		}
+		if update.DefaultCategory != nil {
+			current.DefaultCategory = *update.DefaultCategory
+		}
+		if update.Categories != nil {
+			current.Categories = *update.Categories
+		}
+		replaced := update.DefaultCategory == nil
+		if err := checkDefaultCategory(cmd.Type, current.DefaultCategory, current.Categories, replaced); err != nil {
+			return fmt.Errorf("command %d: %w", i, err)
+		}
+	}
+	return nil
+}
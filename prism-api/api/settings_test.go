@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"prism-api/domain"
+	"settings"
+)
+
+func TestValidateSettingsCommand(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"single field", `{"showDoneTasks":true}`, ""},
+		{"full document", `{"tasksPerCategory":5,"showDoneTasks":false,"theme":"dark","defaultCategory":"work","categories":[{"name":"work","color":"#1a2B3c"}],"timezone":"America/New_York","weekStart":"sunday"}`, ""},
+		{"empty category list", `{"categories":[]}`, ""},
+		{"missing data", ``, "requires data"},
+		{"null data", `null`, "data /"},
+		{"no fields", `{}`, "data /"},
+		{"unknown field", `{"fontSize":12}`, "data /"},
+		{"tasks per category below one", `{"tasksPerCategory":0}`, "/tasksPerCategory"},
+		{"fractional tasks per category", `{"tasksPerCategory":2.5}`, "/tasksPerCategory"},
+		{"unknown theme", `{"theme":"sepia"}`, "/theme"},
+		{"unknown week start", `{"weekStart":"friday"}`, "/weekStart"},
+		{"unknown timezone", `{"timezone":"Mars/Olympus"}`, "/timezone"},
+		{"blank default category", `{"defaultCategory":" "}`, "/defaultCategory"},
+		{"invalid color", `{"categories":[{"name":"work","color":"red"}]}`, "/categories/0/color"},
+		{"category without color", `{"categories":[{"name":"work"}]}`, "/categories/0"},
+		{"built-in default category", `{"defaultCategory":"fun","categories":[]}`, ""},
+		{"default category not in categories", `{"defaultCategory":"work","categories":[{"name":"home","color":"#112233"}]}`, "/defaultCategory"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := domain.Command{EntityType: "user-settings", Type: "update-user-settings", Data: []byte(tc.data)}
+			err := validateSettingsCommand(&cmd)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateSettingsCategories(t *testing.T) {
+	work := []settings.Category{{Name: "work", Color: "#112233"}}
+	cases := []struct {
+		name     string
+		stored   domain.Settings
+		notFound bool
+		data     []string
+		wantErr  string
+	}{
+		{"built-in default", domain.Settings{}, false, []string{`{"defaultCategory":"important"}`}, ""},
+		{"stored category as default", domain.Settings{Categories: work}, false, []string{`{"defaultCategory":"work"}`}, ""},
+		{"unknown default", domain.Settings{Categories: work}, false, []string{`{"defaultCategory":"home"}`}, "command 0: update-user-settings data /defaultCategory"},
+		{"unknown default without stored settings", domain.Settings{}, true, []string{`{"defaultCategory":"work"}`}, "/defaultCategory"},
+		{"categories removing the default", domain.Settings{DefaultCategory: "work", Categories: work}, false, []string{`{"categories":[]}`}, "/categories: removes default category \"work\""},
+		{"categories keeping the default", domain.Settings{DefaultCategory: "work", Categories: work}, false, []string{`{"categories":[{"name":"work","color":"#445566"}]}`}, ""},
+		{"categories removing a built-in default", domain.Settings{DefaultCategory: "fun", Categories: work}, false, []string{`{"categories":[]}`}, ""},
+		{"category added earlier in the batch", domain.Settings{}, false, []string{`{"categories":[{"name":"home","color":"#112233"}]}`, `{"defaultCategory":"home"}`}, ""},
+		{"category removed earlier in the batch", domain.Settings{Categories: work}, false, []string{`{"categories":[]}`, `{"defaultCategory":"work"}`}, "command 1: update-user-settings data /defaultCategory"},
+		{"other fields only", domain.Settings{DefaultCategory: "gone"}, false, []string{`{"theme":"dark"}`}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockStore{settings: tc.stored}
+			if tc.notFound {
+				store.settingsErr = domain.ErrSettingsNotFound
+			}
+			cmds := make([]domain.Command, len(tc.data))
+			for i, data := range tc.data {
+				cmds[i] = domain.Command{EntityType: "user-settings", Type: "update-user-settings", Data: []byte(data)}
+			}
+			err := validateSettingsCategories(context.Background(), store, "u1", cmds)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPostCommandsRejectsDefaultCategoryOfRemovedCategories(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	store := &mockStore{settings: domain.Settings{DefaultCategory: "work", Categories: []settings.Category{{Name: "work", Color: "#112233"}}}}
+	initCommandSender(store, log.New())
+
+	body := `[{"entityType":"user-settings","type":"update-user-settings","data":{"categories":[]}}]`
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := postCommands(store, mockAuth{}, nil, nil, nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if n := len(store.Commands()); n != 0 {
+		t.Fatalf("expected nothing enqueued, got %d commands", n)
+	}
+}
+
+func TestPostCommandsFailsWhenSettingsUnavailable(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	store := &mockStore{settingsErr: errors.New("table unavailable")}
+	initCommandSender(store, log.New())
+
+	body := `[{"entityType":"user-settings","type":"update-user-settings","data":{"defaultCategory":"fun"}}]`
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := postCommands(store, mockAuth{}, nil, nil, nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+}
+
+func TestPostCommandsRejectsInvalidSettings(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	store := &mockStore{}
+	initCommandSender(store, log.New())
+
+	body := `[{"entityType":"task","type":"create-task"},{"entityType":"user-settings","type":"update-user-settings","data":{"theme":"sepia"}}]`
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := postCommands(store, mockAuth{}, nil, nil, nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "command 1: update-user-settings data /theme") {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+	if n := len(store.Commands()); n != 0 {
+		t.Fatalf("expected nothing enqueued, got %d commands", n)
+	}
+}
+
+func TestGetSettingsReturnsVersionedDocument(t *testing.T) {
+	stored := domain.Settings{TasksPerCategory: 3}
+	stored.Upgrade()
+	store := &mockStore{settings: stored}
+	req := httptest.NewRequest(http.MethodGet, settingsRoute, nil)
+	rec := httptest.NewRecorder()
+	if err := getSettings(store, mockAuth{}, nil, nil)(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	if err := sonic.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"version", "tasksPerCategory", "showDoneTasks", "theme", "defaultCategory", "categories", "timezone", "weekStart"} {
+		if _, ok := body[field]; !ok {
+			t.Fatalf("expected %s in %s", field, rec.Body.String())
+		}
+	}
+}
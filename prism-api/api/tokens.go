@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+
+	"auth"
+)
+
+const tokensRoute = "/api/tokens"
+
+const (
+	defaultTokenLifetimeDays = 30
+	maxTokenLifetimeDays     = 365
+	maxTokenNameLength       = 100
+	maxTokensPerUser         = 50
+	// createTokenMaxSize bounds the body of a token creation request.
+	createTokenMaxSize = 4 * 1024
+)
+
+// TokenStore persists personal access tokens.
+type TokenStore interface {
+	CreateToken(ctx context.Context, tok auth.PersonalToken) error
+	ListTokens(ctx context.Context, userID string) ([]auth.PersonalToken, error)
+	RevokeToken(ctx context.Context, userID, id string) (bool, error)
+}
+
+// WithPersonalTokens exposes the endpoints managing personal access tokens.
+func WithPersonalTokens(store TokenStore) Option {
+	return func(o *options) {
+		o.tokens = store
+	}
+}
+
+type createTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays,omitempty"`
+}
+
+type tokenResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Token is only returned when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+func newTokenResponse(tok auth.PersonalToken) tokenResponse {
+	return tokenResponse{ID: tok.ID, Name: tok.Name, Scopes: tok.Scopes, CreatedAt: tok.CreatedAt, ExpiresAt: tok.ExpiresAt}
+}
+
+func (r *createTokenRequest) validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > maxTokenNameLength {
+		return fmt.Errorf("name must be between 1 and %d characters", maxTokenNameLength)
+	}
+	if len(r.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, s := range r.Scopes {
+		if !auth.IsPrismScope(s) {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	if r.ExpiresInDays == 0 {
+		r.ExpiresInDays = defaultTokenLifetimeDays
+	}
+	if r.ExpiresInDays < 0 || r.ExpiresInDays > maxTokenLifetimeDays {
+		return fmt.Errorf("expiresInDays must be between 1 and %d", maxTokenLifetimeDays)
+	}
+	return nil
+}
+
+// tokenCaller authenticates a token management request. Personal access
+// tokens cannot manage tokens, so a leaked token cannot mint new ones.
+func tokenCaller(c echo.Context, authn Authenticator, limiter *rateLimiter) (p auth.Principal, ok bool, err error) {
+	p, authErr := authn.Authenticate(c.Request().Header.Get("Authorization"))
+	if authErr != nil {
+		return p, false, unauthenticated(c, authErr)
+	}
+	if p.TokenID != "" {
+		return p, false, c.String(http.StatusForbidden, "personal access tokens cannot manage tokens")
+	}
+	if !limiter.allowQuery(c, p.UserID) {
+		return p, false, rateLimited(c)
+	}
+	return p, true, nil
+}
+
+func createToken(store TokenStore, authn Authenticator, limiter *rateLimiter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, ok, err := tokenCaller(c, authn, limiter)
+		if !ok {
+			return err
+		}
+		var req createTokenRequest
+		dec := sonic.ConfigFastest.NewDecoder(io.LimitReader(c.Request().Body, createTokenMaxSize))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return c.String(http.StatusBadRequest, "invalid body")
+		}
+		if err := req.validate(); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		// Tokens cannot grant more than the session creating them.
+		for _, s := range req.Scopes {
+			if err := requireScope(p, s); err != nil {
+				return c.String(http.StatusForbidden, err.Error())
+			}
+		}
+		ctx := c.Request().Context()
+		existing, err := store.ListTokens(ctx, p.UserID)
+		if err != nil {
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to list tokens")
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		// Expired tokens are kept for the list but no longer count.
+		active := 0
+		for _, tok := range existing {
+			if now.Before(tok.ExpiresAt) {
+				active++
+			}
+		}
+		if active >= maxTokensPerUser {
+			return c.String(http.StatusConflict, fmt.Sprintf("at most %d tokens per user", maxTokensPerUser))
+		}
+		raw, tok, err := auth.NewPersonalToken(p.UserID, req.Name, req.Scopes, now, now.AddDate(0, 0, req.ExpiresInDays))
+		if err != nil {
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to create token")
+		}
+		if err := store.CreateToken(ctx, tok); err != nil {
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to create token")
+		}
+		resp := newTokenResponse(tok)
+		resp.Token = raw
+		return c.JSON(http.StatusCreated, resp)
+	}
+}
+
+func listTokens(store TokenStore, authn Authenticator, limiter *rateLimiter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, ok, err := tokenCaller(c, authn, limiter)
+		if !ok {
+			return err
+		}
+		tokens, err := store.ListTokens(c.Request().Context(), p.UserID)
+		if err != nil {
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to list tokens")
+		}
+		resp := make([]tokenResponse, 0, len(tokens))
+		for _, tok := range tokens {
+			resp = append(resp, newTokenResponse(tok))
+		}
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+func revokeToken(store TokenStore, authn Authenticator, limiter *rateLimiter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, ok, err := tokenCaller(c, authn, limiter)
+		if !ok {
+			return err
+		}
+		found, err := store.RevokeToken(c.Request().Context(), p.UserID, c.Param("id"))
+		if err != nil {
+			c.Logger().Error(err)
+			return c.String(http.StatusInternalServerError, "failed to revoke token")
+		}
+		if !found {
+			return c.String(http.StatusNotFound, "token not found")
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
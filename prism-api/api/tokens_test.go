@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"auth"
+)
+
+type memoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]auth.PersonalToken
+}
+
+func (m *memoryTokenStore) CreateToken(_ context.Context, tok auth.PersonalToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = map[string]auth.PersonalToken{}
+	}
+	m.tokens[tok.ID] = tok
+	return nil
+}
+
+func (m *memoryTokenStore) ListTokens(_ context.Context, userID string) ([]auth.PersonalToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []auth.PersonalToken{}
+	for _, tok := range m.tokens {
+		if tok.UserID == userID {
+			out = append(out, tok)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryTokenStore) RevokeToken(_ context.Context, userID, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tok, ok := m.tokens[id]
+	if !ok || tok.UserID != userID {
+		return false, nil
+	}
+	delete(m.tokens, id)
+	return true, nil
+}
+
+func (m *memoryTokenStore) PersonalToken(_ context.Context, userID, id string) (*auth.PersonalToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tok, ok := m.tokens[id]
+	if !ok || tok.UserID != userID {
+		return nil, nil
+	}
+	return &tok, nil
+}
+
+func serveTokens(t *testing.T, store *memoryTokenStore, authn Authenticator, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	e.GET(tokensRoute, listTokens(store, authn, nil))
+	e.POST(tokensRoute, createToken(store, authn, nil))
+	e.DELETE(tokensRoute+"/:id", revokeToken(store, authn, nil))
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPersonalTokenLifecycle(t *testing.T) {
+	store := &memoryTokenStore{}
+
+	rec := serveTokens(t, store, mockAuth{}, http.MethodPost, tokensRoute, `{"name":"ci","scopes":["tasks:read"],"expiresInDays":7}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created tokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Token, auth.PersonalTokenPrefix) || created.ExpiresAt.Sub(created.CreatedAt).Hours() != 7*24 {
+		t.Fatalf("unexpected token %+v", created)
+	}
+	if stored := store.tokens[created.ID]; stored.Hash == "" || strings.Contains(stored.Hash, created.Token) {
+		t.Fatalf("expected only the hash to be stored, got %+v", stored)
+	}
+
+	// The authenticator accepts the token with exactly the granted scopes.
+	authn := &auth.Authenticator{}
+	authn.AcceptPersonalTokens(store)
+	p, err := authn.Authenticate("Bearer " + created.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.UserID != "user" || !p.HasScope(auth.ScopeTasksRead) || p.HasScope(auth.ScopeTasksWrite) {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+
+	rec = serveTokens(t, store, mockAuth{}, http.MethodGet, tokensRoute, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Token) || !strings.Contains(rec.Body.String(), created.ID) {
+		t.Fatalf("list: unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveTokens(t, store, mockAuth{}, http.MethodDelete, tokensRoute+"/"+created.ID, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d", rec.Code)
+	}
+	if _, err := authn.Authenticate("Bearer " + created.Token); err == nil {
+		t.Fatal("expected revoked token to be rejected")
+	}
+	rec = serveTokens(t, store, mockAuth{}, http.MethodDelete, tokensRoute+"/"+created.ID, "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("revoke again: expected 404, got %d", rec.Code)
+	}
+}
+
+// patAuth authenticates every request with a personal access token.
+type patAuth struct{}
+
+func (patAuth) Authenticate(string) (auth.Principal, error) {
+	return auth.Principal{UserID: "user", Scopes: []string{auth.ScopeTasksRead}, TokenID: "t1"}, nil
+}
+
+func TestCreatePersonalTokenRejections(t *testing.T) {
+	cases := []struct {
+		name   string
+		authn  Authenticator
+		body   string
+		status int
+	}{
+		{"unknown scope", mockAuth{}, `{"name":"ci","scopes":["admin"]}`, http.StatusBadRequest},
+		{"no scopes", mockAuth{}, `{"name":"ci","scopes":[]}`, http.StatusBadRequest},
+		{"missing name", mockAuth{}, `{"scopes":["tasks:read"]}`, http.StatusBadRequest},
+		{"too long", mockAuth{}, `{"name":"ci","scopes":["tasks:read"],"expiresInDays":400}`, http.StatusBadRequest},
+		{"scope escalation", scopedAuth{auth.ScopeTasksRead}, `{"name":"ci","scopes":["tasks:write"]}`, http.StatusForbidden},
+		{"personal token caller", patAuth{}, `{"name":"ci","scopes":["tasks:read"]}`, http.StatusForbidden},
+		{"unknown field", mockAuth{}, `{"name":"ci","scopes":["tasks:read"],"owner":"someone"}`, http.StatusBadRequest},
+		{"not json", mockAuth{}, `name=ci`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &memoryTokenStore{}
+			rec := serveTokens(t, store, tc.authn, http.MethodPost, tokensRoute, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if len(store.tokens) != 0 {
+				t.Fatal("rejected request must not create a token")
+			}
+		})
+	}
+}
+
+func TestExpiredTokensDoNotCountTowardsLimit(t *testing.T) {
+	store := &memoryTokenStore{}
+	past := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < maxTokensPerUser; i++ {
+		_, tok, err := auth.NewPersonalToken("user", "old", []string{auth.ScopeTasksRead}, past, past.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.CreateToken(context.Background(), tok)
+	}
+	rec := serveTokens(t, store, mockAuth{}, http.MethodPost, tokensRoute, `{"name":"ci","scopes":["tasks:read"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected expired tokens to be ignored, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	_, tok, _ := auth.NewPersonalToken("user", "live", []string{auth.ScopeTasksRead}, time.Now(), time.Now().Add(time.Hour))
+	for i := 1; i < maxTokensPerUser; i++ {
+		tok.ID = fmt.Sprintf("live-%d", i)
+		store.CreateToken(context.Background(), tok)
+	}
+	rec = serveTokens(t, store, mockAuth{}, http.MethodPost, tokensRoute, `{"name":"ci","scopes":["tasks:read"]}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 with %d active tokens, got %d", maxTokensPerUser, rec.Code)
+	}
+}
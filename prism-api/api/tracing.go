@@ -0,0 +1,20 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const commandsSpanName = "POST /api/commands"
+
+// propagateTrace continues a trace started by the caller: the span context sent in
+// the request headers becomes the parent of the spans started by the handlers.
+func propagateTrace(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		c.SetRequest(req.WithContext(ctx))
+		return next(c)
+	}
+}
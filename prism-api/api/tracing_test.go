@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"prism-api/domain"
+)
+
+type tracingStore struct {
+	mockStore
+	mu           sync.Mutex
+	traceParents []string
+}
+
+func (s *tracingStore) EnqueueCommands(ctx context.Context, userID string, cmds []domain.Command) error {
+	s.mu.Lock()
+	s.traceParents = append(s.traceParents, domain.TraceParent(ctx))
+	s.mu.Unlock()
+	return s.mockStore.EnqueueCommands(ctx, userID, cmds)
+}
+
+func TestPostCommandsPropagatesTraceContext(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	_, exporter, cleanup := setupTestTracer(t)
+	t.Cleanup(cleanup)
+	prevPropagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prevPropagator) })
+
+	store := &tracingStore{}
+	initCommandSender(store, log.New())
+	handler := propagateTrace(postCommands(store, mockAuth{}, nil, nil, nil, nil))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, commandsRoute, strings.NewReader(`[{"entityType":"task","type":"create-task"}]`))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d", rec.Code)
+	}
+	waitForCommands(t, &store.mockStore, 1)
+
+	// The worker ends the job span after the store returns.
+	spans := waitForSpans(t, exporter, 2)
+	var request, job tracetest.SpanStub
+	for _, s := range spans {
+		switch s.Name {
+		case commandsSpanName:
+			request = s
+		case commandsEnqueue.spanName:
+			job = s
+		}
+	}
+	if request.Name == "" || job.Name == "" {
+		t.Fatalf("expected request and job spans, got %v", spans)
+	}
+	if got := request.SpanContext.TraceID().String(); got != traceID {
+		t.Fatalf("expected span in trace %s, got %s", traceID, got)
+	}
+	if job.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Fatalf("expected job span to be a child of the request span")
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	want := "00-" + traceID + "-" + job.SpanContext.SpanID().String() + "-01"
+	if len(store.traceParents) != 1 || store.traceParents[0] != want {
+		t.Fatalf("expected enqueue traceparent %q, got %v", want, store.traceParents)
+	}
+}
+
+func waitForSpans(t *testing.T, exporter *tracetest.InMemoryExporter, n int) tracetest.SpanStubs {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		spans := exporter.GetSpans()
+		if len(spans) >= n {
+			return spans
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d spans, got %d", n, len(spans))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+
+	"auth"
 	"prism-api/domain"
 )
 
@@ -12,13 +14,21 @@ type Storage interface {
 	EnqueueCommands(ctx context.Context, userID string, cmds []domain.Command) error
 }
 
+// BoardStore resolves shared board memberships for access control.
+type BoardStore interface {
+	// BoardRole returns the user's role on the board or "" when the user is not a member.
+	BoardRole(ctx context.Context, boardID, userID string) (string, error)
+	FetchBoards(ctx context.Context, userID string) ([]domain.Board, error)
+}
+
 // InvalidContinuationTokenError is returned when a supplied pagination token is malformed or expired.
 type InvalidContinuationTokenError interface {
 	error
 	InvalidContinuationToken()
 }
 
-// Authenticator is implemented by types able to extract user IDs from headers.
+// Authenticator is implemented by types able to identify the caller and its
+// granted scopes from the Authorization header.
 type Authenticator interface {
-	UserIDFromAuthHeader(string) (string, error)
+	Authenticate(string) (auth.Principal, error)
 }
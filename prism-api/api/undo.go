@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"auth"
+	"prism-api/domain"
+)
+
+const (
+	undoRoute = commandsRoute + "/:key/undo"
+	redoRoute = commandsRoute + "/:key/redo"
+)
+
+// Compensating commands get idempotency keys linked to the command they revert:
+// undoing K issues "K:undo:0", "K:undo:1", ... and redoing K reverts all of
+// those under "K:redo:<n>". Retrying either reuses the same keys, so the
+// domain service drops the repeats.
+const (
+	undoKeySuffix = ":undo:"
+	redoKeySuffix = ":redo:"
+)
+
+// UndoStore reads the task event store and index to revert commands.
+type UndoStore interface {
+	TaskHistoryStore
+	// CommandTaskEvents returns the events of the command with the
+	// idempotency key.
+	CommandTaskEvents(ctx context.Context, key string) ([]domain.TaskEvent, error)
+	// LinkedTaskEvents returns the events of the commands whose idempotency
+	// keys start with prefix.
+	LinkedTaskEvents(ctx context.Context, prefix string) ([]domain.TaskEvent, error)
+}
+
+// WithUndo lets users undo and redo their task commands using store.
+func WithUndo(store UndoStore) Option {
+	return func(o *options) {
+		o.undo = store
+	}
+}
+
+// undoCommand reverts the task events the caller's command produced with
+// compensating commands. With redo set it reverts all compensating commands of
+// an undo of the command in one request instead. It answers 404 when there are
+// no events yet, 409 when later events changed the same fields and 422 for task
+// creations and reorders.
+func undoCommand(store Storage, events UndoStore, authn Authenticator, logger *log.Logger, limiter *rateLimiter, boards *boardAccess, audit *AuditLog, redo bool) echo.HandlerFunc {
+	kind := undoRequest
+	if redo {
+		kind = redoRequest
+	}
+	return func(c echo.Context) (err error) {
+		metrics, ctx := newRequestMetrics(c.Request().Context(), kind, logger)
+		c.SetRequest(c.Request().WithContext(ctx))
+		defer func() {
+			metrics.Log(c.Response().Status, err)
+		}()
+
+		principal, authErr := authn.Authenticate(c.Request().Header.Get("Authorization"))
+		if authErr != nil {
+			metrics.SetErrorStage("auth")
+			return unauthenticated(c, authErr)
+		}
+		if scopeErr := requireScope(principal, auth.ScopeTasksWrite); scopeErr != nil {
+			return scopeRejected(c, metrics, scopeErr)
+		}
+		userID := principal.UserID
+		key := c.Param("key")
+		if key == "" {
+			return c.String(http.StatusBadRequest, "idempotency key is required")
+		}
+
+		fetchStart := time.Now()
+		linked := key + undoKeySuffix
+		var all []domain.TaskEvent
+		var fetchErr error
+		if redo {
+			linked = key + redoKeySuffix
+			all, fetchErr = events.LinkedTaskEvents(ctx, key+undoKeySuffix)
+		} else {
+			all, fetchErr = events.CommandTaskEvents(ctx, key)
+		}
+		if fetchErr != nil {
+			metrics.SetErrorStage("fetch")
+			c.Logger().Error(fetchErr)
+			return c.String(http.StatusInternalServerError, "failed to read task events")
+		}
+		var targets []domain.TaskEvent
+		for _, ev := range all {
+			if ev.UserID == userID {
+				targets = append(targets, ev)
+			}
+		}
+		if len(targets) == 0 {
+			return c.String(http.StatusNotFound, "no task events for command")
+		}
+
+		cmds := make([]domain.Command, 0, len(targets))
+		for _, target := range targets {
+			history, fetchErr := events.TaskEvents(ctx, target.TaskID)
+			if fetchErr != nil {
+				metrics.SetErrorStage("fetch")
+				c.Logger().Error(fetchErr)
+				return c.String(http.StatusInternalServerError, "failed to read task events")
+			}
+			// The compensation has to order after every event of the task,
+			// including those stamped by nodes whose clocks run ahead.
+			for _, ev := range history {
+				observeTimestamp(ev.Timestamp)
+			}
+			comp, compErr := domain.CompensateTaskEvent(history, target, linked)
+			var conflict *domain.UndoConflictError
+			switch {
+			case errors.As(compErr, &conflict):
+				return c.String(http.StatusConflict, conflict.Error())
+			case errors.Is(compErr, domain.ErrNotUndoable):
+				return c.String(http.StatusUnprocessableEntity, compErr.Error())
+			case compErr != nil:
+				c.Logger().Error(compErr)
+				return c.String(http.StatusInternalServerError, "failed to compute compensation")
+			case comp.Type == "":
+				continue
+			}
+			data, marshalErr := sonic.Marshal(comp.Data())
+			if marshalErr != nil {
+				return marshalErr
+			}
+			cmds = append(cmds, domain.Command{
+				IdempotencyKey: linked + strconv.Itoa(len(cmds)),
+				EntityType:     "task",
+				Type:           comp.Type,
+				Data:           data,
+				BoardID:        comp.BoardID,
+			})
+		}
+		metrics.ObserveFetch(time.Since(fetchStart))
+		if len(cmds) == 0 {
+			return c.String(http.StatusConflict, "command changed nothing")
+		}
+		metrics.SetCommandCount(len(cmds))
+
+		if !limiter.allowCommands(c, userID, cmds) {
+			metrics.SetErrorStage("rate_limit")
+			return rateLimited(c)
+		}
+		authzStart := time.Now()
+		authzErr := boards.authorizeCommands(ctx, userID, cmds)
+		metrics.ObserveAuthorize(time.Since(authzStart))
+		if authzErr != nil {
+			return boardAuthorizationFailed(c, metrics, authzErr)
+		}
+		return submitCommands(c, store, metrics, principal, cmds, audit)
+	}
+}
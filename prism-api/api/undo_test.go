@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"auth"
+	"prism-api/domain"
+)
+
+// stubUndoEvents serves task events by task, including the tasks-reordered
+// events listing each task.
+type stubUndoEvents struct {
+	stubTaskEvents
+}
+
+func (s stubUndoEvents) CommandTaskEvents(_ context.Context, key string) ([]domain.TaskEvent, error) {
+	var out []domain.TaskEvent
+	for _, events := range s.stubTaskEvents {
+		for _, ev := range events {
+			if ev.IdempotencyKey == key {
+				out = append(out, ev)
+			}
+		}
+	}
+	domain.SortTaskEvents(out)
+	return out, nil
+}
+
+func (s stubUndoEvents) LinkedTaskEvents(_ context.Context, prefix string) ([]domain.TaskEvent, error) {
+	var out []domain.TaskEvent
+	for _, events := range s.stubTaskEvents {
+		for _, ev := range events {
+			if strings.HasPrefix(ev.IdempotencyKey, prefix) {
+				out = append(out, ev)
+			}
+		}
+	}
+	domain.SortTaskEvents(out)
+	return out, nil
+}
+
+func serveUndo(t *testing.T, store *mockStore, events UndoStore, authn Authenticator, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	e.POST(undoRoute, undoCommand(store, events, authn, log.New(), nil, nil, nil, false))
+	e.POST(redoRoute, undoCommand(store, events, authn, log.New(), nil, nil, nil, true))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+	return rec
+}
+
+func movedTaskEvents() stubTaskEvents {
+	return stubTaskEvents{"t1": {
+		{ID: "e1", TaskID: "t1", Type: domain.TaskCreated, Timestamp: 1, UserID: "user", IdempotencyKey: "c", Data: []byte(`{"title":"a","category":"normal"}`)},
+		{ID: "e2", TaskID: "t1", Type: domain.TaskUpdated, Timestamp: 2, UserID: "user", IdempotencyKey: "k", Data: []byte(`{"category":"urgent"}`)},
+	}}
+}
+
+func TestUndoCommandEnqueuesCompensation(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	store := &mockStore{}
+	initCommandSender(store, log.New())
+
+	rec := serveUndo(t, store, stubUndoEvents{stubTaskEvents: movedTaskEvents()}, mockAuth{}, commandsRoute+"/k/undo")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp postCommandResponse
+	if err := sonic.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.IdempotencyKeys) != 1 || resp.IdempotencyKeys[0] != "k:undo:0" {
+		t.Fatalf("unexpected keys %v", resp.IdempotencyKeys)
+	}
+	cmds := waitForCommands(t, store, 1)
+	if cmds[0].Type != domain.UpdateTaskCommand || cmds[0].EntityType != "task" || cmds[0].Timestamp == 0 {
+		t.Fatalf("unexpected command %+v", cmds[0])
+	}
+	var data map[string]any
+	if err := sonic.Unmarshal(cmds[0].Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data["id"] != "t1" || data["category"] != "normal" || len(data) != 2 {
+		t.Fatalf("unexpected data %v", data)
+	}
+}
+
+func TestRedoCommandRevertsAllUndoCommands(t *testing.T) {
+	resetCommandSenderForTests()
+	t.Cleanup(resetCommandSenderForTests)
+	store := &mockStore{}
+	initCommandSender(store, log.New())
+
+	// k moved two tasks and was undone with one compensating command per task.
+	events := movedTaskEvents()
+	events["t1"] = append(events["t1"], domain.TaskEvent{ID: "e3", TaskID: "t1", Type: domain.TaskUpdated, Timestamp: 3, UserID: "user", IdempotencyKey: "k:undo:0", Data: []byte(`{"category":"normal"}`)})
+	events["t2"] = []domain.TaskEvent{
+		{ID: "f1", TaskID: "t2", Type: domain.TaskCreated, Timestamp: 1, UserID: "user", IdempotencyKey: "c2", Data: []byte(`{"title":"b","category":"fun"}`)},
+		{ID: "f2", TaskID: "t2", Type: domain.TaskUpdated, Timestamp: 2, UserID: "user", IdempotencyKey: "k", Data: []byte(`{"category":"urgent"}`)},
+		{ID: "f3", TaskID: "t2", Type: domain.TaskUpdated, Timestamp: 3, UserID: "user", IdempotencyKey: "k:undo:1", Data: []byte(`{"category":"fun"}`)},
+	}
+
+	rec := serveUndo(t, store, stubUndoEvents{stubTaskEvents: events}, mockAuth{}, commandsRoute+"/k/redo")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp postCommandResponse
+	if err := sonic.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.IdempotencyKeys) != 2 || resp.IdempotencyKeys[0] != "k:redo:0" || resp.IdempotencyKeys[1] != "k:redo:1" {
+		t.Fatalf("unexpected keys %v", resp.IdempotencyKeys)
+	}
+	for _, cmd := range waitForCommands(t, store, 2) {
+		var data map[string]any
+		if err := sonic.Unmarshal(cmd.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if data["category"] != "urgent" {
+			t.Fatalf("expected redo to restore the moved category, got %v", data)
+		}
+	}
+}
+
+func TestUndoCommandRejections(t *testing.T) {
+	conflicting := movedTaskEvents()
+	conflicting["t1"] = append(conflicting["t1"], domain.TaskEvent{ID: "e3", TaskID: "t1", Type: domain.TaskUpdated, Timestamp: 3, UserID: "other", Data: []byte(`{"category":"later"}`)})
+
+	// The reorder is stored under the user's partition and moves t1 again.
+	reordered := movedTaskEvents()
+	reordered["t1"] = append(reordered["t1"], domain.TaskEvent{ID: "e4", TaskID: "user", Type: domain.TasksReordered, Timestamp: 4, UserID: "other", Data: []byte(`{"category":"fun","ids":["t1"]}`)})
+
+	cases := []struct {
+		name   string
+		events stubUndoEvents
+		authn  Authenticator
+		target string
+		status int
+	}{
+		{"unknown key", stubUndoEvents{stubTaskEvents: movedTaskEvents()}, mockAuth{}, commandsRoute + "/missing/undo", http.StatusNotFound},
+		{"later edit", stubUndoEvents{stubTaskEvents: conflicting}, mockAuth{}, commandsRoute + "/k/undo", http.StatusConflict},
+		{"later reorder", stubUndoEvents{stubTaskEvents: reordered}, mockAuth{}, commandsRoute + "/k/undo", http.StatusConflict},
+		{"creation", stubUndoEvents{stubTaskEvents: movedTaskEvents()}, mockAuth{}, commandsRoute + "/c/undo", http.StatusUnprocessableEntity},
+		{"redo without undo", stubUndoEvents{stubTaskEvents: movedTaskEvents()}, mockAuth{}, commandsRoute + "/k/redo", http.StatusNotFound},
+		{"read-only token", stubUndoEvents{stubTaskEvents: movedTaskEvents()}, scopedAuth{auth.ScopeTasksRead}, commandsRoute + "/k/undo", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockStore{}
+			rec := serveUndo(t, store, tc.events, tc.authn, tc.target)
+			if rec.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if len(store.Commands()) != 0 {
+				t.Fatal("rejected undo must not enqueue commands")
+			}
+		})
+	}
+}
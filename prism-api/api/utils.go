@@ -1,20 +1,59 @@
 package api
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"sync/atomic"
 	"time"
 )
 
+// Command timestamps are hybrid logical clock values packed into an int64:
+//
+//	unixNano &^ 0x3FF | logical<<4 | nodeID
+//
+// The physical part keeps the wall clock at ~1µs resolution, the 6-bit logical
+// counter orders timestamps issued within the same microsecond or after
+// observing a clock that runs ahead, and the node ID keeps the values of
+// different API nodes apart. Comparing two timestamps as integers thus compares
+// physical time, then the counter, then the node, so no two nodes ever issue
+// the same timestamp. A counter overflow carries into the physical part.
+const (
+	clockNodeBits  = 4
+	clockStep      = 1 << clockNodeBits
+	clockLowMask   = 1<<10 - 1
+	maxClockNodeID = clockStep - 1
+	// maxClockOffset bounds how far ahead of the local clock an observed
+	// timestamp may be before it is ignored instead of adopted.
+	maxClockOffset = time.Minute
+)
+
 var (
 	lastTimestamp int64
+	clockNodeID   int64
 )
 
+// WithClockNode sets the node ID, 0 to 15, placed in the timestamps this API
+// instance issues. Every instance behind the load balancer needs its own.
+func WithClockNode(id int) Option {
+	return func(o *options) {
+		o.clockNode = id
+	}
+}
+
+func setClockNode(id int) {
+	if id < 0 || id > maxClockNodeID {
+		panic(fmt.Sprintf("clock node ID %d out of range 0-%d", id, maxClockNodeID))
+	}
+	atomic.StoreInt64(&clockNodeID, int64(id))
+}
+
 func nextTimestamp() int64 {
 	return nextTimestampRange(1)
 }
 
+// nextTimestampRange reserves n timestamps and returns the first one; the
+// others follow clockStep apart.
 func nextTimestampRange(n int) int64 {
 	if n <= 0 {
 		return 0
@@ -23,22 +62,38 @@ func nextTimestampRange(n int) int64 {
 	// Reserve a contiguous, monotonically increasing sequence of timestamps with a
 	// single atomic update. This avoids calling time.Now for every element in the
 	// batch and keeps timestamp assignment contention low under high concurrency.
+	node := atomic.LoadInt64(&clockNodeID)
 	for {
-		now := time.Now().UnixNano()
+		now := time.Now().UnixNano()&^clockLowMask | node
 		last := atomic.LoadInt64(&lastTimestamp)
 
 		start := now
 		if now <= last {
-			start = last + 1
+			start = last&^maxClockNodeID | node + clockStep
 		}
 
-		end := start + int64(n-1)
+		end := start + int64(n-1)*clockStep
 		if atomic.CompareAndSwapInt64(&lastTimestamp, last, end) {
 			return start
 		}
 	}
 }
 
+// observeTimestamp merges a timestamp issued elsewhere into the clock, so the
+// timestamps issued next order after it even if that node's clock runs ahead.
+// Timestamps further ahead than maxClockOffset are ignored.
+func observeTimestamp(ts int64) {
+	if ts > time.Now().Add(maxClockOffset).UnixNano() {
+		return
+	}
+	for {
+		last := atomic.LoadInt64(&lastTimestamp)
+		if ts <= last || atomic.CompareAndSwapInt64(&lastTimestamp, last, ts) {
+			return
+		}
+	}
+}
+
 func envInt(key string, def int) int {
 	if v := os.Getenv(key); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
@@ -17,15 +17,12 @@ func TestNextTimestampRangeSequential(t *testing.T) {
 		t.Fatal("expected non-zero start timestamp")
 	}
 
-	wantLast := start + 2
+	wantLast := start + 2*clockStep
 	if got := atomic.LoadInt64(&lastTimestamp); got != wantLast {
 		t.Fatalf("expected lastTimestamp=%d, got %d", wantLast, got)
 	}
-
-	second := start + 1
-	third := start + 2
-	if second-start != 1 || third-second != 1 {
-		t.Fatalf("expected sequential timestamps, got start=%d second=%d third=%d", start, second, third)
+	if start&clockLowMask != 0 {
+		t.Fatalf("expected a fresh physical time with counter and node 0, got low bits %#x", start&clockLowMask)
 	}
 }
 
@@ -34,15 +31,15 @@ func TestNextTimestampRangeAdvancesPastLast(t *testing.T) {
 		atomic.StoreInt64(&lastTimestamp, 0)
 	})
 
-	base := time.Now().Add(time.Second).UnixNano()
+	base := time.Now().Add(time.Second).UnixNano() &^ clockLowMask
 	atomic.StoreInt64(&lastTimestamp, base)
 
 	start := nextTimestampRange(2)
-	if start != base+1 {
-		t.Fatalf("expected range to start at %d, got %d", base+1, start)
+	if start != base+clockStep {
+		t.Fatalf("expected range to start at %d, got %d", base+clockStep, start)
 	}
 
-	wantLast := base + 2
+	wantLast := base + 2*clockStep
 	if got := atomic.LoadInt64(&lastTimestamp); got != wantLast {
 		t.Fatalf("expected lastTimestamp=%d, got %d", wantLast, got)
 	}
@@ -61,3 +58,47 @@ func TestNextTimestampRangeZeroCount(t *testing.T) {
 		t.Fatalf("expected lastTimestamp unchanged, got %d", got)
 	}
 }
+
+func TestNextTimestampRangeStampsNodeID(t *testing.T) {
+	t.Cleanup(func() {
+		atomic.StoreInt64(&lastTimestamp, 0)
+		setClockNode(0)
+	})
+	setClockNode(5)
+
+	// Another node issued the last timestamp, at the same microsecond and
+	// counter 63 and with a higher node ID.
+	base := time.Now().Add(time.Second).UnixNano()&^clockLowMask | 63<<clockNodeBits
+	atomic.StoreInt64(&lastTimestamp, base|9)
+
+	start := nextTimestampRange(2)
+	if start <= base|9 || start&maxClockNodeID != 5 {
+		t.Fatalf("expected a later timestamp of node 5, got %d after %d", start, base|9)
+	}
+	// The counter overflowed into the next microsecond.
+	if start != (base+clockStep)|5 {
+		t.Fatalf("expected counter overflow into the next microsecond, got %#x after %#x", start, base)
+	}
+	if second := start + clockStep; second&maxClockNodeID != 5 {
+		t.Fatalf("expected every timestamp of the range to carry node 5, got %#x", second)
+	}
+}
+
+func TestObserveTimestampOrdersLaterTimestampsAfterIt(t *testing.T) {
+	t.Cleanup(func() {
+		atomic.StoreInt64(&lastTimestamp, 0)
+	})
+	atomic.StoreInt64(&lastTimestamp, 0)
+
+	ahead := time.Now().Add(5*time.Second).UnixNano()&^clockLowMask | 3
+	observeTimestamp(ahead)
+	if next := nextTimestamp(); next <= ahead {
+		t.Fatalf("expected timestamp after %d, got %d", ahead, next)
+	}
+
+	atomic.StoreInt64(&lastTimestamp, 0)
+	observeTimestamp(time.Now().Add(time.Hour).UnixNano())
+	if got := atomic.LoadInt64(&lastTimestamp); got != 0 {
+		t.Fatalf("expected timestamps beyond the maximum offset to be ignored, got %d", got)
+	}
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+// AuditEntry records a command accepted by the API on behalf of a user.
+type AuditEntry struct {
+	UserID         string    `json:"userId"`
+	Type           string    `json:"type"`
+	EntityType     string    `json:"entityType"`
+	IdempotencyKey string    `json:"idempotencyKey"`
+	Timestamp      time.Time `json:"timestamp"`
+	BoardID        string    `json:"boardId,omitempty"`
+	SourceIP       string    `json:"sourceIp,omitempty"`
+	UserAgent      string    `json:"userAgent,omitempty"`
+	// TokenID identifies the personal access token used, if any.
+	TokenID string `json:"tokenId,omitempty"`
+}
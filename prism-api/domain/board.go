@@ -0,0 +1,16 @@
+package domain
+
+// Board roles. Viewers may read a board's tasks, editors may also change them
+// and only the owner manages the board's members.
+const (
+	BoardRoleOwner  = "owner"
+	BoardRoleEditor = "editor"
+	BoardRoleViewer = "viewer"
+)
+
+// Board is a shared task list the user is a member of.
+type Board struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
@@ -11,10 +11,29 @@ type Command struct {
 	Type           string                 `json:"type"`
 	Data           sonic.NoCopyRawMessage `json:"data,omitempty"`
 	Timestamp      int64                  `json:"timestamp"`
+	// BoardID targets a shared board; task commands without it act on the user's own tasks.
+	BoardID string `json:"boardId,omitempty"`
+	// Sequence orders the commands of a read model partition when the API runs
+	// with a sequencer; Timestamp is then only shown to users.
+	Sequence int64 `json:"sequence,omitempty"`
 }
 
-// CommandEnvelope wraps a command with the user performing it.
+// CommandEnvelope wraps a command with the user performing it. TraceParent is the
+// W3C traceparent of the span that enqueued the command.
 type CommandEnvelope struct {
-	UserID  string  `json:"userId"`
-	Command Command `json:"command"`
+	UserID      string  `json:"userId"`
+	Command     Command `json:"command"`
+	TraceParent string  `json:"traceparent,omitempty"`
+}
+
+// CommandBatchEnvelope packs the commands of a single request into one queue message.
+// Batches larger than the transport's message limit are split into parts; Part is
+// zero-based and commands keep their request order within and across parts.
+type CommandBatchEnvelope struct {
+	UserID      string    `json:"userId"`
+	BatchID     string    `json:"batchId"`
+	Part        int       `json:"part"`
+	Parts       int       `json:"parts"`
+	Commands    []Command `json:"commands"`
+	TraceParent string    `json:"traceparent,omitempty"`
 }
@@ -0,0 +1,210 @@
+package domain
+
+import (
+	"sort"
+
+	"taskstate"
+)
+
+// Task event types written to the task event store by the domain service.
+const (
+	TaskCreated   = taskstate.Created
+	TaskUpdated   = taskstate.Updated
+	TaskCompleted = taskstate.Completed
+	TaskReopened  = taskstate.Reopened
+	// TasksReordered events are stored under the read model partition, not a
+	// task, so they only show up in partition-wide replays.
+	TasksReordered = taskstate.Reordered
+)
+
+// TaskEvent is an event read from the task event store.
+type TaskEvent struct {
+	ID             string
+	TaskID         string
+	Type           string
+	Timestamp      int64
+	UserID         string
+	IdempotencyKey string
+	BoardID        string
+	Data           []byte
+	// Sequence is zero for events of commands issued without a sequencer.
+	Sequence int64
+}
+
+// FieldChange describes how one task field changed. From is nil for the
+// fields set when the task was created.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// TaskHistoryEntry is a task event together with the fields it changed.
+type TaskHistoryEntry struct {
+	EventID        string        `json:"eventId"`
+	Type           string        `json:"type"`
+	Timestamp      int64         `json:"timestamp"`
+	UserID         string        `json:"userId"`
+	IdempotencyKey string        `json:"idempotencyKey,omitempty"`
+	Changes        []FieldChange `json:"changes"`
+	// Sequence places the entry in replay order together with the timestamp
+	// and event ID; see SortTaskEvents.
+	Sequence int64 `json:"-"`
+}
+
+// SortTaskEvents orders events the way the domain service replays them: by
+// sequence, then by timestamp and event ID. Unsequenced events predate the
+// sequencer and come first.
+func SortTaskEvents(events []TaskEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Sequence != events[j].Sequence {
+			return events[i].Sequence < events[j].Sequence
+		}
+		if events[i].Timestamp != events[j].Timestamp {
+			return events[i].Timestamp < events[j].Timestamp
+		}
+		return events[i].ID < events[j].ID
+	})
+}
+
+func (ev TaskEvent) state() taskstate.Event {
+	return taskstate.Event{Type: ev.Type, Data: ev.Data, Timestamp: ev.Timestamp, Sequence: ev.Sequence}
+}
+
+// stateFor returns what ev does to the task, whose state before ev is cur: a
+// tasks-reordered event is reduced to the update of that task and ignored when
+// it does not list the task or was planned before the task's last change.
+// Only the task's own events are at hand, so a reorder the read model dropped
+// because another listed task changed still counts.
+func (ev TaskEvent) stateFor(taskID string, cur *taskstate.Task) (taskstate.Event, bool) {
+	if ev.Type != TasksReordered {
+		return ev.state(), true
+	}
+	updates, err := taskstate.SplitReorder(ev.state())
+	if err != nil {
+		return taskstate.Event{}, false
+	}
+	for _, u := range updates {
+		if u.TaskID == taskID {
+			current := taskstate.ReorderCurrent([]taskstate.TaskUpdate{u}, func(string) *taskstate.Task { return cur })
+			return u.Event, current
+		}
+	}
+	return taskstate.Event{}, false
+}
+
+// ReplayTasks folds sorted events into the tasks they describe, ordered by ID
+// like the read model. Events the read model would reject are skipped.
+func ReplayTasks(events []TaskEvent) []Task {
+	snapshot := TaskSnapshot{}
+	snapshot.Replay(events)
+	return snapshot.Tasks()
+}
+
+// TaskSnapshot is the state of a partition's tasks after a replay, keyed by
+// task ID. It keeps the timestamp and sequence of each task's last event, so
+// later events can be replayed on top of it.
+type TaskSnapshot map[string]taskstate.Task
+
+// Replay folds sorted events into the snapshot. Events the read model would
+// reject are skipped.
+func (s TaskSnapshot) Replay(events []TaskEvent) {
+	apply := func(taskID string, ev taskstate.Event) {
+		if next, _, err := taskstate.Apply(s.lookup(taskID), ev); err == nil {
+			s[taskID] = next
+		}
+	}
+	for _, ev := range events {
+		if ev.Type != TasksReordered {
+			apply(ev.TaskID, ev.state())
+			continue
+		}
+		updates, err := taskstate.SplitReorder(ev.state())
+		if err != nil || !taskstate.ReorderCurrent(updates, s.lookup) {
+			continue
+		}
+		for _, u := range updates {
+			apply(u.TaskID, u.Event)
+		}
+	}
+}
+
+func (s TaskSnapshot) lookup(taskID string) *taskstate.Task {
+	if st, ok := s[taskID]; ok {
+		return &st
+	}
+	return nil
+}
+
+// Tasks lists the tasks of the snapshot ordered by ID like the read model.
+func (s TaskSnapshot) Tasks() []Task {
+	tasks := make([]Task, 0, len(s))
+	for id, st := range s {
+		tasks = append(tasks, taskFromState(id, st))
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks
+}
+
+func taskFromState(id string, st taskstate.Task) Task {
+	return Task{ID: id, Title: st.Title, Notes: st.Notes, Category: st.Category, Order: st.Order, Rank: st.Rank, Done: st.Done}
+}
+
+// TaskHistory replays the task's events, which must be sorted, and reports the
+// fields each event changed. Reorders report the task's own move and are left
+// out when they do not list it. Events the read model would reject change
+// nothing.
+func TaskHistory(taskID string, events []TaskEvent) []TaskHistoryEntry {
+	history := make([]TaskHistoryEntry, 0, len(events))
+	var cur *taskstate.Task
+	for _, ev := range events {
+		st, ok := ev.stateFor(taskID, cur)
+		if !ok {
+			continue
+		}
+		entry := TaskHistoryEntry{
+			EventID:        ev.ID,
+			Type:           ev.Type,
+			Timestamp:      ev.Timestamp,
+			UserID:         ev.UserID,
+			IdempotencyKey: ev.IdempotencyKey,
+			Changes:        []FieldChange{},
+			Sequence:       ev.Sequence,
+		}
+		if next, _, err := taskstate.Apply(cur, st); err == nil {
+			var before Task
+			if cur != nil {
+				before = taskFromState(taskID, *cur)
+			}
+			entry.Changes = diffTasks(before, taskFromState(taskID, next), ev.Type == TaskCreated)
+			cur = &next
+		}
+		history = append(history, entry)
+	}
+	return history
+}
+
+// diffTasks lists the fields that differ. A created task is compared with an
+// empty one, so only the fields it was created with are reported.
+func diffTasks(before, after Task, created bool) []FieldChange {
+	if created {
+		before = Task{}
+	}
+	changes := []FieldChange{}
+	add := func(field string, from, to any, changed bool) {
+		if !changed {
+			return
+		}
+		if created {
+			from = nil
+		}
+		changes = append(changes, FieldChange{Field: field, From: from, To: to})
+	}
+	add("title", before.Title, after.Title, before.Title != after.Title)
+	add("notes", before.Notes, after.Notes, before.Notes != after.Notes)
+	add("category", before.Category, after.Category, before.Category != after.Category)
+	add("order", before.Order, after.Order, before.Order != after.Order)
+	add("rank", before.Rank, after.Rank, before.Rank != after.Rank)
+	add("done", before.Done, after.Done, before.Done != after.Done)
+	return changes
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTaskHistoryReportsFieldChanges(t *testing.T) {
+	events := []TaskEvent{
+		{ID: "e3", TaskID: "t1", Type: TaskCompleted, Timestamp: 3},
+		{ID: "e2", TaskID: "t1", Type: TaskUpdated, Timestamp: 2, Data: []byte(`{"title":"Buy oat milk","order":2}`)},
+		{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 1, UserID: "u1", Data: []byte(`{"title":"Buy milk","category":"normal"}`)},
+		{ID: "e4", TaskID: "t1", Type: TaskUpdated, Timestamp: 4, Data: []byte(`{"title":"Buy oat milk"}`)},
+	}
+	SortTaskEvents(events)
+	history := TaskHistory("t1", events)
+
+	want := [][]FieldChange{
+		{{Field: "title", From: nil, To: "Buy milk"}, {Field: "category", From: nil, To: "normal"}},
+		{{Field: "title", From: "Buy milk", To: "Buy oat milk"}, {Field: "order", From: 0, To: 2}},
+		{{Field: "done", From: false, To: true}},
+		{},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(history))
+	}
+	for i, entry := range history {
+		if entry.EventID != events[i].ID {
+			t.Fatalf("entry %d: expected event %s, got %s", i, events[i].ID, entry.EventID)
+		}
+		if !reflect.DeepEqual(entry.Changes, want[i]) {
+			t.Fatalf("entry %d: expected %v, got %v", i, want[i], entry.Changes)
+		}
+	}
+}
+
+func TestTaskHistoryReportsReorders(t *testing.T) {
+	events := []TaskEvent{
+		{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 1, Data: []byte(`{"title":"a","category":"normal","order":0}`)},
+		{ID: "e2", TaskID: "user", Type: TasksReordered, Timestamp: 2, Data: []byte(`{"category":"fun","ids":["t2","t1"]}`)},
+		{ID: "e3", TaskID: "user", Type: TasksReordered, Timestamp: 3, Data: []byte(`{"category":"fun","ids":["t2"]}`)},
+	}
+	history := TaskHistory("t1", events)
+	if len(history) != 2 {
+		t.Fatalf("expected the reorder not listing the task to be left out, got %+v", history)
+	}
+	want := []FieldChange{{Field: "category", From: "normal", To: "fun"}, {Field: "order", From: 0, To: 1}, {Field: "rank", From: "", To: "o"}}
+	if history[1].EventID != "e2" || !reflect.DeepEqual(history[1].Changes, want) {
+		t.Fatalf("expected %v for e2, got %+v", want, history[1])
+	}
+}
+
+func TestReplayTasksAppliesReorders(t *testing.T) {
+	events := []TaskEvent{
+		{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 1, Data: []byte(`{"title":"a","category":"normal","order":0}`)},
+		{ID: "e2", TaskID: "t2", Type: TaskCreated, Timestamp: 2, Data: []byte(`{"title":"b","category":"normal","order":1}`)},
+		{ID: "e3", TaskID: "u1", Type: TasksReordered, Timestamp: 3, Data: []byte(`{"category":"normal","ids":["t2","t1","gone"]}`)},
+	}
+	want := []Task{
+		{ID: "t1", Title: "a", Category: "normal", Order: 1, Rank: "i"},
+		{ID: "t2", Title: "b", Category: "normal", Order: 0, Rank: "9"},
+	}
+	if got := ReplayTasks(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestReplayTasksSkipsRejectedEvents(t *testing.T) {
+	events := []TaskEvent{
+		{ID: "e1", TaskID: "t2", Type: TaskCreated, Timestamp: 1, Data: []byte(`{"title":"second","done":true}`)},
+		{ID: "e2", TaskID: "t1", Type: TaskCreated, Timestamp: 2, Data: []byte(`{"title":"first","order":1}`)},
+		{ID: "e3", TaskID: "t1", Type: TaskCompleted, Timestamp: 3},
+		{ID: "e4", TaskID: "t3", Type: TaskUpdated, Timestamp: 4, Data: []byte(`{"title":"never created"}`)},
+		{ID: "e5", TaskID: "t2", Type: TaskCreated, Timestamp: 5, Data: []byte(`{"title":"duplicate"}`)},
+	}
+	want := []Task{
+		{ID: "t1", Title: "first", Order: 1, Done: true},
+		{ID: "t2", Title: "second"},
+	}
+	if got := ReplayTasks(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestReplayTasksOrdersSequencedEventsBySequence(t *testing.T) {
+	// e3 was stamped by a node whose clock runs behind the one that stamped e2.
+	events := []TaskEvent{
+		{ID: "e3", TaskID: "t1", Type: TaskUpdated, Timestamp: 2, Sequence: 3, Data: []byte(`{"title":"c"}`)},
+		{ID: "e2", TaskID: "t1", Type: TaskUpdated, Timestamp: 9, Sequence: 2, Data: []byte(`{"title":"b"}`)},
+		{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 5, Data: []byte(`{"title":"a"}`)},
+	}
+	SortTaskEvents(events)
+	if ids := []string{events[0].ID, events[1].ID, events[2].ID}; !reflect.DeepEqual(ids, []string{"e1", "e2", "e3"}) {
+		t.Fatalf("unexpected order %v", ids)
+	}
+	want := []Task{{ID: "t1", Title: "c"}}
+	if got := ReplayTasks(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTaskSnapshotReplaysOnTopOfEarlierEvents(t *testing.T) {
+	events := []TaskEvent{
+		{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 1, Data: []byte(`{"title":"a","category":"normal"}`)},
+		{ID: "e2", TaskID: "t1", Type: TaskUpdated, Timestamp: 2, Data: []byte(`{"title":"b"}`)},
+		{ID: "e3", TaskID: "t1", Type: TaskUpdated, Timestamp: 1, Data: []byte(`{"title":"stale"}`)},
+		{ID: "e4", TaskID: "t1", Type: TaskCompleted, Timestamp: 3},
+	}
+	snapshot := TaskSnapshot{}
+	snapshot.Replay(events[:2])
+	snapshot.Replay(events[2:])
+	if got, want := snapshot.Tasks(), ReplayTasks(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
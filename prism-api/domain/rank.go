@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"sort"
+
+	"taskstate"
+)
+
+// ReorderTasksCommand assigns a category's tasks ranks and orders in one event.
+const ReorderTasksCommand = "reorder-tasks"
+
+// MaxReorderTasks is the most tasks the domain service accepts in one
+// reorder-tasks command.
+const MaxReorderTasks = 100
+
+// Reorder lists a category's tasks in the order a reorder-tasks command should
+// give them. A category with more tasks than one command may reorder is split
+// into commands listing the tasks from Offset on out of Total. Expected holds
+// the event timestamp of each task the plan was made from; the read model
+// drops the reorder when one of them changed in the meantime.
+type Reorder struct {
+	Category string           `json:"category"`
+	TaskIDs  []string         `json:"ids"`
+	Offset   int              `json:"offset,omitempty"`
+	Total    int              `json:"total,omitempty"`
+	Expected map[string]int64 `json:"expected,omitempty"`
+}
+
+// PlanRebalance returns the reorders that give the open tasks of a read model
+// partition fresh ranks. A category needs one when a task has no rank yet,
+// such as tasks created before ranks existed, or when a rank grew longer than
+// taskstate.MaxRankLength. Tasks keep their current position. Categories with
+// more than MaxReorderTasks tasks are reordered in parts.
+func PlanRebalance(tasks []Task) []Reorder {
+	byCategory := map[string][]Task{}
+	for _, t := range tasks {
+		if !t.Done {
+			byCategory[t.Category] = append(byCategory[t.Category], t)
+		}
+	}
+	var plans []Reorder
+	for category, list := range byCategory {
+		if !needsRebalance(list) {
+			continue
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			a, b := list[i].state(), list[j].state()
+			if taskstate.Before(a, b) || taskstate.Before(b, a) {
+				return taskstate.Before(a, b)
+			}
+			return list[i].ID < list[j].ID
+		})
+		for offset := 0; offset < len(list); offset += MaxReorderTasks {
+			page := list[offset:min(offset+MaxReorderTasks, len(list))]
+			plan := Reorder{Category: category, TaskIDs: make([]string, len(page)), Expected: make(map[string]int64, len(page))}
+			if len(list) > MaxReorderTasks {
+				plan.Offset, plan.Total = offset, len(list)
+			}
+			for i, t := range page {
+				plan.TaskIDs[i] = t.ID
+				plan.Expected[t.ID] = t.EventTimestamp
+			}
+			plans = append(plans, plan)
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Category != plans[j].Category {
+			return plans[i].Category < plans[j].Category
+		}
+		return plans[i].Offset < plans[j].Offset
+	})
+	return plans
+}
+
+func needsRebalance(tasks []Task) bool {
+	for _, t := range tasks {
+		if t.Rank == "" || len(t.Rank) > taskstate.MaxRankLength {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Task) state() taskstate.Task {
+	return taskstate.Task{Category: t.Category, Order: t.Order, Rank: t.Rank}
+}
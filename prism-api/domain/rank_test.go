@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanRebalanceMigratesUnrankedCategories(t *testing.T) {
+	tasks := []Task{
+		{ID: "a", Category: "normal", Order: 2},
+		{ID: "b", Category: "normal", Order: 0},
+		{ID: "c", Category: "normal", Order: 1},
+		{ID: "d", Category: "normal", Order: 0, Done: true},
+		{ID: "e", Category: "urgent", Order: 0, Rank: "i"},
+		{ID: "f", Category: "urgent", Order: 1, Rank: "r"},
+		{ID: "g", Category: "fun", Order: 0},
+		{ID: "h", Category: "fun", Order: 4, Rank: "i"},
+	}
+	want := []Reorder{
+		{Category: "fun", TaskIDs: []string{"h", "g"}, Expected: map[string]int64{"h": 0, "g": 0}},
+		{Category: "normal", TaskIDs: []string{"b", "c", "a"}, Expected: map[string]int64{"b": 0, "c": 0, "a": 0}},
+	}
+	if got := PlanRebalance(tasks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestPlanRebalanceReranksLongRanksInRankOrder(t *testing.T) {
+	tasks := []Task{
+		{ID: "a", Category: "normal", Order: 0, Rank: "i"},
+		{ID: "b", Category: "normal", Order: 1, Rank: "h" + strings.Repeat("z", 12)},
+		{ID: "c", Category: "urgent", Order: 0, Rank: "i"},
+	}
+	want := []Reorder{{Category: "normal", TaskIDs: []string{"b", "a"}, Expected: map[string]int64{"b": 0, "a": 0}}}
+	if got := PlanRebalance(tasks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestPlanRebalanceSplitsLargeCategories(t *testing.T) {
+	tasks := make([]Task, MaxReorderTasks+5)
+	for i := range tasks {
+		tasks[i] = Task{ID: fmt.Sprintf("t%03d", i), Category: "normal", Order: i, EventTimestamp: int64(i + 1)}
+	}
+	plans := PlanRebalance(tasks)
+	if len(plans) != 2 {
+		t.Fatalf("expected two parts, got %d", len(plans))
+	}
+	first, second := plans[0], plans[1]
+	if first.Offset != 0 || first.Total != len(tasks) || len(first.TaskIDs) != MaxReorderTasks {
+		t.Fatalf("unexpected first part %+v", first)
+	}
+	if second.Offset != MaxReorderTasks || second.Total != len(tasks) || len(second.TaskIDs) != 5 || second.TaskIDs[0] != "t100" {
+		t.Fatalf("unexpected second part %+v", second)
+	}
+	if second.Expected["t100"] != 101 || len(second.Expected) != 5 {
+		t.Fatalf("expected the timestamps of the part's tasks, got %v", second.Expected)
+	}
+}
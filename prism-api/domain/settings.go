@@ -1,7 +1,32 @@
 package domain
 
+import (
+	"errors"
+
+	"settings"
+)
+
+// ErrSettingsNotFound is returned for users who never saved settings.
+var ErrSettingsNotFound = errors.New("settings not found")
+
 // Settings represents user configurable options.
 type Settings struct {
-	TasksPerCategory int  `json:"tasksPerCategory"`
-	ShowDoneTasks    bool `json:"showDoneTasks"`
+	Version          int                 `json:"version"`
+	TasksPerCategory int                 `json:"tasksPerCategory"`
+	ShowDoneTasks    bool                `json:"showDoneTasks"`
+	Theme            string              `json:"theme"`
+	DefaultCategory  string              `json:"defaultCategory"`
+	Categories       []settings.Category `json:"categories"`
+	Timezone         string              `json:"timezone"`
+	WeekStart        string              `json:"weekStart"`
+}
+
+// Upgrade migrates settings stored before settings.Version by giving the
+// fields they lack their defaults.
+func (s *Settings) Upgrade() {
+	settings.Upgrade(&s.Theme, &s.DefaultCategory, &s.Timezone, &s.WeekStart)
+	if s.Categories == nil {
+		s.Categories = []settings.Category{}
+	}
+	s.Version = settings.Version
 }
@@ -1,11 +1,14 @@
 package domain
 
-// Task represents a single board item in the read model.
+// Task represents a single board item in the read model. EventTimestamp is
+// only read by the rank rebalancer and never sent to clients.
 type Task struct {
-	ID       string `json:"id"`
-	Title    string `json:"title"`
-	Notes    string `json:"notes,omitempty"`
-	Category string `json:"category"`
-	Order    int    `json:"order"`
-	Done     bool   `json:"done,omitempty"`
+	ID             string `json:"id"`
+	Title          string `json:"title"`
+	Notes          string `json:"notes,omitempty"`
+	Category       string `json:"category"`
+	Order          int    `json:"order"`
+	Rank           string `json:"rank,omitempty"`
+	Done           bool   `json:"done,omitempty"`
+	EventTimestamp int64  `json:"-"`
 }
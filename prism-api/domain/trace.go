@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const traceParentHeader = "traceparent"
+
+var traceContext propagation.TraceContext
+
+// TraceParent returns the W3C traceparent of the span in ctx, or "" when ctx
+// carries no valid span context.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier[traceParentHeader]
+}
+
+// ContextWithTraceParent returns ctx with the remote span context described by
+// traceParent. Invalid or empty values leave ctx unchanged.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.MapCarrier{traceParentHeader: traceParent})
+}
@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"taskstate"
+)
+
+// Task command types issued to compensate task events.
+const (
+	UpdateTaskCommand   = "update-task"
+	CompleteTaskCommand = "complete-task"
+	ReopenTaskCommand   = "reopen-task"
+)
+
+// ErrNotUndoable is returned for events no command can revert.
+var ErrNotUndoable = errors.New("task creations and reorders cannot be undone")
+
+// UndoConflictError reports fields changed again after the event being undone.
+type UndoConflictError struct {
+	TaskID string
+	Fields []string
+}
+
+func (e *UndoConflictError) Error() string {
+	return fmt.Sprintf("task %s: %s changed since", e.TaskID, strings.Join(e.Fields, ", "))
+}
+
+// Compensation is the task command reverting an event. Type is empty when the
+// event changed nothing, e.g. because the read model rejected it.
+type Compensation struct {
+	TaskID  string
+	BoardID string
+	Type    string
+	// Fields holds the prior values of the fields an update changed.
+	Fields map[string]any
+}
+
+// CompensateTaskEvent replays the task's sorted events and returns the command
+// restoring the state target replaced. Later events whose idempotency key
+// starts with ignorePrefix, the keys of the compensation itself, are
+// disregarded so retrying an undo does not conflict with its own result.
+// Events may include the tasks-reordered events of the task's partition; a
+// reorder listing the task after target is a conflict like any other move.
+func CompensateTaskEvent(events []TaskEvent, target TaskEvent, ignorePrefix string) (Compensation, error) {
+	comp := Compensation{TaskID: target.TaskID, BoardID: target.BoardID}
+	if target.Type == TaskCreated || target.Type == TasksReordered {
+		return comp, ErrNotUndoable
+	}
+	var cur *taskstate.Task
+	var changes []FieldChange
+	found := false
+	touched := map[string]bool{}
+	for _, ev := range events {
+		if found && ignorePrefix != "" && strings.HasPrefix(ev.IdempotencyKey, ignorePrefix) {
+			continue
+		}
+		st, ok := ev.stateFor(target.TaskID, cur)
+		if !ok {
+			continue
+		}
+		next, change, err := taskstate.Apply(cur, st)
+		if err != nil {
+			continue
+		}
+		if found {
+			for _, f := range changedFields(change) {
+				touched[f] = true
+			}
+		} else if ev.ID == target.ID {
+			found = true
+			if cur != nil {
+				changes = diffTasks(taskFromState(ev.TaskID, *cur), taskFromState(ev.TaskID, next), false)
+			}
+		}
+		cur = &next
+	}
+	if len(changes) == 0 {
+		return comp, nil
+	}
+
+	var conflicts []string
+	comp.Fields = make(map[string]any, len(changes))
+	for _, ch := range changes {
+		if touched[ch.Field] {
+			conflicts = append(conflicts, ch.Field)
+		}
+		comp.Fields[ch.Field] = ch.From
+	}
+	if len(conflicts) > 0 {
+		return comp, &UndoConflictError{TaskID: target.TaskID, Fields: conflicts}
+	}
+
+	switch target.Type {
+	case TaskCompleted:
+		comp.Type, comp.Fields = ReopenTaskCommand, nil
+	case TaskReopened:
+		comp.Type, comp.Fields = CompleteTaskCommand, nil
+	default:
+		comp.Type = UpdateTaskCommand
+	}
+	return comp, nil
+}
+
+// Data returns the command payload: the task ID plus any restored fields.
+func (c Compensation) Data() map[string]any {
+	data := make(map[string]any, len(c.Fields)+1)
+	for f, v := range c.Fields {
+		data[f] = v
+	}
+	data["id"] = c.TaskID
+	return data
+}
+
+func changedFields(c taskstate.Change) []string {
+	var fields []string
+	if c.Title != nil {
+		fields = append(fields, "title")
+	}
+	if c.Notes != nil {
+		fields = append(fields, "notes")
+	}
+	if c.Category != nil {
+		fields = append(fields, "category")
+	}
+	if c.Order != nil {
+		fields = append(fields, "order")
+	}
+	if c.Rank != nil {
+		fields = append(fields, "rank")
+	}
+	if c.Done != nil {
+		fields = append(fields, "done")
+	}
+	return fields
+}
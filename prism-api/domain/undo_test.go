@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompensateTaskEvent(t *testing.T) {
+	created := TaskEvent{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 1, Data: []byte(`{"title":"a","category":"normal"}`)}
+	moved := TaskEvent{ID: "e2", TaskID: "t1", Type: TaskUpdated, Timestamp: 2, IdempotencyKey: "k", Data: []byte(`{"category":"urgent","order":3}`)}
+	completed := TaskEvent{ID: "e3", TaskID: "t1", Type: TaskCompleted, Timestamp: 3, IdempotencyKey: "c"}
+	reordered := TaskEvent{ID: "e5", TaskID: "u1", Type: TasksReordered, Timestamp: 5, Data: []byte(`{"category":"normal","ids":["t1"]}`)}
+
+	cases := []struct {
+		name   string
+		events []TaskEvent
+		target TaskEvent
+		want   Compensation
+		err    error
+	}{
+		{"update restores prior fields", []TaskEvent{created, moved}, moved,
+			Compensation{TaskID: "t1", Type: UpdateTaskCommand, Fields: map[string]any{"category": "normal", "order": 0}}, nil},
+		{"unrelated later edit", []TaskEvent{created, moved, completed}, moved,
+			Compensation{TaskID: "t1", Type: UpdateTaskCommand, Fields: map[string]any{"category": "normal", "order": 0}}, nil},
+		{"completion reopens", []TaskEvent{created, moved, completed}, completed,
+			Compensation{TaskID: "t1", Type: ReopenTaskCommand}, nil},
+		{"own compensation ignored", []TaskEvent{created, moved,
+			{ID: "e4", TaskID: "t1", Type: TaskUpdated, Timestamp: 4, IdempotencyKey: "k:undo:0", Data: []byte(`{"category":"normal"}`)}}, moved,
+			Compensation{TaskID: "t1", Type: UpdateTaskCommand, Fields: map[string]any{"category": "normal", "order": 0}}, nil},
+		{"creation", []TaskEvent{created}, created, Compensation{TaskID: "t1"}, ErrNotUndoable},
+		{"reorder", []TaskEvent{created, reordered}, reordered, Compensation{TaskID: "u1"}, ErrNotUndoable},
+		{"reorder of other tasks", []TaskEvent{created, moved,
+			{ID: "e5", TaskID: "u1", Type: TasksReordered, Timestamp: 5, Data: []byte(`{"category":"urgent","ids":["t2"]}`)}}, moved,
+			Compensation{TaskID: "t1", Type: UpdateTaskCommand, Fields: map[string]any{"category": "normal", "order": 0}}, nil},
+		{"rejected event", []TaskEvent{created, {ID: "e0", TaskID: "t1", Type: TaskReopened, Timestamp: 2}},
+			TaskEvent{ID: "e0", TaskID: "t1", Type: TaskReopened, Timestamp: 2}, Compensation{TaskID: "t1"}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CompensateTaskEvent(tc.events, tc.target, "k:undo:")
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCompensateTaskEventReportsReorderConflicts(t *testing.T) {
+	events := []TaskEvent{
+		{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 1, Data: []byte(`{"title":"a","category":"normal"}`)},
+		{ID: "e2", TaskID: "t1", Type: TaskUpdated, Timestamp: 2, Data: []byte(`{"category":"urgent"}`)},
+		// The reorder is stored under the partition u1 and moves t1 again.
+		{ID: "e3", TaskID: "u1", Type: TasksReordered, Timestamp: 3, Data: []byte(`{"category":"fun","ids":["t2","t1"]}`)},
+	}
+	_, err := CompensateTaskEvent(events, events[1], "")
+	var conflict *UndoConflictError
+	if !errors.As(err, &conflict) || !reflect.DeepEqual(conflict.Fields, []string{"category"}) {
+		t.Fatalf("expected a category conflict, got %v", err)
+	}
+}
+
+func TestCompensateTaskEventReportsConflicts(t *testing.T) {
+	events := []TaskEvent{
+		{ID: "e1", TaskID: "t1", Type: TaskCreated, Timestamp: 1, Data: []byte(`{"title":"a","category":"normal"}`)},
+		{ID: "e2", TaskID: "t1", Type: TaskUpdated, Timestamp: 2, Data: []byte(`{"title":"b","category":"urgent"}`)},
+		{ID: "e3", TaskID: "t1", Type: TaskUpdated, Timestamp: 3, Data: []byte(`{"category":"urgent"}`)},
+	}
+	_, err := CompensateTaskEvent(events, events[1], "")
+	var conflict *UndoConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if conflict.TaskID != "t1" || !reflect.DeepEqual(conflict.Fields, []string{"category"}) {
+		t.Fatalf("unexpected conflict %+v", conflict)
+	}
+}
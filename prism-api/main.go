@@ -3,21 +3,26 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/MicahParks/keyfunc"
 	"github.com/labstack/echo-contrib/pprof"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 
+	"auth"
 	"prism-api/api"
 	"prism-api/storage"
+	"tracing"
 )
 
 func configureJSONLogger(logger *log.Logger) {
@@ -31,14 +36,35 @@ func configureJSONLogger(logger *log.Logger) {
 	logger.SetOutput(os.Stdout)
 }
 
+// shutdownTimeout bounds how long the server waits for requests in flight and
+// queued audit entries after SIGTERM.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	configureJSONLogger(log.StandardLogger())
 	if dbg, err := strconv.ParseBool(os.Getenv("DEBUG")); err == nil && dbg {
 		log.SetLevel(log.DebugLevel)
 	}
+	shutdownTracing, err := tracing.Setup(context.Background(), "prism-api")
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.WithError(err).Warn("tracing shutdown failed")
+		}
+	}()
+
 	connStr := os.Getenv("STORAGE_CONNECTION_STRING")
 	tasksTableName := os.Getenv("TASKS_TABLE")
 	settingsTableName := os.Getenv("SETTINGS_TABLE")
+	boardsTableName := os.Getenv("BOARDS_TABLE")
+	tokensTableName := os.Getenv("TOKENS_TABLE")
+	auditTableName := os.Getenv("AUDIT_TABLE")
+	taskEventsTableName := os.Getenv("TASK_EVENTS_TABLE")
+	taskEventIndexTableName := os.Getenv("TASK_EVENT_INDEX_TABLE")
 	commandQueueName := os.Getenv("COMMAND_QUEUE")
 	if connStr == "" || tasksTableName == "" || settingsTableName == "" || commandQueueName == "" {
 		log.Fatal("missing storage config")
@@ -92,14 +118,49 @@ func main() {
 	}
 	rc := redis.NewClient(redisOpts)
 
+	snapshotTTL := time.Hour
+	if v := os.Getenv("TASKS_SNAPSHOT_CACHE_TTL"); v != "" {
+		snapshotTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid TASKS_SNAPSHOT_CACHE_TTL: %v", err)
+		}
+	}
+
+	storageOpts := []storage.Option{
+		storage.WithQueueConcurrency(queueConcurrency),
+		storage.WithCache(rc),
+		storage.WithTokensTable(tokensTableName),
+		storage.WithAuditTable(auditTableName),
+		storage.WithTaskEventsTable(taskEventsTableName),
+		storage.WithTaskEventIndexTable(taskEventIndexTableName),
+		storage.WithSnapshotCache(rc, snapshotTTL),
+	}
+	switch transport := os.Getenv("COMMAND_TRANSPORT"); transport {
+	case "", "azure":
+	case "redis":
+		// COMMAND_QUEUE names the stream consumed by the domain service consumer group.
+		storageOpts = append(storageOpts, storage.WithRedisCommandStream(rc, commandQueueName))
+	default:
+		log.Fatalf("invalid COMMAND_TRANSPORT: %s", transport)
+	}
+	if v := os.Getenv("COMMAND_BATCHING"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid COMMAND_BATCHING: %v", err)
+		}
+		if enabled {
+			storageOpts = append(storageOpts, storage.WithCommandBatching(storage.MaxCommandMessageSize))
+		}
+	}
+
 	store, err := storage.New(
 		connStr,
 		tasksTableName,
 		settingsTableName,
+		boardsTableName,
 		commandQueueName,
 		taskPageSize,
-		storage.WithQueueConcurrency(queueConcurrency),
-		storage.WithCache(rc),
+		storageOpts...,
 	)
 	if err != nil {
 		log.Fatalf("storage: %v", err)
@@ -114,41 +175,185 @@ func main() {
 	}
 
 	testMode := os.Getenv("AUTH0_TEST_MODE") == "1"
-	var auth *api.Auth
+	var authenticator *auth.Authenticator
 	if testMode {
-		auth = api.NewAuth(nil, "", "")
+		authenticator = auth.New("", nil, nil)
 	} else {
-		jwtAudience := os.Getenv("AUTH0_AUDIENCE")
-		domain := os.Getenv("AUTH0_DOMAIN")
-		if jwtAudience == "" || domain == "" {
-			log.Fatal("missing Auth0 config")
+		oidcCfg, err := auth.ConfigFromEnv()
+		if err != nil {
+			log.Fatalf("missing OIDC config: %v", err)
 		}
-		jwksURL := fmt.Sprintf("https://%s/.well-known/jwks.json", domain)
-		jwks, err := keyfunc.Get(jwksURL, keyfunc.Options{})
+		authenticator, err = auth.NewOIDC(context.Background(), oidcCfg)
 		if err != nil {
-			log.Fatalf("jwks: %v", err)
+			log.Fatalf("oidc: %v", err)
 		}
-		auth = api.NewAuth(jwks, jwtAudience, "https://"+domain+"/")
+	}
+	defer authenticator.Close()
+	if tokensTableName != "" {
+		authenticator.AcceptPersonalTokens(store)
 	}
 
 	e := echo.New()
 	e.Use(middleware.Decompress())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "traceparent", "tracestate"},
 	}))
 	e.Use(middleware.Gzip())
 	logger := log.New()
 	configureJSONLogger(logger)
 	logger.SetLevel(log.GetLevel())
-	api.Register(e, store, auth, logger)
+	var apiOpts []api.Option
+	if boardsTableName != "" {
+		apiOpts = append(apiOpts, api.WithBoards(store))
+	} else {
+		log.Info("BOARDS_TABLE is empty; shared boards are disabled")
+	}
+	if tokensTableName != "" {
+		apiOpts = append(apiOpts, api.WithPersonalTokens(store))
+	}
+	var auditLog *api.AuditLog
+	if auditTableName != "" {
+		auditLog = api.NewAuditLog(store, logger)
+		apiOpts = append(apiOpts, api.WithAuditLog(auditLog))
+	}
+	if taskEventsTableName != "" {
+		apiOpts = append(apiOpts, api.WithTaskHistory(store))
+	}
+	// Point-in-time views and undo find their events through the index.
+	if taskEventIndexTableName != "" {
+		apiOpts = append(apiOpts, api.WithTaskSnapshots(store))
+		if taskEventsTableName != "" {
+			apiOpts = append(apiOpts, api.WithUndo(store))
+		}
+	}
+	// The rebalancer also migrates tasks created before ranks existed. It scans
+	// the whole tasks table, so it is off unless an interval is set, and the
+	// nodes take turns through a Redis lock. A scan longer than the interval
+	// resumes from the partition cursor kept next to the lock.
+	if v := os.Getenv("RANK_REBALANCE_INTERVAL"); v != "" {
+		rankInterval, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid RANK_REBALANCE_INTERVAL: %v", err)
+		}
+		if rankInterval > 0 {
+			apiOpts = append(apiOpts, api.WithRankRebalance(store, api.NewRedisRebalanceLock(rc, "ranks:rebalance:"), rankInterval))
+		}
+	}
+	// Each instance behind the load balancer needs its own node ID, which
+	// breaks ties between the timestamps of different instances.
+	if v := os.Getenv("API_NODE_ID"); v != "" {
+		nodeID, err := strconv.Atoi(v)
+		if err != nil || nodeID < 0 || nodeID > 15 {
+			log.Fatalf("invalid API_NODE_ID %q: expected 0-15", v)
+		}
+		apiOpts = append(apiOpts, api.WithClockNode(nodeID))
+	}
+	// The sequencer orders commands per user (or board) independent of the
+	// API nodes' clocks.
+	switch sequencer := os.Getenv("COMMAND_SEQUENCER"); sequencer {
+	case "":
+	case "redis":
+		apiOpts = append(apiOpts, api.WithSequencer(api.NewRedisSequencer(rc, "commands:seq:", store)))
+	default:
+		log.Fatalf("invalid COMMAND_SEQUENCER: %s", sequencer)
+	}
+	eventExport, shutdownEventExport, err := setupEventExport(context.Background(), "prism-api")
+	if err != nil {
+		log.Fatalf("observability exporter: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownEventExport(ctx); err != nil {
+			log.WithError(err).Warn("observability exporter shutdown failed")
+		}
+	}()
+	if eventExport != nil {
+		apiOpts = append(apiOpts, eventExport)
+	}
+	rateLimits, err := rateLimitsFromEnv()
+	if err != nil {
+		log.Fatalf("rate limits: %v", err)
+	}
+	if rateLimits.Queries.Enabled() || rateLimits.Commands.Enabled() || len(rateLimits.CommandTypes) > 0 {
+		apiOpts = append(apiOpts, api.WithRateLimits(api.NewRedisRateLimiter(rc), rateLimits))
+	}
+	if os.Getenv("OVERLOAD_POLICY") == "spill" {
+		spillKey := os.Getenv("COMMAND_SPILL_KEY")
+		if spillKey == "" {
+			spillKey = "commands:spill"
+		}
+		// Batches popped by this node wait in its own processing list, so a
+		// restart recovers only those and not the ones other nodes are sending.
+		spillNode := os.Getenv("API_NODE_ID")
+		if spillNode == "" {
+			spillNode = "0"
+		}
+		spill := storage.NewCommandSpill(rc, spillKey, spillNode)
+		if n, err := spill.Recover(context.Background()); err != nil {
+			log.WithError(err).Warn("command spill recovery failed")
+		} else if n > 0 {
+			log.Infof("recovered %d spilled command batches", n)
+		}
+		apiOpts = append(apiOpts, api.WithCommandSpill(spill))
+	}
+	api.Register(e, store, authenticator, logger, apiOpts...)
 	if os.Getenv("APP_ENV") == "development" {
 		log.Println("Enabling pprof for profiling")
 		pprof.Register(e)
 	}
-	if port := os.Getenv("PORT"); port != "" {
-		e.Logger.Fatal(e.Start(":" + port))
+	// Metrics and pool state are served on a separate port that is not
+	// published through the load balancer.
+	if port := os.Getenv("INTERNAL_PORT"); port != "" {
+		internal := echo.New()
+		internal.HideBanner = true
+		internal.HidePort = true
+		api.RegisterInternal(internal)
+		go func() {
+			if err := internal.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("internal server: %v", err)
+			}
+		}()
 	} else {
+		log.Info("INTERNAL_PORT is empty; metrics and pool state are not served")
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
 		log.Fatal("PORT is empty")
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := e.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server: %v", err)
+		}
+	}()
+	<-ctx.Done()
+
+	// Requests in flight finish before the audit entries they queued are
+	// flushed; the deferred exporter shutdowns run once main returns.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("server shutdown failed")
+	}
+	if err := auditLog.Close(shutdownCtx); err != nil {
+		log.WithError(err).Warn("audit log shutdown failed")
+	}
+}
+
+func rateLimitsFromEnv() (api.RateLimits, error) {
+	var limits api.RateLimits
+	var err error
+	if limits.Queries, err = api.ParseRateLimit(os.Getenv("RATE_LIMIT_QUERIES")); err != nil {
+		return limits, fmt.Errorf("RATE_LIMIT_QUERIES: %w", err)
+	}
+	if limits.Commands, err = api.ParseRateLimit(os.Getenv("RATE_LIMIT_COMMANDS")); err != nil {
+		return limits, fmt.Errorf("RATE_LIMIT_COMMANDS: %w", err)
+	}
+	if limits.CommandTypes, err = api.ParseCommandTypeLimits(os.Getenv("RATE_LIMIT_COMMAND_TYPES")); err != nil {
+		return limits, fmt.Errorf("RATE_LIMIT_COMMAND_TYPES: %w", err)
+	}
+	return limits, nil
 }
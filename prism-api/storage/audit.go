@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/bytedance/sonic"
+
+	"prism-api/domain"
+)
+
+// ErrAuditDisabled is returned by the audit methods when no audit table was
+// configured.
+var ErrAuditDisabled = errors.New("audit log is not configured")
+
+const auditDayLayout = "20060102"
+
+// WithAuditTable stores the audit log of accepted commands in the named table.
+func WithAuditTable(name string) Option {
+	return func(s *Storage) {
+		if name != "" && s.svc != nil {
+			s.auditTable = s.svc.NewClient(name)
+		}
+	}
+}
+
+// Audit entries are partitioned by user and UTC day ("<userId>_20060102") so a
+// busy user never grows a single partition without bound. The row key starts
+// with the zero-padded command timestamp, which orders a partition
+// chronologically; the idempotency key keeps rows unique across instances.
+type auditEntity struct {
+	PartitionKey     string `json:"PartitionKey"`
+	RowKey           string `json:"RowKey"`
+	UserID           string `json:"UserId"`
+	Type             string `json:"Type"`
+	EntityType       string `json:"EntityType"`
+	IdempotencyKey   string `json:"IdempotencyKey"`
+	CommandTimestamp int64  `json:"CommandTimestamp,string"`
+	BoardID          string `json:"BoardId,omitempty"`
+	SourceIP         string `json:"SourceIp,omitempty"`
+	UserAgent        string `json:"UserAgent,omitempty"`
+	TokenID          string `json:"TokenId,omitempty"`
+}
+
+func auditPartition(userID string, t time.Time) string {
+	return userID + "_" + t.UTC().Format(auditDayLayout)
+}
+
+func auditRowKey(ts int64) string {
+	return fmt.Sprintf("%019d", ts)
+}
+
+// AppendAudit adds the entries to the audit log.
+func (s *Storage) AppendAudit(ctx context.Context, entries []domain.AuditEntry) error {
+	if s.auditTable == nil {
+		return ErrAuditDisabled
+	}
+	for _, a := range entries {
+		ts := a.Timestamp.UnixNano()
+		data, err := sonic.Marshal(auditEntity{
+			PartitionKey:     auditPartition(a.UserID, a.Timestamp),
+			RowKey:           auditRowKey(ts) + "_" + a.IdempotencyKey,
+			UserID:           a.UserID,
+			Type:             a.Type,
+			EntityType:       a.EntityType,
+			IdempotencyKey:   a.IdempotencyKey,
+			CommandTimestamp: ts,
+			BoardID:          a.BoardID,
+			SourceIP:         a.SourceIP,
+			UserAgent:        a.UserAgent,
+			TokenID:          a.TokenID,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := s.auditTable.AddEntity(ctx, data, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchAudit returns a page of the user's audit entries in [start, end), oldest
+// first. The query spans the day partitions covering the range; the UserId
+// filter guards against user IDs that share a prefix with another user's
+// partition keys.
+func (s *Storage) FetchAudit(ctx context.Context, userID string, start, end time.Time, token string, limit int) ([]domain.AuditEntry, string, error) {
+	if s.auditTable == nil {
+		return nil, "", ErrAuditDisabled
+	}
+	nextPartitionKey, nextRowKey, err := decodeContinuationToken(token)
+	if err != nil {
+		return nil, "", &invalidContinuationTokenError{cause: err}
+	}
+	quoted := strings.ReplaceAll(userID, "'", "''")
+	filter := fmt.Sprintf(
+		"PartitionKey ge '%s' and PartitionKey le '%s' and UserId eq '%s' and RowKey ge '%s' and RowKey lt '%s'",
+		auditPartition(quoted, start), auditPartition(quoted, end), quoted,
+		auditRowKey(start.UnixNano()), auditRowKey(end.UnixNano()),
+	)
+	pageSize := resolveTaskPageSize(limit, maxTaskPageSize)
+	pager := s.auditTable.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter:           &filter,
+		Top:              &pageSize,
+		Format:           to.Ptr(aztables.MetadataFormatNone),
+		NextPartitionKey: nextPartitionKey,
+		NextRowKey:       nextRowKey,
+	})
+	if !pager.More() {
+		return []domain.AuditEntry{}, "", nil
+	}
+	resp, err := pager.NextPage(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	entries := make([]domain.AuditEntry, 0, len(resp.Entities))
+	for _, raw := range resp.Entities {
+		var e auditEntity
+		if err := sonic.Unmarshal(raw, &e); err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, domain.AuditEntry{
+			UserID:         e.UserID,
+			Type:           e.Type,
+			EntityType:     e.EntityType,
+			IdempotencyKey: e.IdempotencyKey,
+			Timestamp:      time.Unix(0, e.CommandTimestamp).UTC(),
+			BoardID:        e.BoardID,
+			SourceIP:       e.SourceIP,
+			UserAgent:      e.UserAgent,
+			TokenID:        e.TokenID,
+		})
+	}
+	next, err := encodeContinuationToken(resp.NextPartitionKey, resp.NextRowKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return entries, next, nil
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditKeysOrderChronologically(t *testing.T) {
+	day := time.Date(2026, 3, 9, 23, 59, 0, 0, time.UTC)
+	if got := auditPartition("auth0|u1", day); got != "auth0|u1_20260309" {
+		t.Fatalf("unexpected partition %q", got)
+	}
+	if got := auditPartition("u1", day.Add(2*time.Minute)); got != "u1_20260310" {
+		t.Fatalf("expected the next UTC day, got %q", got)
+	}
+	// Zero padding keeps row keys ordered even when the digit count differs.
+	if early, late := auditRowKey(999), auditRowKey(day.UnixNano()); early >= late {
+		t.Fatalf("expected %q < %q", early, late)
+	}
+}
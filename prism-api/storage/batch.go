@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+
+	"prism-api/domain"
+)
+
+// MaxCommandMessageSize is the largest queue message accepted by Azure Storage queues.
+const MaxCommandMessageSize = 64 * 1024
+
+// WithCommandBatching packs all commands of an EnqueueCommands call into
+// CommandBatchEnvelope messages of at most maxBytes each instead of sending one
+// message per command. Values outside (0, MaxCommandMessageSize] use the queue limit.
+func WithCommandBatching(maxBytes int) Option {
+	return func(s *Storage) {
+		if maxBytes <= 0 || maxBytes > MaxCommandMessageSize {
+			maxBytes = MaxCommandMessageSize
+		}
+		s.batchMessageSize = maxBytes
+	}
+}
+
+// enqueueBatch sends the commands as one or more batch parts. Parts are sent one
+// after another so a part is only enqueued once its predecessor was accepted.
+func (s *Storage) enqueueBatch(ctx context.Context, userID string, cmds []domain.Command, traceParent string) error {
+	payloads, err := packCommandBatch(userID, cmds, traceParent, s.batchMessageSize)
+	if err != nil {
+		return err
+	}
+	for _, payload := range payloads {
+		if err := s.commandQueue.Send(ctx, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packCommandBatch splits cmds into the fewest ordered batch envelopes whose
+// serialized size does not exceed maxBytes. The first command's ID identifies the batch.
+func packCommandBatch(userID string, cmds []domain.Command, traceParent string, maxBytes int) ([]string, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	// The header is measured with the widest part numbers that can occur, so the
+	// estimate below is an upper bound of the final envelope size.
+	header, err := sonic.Marshal(domain.CommandBatchEnvelope{
+		UserID:      userID,
+		BatchID:     cmds[0].ID,
+		Part:        len(cmds),
+		Parts:       len(cmds),
+		Commands:    []domain.Command{},
+		TraceParent: traceParent,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]domain.Command
+	start, size := 0, len(header)
+	for i := range cmds {
+		data, err := sonic.Marshal(cmds[i])
+		if err != nil {
+			return nil, err
+		}
+		cmdSize := len(data) + 1 // separating comma
+		if len(header)+cmdSize > maxBytes {
+			return nil, fmt.Errorf("command %s exceeds the %d byte message limit", cmds[i].ID, maxBytes)
+		}
+		if size+cmdSize > maxBytes {
+			groups = append(groups, cmds[start:i])
+			start, size = i, len(header)
+		}
+		size += cmdSize
+	}
+	groups = append(groups, cmds[start:])
+
+	payloads := make([]string, len(groups))
+	for i, group := range groups {
+		data, err := sonic.Marshal(domain.CommandBatchEnvelope{
+			UserID:      userID,
+			BatchID:     cmds[0].ID,
+			Part:        i,
+			Parts:       len(groups),
+			Commands:    group,
+			TraceParent: traceParent,
+		})
+		if err != nil {
+			return nil, err
+		}
+		payloads[i] = string(data)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+
+	"prism-api/domain"
+)
+
+type recordingTransport struct {
+	payloads []string
+}
+
+func (r *recordingTransport) Send(ctx context.Context, payload string) error {
+	r.payloads = append(r.payloads, payload)
+	return nil
+}
+
+func (r *recordingTransport) Ping(ctx context.Context) error { return nil }
+
+func batchCommands(n int, notesSize int) []domain.Command {
+	cmds := make([]domain.Command, n)
+	notes := strings.Repeat("x", notesSize)
+	for i := range cmds {
+		id := string(rune('a' + i))
+		cmds[i] = domain.Command{
+			ID:             id,
+			IdempotencyKey: id,
+			EntityType:     "task",
+			Type:           "update-task",
+			Data:           sonic.NoCopyRawMessage(`{"id":"` + id + `","notes":"` + notes + `"}`),
+			Timestamp:      int64(i),
+		}
+	}
+	return cmds
+}
+
+func decodeBatches(t *testing.T, payloads []string) []domain.CommandBatchEnvelope {
+	t.Helper()
+	out := make([]domain.CommandBatchEnvelope, len(payloads))
+	for i, p := range payloads {
+		if err := sonic.Unmarshal([]byte(p), &out[i]); err != nil {
+			t.Fatalf("decode batch %d: %v", i, err)
+		}
+	}
+	return out
+}
+
+func TestEnqueueCommandsPacksBatchIntoSingleMessage(t *testing.T) {
+	rt := &recordingTransport{}
+	store := &Storage{commandQueue: rt, queueConcurrency: 4}
+	WithCommandBatching(0)(store)
+
+	cmds := batchCommands(2, 8)
+	if err := store.EnqueueCommands(context.Background(), "user", cmds); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if len(rt.payloads) != 1 {
+		t.Fatalf("expected one message, got %d", len(rt.payloads))
+	}
+	batch := decodeBatches(t, rt.payloads)[0]
+	if batch.UserID != "user" || batch.BatchID != "a" || batch.Part != 0 || batch.Parts != 1 {
+		t.Fatalf("unexpected batch metadata: %+v", batch)
+	}
+	if len(batch.Commands) != 2 || batch.Commands[0].ID != "a" || batch.Commands[1].ID != "b" {
+		t.Fatalf("unexpected batch commands: %+v", batch.Commands)
+	}
+}
+
+func TestEnqueueCommandsSplitsBatchAtMessageLimit(t *testing.T) {
+	rt := &recordingTransport{}
+	store := &Storage{commandQueue: rt}
+	WithCommandBatching(600)(store)
+
+	cmds := batchCommands(5, 100)
+	if err := store.EnqueueCommands(context.Background(), "user", cmds); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if len(rt.payloads) < 2 {
+		t.Fatalf("expected batch to be split, got %d message(s)", len(rt.payloads))
+	}
+
+	var ids []string
+	for i, batch := range decodeBatches(t, rt.payloads) {
+		if len(rt.payloads[i]) > 600 {
+			t.Fatalf("part %d exceeds limit: %d bytes", i, len(rt.payloads[i]))
+		}
+		if batch.BatchID != "a" || batch.Part != i || batch.Parts != len(rt.payloads) {
+			t.Fatalf("unexpected metadata for part %d: %+v", i, batch)
+		}
+		for _, cmd := range batch.Commands {
+			ids = append(ids, cmd.ID)
+		}
+	}
+	if strings.Join(ids, "") != "abcde" {
+		t.Fatalf("commands out of order across parts: %v", ids)
+	}
+}
+
+func TestEnqueueCommandsRejectsOversizedCommand(t *testing.T) {
+	rt := &recordingTransport{}
+	store := &Storage{commandQueue: rt}
+	WithCommandBatching(300)(store)
+
+	if err := store.EnqueueCommands(context.Background(), "user", batchCommands(1, 400)); err == nil {
+		t.Fatalf("expected error for command larger than the message limit")
+	}
+	if len(rt.payloads) != 0 {
+		t.Fatalf("expected nothing to be sent, got %d message(s)", len(rt.payloads))
+	}
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/bytedance/sonic"
+
+	"prism-api/domain"
+)
+
+// Board memberships are maintained by the read-model-updater: the board is the
+// partition key, the member's user ID the row key.
+type boardMemberEntity struct {
+	Name string `json:"Name"`
+	Role string `json:"Role"`
+}
+
+// boardIndexEntity is a membership in the member's index partition, keyed by
+// board.
+type boardIndexEntity struct {
+	RowKey string `json:"RowKey"`
+	Name   string `json:"Name"`
+	Role   string `json:"Role"`
+}
+
+// BoardRole returns the user's role on the board or "" when the user is not a member.
+func (s *Storage) BoardRole(ctx context.Context, boardID, userID string) (string, error) {
+	ent, err := s.boardTable.GetEntity(ctx, boardID, userID, &aztables.GetEntityOptions{Format: to.Ptr(aztables.MetadataFormatNone)})
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	var member boardMemberEntity
+	if err := sonic.Unmarshal(ent.Value, &member); err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// boardIndexPrefix starts the partition key of the rows the read-model-updater
+// keeps for each member, keyed by board, so a user's boards are one partition.
+const boardIndexPrefix = "member:"
+
+// FetchBoards lists the boards the user is a member of from the user's index
+// partition.
+func (s *Storage) FetchBoards(ctx context.Context, userID string) ([]domain.Board, error) {
+	filter := "PartitionKey eq '" + quoteFilter(boardIndexPrefix+userID) + "'"
+	pager := s.boardTable.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: &filter,
+		Select: to.Ptr("RowKey,Name,Role"),
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	})
+	boards := []domain.Board{}
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range resp.Entities {
+			var member boardIndexEntity
+			if err := sonic.Unmarshal(e, &member); err != nil {
+				return nil, err
+			}
+			boards = append(boards, domain.Board{ID: member.RowKey, Name: member.Name, Role: member.Role})
+		}
+	}
+	return boards, nil
+}
+
+// BoardOwner returns the owner of the board, or "" when no board has the ID,
+// e.g. because the tasks partition belongs to a user.
+func (s *Storage) BoardOwner(ctx context.Context, boardID string) (string, error) {
+	if s.boardTable == nil {
+		return "", nil
+	}
+	filter := "PartitionKey eq '" + quoteFilter(boardID) + "' and Role eq '" + domain.BoardRoleOwner + "'"
+	pager := s.boardTable.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: &filter,
+		Select: to.Ptr("RowKey"),
+		Top:    to.Ptr(int32(1)),
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range resp.Entities {
+			var owner struct {
+				RowKey string `json:"RowKey"`
+			}
+			if err := sonic.Unmarshal(e, &owner); err != nil {
+				return "", err
+			}
+			return owner.RowKey, nil
+		}
+	}
+	return "", nil
+}
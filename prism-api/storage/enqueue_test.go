@@ -8,6 +8,11 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
+
 	"prism-api/domain"
 )
 
@@ -63,7 +68,7 @@ func (f *fakeQueue) GetProperties(ctx context.Context, o *azqueue.GetQueueProper
 func TestEnqueueCommandsUsesConcurrency(t *testing.T) {
 	fq := newFakeQueue()
 	store := &Storage{
-		commandQueue:     fq,
+		commandQueue:     azureQueueTransport{client: fq},
 		queueConcurrency: 4,
 	}
 	cmds := make([]domain.Command, 8)
@@ -86,7 +91,7 @@ func TestEnqueueCommandsPropagatesErrors(t *testing.T) {
 	fq := newFakeQueue()
 	fq.failAt = 2
 	store := &Storage{
-		commandQueue:     fq,
+		commandQueue:     azureQueueTransport{client: fq},
 		queueConcurrency: 3,
 	}
 	cmds := make([]domain.Command, 6)
@@ -103,7 +108,7 @@ func TestEnqueueCommandsPropagatesErrors(t *testing.T) {
 func TestEnqueueCommandsSequentialWhenConfigured(t *testing.T) {
 	fq := newFakeQueue()
 	store := &Storage{
-		commandQueue:     fq,
+		commandQueue:     azureQueueTransport{client: fq},
 		queueConcurrency: 1,
 	}
 	cmds := make([]domain.Command, 5)
@@ -118,3 +123,77 @@ func TestEnqueueCommandsSequentialWhenConfigured(t *testing.T) {
 		t.Fatalf("expected sequential sends, observed max in flight: %d", fq.max)
 	}
 }
+
+func TestEnqueueCommandsRedisStream(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	defer m.Close()
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer rc.Close()
+
+	store := &Storage{queueConcurrency: 1}
+	WithRedisCommandStream(rc, "commands")(store)
+
+	cmds := []domain.Command{{IdempotencyKey: "k1", Type: "create-task"}, {IdempotencyKey: "k2", Type: "update-task"}}
+	if err := store.EnqueueCommands(context.Background(), "user", cmds); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	entries, err := rc.XRange(context.Background(), "commands", "-", "+").Result()
+	if err != nil {
+		t.Fatalf("xrange: %v", err)
+	}
+	if len(entries) != len(cmds) {
+		t.Fatalf("expected %d stream entries, got %d", len(cmds), len(entries))
+	}
+	for i, entry := range entries {
+		raw, ok := entry.Values[streamPayloadField].(string)
+		if !ok {
+			t.Fatalf("entry %d missing payload: %#v", i, entry.Values)
+		}
+		var env domain.CommandEnvelope
+		if err := sonic.Unmarshal([]byte(raw), &env); err != nil {
+			t.Fatalf("decode payload: %v", err)
+		}
+		if env.UserID != "user" || env.Command.IdempotencyKey != cmds[i].IdempotencyKey {
+			t.Fatalf("unexpected envelope at %d: %+v", i, env)
+		}
+	}
+}
+
+func TestEnqueueCommandsCarriesTraceParent(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	rt := &recordingTransport{}
+	store := &Storage{commandQueue: rt, queueConcurrency: 1}
+	if err := store.EnqueueCommands(ctx, "user", batchCommands(2, 1)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	for _, p := range rt.payloads {
+		var env domain.CommandEnvelope
+		if err := sonic.UnmarshalString(p, &env); err != nil {
+			t.Fatalf("decode envelope: %v", err)
+		}
+		if env.TraceParent != want {
+			t.Fatalf("expected traceparent %q, got %q", want, env.TraceParent)
+		}
+	}
+
+	rt.payloads = nil
+	WithCommandBatching(0)(store)
+	if err := store.EnqueueCommands(ctx, "user", batchCommands(2, 1)); err != nil {
+		t.Fatalf("enqueue batch: %v", err)
+	}
+	if batch := decodeBatches(t, rt.payloads)[0]; batch.TraceParent != want {
+		t.Fatalf("expected batch traceparent %q, got %q", want, batch.TraceParent)
+	}
+}
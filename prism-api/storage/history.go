@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/bytedance/sonic"
+
+	"prism-api/domain"
+)
+
+// ErrTaskEventsDisabled is returned by the task event methods when the task
+// event table or index they read was not configured.
+var ErrTaskEventsDisabled = errors.New("task event store is not configured")
+
+const taskEventsSelect = "PartitionKey,RowKey,Type,EventTimestamp,EventSequence,UserId,IdempotencyKey,EntityType,BoardId,Data"
+
+// WithTaskEventsTable reads task history from the domain service's event store.
+func WithTaskEventsTable(name string) Option {
+	return func(s *Storage) {
+		if name != "" && s.svc != nil {
+			s.taskEventsTable = s.svc.NewClient(name)
+		}
+	}
+}
+
+type entityLister interface {
+	NewListEntitiesPager(listOptions *aztables.ListEntitiesOptions) *runtime.Pager[aztables.ListEntitiesResponse]
+}
+
+// taskEventEntity mirrors the rows the domain service writes: the task ID is
+// the partition key and the event ID the row key. Rows of the task event index
+// carry both in TaskId and EventId instead.
+type taskEventEntity struct {
+	PartitionKey   string `json:"PartitionKey"`
+	RowKey         string `json:"RowKey"`
+	TaskID         string `json:"TaskId"`
+	EventID        string `json:"EventId"`
+	Type           string `json:"Type"`
+	EventTimestamp int64  `json:"EventTimestamp,string"`
+	EventSequence  int64  `json:"EventSequence,string"`
+	UserID         string `json:"UserId"`
+	IdempotencyKey string `json:"IdempotencyKey"`
+	EntityType     string `json:"EntityType"`
+	BoardID        string `json:"BoardId"`
+	Data           string `json:"Data"`
+}
+
+// TaskEvents returns every event of the task, sorted for replay. The event
+// store keeps tasks-reordered events under the read model partition, so with
+// the task event index configured those listing the task are read from it.
+func (s *Storage) TaskEvents(ctx context.Context, taskID string) ([]domain.TaskEvent, error) {
+	events, err := s.queryTaskEvents(ctx, "PartitionKey eq '"+quoteFilter(taskID)+"'")
+	if err != nil || s.taskEventIndex == nil {
+		return events, err
+	}
+	reorders, err := s.queryTaskEventIndex(ctx, taskIndexPrefix+taskID)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, reorders...)
+	domain.SortTaskEvents(events)
+	return events, nil
+}
+
+// Besides the partition of each user and board, the task event index lists the
+// events of each command under commandIndexPrefix and its idempotency key, and
+// each tasks-reordered event under taskIndexPrefix and every task it lists.
+const (
+	commandIndexPrefix = "key:"
+	taskIndexPrefix    = "task:"
+)
+
+// CommandTaskEvents returns the events produced by the command with the
+// idempotency key, sorted for replay.
+func (s *Storage) CommandTaskEvents(ctx context.Context, key string) ([]domain.TaskEvent, error) {
+	return s.queryTaskEventIndex(ctx, commandIndexPrefix+key)
+}
+
+// LinkedTaskEvents returns the events produced by the commands whose
+// idempotency keys start with prefix, sorted for replay. prefix must end in a
+// separator such as ":", whose successor bounds the partition range.
+func (s *Storage) LinkedTaskEvents(ctx context.Context, prefix string) ([]domain.TaskEvent, error) {
+	if s.taskEventIndex == nil {
+		return nil, ErrTaskEventsDisabled
+	}
+	from := commandIndexPrefix + prefix
+	to := from[:len(from)-1] + string(from[len(from)-1]+1)
+	filter := "PartitionKey ge '" + quoteFilter(from) + "' and PartitionKey lt '" + quoteFilter(to) + "'"
+	return listTaskEvents(ctx, s.taskEventIndex, filter, taskEventIndexSelect)
+}
+
+func (s *Storage) queryTaskEventIndex(ctx context.Context, partition string) ([]domain.TaskEvent, error) {
+	if s.taskEventIndex == nil {
+		return nil, ErrTaskEventsDisabled
+	}
+	return listTaskEvents(ctx, s.taskEventIndex, "PartitionKey eq '"+quoteFilter(partition)+"'", taskEventIndexSelect)
+}
+
+// queryTaskEvents returns the task events matching filter, sorted for replay.
+// Idempotency markers sharing the table carry no event type and are skipped.
+func (s *Storage) queryTaskEvents(ctx context.Context, filter string) ([]domain.TaskEvent, error) {
+	if s.taskEventsTable == nil {
+		return nil, ErrTaskEventsDisabled
+	}
+	return listTaskEvents(ctx, s.taskEventsTable, filter, taskEventsSelect)
+}
+
+func listTaskEvents(ctx context.Context, table entityLister, filter, sel string) ([]domain.TaskEvent, error) {
+	pager := table.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: &filter,
+		Select: to.Ptr(sel),
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	})
+	events := []domain.TaskEvent{}
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range resp.Entities {
+			var e taskEventEntity
+			if err := sonic.Unmarshal(raw, &e); err != nil {
+				return nil, err
+			}
+			if e.Type == "" || (e.EntityType != "" && e.EntityType != "task") {
+				continue
+			}
+			ev := domain.TaskEvent{
+				ID:             e.RowKey,
+				TaskID:         e.PartitionKey,
+				Type:           e.Type,
+				Timestamp:      e.EventTimestamp,
+				UserID:         e.UserID,
+				IdempotencyKey: e.IdempotencyKey,
+				BoardID:        e.BoardID,
+				Data:           []byte(e.Data),
+				Sequence:       e.EventSequence,
+			}
+			if e.TaskID != "" {
+				ev.TaskID, ev.ID = e.TaskID, e.EventID
+			}
+			events = append(events, ev)
+		}
+	}
+	domain.SortTaskEvents(events)
+	return events, nil
+}
+
+func quoteFilter(v string) string {
+	return strings.ReplaceAll(v, "'", "''")
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "prism_api",
+	Name:      "cache_lookups_total",
+	Help:      "Read model cache lookups by cache (tasks, settings, snapshots) and result (hit, miss).",
+}, []string{"cache", "result"})
+
+func observeCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
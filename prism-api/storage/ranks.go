@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/bytedance/sonic"
+
+	"prism-api/domain"
+)
+
+type rankedTaskEntity struct {
+	taskEntity
+	EventTimestamp int64 `json:"EventTimestamp,string"`
+}
+
+// ScanTasks walks the tasks table from the partition after the given one, or
+// from the start when it is "", and calls fn once per partition, a
+// user or a board, with the ordering fields and event timestamps of its tasks. Entities are listed
+// in partition order, so each partition is held in memory only while fn runs.
+func (s *Storage) ScanTasks(ctx context.Context, after string, fn func(partition string, tasks []domain.Task) error) error {
+	opts := &aztables.ListEntitiesOptions{
+		Select: to.Ptr("PartitionKey,RowKey,Category,Order,Rank,Done,EventTimestamp"),
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	}
+	if after != "" {
+		opts.Filter = to.Ptr("PartitionKey gt '" + quoteFilter(after) + "'")
+	}
+	pager := s.taskTable.NewListEntitiesPager(opts)
+	partition := ""
+	var tasks []domain.Task
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, e := range resp.Entities {
+			var ent rankedTaskEntity
+			if err := sonic.Unmarshal(e, &ent); err != nil {
+				return err
+			}
+			if ent.PartitionKey != partition && len(tasks) > 0 {
+				if err := fn(partition, tasks); err != nil {
+					return err
+				}
+				tasks = nil
+			}
+			partition = ent.PartitionKey
+			tasks = append(tasks, domain.Task{ID: ent.RowKey, Category: ent.Category, Order: ent.Order, Rank: ent.Rank, Done: ent.Done, EventTimestamp: ent.EventTimestamp})
+		}
+	}
+	if len(tasks) > 0 {
+		return fn(partition, tasks)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/bytedance/sonic"
+)
+
+// LastSequence returns the highest sequence the read model holds for a
+// sequencer partition: over the tasks of the user or board, the user's
+// settings and the board's members. The partitions of users and boards share
+// the sequencer's key space, so all three are read for either.
+func (s *Storage) LastSequence(ctx context.Context, partition string) (int64, error) {
+	filter := "PartitionKey eq '" + quoteFilter(partition) + "'"
+	tables := []*aztables.Client{s.taskTable, s.settingsTable, s.boardTable}
+	var last int64
+	for _, table := range tables {
+		if table == nil {
+			continue
+		}
+		seq, err := maxSequence(ctx, table, filter)
+		if err != nil {
+			return 0, err
+		}
+		last = max(last, seq)
+	}
+	return last, nil
+}
+
+func maxSequence(ctx context.Context, table *aztables.Client, filter string) (int64, error) {
+	pager := table.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: &filter,
+		Select: to.Ptr("EventSequence"),
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	})
+	var last int64
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, e := range resp.Entities {
+			var ent struct {
+				EventSequence int64 `json:"EventSequence,string"`
+			}
+			if err := sonic.Unmarshal(e, &ent); err != nil {
+				return 0, err
+			}
+			last = max(last, ent.EventSequence)
+		}
+	}
+	return last, nil
+}
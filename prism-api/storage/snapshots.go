@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+
+	"prism-api/domain"
+)
+
+const snapshotCachePrefix = "snapshot"
+
+// snapshotInterval spaces the snapshots kept in Redis. A point-in-time view
+// starts from the snapshot at the last multiple of the interval and replays
+// only the events after it.
+const snapshotInterval = time.Hour
+
+// snapshotSettle is how far in the past a snapshot must be before it is
+// cached. Events reach the index through the read-model updater shortly after
+// their timestamp, so a snapshot of the last moments could still change.
+const snapshotSettle = 5 * time.Minute
+
+const taskEventIndexSelect = "RowKey,TaskId,EventId,Type,EventTimestamp,EventSequence,UserId,IdempotencyKey,BoardId,Data"
+
+type snapshotCache interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value any, expiration time.Duration) *redis.StatusCmd
+}
+
+// WithTaskEventIndexTable reads point-in-time views and undo targets from the
+// task event index the read-model updater keeps: one partition per read model
+// partition, with rows keyed by event timestamp.
+func WithTaskEventIndexTable(name string) Option {
+	return func(s *Storage) {
+		if name != "" && s.svc != nil {
+			s.taskEventIndex = s.svc.NewClient(name)
+		}
+	}
+}
+
+// WithSnapshotCache keeps the periodic task snapshots in Redis for ttl.
+func WithSnapshotCache(client snapshotCache, ttl time.Duration) Option {
+	return func(s *Storage) {
+		if client != nil && ttl > 0 {
+			s.snapshots = client
+			s.snapshotTTL = ttl
+		}
+	}
+}
+
+// TasksAsOf replays the task events of a partition up to and including asOf,
+// a command timestamp in Unix nanoseconds. The partition is a board when board
+// is set and otherwise a user, whose personal tasks are returned.
+func (s *Storage) TasksAsOf(ctx context.Context, partition string, board bool, asOf int64) ([]domain.Task, error) {
+	if s.taskEventIndex == nil {
+		return nil, ErrTaskEventsDisabled
+	}
+	at := asOf - asOf%int64(snapshotInterval)
+	snapshot, err := s.snapshotAt(ctx, partition, at)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.indexedTaskEvents(ctx, partition, at, asOf+1)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Replay(events)
+	return snapshot.Tasks(), nil
+}
+
+// snapshotAt returns the tasks of a partition after the events before at, a
+// multiple of snapshotInterval. A settled snapshot missing from the cache is
+// built from the previous one when that is cached and from all earlier events
+// otherwise. One that has not settled yet is built from the previous one,
+// which has.
+//
+// Events are ordered by sequence within a replay but split between snapshots
+// by timestamp, so an event stamped just before a snapshot by a node whose
+// clock ran ahead can be replayed as stale after it.
+func (s *Storage) snapshotAt(ctx context.Context, partition string, at int64) (domain.TaskSnapshot, error) {
+	key := cacheKey(partition, snapshotCachePrefix+":"+strconv.FormatInt(at, 10))
+	settled := s.snapshots != nil && at <= time.Now().Add(-snapshotSettle).UnixNano()
+	if settled {
+		snapshot, ok := s.loadSnapshot(ctx, key)
+		observeCacheLookup("snapshots", ok)
+		if ok {
+			return snapshot, nil
+		}
+	}
+
+	snapshot, from := domain.TaskSnapshot{}, int64(0)
+	if prev := at - int64(snapshotInterval); s.snapshots != nil && prev > 0 {
+		if settled {
+			prevKey := cacheKey(partition, snapshotCachePrefix+":"+strconv.FormatInt(prev, 10))
+			if cached, ok := s.loadSnapshot(ctx, prevKey); ok {
+				snapshot, from = cached, prev
+			}
+		} else {
+			cached, err := s.snapshotAt(ctx, partition, prev)
+			if err != nil {
+				return nil, err
+			}
+			snapshot, from = cached, prev
+		}
+	}
+	events, err := s.indexedTaskEvents(ctx, partition, from, at)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Replay(events)
+
+	if settled {
+		if data, err := sonic.Marshal(snapshot); err == nil {
+			if err := s.snapshots.Set(ctx, key, data, s.snapshotTTL).Err(); err != nil {
+				log.Printf("storage: snapshot cache store failed: %v", err)
+			}
+		}
+	}
+	return snapshot, nil
+}
+
+// indexedTaskEvents returns the events of a partition with a timestamp in
+// [from, to), sorted for replay. Index row keys start with the zero-padded
+// timestamp, so the range is a row key range within the partition.
+func (s *Storage) indexedTaskEvents(ctx context.Context, partition string, from, to int64) ([]domain.TaskEvent, error) {
+	filter := "PartitionKey eq '" + quoteFilter(partition) + "' and RowKey ge '" + taskEventIndexKey(from) + "' and RowKey lt '" + taskEventIndexKey(to) + "'"
+	return listTaskEvents(ctx, s.taskEventIndex, filter, taskEventIndexSelect)
+}
+
+// taskEventIndexKey is the row key prefix of the index rows of events stamped
+// ts. The read-model updater appends "_" and the event ID.
+func taskEventIndexKey(ts int64) string {
+	return fmt.Sprintf("%019d", ts)
+}
+
+func (s *Storage) loadSnapshot(ctx context.Context, key string) (domain.TaskSnapshot, bool) {
+	raw, err := s.snapshots.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("storage: snapshot cache lookup failed: %v", err)
+		return nil, false
+	}
+	var snapshot domain.TaskSnapshot
+	if err := sonic.Unmarshal([]byte(raw), &snapshot); err != nil {
+		log.Printf("storage: snapshot cache decode failed: %v", err)
+		return nil, false
+	}
+	if snapshot == nil {
+		snapshot = domain.TaskSnapshot{}
+	}
+	return snapshot, true
+}
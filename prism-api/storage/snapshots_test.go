@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+
+	"prism-api/domain"
+)
+
+type mapSnapshotCache struct {
+	values map[string]string
+}
+
+func (c *mapSnapshotCache) Get(ctx context.Context, key string) *redis.StringCmd {
+	v, ok := c.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+func (c *mapSnapshotCache) Set(ctx context.Context, key string, value any, expiration time.Duration) *redis.StatusCmd {
+	c.values[key] = string(value.([]byte))
+	return redis.NewStatusResult("OK", nil)
+}
+
+var indexRangeFilter = regexp.MustCompile(`RowKey ge '(\d+)' and RowKey lt '(\d+)'`)
+
+// fakeEventIndex serves index rows whose row key lies in the range of the
+// filter and records the ranges it was asked for.
+type fakeEventIndex struct {
+	rows    []taskEventEntity
+	queries [][2]int64
+}
+
+func (f *fakeEventIndex) NewListEntitiesPager(opts *aztables.ListEntitiesOptions) *azruntime.Pager[aztables.ListEntitiesResponse] {
+	m := indexRangeFilter.FindStringSubmatch(*opts.Filter)
+	from, _ := strconv.ParseInt(m[1], 10, 64)
+	to, _ := strconv.ParseInt(m[2], 10, 64)
+	f.queries = append(f.queries, [2]int64{from, to})
+	var entities [][]byte
+	for _, row := range f.rows {
+		if row.RowKey >= m[1] && row.RowKey < m[2] {
+			data, _ := sonic.Marshal(row)
+			entities = append(entities, data)
+		}
+	}
+	return azruntime.NewPager(azruntime.PagingHandler[aztables.ListEntitiesResponse]{
+		More: func(aztables.ListEntitiesResponse) bool { return false },
+		Fetcher: func(context.Context, *aztables.ListEntitiesResponse) (aztables.ListEntitiesResponse, error) {
+			return aztables.ListEntitiesResponse{Entities: entities}, nil
+		},
+	})
+}
+
+func indexRow(ts int64, taskID, typ, data string) taskEventEntity {
+	id := fmt.Sprintf("e%d", ts)
+	return taskEventEntity{RowKey: taskEventIndexKey(ts) + "_" + id, TaskID: taskID, EventID: id, Type: typ, EventTimestamp: ts, Data: data}
+}
+
+func TestTasksAsOfReplaysFromPreviousSnapshot(t *testing.T) {
+	interval := int64(snapshotInterval)
+	at := time.Now().Add(-24*time.Hour).UnixNano() / interval * interval
+	prev := at - interval
+	index := &fakeEventIndex{rows: []taskEventEntity{
+		indexRow(prev+1, "t2", domain.TaskCreated, `{"title":"second"}`),
+		indexRow(at+1, "t1", domain.TaskCompleted, ""),
+		indexRow(at+3, "t2", domain.TaskCompleted, ""),
+	}}
+	before, _ := sonic.Marshal(domain.TaskSnapshot{"t1": {Title: "first", EventTimestamp: prev - 1}})
+	cache := &mapSnapshotCache{values: map[string]string{
+		cacheKey("user", snapshotCachePrefix+":"+strconv.FormatInt(prev, 10)): string(before),
+	}}
+	store := &Storage{taskEventIndex: index}
+	WithSnapshotCache(cache, time.Hour)(store)
+
+	tasks, err := store.TasksAsOf(context.Background(), "user", false, at+2)
+	if err != nil {
+		t.Fatalf("TasksAsOf: %v", err)
+	}
+	want := []domain.Task{{ID: "t1", Title: "first", Done: true}, {ID: "t2", Title: "second"}}
+	if fmt.Sprint(tasks) != fmt.Sprint(want) {
+		t.Fatalf("expected %+v, got %+v", want, tasks)
+	}
+	// Only the events since the previous snapshot are read.
+	if fmt.Sprint(index.queries) != fmt.Sprint([][2]int64{{prev, at}, {at, at + 3}}) {
+		t.Fatalf("unexpected index queries %v", index.queries)
+	}
+	if _, ok := cache.values[cacheKey("user", snapshotCachePrefix+":"+strconv.FormatInt(at, 10))]; !ok {
+		t.Fatal("expected the snapshot to be cached")
+	}
+
+	// The cached snapshot serves later views of the same interval.
+	index.queries = nil
+	if _, err := store.TasksAsOf(context.Background(), "user", false, at+5); err != nil {
+		t.Fatalf("TasksAsOf: %v", err)
+	}
+	if fmt.Sprint(index.queries) != fmt.Sprint([][2]int64{{at, at + 6}}) {
+		t.Fatalf("unexpected index queries %v", index.queries)
+	}
+}
+
+func TestTasksAsOfDoesNotCacheUnsettledSnapshots(t *testing.T) {
+	interval := int64(snapshotInterval)
+	at := (time.Now().UnixNano()/interval + 1) * interval
+	cache := &mapSnapshotCache{values: map[string]string{}}
+	store := &Storage{taskEventIndex: &fakeEventIndex{}}
+	WithSnapshotCache(cache, time.Hour)(store)
+
+	if _, err := store.TasksAsOf(context.Background(), "user", false, at); err != nil {
+		t.Fatalf("TasksAsOf: %v", err)
+	}
+	if _, ok := cache.values[cacheKey("user", snapshotCachePrefix+":"+strconv.FormatInt(at, 10))]; ok {
+		t.Fatal("expected the unsettled snapshot not to be cached")
+	}
+	// It was built on an earlier snapshot, which has settled: the last one
+	// unless that is younger than snapshotSettle.
+	_, last := cache.values[cacheKey("user", snapshotCachePrefix+":"+strconv.FormatInt(at-interval, 10))]
+	_, earlier := cache.values[cacheKey("user", snapshotCachePrefix+":"+strconv.FormatInt(at-2*interval, 10))]
+	if !last && !earlier {
+		t.Fatal("expected a settled snapshot to be cached")
+	}
+}
+
+func TestTasksAsOfWithoutIndex(t *testing.T) {
+	store := &Storage{}
+	if _, err := store.TasksAsOf(context.Background(), "user", false, time.Now().UnixNano()); !errors.Is(err, ErrTaskEventsDisabled) {
+		t.Fatalf("expected ErrTaskEventsDisabled, got %v", err)
+	}
+}
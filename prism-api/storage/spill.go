@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+
+	"prism-api/domain"
+)
+
+const (
+	spillProcessingSuffix = ":processing:"
+	spillDeadLetterSuffix = ":dead-letter"
+	// spillMaxAttempts is how often a spilled batch may fail to enqueue before
+	// it is moved to the dead-letter list.
+	spillMaxAttempts = 5
+	// spillDeadLetterMaxLen caps the dead-letter list, which nothing consumes.
+	spillDeadLetterMaxLen = 10000
+)
+
+type spillClient interface {
+	RPush(ctx context.Context, key string, values ...any) *redis.IntCmd
+	LPush(ctx context.Context, key string, values ...any) *redis.IntCmd
+	BLMove(ctx context.Context, source, destination, srcpos, destpos string, timeout time.Duration) *redis.StringCmd
+	LMove(ctx context.Context, source, destination, srcpos, destpos string) *redis.StringCmd
+	LRem(ctx context.Context, key string, count int64, value any) *redis.IntCmd
+	LTrim(ctx context.Context, key string, start, stop int64) *redis.StatusCmd
+}
+
+// spilledBatch is a buffered batch and the number of times it failed to enqueue.
+type spilledBatch struct {
+	domain.CommandBatchEnvelope
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// CommandSpill buffers command batches in a Redis list while the enqueue pool is
+// saturated. Popped batches are moved to a processing list of the popping node
+// until they are acknowledged, so a crash between pop and enqueue does not lose
+// them and a restarting node only recovers the batches it popped itself.
+type CommandSpill struct {
+	client     spillClient
+	key        string
+	processing string
+}
+
+// NewCommandSpill creates a spill buffer stored under key, shared by all nodes.
+// node names the processing list of this node and must differ between nodes.
+func NewCommandSpill(client spillClient, key, node string) *CommandSpill {
+	return &CommandSpill{client: client, key: key, processing: key + spillProcessingSuffix + node}
+}
+
+func (s *CommandSpill) Push(ctx context.Context, userID string, cmds []domain.Command) error {
+	data, err := sonic.Marshal(spilledBatch{CommandBatchEnvelope: domain.CommandBatchEnvelope{UserID: userID, Parts: 1, Commands: cmds, TraceParent: domain.TraceParent(ctx)}})
+	if err != nil {
+		return err
+	}
+	return s.client.RPush(ctx, s.key, string(data)).Err()
+}
+
+func (s *CommandSpill) Pop(ctx context.Context, timeout time.Duration) (domain.CommandBatchEnvelope, string, error) {
+	var entry spilledBatch
+	raw, err := s.client.BLMove(ctx, s.key, s.processing, "LEFT", "RIGHT", timeout).Result()
+	if errors.Is(err, redis.Nil) {
+		return entry.CommandBatchEnvelope, "", nil
+	}
+	if err != nil {
+		return entry.CommandBatchEnvelope, "", err
+	}
+	if err := sonic.UnmarshalString(raw, &entry); err != nil {
+		// A malformed entry can never be delivered; drop it instead of blocking the buffer.
+		_ = s.Ack(ctx, raw)
+		return domain.CommandBatchEnvelope{}, "", err
+	}
+	return entry.CommandBatchEnvelope, raw, nil
+}
+
+// Ack removes a delivered batch from the processing list.
+func (s *CommandSpill) Ack(ctx context.Context, receipt string) error {
+	return s.client.LRem(ctx, s.processing, 1, receipt).Err()
+}
+
+// Requeue moves a popped batch from the processing list back to the head of the
+// buffer, so it is still delivered before the user's later batches.
+func (s *CommandSpill) Requeue(ctx context.Context, receipt string) error {
+	if err := s.client.LRem(ctx, s.processing, 1, receipt).Err(); err != nil {
+		return err
+	}
+	return s.client.LPush(ctx, s.key, receipt).Err()
+}
+
+// Retry counts a failed enqueue of a popped batch and requeues it at the head of
+// the buffer, or moves it to the dead-letter list once it failed spillMaxAttempts
+// times. It reports whether the batch was requeued. The batch is pushed before it
+// leaves the processing list, so a crash in between delivers it twice at worst.
+func (s *CommandSpill) Retry(ctx context.Context, receipt string) (bool, error) {
+	var entry spilledBatch
+	if err := sonic.UnmarshalString(receipt, &entry); err != nil {
+		return false, err
+	}
+	entry.Attempts++
+	data, err := sonic.MarshalString(entry)
+	if err != nil {
+		return false, err
+	}
+	if entry.Attempts < spillMaxAttempts {
+		if err := s.client.LPush(ctx, s.key, data).Err(); err != nil {
+			return false, err
+		}
+		return true, s.Ack(ctx, receipt)
+	}
+	deadLetter := s.key + spillDeadLetterSuffix
+	if err := s.client.RPush(ctx, deadLetter, data).Err(); err != nil {
+		return false, err
+	}
+	if err := s.client.LTrim(ctx, deadLetter, -spillDeadLetterMaxLen, -1).Err(); err != nil {
+		return false, err
+	}
+	return false, s.Ack(ctx, receipt)
+}
+
+// Recover moves batches left in this node's processing list by its previous run
+// back to the head of the buffer in the order they were popped. Commands are
+// idempotent, so a batch delivered twice is harmless.
+func (s *CommandSpill) Recover(ctx context.Context) (int, error) {
+	n := 0
+	for {
+		_, err := s.client.LMove(ctx, s.processing, s.key, "RIGHT", "LEFT").Result()
+		if errors.Is(err, redis.Nil) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
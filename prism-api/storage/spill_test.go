@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"prism-api/domain"
+)
+
+func newTestSpill(t *testing.T) (*CommandSpill, *redis.Client) {
+	t.Helper()
+	rc := newTestSpillRedis(t)
+	return NewCommandSpill(rc, "spill", "0"), rc
+}
+
+func newTestSpillRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		rc.Close()
+		m.Close()
+	})
+	return rc
+}
+
+func TestCommandSpillRoundTrip(t *testing.T) {
+	spill, rc := newTestSpill(t)
+	ctx := context.Background()
+
+	cmds := []domain.Command{{ID: "k1", Type: "create-task"}, {ID: "k2", Type: "update-task"}}
+	if err := spill.Push(ctx, "user", cmds); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	batch, receipt, err := spill.Pop(ctx, 10*time.Millisecond)
+	if err != nil || receipt == "" {
+		t.Fatalf("pop: receipt %q err %v", receipt, err)
+	}
+	if batch.UserID != "user" || len(batch.Commands) != 2 || batch.Commands[1].ID != "k2" {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+	if n := rc.LLen(ctx, spill.processing).Val(); n != 1 {
+		t.Fatalf("expected batch to be reserved, processing length %d", n)
+	}
+	if err := spill.Ack(ctx, receipt); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if n := rc.LLen(ctx, spill.processing).Val(); n != 0 {
+		t.Fatalf("expected processing list to be empty, got %d", n)
+	}
+
+	if _, receipt, err := spill.Pop(ctx, 10*time.Millisecond); err != nil || receipt != "" {
+		t.Fatalf("expected empty pop, receipt %q err %v", receipt, err)
+	}
+}
+
+func TestCommandSpillRequeueAndRecover(t *testing.T) {
+	spill, rc := newTestSpill(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		if err := spill.Push(ctx, "user", []domain.Command{{ID: id}}); err != nil {
+			t.Fatalf("push: %v", err)
+		}
+	}
+	_, receipt, err := spill.Pop(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("pop: %v", err)
+	}
+	if err := spill.Requeue(ctx, receipt); err != nil {
+		t.Fatalf("requeue: %v", err)
+	}
+	if n := rc.LLen(ctx, "spill").Val(); n != 2 {
+		t.Fatalf("expected both batches buffered, got %d", n)
+	}
+	if batch, _, _ := spill.Pop(ctx, 10*time.Millisecond); batch.Commands[0].ID != "a" {
+		t.Fatalf("expected the requeued batch first, got %+v", batch)
+	}
+	if err := spill.Requeue(ctx, receipt); err != nil {
+		t.Fatalf("requeue: %v", err)
+	}
+
+	if _, _, err := spill.Pop(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("pop: %v", err)
+	}
+	recovered, err := spill.Recover(ctx)
+	if err != nil || recovered != 1 {
+		t.Fatalf("recover: %d %v", recovered, err)
+	}
+	if n := rc.LLen(ctx, "spill").Val(); n != 2 {
+		t.Fatalf("expected recovered batch to be buffered, got %d", n)
+	}
+}
+
+func TestCommandSpillRecoverKeepsOrder(t *testing.T) {
+	spill, _ := newTestSpill(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := spill.Push(ctx, "user", []domain.Command{{ID: id}}); err != nil {
+			t.Fatalf("push: %v", err)
+		}
+	}
+	// A crash leaves a and b in the processing list.
+	for i := 0; i < 2; i++ {
+		if _, _, err := spill.Pop(ctx, 10*time.Millisecond); err != nil {
+			t.Fatalf("pop: %v", err)
+		}
+	}
+	if _, err := spill.Recover(ctx); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		batch, receipt, err := spill.Pop(ctx, 10*time.Millisecond)
+		if err != nil || receipt == "" {
+			t.Fatalf("pop: receipt %q err %v", receipt, err)
+		}
+		if batch.Commands[0].ID != want {
+			t.Fatalf("expected batch %s, got %s", want, batch.Commands[0].ID)
+		}
+		if err := spill.Ack(ctx, receipt); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+}
+
+func TestCommandSpillRetryDeadLettersAfterMaxAttempts(t *testing.T) {
+	spill, rc := newTestSpill(t)
+	ctx := context.Background()
+
+	if err := spill.Push(ctx, "user", []domain.Command{{ID: "a"}}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	for attempt := 1; attempt <= spillMaxAttempts; attempt++ {
+		batch, receipt, err := spill.Pop(ctx, 10*time.Millisecond)
+		if err != nil || receipt == "" {
+			t.Fatalf("attempt %d: pop: receipt %q err %v", attempt, receipt, err)
+		}
+		if batch.Commands[0].ID != "a" {
+			t.Fatalf("attempt %d: unexpected batch %+v", attempt, batch)
+		}
+		requeued, err := spill.Retry(ctx, receipt)
+		if err != nil {
+			t.Fatalf("attempt %d: retry: %v", attempt, err)
+		}
+		if want := attempt < spillMaxAttempts; requeued != want {
+			t.Fatalf("attempt %d: expected requeued %v", attempt, want)
+		}
+	}
+	if n := rc.LLen(ctx, "spill").Val(); n != 0 {
+		t.Fatalf("expected the buffer to be empty, got %d", n)
+	}
+	if n := rc.LLen(ctx, spill.processing).Val(); n != 0 {
+		t.Fatalf("expected the processing list to be empty, got %d", n)
+	}
+	dead := rc.LRange(ctx, "spill"+spillDeadLetterSuffix, 0, -1).Val()
+	if len(dead) != 1 || !strings.Contains(dead[0], `"attempts":5`) {
+		t.Fatalf("unexpected dead-letter list: %v", dead)
+	}
+}
+
+func TestCommandSpillRecoverLeavesOtherNodesBatches(t *testing.T) {
+	rc := newTestSpillRedis(t)
+	ctx := context.Background()
+	node0 := NewCommandSpill(rc, "spill", "0")
+	node1 := NewCommandSpill(rc, "spill", "1")
+
+	for _, id := range []string{"a", "b"} {
+		if err := node0.Push(ctx, "user", []domain.Command{{ID: id}}); err != nil {
+			t.Fatalf("push: %v", err)
+		}
+	}
+	if _, _, err := node0.Pop(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("pop: %v", err)
+	}
+	_, receipt, err := node1.Pop(ctx, 10*time.Millisecond)
+	if err != nil || receipt == "" {
+		t.Fatalf("pop: receipt %q err %v", receipt, err)
+	}
+
+	recovered, err := node0.Recover(ctx)
+	if err != nil || recovered != 1 {
+		t.Fatalf("recover: %d %v", recovered, err)
+	}
+	if n := rc.LLen(ctx, node1.processing).Val(); n != 1 {
+		t.Fatalf("expected node 1 to keep its batch, processing length %d", n)
+	}
+	if err := node1.Ack(ctx, receipt); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if n := rc.LLen(ctx, node1.processing).Val(); n != 0 {
+		t.Fatalf("expected node 1's batch acknowledged, processing length %d", n)
+	}
+}
@@ -19,24 +19,36 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
 	"github.com/bytedance/sonic"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
+	"auth"
 	"prism-api/domain"
+	"settings"
 )
 
-type queueClient interface {
-	EnqueueMessage(ctx context.Context, content string, o *azqueue.EnqueueMessageOptions) (azqueue.EnqueueMessagesResponse, error)
-	GetProperties(ctx context.Context, o *azqueue.GetQueuePropertiesOptions) (azqueue.GetQueuePropertiesResponse, error)
-}
+const enqueueSpanName = "enqueue commands"
 
 type Storage struct {
 	taskTable              *aztables.Client
 	settingsTable          *aztables.Client
-	commandQueue           queueClient
+	boardTable             *aztables.Client
+	tokens                 *auth.TableTokenStore
+	auditTable             *aztables.Client
+	taskEventsTable        *aztables.Client
+	taskEventIndex         entityLister
+	svc                    *aztables.ServiceClient
+	commandQueue           commandTransport
 	taskPageSize           int32
 	tasksSelectClause      string
 	tasksSelectMetadataFmt aztables.MetadataFormat
 	queueConcurrency       int
+	batchMessageSize       int
 	cache                  redisGetter
+	snapshots              snapshotCache
+	snapshotTTL            time.Duration
 }
 
 // Option configures optional storage behaviors.
@@ -87,7 +99,7 @@ func queueConcurrencyForCPU(numCPU int) int {
 
 const maxTaskPageSize = int32(1000)
 
-func New(connStr, tasksTable, settingsTable, commandQueue string, taskPageSize int, opts ...Option) (*Storage, error) {
+func New(connStr, tasksTable, settingsTable, boardsTable, commandQueue string, taskPageSize int, opts ...Option) (*Storage, error) {
 	tablesClientOptions := aztables.ClientOptions{
 		ClientOptions: azcore.ClientOptions{
 			Retry: policy.RetryOptions{
@@ -105,6 +117,11 @@ func New(connStr, tasksTable, settingsTable, commandQueue string, taskPageSize i
 	}
 	tt := svc.NewClient(tasksTable)
 	st := svc.NewClient(settingsTable)
+	// Shared boards are optional; without a table no ID names a board.
+	var bt *aztables.Client
+	if boardsTable != "" {
+		bt = svc.NewClient(boardsTable)
+	}
 	queueClientOptions := azqueue.ClientOptions{
 		ClientOptions: azcore.ClientOptions{
 			Retry: policy.RetryOptions{
@@ -126,9 +143,11 @@ func New(connStr, tasksTable, settingsTable, commandQueue string, taskPageSize i
 	store := &Storage{
 		taskTable:              tt,
 		settingsTable:          st,
-		commandQueue:           cq,
+		boardTable:             bt,
+		svc:                    svc,
+		commandQueue:           azureQueueTransport{client: cq},
 		taskPageSize:           int32(taskPageSize),
-		tasksSelectClause:      "RowKey,Title,Notes,Category,Order,Done",
+		tasksSelectClause:      "RowKey,Title,Notes,Category,Order,Rank,Done",
 		tasksSelectMetadataFmt: aztables.MetadataFormatNone,
 		queueConcurrency:       defaultQueueConcurrency,
 	}
@@ -159,6 +178,7 @@ type taskEntity struct {
 	Notes    string `json:"Notes"`
 	Category string `json:"Category"`
 	Order    int    `json:"Order"`
+	Rank     string `json:"Rank"`
 	Done     bool   `json:"Done"`
 }
 
@@ -291,8 +311,10 @@ func resolveTaskPageSize(requested int, defaultSize int32) int32 {
 
 func (s *Storage) FetchTasks(ctx context.Context, userID, token string, limit int) ([]domain.Task, string, error) {
 	pageSize := resolveTaskPageSize(limit, s.taskPageSize)
-	if pageSize == s.taskPageSize {
-		if tasks, next, ok := s.fetchTasksFromCache(ctx, userID, token, pageSize); ok {
+	if pageSize == s.taskPageSize && s.cache != nil {
+		tasks, next, ok := s.fetchTasksFromCache(ctx, userID, token, pageSize)
+		observeCacheLookup("tasks", ok)
+		if ok {
 			return tasks, next, nil
 		}
 	}
@@ -323,6 +345,7 @@ func (s *Storage) FetchTasks(ctx context.Context, userID, token string, limit in
 			Notes:    ent.Notes,
 			Category: ent.Category,
 			Order:    ent.Order,
+			Rank:     ent.Rank,
 			Done:     ent.Done,
 		})
 	}
@@ -389,15 +412,38 @@ func (s *Storage) fetchTasksFromCache(ctx context.Context, userID, token string,
 	return page, nextToken, true
 }
 
+// decodeSettingsEntity reads a settings row; rows stored before the current
+// settings version are upgraded.
 func decodeSettingsEntity(data []byte) (domain.Settings, error) {
 	var raw struct {
-		TasksPerCategory int  `json:"TasksPerCategory"`
-		ShowDoneTasks    bool `json:"ShowDoneTasks"`
+		SettingsVersion  int    `json:"SettingsVersion"`
+		TasksPerCategory int    `json:"TasksPerCategory"`
+		ShowDoneTasks    bool   `json:"ShowDoneTasks"`
+		Theme            string `json:"Theme"`
+		DefaultCategory  string `json:"DefaultCategory"`
+		Categories       string `json:"Categories"`
+		Timezone         string `json:"Timezone"`
+		WeekStart        string `json:"WeekStart"`
 	}
 	if err := sonic.Unmarshal(data, &raw); err != nil {
 		return domain.Settings{}, err
 	}
-	return domain.Settings{TasksPerCategory: raw.TasksPerCategory, ShowDoneTasks: raw.ShowDoneTasks}, nil
+	categories, err := settings.DecodeCategories(raw.Categories)
+	if err != nil {
+		return domain.Settings{}, fmt.Errorf("decode settings categories: %w", err)
+	}
+	doc := domain.Settings{
+		Version:          raw.SettingsVersion,
+		TasksPerCategory: raw.TasksPerCategory,
+		ShowDoneTasks:    raw.ShowDoneTasks,
+		Theme:            raw.Theme,
+		DefaultCategory:  raw.DefaultCategory,
+		Categories:       categories,
+		Timezone:         raw.Timezone,
+		WeekStart:        raw.WeekStart,
+	}
+	doc.Upgrade()
+	return doc, nil
 }
 
 func (s *Storage) loadTasksFromCache(ctx context.Context, userID string) (*cachedTasks, bool) {
@@ -443,6 +489,8 @@ func (s *Storage) loadSettingsFromCache(ctx context.Context, userID string) (*do
 		log.Printf("storage: settings cache decode failed: %v", err)
 		return nil, false
 	}
+	// Entries cached before settings version 2 lack the newer fields.
+	payload.Settings.Upgrade()
 	return &payload.Settings, true
 }
 
@@ -451,14 +499,22 @@ func cacheKey(userID, prefix string) string {
 }
 
 func (s *Storage) FetchSettings(ctx context.Context, userID string) (domain.Settings, error) {
-	if settings, ok := s.loadSettingsFromCache(ctx, userID); ok {
-		if settings == nil {
+	cached, ok := s.loadSettingsFromCache(ctx, userID)
+	if s.cache != nil {
+		observeCacheLookup("settings", ok)
+	}
+	if ok {
+		if cached == nil {
 			return domain.Settings{}, nil
 		}
-		return *settings, nil
+		return *cached, nil
 	}
 	ent, err := s.settingsTable.GetEntity(ctx, userID, userID, &aztables.GetEntityOptions{Format: to.Ptr(aztables.MetadataFormatNone)})
 	if err != nil {
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+			return domain.Settings{}, domain.ErrSettingsNotFound
+		}
 		return domain.Settings{}, err
 	}
 	return decodeSettingsEntity(ent.Value)
@@ -478,21 +534,39 @@ func (s *Storage) Warmup(ctx context.Context) error {
 		}
 	}
 
-	if _, err := s.commandQueue.GetProperties(ctx, nil); err != nil {
+	if err := s.commandQueue.Ping(ctx); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *Storage) EnqueueCommands(ctx context.Context, userID string, cmds []domain.Command) error {
+// EnqueueCommands sends the commands to the domain service. Every message carries
+// the traceparent of the enqueue span, so processing downstream joins the trace
+// of the request that issued the commands.
+func (s *Storage) EnqueueCommands(ctx context.Context, userID string, cmds []domain.Command) (err error) {
 	if len(cmds) == 0 {
 		return nil
 	}
+	ctx, span := otel.Tracer("prism-api/storage").Start(ctx, enqueueSpanName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.Int("prism.commands.count", len(cmds))),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	traceParent := domain.TraceParent(ctx)
+	if s.batchMessageSize > 0 {
+		return s.enqueueBatch(ctx, userID, cmds, traceParent)
+	}
 
 	payloads := make([]string, len(cmds))
 	for i, cmd := range cmds {
-		env := domain.CommandEnvelope{UserID: userID, Command: cmd}
+		env := domain.CommandEnvelope{UserID: userID, Command: cmd, TraceParent: traceParent}
 		data, err := sonic.Marshal(env)
 		if err != nil {
 			return err
@@ -503,7 +577,7 @@ func (s *Storage) EnqueueCommands(ctx context.Context, userID string, cmds []dom
 	workers := s.queueConcurrency
 	if workers <= 1 {
 		for _, payload := range payloads {
-			if _, err := s.commandQueue.EnqueueMessage(ctx, payload, nil); err != nil {
+			if err := s.commandQueue.Send(ctx, payload); err != nil {
 				return err
 			}
 		}
@@ -532,7 +606,7 @@ func (s *Storage) EnqueueCommands(ctx context.Context, userID string, cmds []dom
 				if !ok {
 					return
 				}
-				if _, err := s.commandQueue.EnqueueMessage(ctx, payload, nil); err != nil {
+				if err := s.commandQueue.Send(ctx, payload); err != nil {
 					once.Do(func() {
 						firstErr = err
 						cancel()
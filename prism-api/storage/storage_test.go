@@ -3,11 +3,15 @@ package storage
 import (
 	"context"
 	"encoding/base64"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/redis/go-redis/v9"
+
+	"prism-api/domain"
+	"settings"
 )
 
 func TestDecodeSettingsEntity(t *testing.T) {
@@ -29,6 +33,37 @@ func TestDecodeSettingsEntity(t *testing.T) {
 	}
 }
 
+func TestDecodeSettingsEntityVersions(t *testing.T) {
+	testCases := map[string]struct {
+		data string
+		want domain.Settings
+	}{
+		"version_1_row_is_upgraded": {
+			data: `{"TasksPerCategory":4,"ShowDoneTasks":true}`,
+			want: domain.Settings{Version: 2, TasksPerCategory: 4, ShowDoneTasks: true, Theme: "system", DefaultCategory: "normal", Categories: []settings.Category{}, Timezone: "UTC", WeekStart: "monday"},
+		},
+		"version_2_row": {
+			data: `{"SettingsVersion":2,"TasksPerCategory":4,"ShowDoneTasks":false,"Theme":"dark","DefaultCategory":"work","Categories":"[{\"name\":\"work\",\"color\":\"#112233\"}]","Timezone":"Europe/Berlin","WeekStart":"sunday"}`,
+			want: domain.Settings{Version: 2, TasksPerCategory: 4, Theme: "dark", DefaultCategory: "work", Categories: []settings.Category{{Name: "work", Color: "#112233"}}, Timezone: "Europe/Berlin", WeekStart: "sunday"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, err := decodeSettingsEntity([]byte(tc.data))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(s, tc.want) {
+				t.Fatalf("unexpected settings:\n got %+v\nwant %+v", s, tc.want)
+			}
+		})
+	}
+
+	if _, err := decodeSettingsEntity([]byte(`{"SettingsVersion":2,"Categories":"not-json"}`)); err == nil {
+		t.Fatal("expected an error for malformed categories")
+	}
+}
+
 func TestTaskEntityDecodeWithoutMetadata(t *testing.T) {
 	payload := []byte(`{"RowKey":"task1","Title":"Write tests","Notes":"cover metadata removal","Category":"dev","Order":3,"Done":false}`)
 	var ent taskEntity
@@ -266,12 +301,16 @@ func TestFetchSettingsUsesCache(t *testing.T) {
 	cacheValue := `{"version":1,"cachedAt":"` + time.Now().UTC().Format(time.RFC3339Nano) + `","lastUpdatedAt":1,"settings":{"tasksPerCategory":4,"showDoneTasks":true}}`
 	cache := &stubRedisGetter{value: cacheValue}
 	store := &Storage{cache: cache}
-	settings, err := store.FetchSettings(context.Background(), "user")
+	got, err := store.FetchSettings(context.Background(), "user")
 	if err != nil {
 		t.Fatalf("FetchSettings: %v", err)
 	}
-	if settings.TasksPerCategory != 4 || !settings.ShowDoneTasks {
-		t.Fatalf("unexpected settings: %+v", settings)
+	if got.TasksPerCategory != 4 || !got.ShowDoneTasks {
+		t.Fatalf("unexpected settings: %+v", got)
+	}
+	// Entries cached before settings version 2 get the newer defaults.
+	if got.Version != settings.Version || got.Theme != settings.DefaultTheme || got.Categories == nil {
+		t.Fatalf("expected upgraded settings: %+v", got)
 	}
 	if cache.lastKey != cacheKey("user", settingsCachePrefix) {
 		t.Fatalf("unexpected cache key: %s", cache.lastKey)
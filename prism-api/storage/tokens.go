@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"auth"
+)
+
+// ErrTokensDisabled is returned by the token methods when no tokens table was
+// configured.
+var ErrTokensDisabled = errors.New("personal access tokens are not configured")
+
+// WithTokensTable stores personal access tokens in the named table.
+func WithTokensTable(name string) Option {
+	return func(s *Storage) {
+		if name != "" && s.svc != nil {
+			s.tokens = auth.NewTableTokenStore(s.svc.NewClient(name))
+		}
+	}
+}
+
+// CreateToken stores a newly issued personal access token.
+func (s *Storage) CreateToken(ctx context.Context, tok auth.PersonalToken) error {
+	if s.tokens == nil {
+		return ErrTokensDisabled
+	}
+	return s.tokens.CreateToken(ctx, tok)
+}
+
+// ListTokens returns the user's personal access tokens, including expired ones.
+func (s *Storage) ListTokens(ctx context.Context, userID string) ([]auth.PersonalToken, error) {
+	if s.tokens == nil {
+		return nil, ErrTokensDisabled
+	}
+	return s.tokens.ListTokens(ctx, userID)
+}
+
+// RevokeToken deletes the token and reports whether it existed.
+func (s *Storage) RevokeToken(ctx context.Context, userID, id string) (bool, error) {
+	if s.tokens == nil {
+		return false, ErrTokensDisabled
+	}
+	return s.tokens.RevokeToken(ctx, userID, id)
+}
+
+// PersonalToken returns the token or nil when it does not exist or was revoked.
+func (s *Storage) PersonalToken(ctx context.Context, userID, id string) (*auth.PersonalToken, error) {
+	if s.tokens == nil {
+		return nil, ErrTokensDisabled
+	}
+	return s.tokens.PersonalToken(ctx, userID, id)
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
+	"github.com/redis/go-redis/v9"
+)
+
+// commandTransport delivers serialized command envelopes to the domain service.
+type commandTransport interface {
+	Send(ctx context.Context, payload string) error
+	Ping(ctx context.Context) error
+}
+
+// streamPayloadField is the Redis Streams entry field carrying the serialized message.
+const streamPayloadField = "payload"
+
+type queueClient interface {
+	EnqueueMessage(ctx context.Context, content string, o *azqueue.EnqueueMessageOptions) (azqueue.EnqueueMessagesResponse, error)
+	GetProperties(ctx context.Context, o *azqueue.GetQueuePropertiesOptions) (azqueue.GetQueuePropertiesResponse, error)
+}
+
+// azureQueueTransport sends commands to an Azure Storage queue.
+type azureQueueTransport struct {
+	client queueClient
+}
+
+func (t azureQueueTransport) Send(ctx context.Context, payload string) error {
+	_, err := t.client.EnqueueMessage(ctx, payload, nil)
+	return err
+}
+
+func (t azureQueueTransport) Ping(ctx context.Context) error {
+	_, err := t.client.GetProperties(ctx, nil)
+	return err
+}
+
+type redisStreamAdder interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	Ping(ctx context.Context) *redis.StatusCmd
+}
+
+// redisStreamTransport appends commands to a Redis stream consumed through a consumer group.
+type redisStreamTransport struct {
+	client redisStreamAdder
+	stream string
+}
+
+func (t redisStreamTransport) Send(ctx context.Context, payload string) error {
+	return t.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: t.stream,
+		Values: []any{streamPayloadField, payload},
+	}).Err()
+}
+
+func (t redisStreamTransport) Ping(ctx context.Context) error {
+	return t.client.Ping(ctx).Err()
+}
+
+// WithRedisCommandStream publishes commands to the given Redis stream instead of the Azure command queue.
+func WithRedisCommandStream(client redisStreamAdder, stream string) Option {
+	return func(s *Storage) {
+		if client == nil || stream == "" {
+			return
+		}
+		s.commandQueue = redisStreamTransport{client: client, stream: stream}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"prism-api/api"
+	"tracing"
+)
+
+// setupEventExport selects where the request observability events go, based on
+// OBSERVABILITY_EXPORTER:
+//
+//   - stdout (default): JSON lines on stdout, read by collect-otel-events.
+//   - otlp: OTel log records and latency histograms sent over OTLP/HTTP to the
+//     endpoint in the standard OTEL_EXPORTER_OTLP_* variables.
+//   - file: the same log records and histograms appended as JSON to
+//     OBSERVABILITY_FILE, a local stand-in for a collector.
+//
+// The returned option is nil for stdout. The shutdown function flushes pending
+// records.
+func setupEventExport(ctx context.Context, serviceName string) (api.Option, func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	var (
+		logExporter    sdklog.Exporter
+		metricExporter sdkmetric.Exporter
+		closeFile      = noop
+	)
+	switch exporter := os.Getenv("OBSERVABILITY_EXPORTER"); exporter {
+	case "", "stdout":
+		return nil, noop, nil
+	case "otlp":
+		var err error
+		if logExporter, err = otlploghttp.New(ctx); err != nil {
+			return nil, nil, err
+		}
+		if metricExporter, err = otlpmetrichttp.New(ctx); err != nil {
+			return nil, nil, err
+		}
+	case "file":
+		path := os.Getenv("OBSERVABILITY_FILE")
+		if path == "" {
+			return nil, nil, errors.New("OBSERVABILITY_FILE is required for the file exporter")
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		closeFile = func(context.Context) error { return f.Close() }
+		if logExporter, err = stdoutlog.New(stdoutlog.WithWriter(f)); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		if metricExporter, err = stdoutmetric.New(stdoutmetric.WithWriter(f)); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid OBSERVABILITY_EXPORTER: %s", exporter)
+	}
+
+	res, err := tracing.NewResource(ctx, serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+		sdklog.WithResource(res),
+	)
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	shutdown := func(ctx context.Context) error {
+		return errors.Join(lp.Shutdown(ctx), mp.Shutdown(ctx), closeFile(ctx))
+	}
+	return api.WithEventExport(lp, mp), shutdown, nil
+}
@@ -11,6 +11,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"read-model-updater/domain"
+	"settings"
 )
 
 type cacheStore interface {
@@ -44,6 +45,7 @@ type cachedTask struct {
 	Notes    string `json:"notes,omitempty"`
 	Category string `json:"category"`
 	Order    int    `json:"order"`
+	Rank     string `json:"rank,omitempty"`
 	Done     bool   `json:"done,omitempty"`
 }
 
@@ -66,8 +68,14 @@ type cachedSettings struct {
 }
 
 type cachedSettingsEntry struct {
-	TasksPerCategory int  `json:"tasksPerCategory"`
-	ShowDoneTasks    bool `json:"showDoneTasks"`
+	Version          int                 `json:"version"`
+	TasksPerCategory int                 `json:"tasksPerCategory"`
+	ShowDoneTasks    bool                `json:"showDoneTasks"`
+	Theme            string              `json:"theme"`
+	DefaultCategory  string              `json:"defaultCategory"`
+	Categories       []settings.Category `json:"categories"`
+	Timezone         string              `json:"timezone"`
+	WeekStart        string              `json:"weekStart"`
 }
 
 func newCacheUpdater(store cacheStore, redis *redis.Client, tasksPerPage int32, cachedPages int, tasksTTL, settingsTTL time.Duration) *cacheUpdater {
@@ -128,6 +136,7 @@ func (c *cacheUpdater) RefreshTasks(ctx context.Context, userID string, entityID
 				Notes:    t.Notes,
 				Category: t.Category,
 				Order:    t.Order,
+				Rank:     t.Rank,
 				Done:     t.Done,
 			})
 			if t.EventTimestamp > maxTs {
@@ -208,13 +217,25 @@ func (c *cacheUpdater) RefreshSettings(ctx context.Context, userID string, lastU
 	if ts < lastUpdated {
 		ts = lastUpdated
 	}
+	ent.Upgrade()
+	categories, err := ent.CategoryList()
+	if err != nil {
+		log.WithError(err).WithField("user", userID).Error("failed to decode settings categories for cache")
+		return
+	}
 	payload := cachedSettings{
-		Version:       1,
+		Version:       2,
 		CachedAt:      c.now().UTC(),
 		LastUpdatedAt: ts,
 		Settings: cachedSettingsEntry{
+			Version:          ent.SettingsVersion,
 			TasksPerCategory: ent.TasksPerCategory,
 			ShowDoneTasks:    ent.ShowDoneTasks,
+			Theme:            ent.Theme,
+			DefaultCategory:  ent.DefaultCategory,
+			Categories:       categories,
+			Timezone:         ent.Timezone,
+			WeekStart:        ent.WeekStart,
 		},
 	}
 	data, err := json.Marshal(payload)
@@ -10,6 +10,7 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"read-model-updater/domain"
+	"settings"
 )
 
 type taskPageResponse struct {
@@ -221,6 +222,10 @@ func TestCacheUpdaterRefreshSettingsStoresPayload(t *testing.T) {
 	if payload.Settings.TasksPerCategory != 3 || !payload.Settings.ShowDoneTasks {
 		t.Fatalf("unexpected settings payload: %+v", payload.Settings)
 	}
+	// Settings stored before version 2 are cached with the newer defaults.
+	if payload.Settings.Version != settings.Version || payload.Settings.Theme != settings.DefaultTheme || payload.Settings.Categories == nil {
+		t.Fatalf("expected upgraded settings payload: %+v", payload.Settings)
+	}
 	if got := m.TTL(cacheKey("user", settingsCachePrefix)); got <= 0 {
 		t.Fatalf("expected ttl to be set for settings, got %v", got)
 	}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BoardStorage defines methods required for updating board memberships.
+type BoardStorage interface {
+	GetBoardMember(ctx context.Context, boardID, userID string) (*BoardMemberEntity, error)
+	UpsertBoardMember(ctx context.Context, ent BoardMemberEntity) error
+	DeleteBoardMember(ctx context.Context, boardID, userID string) error
+	ListBoardMembers(ctx context.Context, boardID string) ([]BoardMemberEntity, error)
+}
+
+// BoardService processes board events.
+type BoardService struct{ st BoardStorage }
+
+// NewBoardService returns a BoardService writing to st. A nil st disables
+// shared boards: board events are then dropped.
+func NewBoardService(st BoardStorage) BoardService { return BoardService{st: st} }
+
+// Apply updates the membership read model for board related events.
+func (s BoardService) Apply(ctx context.Context, ev Event) error {
+	pk := ev.EntityID
+	if s.st == nil {
+		log.WithFields(log.Fields{"board": pk, "type": ev.Type}).Warn("dropping board event: boards are disabled")
+		return nil
+	}
+	switch ev.Type {
+	case BoardCreated:
+		var data BoardCreatedEventData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return err
+		}
+		ent, err := s.st.GetBoardMember(ctx, pk, ev.UserID)
+		if err != nil {
+			return err
+		}
+		if ent != nil {
+			log.WithFields(log.Fields{"board": pk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("duplicate board-created event")
+			return fmt.Errorf("board %s already exists", pk)
+		}
+		return s.st.UpsertBoardMember(ctx, BoardMemberEntity{
+			Entity:         Entity{PartitionKey: pk, RowKey: ev.UserID},
+			Name:           data.Name,
+			Role:           BoardRoleOwner,
+			EventTimestamp: ev.Timestamp,
+			EventSequence:  ev.Sequence,
+		})
+	case BoardMemberAdded:
+		var data BoardMemberEventData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return err
+		}
+		if data.Role != BoardRoleEditor && data.Role != BoardRoleViewer {
+			return fmt.Errorf("board %s member %s has invalid role %q", pk, data.UserID, data.Role)
+		}
+		// The name is copied from the issuing member so every row can list the board.
+		issuer, err := s.st.GetBoardMember(ctx, pk, ev.UserID)
+		if err != nil {
+			return err
+		}
+		if issuer == nil {
+			log.WithFields(log.Fields{"board": pk, "user": ev.UserID}).Error("board-member-added event from non-member")
+			return fmt.Errorf("board %s not found for %s", pk, ev.UserID)
+		}
+		cur, err := s.st.GetBoardMember(ctx, pk, data.UserID)
+		if err != nil {
+			return err
+		}
+		if cur != nil {
+			if cur.Role == BoardRoleOwner {
+				return fmt.Errorf("board %s owner role cannot be changed", pk)
+			}
+			if !ev.after(cur.EventSequence, cur.EventTimestamp) {
+				log.WithFields(log.Fields{"board": pk, "member": data.UserID, "ts": ev.Timestamp, "seq": ev.Sequence, "current": cur.EventTimestamp, "currentSeq": cur.EventSequence}).Error("stale board-member-added event")
+				return fmt.Errorf("board %s received stale member update", pk)
+			}
+		}
+		return s.st.UpsertBoardMember(ctx, BoardMemberEntity{
+			Entity:         Entity{PartitionKey: pk, RowKey: data.UserID},
+			Name:           issuer.Name,
+			Role:           data.Role,
+			EventTimestamp: ev.Timestamp,
+			EventSequence:  ev.Sequence,
+		})
+	case BoardMemberRemoved:
+		var data BoardMemberEventData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return err
+		}
+		cur, err := s.st.GetBoardMember(ctx, pk, data.UserID)
+		if err != nil {
+			return err
+		}
+		if cur == nil {
+			return nil
+		}
+		if cur.Role == BoardRoleOwner {
+			return fmt.Errorf("board %s owner cannot be removed", pk)
+		}
+		if !ev.after(cur.EventSequence, cur.EventTimestamp) {
+			log.WithFields(log.Fields{"board": pk, "member": data.UserID, "ts": ev.Timestamp, "seq": ev.Sequence, "current": cur.EventTimestamp, "currentSeq": cur.EventSequence}).Error("stale board-member-removed event")
+			return fmt.Errorf("board %s received stale member removal", pk)
+		}
+		return s.st.DeleteBoardMember(ctx, pk, data.UserID)
+	default:
+		return fmt.Errorf("unknown board event %s", ev.Type)
+	}
+}
+
+// Recipients returns the users an event on the board must reach: its current
+// members and, for removals, the user who just lost access.
+func (s BoardService) Recipients(ctx context.Context, ev Event) ([]string, error) {
+	members, err := s.st.ListBoardMembers(ctx, ev.BoardID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(members)+1)
+	for _, m := range members {
+		ids = append(ids, m.RowKey)
+	}
+	if ev.Type == BoardMemberRemoved {
+		var data BoardMemberEventData
+		if err := json.Unmarshal(ev.Data, &data); err == nil && data.UserID != "" {
+			ids = append(ids, data.UserID)
+		}
+	}
+	return ids, nil
+}
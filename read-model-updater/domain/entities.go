@@ -19,8 +19,10 @@ type TaskEntity struct {
 	Notes          string `json:"Notes,omitempty"`
 	Category       string `json:"Category,omitempty"`
 	Order          int    `json:"Order"`
+	Rank           string `json:"Rank,omitempty"`
 	Done           bool   `json:"Done"`
 	EventTimestamp int64  `json:"EventTimestamp,string"`
+	EventSequence  int64  `json:"EventSequence,string"`
 	ETag           string `json:"-"`
 }
 
@@ -31,8 +33,35 @@ type TaskUpdate struct {
 	Notes          *string `json:"Notes,omitempty"`
 	Category       *string `json:"Category,omitempty"`
 	Order          *int    `json:"Order,omitempty"`
+	Rank           *string `json:"Rank,omitempty"`
 	Done           *bool   `json:"Done,omitempty"`
 	EventTimestamp *int64  `json:"EventTimestamp,omitempty,string"`
+	EventSequence  *int64  `json:"EventSequence,omitempty,string"`
+}
+
+// TaskEventIndexEntity is a row of the task event index, which lists the task
+// events of each read model partition by timestamp so that the Prism API can
+// replay a partition without scanning the event store.
+type TaskEventIndexEntity struct {
+	Entity
+	TaskID         string `json:"TaskId"`
+	EventID        string `json:"EventId"`
+	Type           string `json:"Type"`
+	EventTimestamp int64  `json:"EventTimestamp,string"`
+	EventSequence  int64  `json:"EventSequence,string"`
+	UserID         string `json:"UserId"`
+	IdempotencyKey string `json:"IdempotencyKey,omitempty"`
+	BoardID        string `json:"BoardId,omitempty"`
+	Data           string `json:"Data,omitempty"`
+}
+
+// TaskWrite is one row a unit of work commits: either a new task or changes
+// merged into an existing one whose ETag must still match. An empty ETag
+// matches any version.
+type TaskWrite struct {
+	Insert *TaskEntity
+	Update *TaskUpdate
+	ETag   string
 }
 
 // UserEntity represents a user stored in the read model.
@@ -42,16 +71,45 @@ type UserEntity struct {
 	Email string `json:"Email,omitempty"`
 }
 
+// UserSettingsEntity stores a user's settings document. Rows written before
+// settings version 2 have no SettingsVersion and none of the fields added with
+// it; see Upgrade.
 type UserSettingsEntity struct {
 	Entity
-	TasksPerCategory int   `json:"TasksPerCategory"`
-	ShowDoneTasks    bool  `json:"ShowDoneTasks"`
-	EventTimestamp   int64 `json:"EventTimestamp,string"`
+	SettingsVersion  int    `json:"SettingsVersion"`
+	TasksPerCategory int    `json:"TasksPerCategory"`
+	ShowDoneTasks    bool   `json:"ShowDoneTasks"`
+	Theme            string `json:"Theme"`
+	DefaultCategory  string `json:"DefaultCategory"`
+	// Categories holds the user's categories as a JSON array of settings.Category.
+	Categories     string `json:"Categories"`
+	Timezone       string `json:"Timezone"`
+	WeekStart      string `json:"WeekStart"`
+	EventTimestamp int64  `json:"EventTimestamp,string"`
+	EventSequence  int64  `json:"EventSequence,string"`
+	ETag           string `json:"-"`
 }
 
 type UserSettingsUpdate struct {
 	Entity
-	TasksPerCategory *int   `json:"TasksPerCategory,omitempty"`
-	ShowDoneTasks    *bool  `json:"ShowDoneTasks,omitempty"`
-	EventTimestamp   *int64 `json:"EventTimestamp,omitempty,string"`
+	SettingsVersion  *int    `json:"SettingsVersion,omitempty"`
+	TasksPerCategory *int    `json:"TasksPerCategory,omitempty"`
+	ShowDoneTasks    *bool   `json:"ShowDoneTasks,omitempty"`
+	Theme            *string `json:"Theme,omitempty"`
+	DefaultCategory  *string `json:"DefaultCategory,omitempty"`
+	Categories       *string `json:"Categories,omitempty"`
+	Timezone         *string `json:"Timezone,omitempty"`
+	WeekStart        *string `json:"WeekStart,omitempty"`
+	EventTimestamp   *int64  `json:"EventTimestamp,omitempty,string"`
+	EventSequence    *int64  `json:"EventSequence,omitempty,string"`
+}
+
+// BoardMemberEntity grants a user a role on a board. The board is the partition,
+// so a single query lists its members.
+type BoardMemberEntity struct {
+	Entity
+	Name           string `json:"Name,omitempty"`
+	Role           string `json:"Role"`
+	EventTimestamp int64  `json:"EventTimestamp,string"`
+	EventSequence  int64  `json:"EventSequence,string"`
 }
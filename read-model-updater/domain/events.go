@@ -1,17 +1,32 @@
 package domain
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"settings"
+	"taskstate"
+)
 
 const (
 	TaskCreated         = "task-created"
 	TaskUpdated         = "task-updated"
 	TaskCompleted       = "task-completed"
 	TaskReopened        = "task-reopened"
+	TasksReordered      = "tasks-reordered"
 	UserCreated         = "user-created"
 	UserLoggedIn        = "user-logged-in"
 	UserLoggedOut       = "user-logged-out"
 	UserSettingsCreated = "user-settings-created"
 	UserSettingsUpdated = "user-settings-updated"
+	BoardCreated        = "board-created"
+	BoardMemberAdded    = "board-member-added"
+	BoardMemberRemoved  = "board-member-removed"
+)
+
+const (
+	BoardRoleOwner  = "owner"
+	BoardRoleEditor = "editor"
+	BoardRoleViewer = "viewer"
 )
 
 // Event represents a change in the domain model.
@@ -23,6 +38,39 @@ type Event struct {
 	Data       json.RawMessage `json:"Data"`
 	Timestamp  int64           `json:"Timestamp"`
 	UserID     string          `json:"UserId"`
+	// IdempotencyKey is the key of the command that produced the event.
+	IdempotencyKey string `json:"IdempotencyKey,omitempty"`
+	// Sequence orders the events of a read model partition when the Prism API
+	// stamps commands from its sequencer; zero when it does not.
+	Sequence int64 `json:"Sequence,omitempty"`
+	// TraceParent is the W3C traceparent of the command processing that produced the event.
+	TraceParent string `json:"TraceParent,omitempty"`
+	// BoardID is set for board events and for tasks that belong to a shared board.
+	BoardID string `json:"BoardId,omitempty"`
+	// Recipients lists the users stream-service delivers the event to. It is filled
+	// in before publishing board events; other events go to UserID only.
+	Recipients []string `json:"Recipients,omitempty"`
+}
+
+// after reports whether ev comes after the event last applied to an entity,
+// which carried seq and ts. Like taskstate.Event.After it compares sequences
+// when both are set and falls back to the API nodes' timestamps otherwise.
+func (ev Event) after(seq, ts int64) bool {
+	return taskstate.Event{Timestamp: ev.Timestamp, Sequence: ev.Sequence}.After(taskstate.Task{EventTimestamp: ts, EventSequence: seq})
+}
+
+// state returns the part of ev the task reducer needs.
+func (ev Event) state() taskstate.Event {
+	return taskstate.Event{Type: ev.Type, Data: ev.Data, Timestamp: ev.Timestamp, Sequence: ev.Sequence}
+}
+
+// Partition returns the read model partition the event applies to: the board for
+// shared tasks and the user otherwise.
+func (ev Event) Partition() string {
+	if ev.BoardID != "" {
+		return ev.BoardID
+	}
+	return ev.UserID
 }
 
 type UserEventData struct {
@@ -35,6 +83,7 @@ type TaskCreatedEventData struct {
 	Notes    string `json:"notes"`
 	Category string `json:"category"`
 	Order    int    `json:"order"`
+	Rank     string `json:"rank,omitempty"`
 }
 
 type TaskUpdatedEventData struct {
@@ -42,15 +91,40 @@ type TaskUpdatedEventData struct {
 	Notes    *string `json:"notes"`
 	Category *string `json:"category"`
 	Order    *int    `json:"order"`
+	Rank     *string `json:"rank"`
 	Done     *bool   `json:"done"`
 }
 
+// UserSettingsEventData is the full settings document a user starts with.
+// Events from before settings version 2 only carry the first two fields.
 type UserSettingsEventData struct {
-	TasksPerCategory int  `json:"tasksPerCategory"`
-	ShowDoneTasks    bool `json:"showDoneTasks"`
+	Version          int                 `json:"version"`
+	TasksPerCategory int                 `json:"tasksPerCategory"`
+	ShowDoneTasks    bool                `json:"showDoneTasks"`
+	Theme            string              `json:"theme"`
+	DefaultCategory  string              `json:"defaultCategory"`
+	Categories       []settings.Category `json:"categories"`
+	Timezone         string              `json:"timezone"`
+	WeekStart        string              `json:"weekStart"`
 }
 
+// UserSettingsUpdatedEventData holds the changed fields; nil fields keep their
+// stored value. Categories replaces the whole list.
 type UserSettingsUpdatedEventData struct {
-	TasksPerCategory *int  `json:"tasksPerCategory"`
-	ShowDoneTasks    *bool `json:"showDoneTasks"`
+	TasksPerCategory *int                 `json:"tasksPerCategory"`
+	ShowDoneTasks    *bool                `json:"showDoneTasks"`
+	Theme            *string              `json:"theme"`
+	DefaultCategory  *string              `json:"defaultCategory"`
+	Categories       *[]settings.Category `json:"categories"`
+	Timezone         *string              `json:"timezone"`
+	WeekStart        *string              `json:"weekStart"`
+}
+
+type BoardCreatedEventData struct {
+	Name string `json:"name"`
+}
+
+type BoardMemberEventData struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"`
 }
@@ -7,12 +7,13 @@ import (
 
 // Orchestrator routes events to the appropriate service based on entity type.
 type Orchestrator struct {
-	tasks TaskService
-	users UserService
+	tasks  TaskService
+	users  UserService
+	boards BoardService
 }
 
-func NewOrchestrator(tasks TaskService, users UserService) Orchestrator {
-	return Orchestrator{tasks: tasks, users: users}
+func NewOrchestrator(tasks TaskService, users UserService, boards BoardService) Orchestrator {
+	return Orchestrator{tasks: tasks, users: users, boards: boards}
 }
 
 // Apply delegates event handling to the corresponding service.
@@ -22,6 +23,8 @@ func (o Orchestrator) Apply(ctx context.Context, ev Event) error {
 		return o.tasks.Apply(ctx, ev)
 	case "user", "user-settings":
 		return o.users.Apply(ctx, ev)
+	case "board":
+		return o.boards.Apply(ctx, ev)
 	default:
 		return fmt.Errorf("unknown entity type %s", ev.EntityType)
 	}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"reflect"
 	"testing"
+
+	"settings"
 )
 
 type fakeStore struct {
@@ -13,8 +16,12 @@ type fakeStore struct {
 	insertTask     TaskEntity
 	updateTask     TaskUpdate
 	upsertUser     UserEntity
-	upsertSettings UserSettingsEntity
+	insertSettings UserSettingsEntity
 	updateSettings UserSettingsUpdate
+	members        map[string]BoardMemberEntity
+	batches        int
+	conflicts      int
+	settingsRace   *UserSettingsEntity
 }
 
 func (f *fakeStore) GetTask(ctx context.Context, pk, rk string) (*TaskEntity, error) {
@@ -61,16 +68,42 @@ func (f *fakeStore) UpdateTask(ctx context.Context, upd TaskUpdate, _ string) er
 	if upd.Order != nil {
 		ent.Order = *upd.Order
 	}
+	if upd.Rank != nil {
+		ent.Rank = *upd.Rank
+	}
 	if upd.Done != nil {
 		ent.Done = *upd.Done
 	}
 	if upd.EventTimestamp != nil {
 		ent.EventTimestamp = *upd.EventTimestamp
 	}
+	if upd.EventSequence != nil {
+		ent.EventSequence = *upd.EventSequence
+	}
 	f.tasks[upd.RowKey] = ent
 	return nil
 }
 
+func (f *fakeStore) CommitTasks(ctx context.Context, writes []TaskWrite) error {
+	f.batches++
+	if f.conflicts > 0 {
+		f.conflicts--
+		return ErrConcurrencyConflict
+	}
+	for _, w := range writes {
+		var err error
+		if w.Insert != nil {
+			err = f.InsertTask(ctx, *w.Insert)
+		} else {
+			err = f.UpdateTask(ctx, *w.Update, w.ETag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (f *fakeStore) UpsertUser(ctx context.Context, ent UserEntity) error {
 	f.upsertUser = ent
 	return nil
@@ -87,19 +120,28 @@ func (f *fakeStore) GetUserSettings(ctx context.Context, id string) (*UserSettin
 	return &ent, nil
 }
 
-func (f *fakeStore) UpsertUserSettings(ctx context.Context, ent UserSettingsEntity) error {
+func (f *fakeStore) InsertUserSettings(ctx context.Context, ent UserSettingsEntity) error {
 	if f.settings == nil {
 		f.settings = map[string]UserSettingsEntity{}
 	}
+	if _, exists := f.settings[ent.RowKey]; exists {
+		return ErrConcurrencyConflict
+	}
 	f.settings[ent.RowKey] = ent
-	f.upsertSettings = ent
+	f.insertSettings = ent
 	return nil
 }
 
-func (f *fakeStore) UpdateUserSettings(ctx context.Context, ent UserSettingsUpdate) error {
+func (f *fakeStore) UpdateUserSettings(ctx context.Context, ent UserSettingsUpdate, etag string) error {
 	if f.settings == nil {
 		f.settings = map[string]UserSettingsEntity{}
 	}
+	if f.settingsRace != nil {
+		// Another replica stores newer settings between our read and write.
+		f.settings[ent.RowKey] = *f.settingsRace
+		f.settingsRace = nil
+		return ErrConcurrencyConflict
+	}
 	cur, ok := f.settings[ent.RowKey]
 	if !ok {
 		cur = UserSettingsEntity{Entity: Entity{PartitionKey: ent.PartitionKey, RowKey: ent.RowKey}}
@@ -110,17 +152,69 @@ func (f *fakeStore) UpdateUserSettings(ctx context.Context, ent UserSettingsUpda
 	if ent.ShowDoneTasks != nil {
 		cur.ShowDoneTasks = *ent.ShowDoneTasks
 	}
+	if ent.SettingsVersion != nil {
+		cur.SettingsVersion = *ent.SettingsVersion
+	}
+	if ent.Theme != nil {
+		cur.Theme = *ent.Theme
+	}
+	if ent.DefaultCategory != nil {
+		cur.DefaultCategory = *ent.DefaultCategory
+	}
+	if ent.Categories != nil {
+		cur.Categories = *ent.Categories
+	}
+	if ent.Timezone != nil {
+		cur.Timezone = *ent.Timezone
+	}
+	if ent.WeekStart != nil {
+		cur.WeekStart = *ent.WeekStart
+	}
 	if ent.EventTimestamp != nil {
 		cur.EventTimestamp = *ent.EventTimestamp
 	}
+	if ent.EventSequence != nil {
+		cur.EventSequence = *ent.EventSequence
+	}
 	f.settings[ent.RowKey] = cur
 	f.updateSettings = ent
 	return nil
 }
 
+func (f *fakeStore) GetBoardMember(ctx context.Context, boardID, userID string) (*BoardMemberEntity, error) {
+	ent, ok := f.members[boardID+"/"+userID]
+	if !ok {
+		return nil, nil
+	}
+	return &ent, nil
+}
+
+func (f *fakeStore) UpsertBoardMember(ctx context.Context, ent BoardMemberEntity) error {
+	if f.members == nil {
+		f.members = map[string]BoardMemberEntity{}
+	}
+	f.members[ent.PartitionKey+"/"+ent.RowKey] = ent
+	return nil
+}
+
+func (f *fakeStore) DeleteBoardMember(ctx context.Context, boardID, userID string) error {
+	delete(f.members, boardID+"/"+userID)
+	return nil
+}
+
+func (f *fakeStore) ListBoardMembers(ctx context.Context, boardID string) ([]BoardMemberEntity, error) {
+	var out []BoardMemberEntity
+	for _, m := range f.members {
+		if m.PartitionKey == boardID {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
 func TestApplyTaskCreated(t *testing.T) {
 	fs := &fakeStore{}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	data := struct {
 		Title    string `json:"title"`
 		Notes    string `json:"notes"`
@@ -139,7 +233,7 @@ func TestApplyTaskCreated(t *testing.T) {
 
 func TestApplyTaskUpdatedMissingTask(t *testing.T) {
 	fs := &fakeStore{}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "task", Type: TaskUpdated, UserID: "u1", EntityID: "t1", Timestamp: 1}
 	if err := orch.Apply(context.Background(), ev); err == nil {
 		t.Fatalf("expected error for missing task")
@@ -148,7 +242,7 @@ func TestApplyTaskUpdatedMissingTask(t *testing.T) {
 
 func TestApplyTaskCompletedMissingTask(t *testing.T) {
 	fs := &fakeStore{}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "task", Type: TaskCompleted, UserID: "u1", EntityID: "t1", Timestamp: 1}
 	if err := orch.Apply(context.Background(), ev); err == nil {
 		t.Fatalf("expected error for missing task")
@@ -161,7 +255,7 @@ func TestApplyTaskCompletedStaleEventReturnsError(t *testing.T) {
 		Done:           false,
 		EventTimestamp: 5,
 	}}}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "task", Type: TaskCompleted, UserID: "u1", EntityID: "t1", Timestamp: 3}
 	if err := orch.Apply(context.Background(), ev); err == nil {
 		t.Fatalf("expected error for stale completion")
@@ -174,7 +268,7 @@ func TestApplyTaskCompletedStaleEventReturnsError(t *testing.T) {
 
 func TestApplyTaskReopenedMissingTask(t *testing.T) {
 	fs := &fakeStore{}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "task", Type: TaskReopened, UserID: "u1", EntityID: "t1", Timestamp: 1}
 	if err := orch.Apply(context.Background(), ev); err == nil {
 		t.Fatalf("expected error for missing task")
@@ -187,7 +281,7 @@ func TestApplyTaskReopenedStaleEventReturnsError(t *testing.T) {
 		Done:           false,
 		EventTimestamp: 5,
 	}}}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "task", Type: TaskReopened, UserID: "u1", EntityID: "t1", Timestamp: 3}
 	if err := orch.Apply(context.Background(), ev); err == nil {
 		t.Fatalf("expected error for stale reopen")
@@ -204,7 +298,7 @@ func TestApplyTaskReopened(t *testing.T) {
 		Done:           true,
 		EventTimestamp: 5,
 	}}}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "task", Type: TaskReopened, UserID: "u1", EntityID: "t1", Timestamp: 6}
 	if err := orch.Apply(context.Background(), ev); err != nil {
 		t.Fatalf("apply: %v", err)
@@ -227,7 +321,7 @@ func TestApplyTaskUpdatedStaleEventReturnsError(t *testing.T) {
 	order := 0
 	data := TaskUpdatedEventData{Done: &done, Order: &order}
 	payload, _ := json.Marshal(data)
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "task", Type: TaskUpdated, UserID: "u1", EntityID: "t1", Data: payload, Timestamp: 3}
 	if err := orch.Apply(context.Background(), ev); err == nil {
 		t.Fatalf("expected error for stale update")
@@ -238,9 +332,47 @@ func TestApplyTaskUpdatedStaleEventReturnsError(t *testing.T) {
 	}
 }
 
+func TestApplyTaskEventsOrderBySequence(t *testing.T) {
+	// The second API node's clock runs behind: its later command carries the
+	// next sequence but an older timestamp.
+	cases := []struct {
+		name    string
+		ev      Event
+		wantErr bool
+	}{
+		{"next sequence", Event{Timestamp: 3, Sequence: 8}, false},
+		{"earlier sequence", Event{Timestamp: 9, Sequence: 6}, true},
+		{"unsequenced", Event{Timestamp: 3}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := &fakeStore{tasks: map[string]TaskEntity{"t1": {
+				Entity:         Entity{PartitionKey: "u1", RowKey: "t1"},
+				Title:          "a",
+				EventTimestamp: 5,
+				EventSequence:  7,
+			}}}
+			orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
+			ev := tc.ev
+			ev.EntityType, ev.Type, ev.UserID, ev.EntityID = "task", TaskCompleted, "u1", "t1"
+			err := orch.Apply(context.Background(), ev)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			ent := fs.tasks["t1"]
+			if !tc.wantErr && (!ent.Done || ent.EventSequence != ev.Sequence || ent.EventTimestamp != ev.Timestamp) {
+				t.Fatalf("unexpected task entity: %#v", ent)
+			}
+			if tc.wantErr && (ent.Done || ent.EventSequence != 7) {
+				t.Fatalf("stale event changed the task: %#v", ent)
+			}
+		})
+	}
+}
+
 func TestApplyUserCreated(t *testing.T) {
 	fs := &fakeStore{}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	data := struct {
 		Name  string `json:"name"`
 		Email string `json:"email"`
@@ -266,7 +398,7 @@ func TestApplyUserSettingsUpdatedStaleEventReturnsError(t *testing.T) {
 	sdt := false
 	data := UserSettingsUpdatedEventData{TasksPerCategory: &tpc, ShowDoneTasks: &sdt}
 	payload, _ := json.Marshal(data)
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "user-settings", Type: UserSettingsUpdated, UserID: "u1", EntityID: "u1", Data: payload, Timestamp: 2}
 	if err := orch.Apply(context.Background(), ev); err == nil {
 		t.Fatalf("expected error for stale settings update")
@@ -277,6 +409,31 @@ func TestApplyUserSettingsUpdatedStaleEventReturnsError(t *testing.T) {
 	}
 }
 
+func TestApplyUserSettingsUpdatedOrdersBySequence(t *testing.T) {
+	fs := &fakeStore{settings: map[string]UserSettingsEntity{"u1": {
+		Entity:           Entity{PartitionKey: "u1", RowKey: "u1"},
+		TasksPerCategory: 10,
+		EventTimestamp:   5,
+		EventSequence:    4,
+	}}}
+	tpc := 3
+	payload, _ := json.Marshal(UserSettingsUpdatedEventData{TasksPerCategory: &tpc})
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
+	ev := Event{EntityType: "user-settings", Type: UserSettingsUpdated, UserID: "u1", EntityID: "u1", Data: payload, Timestamp: 2, Sequence: 5}
+	if err := orch.Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	ent := fs.settings["u1"]
+	if ent.TasksPerCategory != 3 || ent.EventSequence != 5 || ent.EventTimestamp != 2 {
+		t.Fatalf("unexpected settings entity: %#v", ent)
+	}
+
+	ev.Timestamp, ev.Sequence = 9, 5
+	if err := orch.Apply(context.Background(), ev); err == nil {
+		t.Fatal("expected error for a repeated sequence")
+	}
+}
+
 func TestApplyUserSettingsUpdatedUpdatesExisting(t *testing.T) {
 	fs := &fakeStore{settings: map[string]UserSettingsEntity{
 		"u1": {
@@ -289,7 +446,7 @@ func TestApplyUserSettingsUpdatedUpdatesExisting(t *testing.T) {
 	sdt := true
 	data := UserSettingsUpdatedEventData{ShowDoneTasks: &sdt}
 	payload, _ := json.Marshal(data)
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	ev := Event{EntityType: "user-settings", Type: UserSettingsUpdated, UserID: "u1", EntityID: "u1", Data: payload, Timestamp: 2}
 	if err := orch.Apply(context.Background(), ev); err != nil {
 		t.Fatalf("apply: %v", err)
@@ -304,7 +461,7 @@ func TestApplyUserSettingsUpdatedUpdatesExisting(t *testing.T) {
 
 func TestApplyUserSettingsUpdatedCreatesWhenMissing(t *testing.T) {
 	fs := &fakeStore{}
-	orch := NewOrchestrator(NewTaskService(fs), NewUserService(fs))
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
 	sdt := true
 	data := UserSettingsUpdatedEventData{ShowDoneTasks: &sdt}
 	payload, _ := json.Marshal(data)
@@ -318,5 +475,358 @@ func TestApplyUserSettingsUpdatedCreatesWhenMissing(t *testing.T) {
 	}
 }
 
+func TestApplyUserSettingsUpdatedMergesProvidedFields(t *testing.T) {
+	fs := &fakeStore{settings: map[string]UserSettingsEntity{"u1": {
+		Entity:           Entity{PartitionKey: "u1", RowKey: "u1"},
+		SettingsVersion:  settings.Version,
+		TasksPerCategory: 5,
+		Theme:            "dark",
+		DefaultCategory:  "fun",
+		Categories:       `[{"name":"home","color":"#00ff00"}]`,
+		Timezone:         "Europe/Berlin",
+		WeekStart:        "sunday",
+		EventTimestamp:   1,
+	}}}
+	categories := []settings.Category{{Name: "work", Color: "#112233"}}
+	payload, _ := json.Marshal(UserSettingsUpdatedEventData{Theme: ptrString("light"), Categories: &categories})
+	ev := Event{EntityType: "user-settings", Type: UserSettingsUpdated, UserID: "u1", EntityID: "u1", Data: payload, Timestamp: 2}
+	if err := NewUserService(fs).Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	upd := fs.updateSettings
+	if upd.TasksPerCategory != nil || upd.DefaultCategory != nil || upd.Timezone != nil || upd.WeekStart != nil || upd.SettingsVersion != nil {
+		t.Fatalf("update should only carry the changed fields: %#v", upd)
+	}
+	ent := fs.settings["u1"]
+	want := UserSettingsEntity{
+		Entity:           ent.Entity,
+		SettingsVersion:  settings.Version,
+		TasksPerCategory: 5,
+		Theme:            "light",
+		DefaultCategory:  "fun",
+		Categories:       `[{"name":"work","color":"#112233"}]`,
+		Timezone:         "Europe/Berlin",
+		WeekStart:        "sunday",
+		EventTimestamp:   2,
+	}
+	if ent != want {
+		t.Fatalf("unexpected settings:\n got %#v\nwant %#v", ent, want)
+	}
+}
+
+func TestApplyUserSettingsUpdatedMigratesVersionOneSettings(t *testing.T) {
+	fs := &fakeStore{settings: map[string]UserSettingsEntity{"u1": {
+		Entity:           Entity{PartitionKey: "u1", RowKey: "u1"},
+		TasksPerCategory: 4,
+		ShowDoneTasks:    true,
+		EventTimestamp:   1,
+	}}}
+	payload, _ := json.Marshal(UserSettingsUpdatedEventData{WeekStart: ptrString("sunday")})
+	ev := Event{EntityType: "user-settings", Type: UserSettingsUpdated, UserID: "u1", EntityID: "u1", Data: payload, Timestamp: 2}
+	if err := NewUserService(fs).Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	ent := fs.settings["u1"]
+	if ent.SettingsVersion != settings.Version || ent.TasksPerCategory != 4 || !ent.ShowDoneTasks {
+		t.Fatalf("unexpected settings: %#v", ent)
+	}
+	if ent.WeekStart != "sunday" || ent.Theme != settings.DefaultTheme || ent.DefaultCategory != settings.DefaultCategory || ent.Categories != "[]" || ent.Timezone != settings.DefaultTimezone {
+		t.Fatalf("settings not migrated: %#v", ent)
+	}
+}
+
+func TestApplyUserSettingsCreatedFillsDefaults(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want UserSettingsEntity
+	}{
+		{
+			name: "version 1 event",
+			data: `{"tasksPerCategory":3,"showDoneTasks":false}`,
+			want: UserSettingsEntity{TasksPerCategory: 3, Theme: settings.DefaultTheme, DefaultCategory: settings.DefaultCategory, Categories: "[]", Timezone: settings.DefaultTimezone, WeekStart: settings.DefaultWeekStart},
+		},
+		{
+			name: "version 2 event",
+			data: `{"version":2,"tasksPerCategory":3,"showDoneTasks":true,"theme":"dark","defaultCategory":"fun","categories":[{"name":"home","color":"#abcdef"}],"timezone":"Asia/Tokyo","weekStart":"saturday"}`,
+			want: UserSettingsEntity{TasksPerCategory: 3, ShowDoneTasks: true, Theme: "dark", DefaultCategory: "fun", Categories: `[{"name":"home","color":"#abcdef"}]`, Timezone: "Asia/Tokyo", WeekStart: "saturday"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := &fakeStore{}
+			ev := Event{EntityType: "user-settings", Type: UserSettingsCreated, UserID: "u1", EntityID: "u1", Data: json.RawMessage(tc.data), Timestamp: 1}
+			if err := NewUserService(fs).Apply(context.Background(), ev); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			want := tc.want
+			want.Entity = Entity{PartitionKey: "u1", RowKey: "u1"}
+			want.SettingsVersion = settings.Version
+			want.EventTimestamp = 1
+			if got := fs.settings["u1"]; got != want {
+				t.Fatalf("unexpected settings:\n got %#v\nwant %#v", got, want)
+			}
+		})
+	}
+}
+
 func ptrString(s string) *string { return &s }
 func ptrInt(i int) *int          { return &i }
+
+func TestApplyTaskCreatedOnBoardUsesBoardPartition(t *testing.T) {
+	fs := &fakeStore{}
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
+	ev := Event{EntityType: "task", Type: TaskCreated, UserID: "u1", BoardID: "b1", EntityID: "t1", Data: json.RawMessage(`{"title":"t"}`), Timestamp: 1}
+	if err := orch.Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if fs.insertTask.PartitionKey != "b1" {
+		t.Fatalf("expected board partition, got %#v", fs.insertTask)
+	}
+}
+
+func TestApplyBoardMembership(t *testing.T) {
+	fs := &fakeStore{}
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
+	ctx := context.Background()
+	events := []Event{
+		{EntityType: "board", Type: BoardCreated, UserID: "u1", BoardID: "b1", EntityID: "b1", Data: json.RawMessage(`{"name":"Team"}`), Timestamp: 1},
+		{EntityType: "board", Type: BoardMemberAdded, UserID: "u1", BoardID: "b1", EntityID: "b1", Data: json.RawMessage(`{"userId":"u2","role":"viewer"}`), Timestamp: 2},
+		{EntityType: "board", Type: BoardMemberAdded, UserID: "u1", BoardID: "b1", EntityID: "b1", Data: json.RawMessage(`{"userId":"u2","role":"editor"}`), Timestamp: 3},
+	}
+	for _, ev := range events {
+		if err := orch.Apply(ctx, ev); err != nil {
+			t.Fatalf("apply %s: %v", ev.Type, err)
+		}
+	}
+	if owner := fs.members["b1/u1"]; owner.Role != BoardRoleOwner || owner.Name != "Team" {
+		t.Fatalf("unexpected owner: %#v", owner)
+	}
+	if member := fs.members["b1/u2"]; member.Role != BoardRoleEditor || member.Name != "Team" {
+		t.Fatalf("unexpected member: %#v", member)
+	}
+
+	demote := Event{EntityType: "board", Type: BoardMemberAdded, UserID: "u2", BoardID: "b1", EntityID: "b1", Data: json.RawMessage(`{"userId":"u1","role":"viewer"}`), Timestamp: 4}
+	if err := orch.Apply(ctx, demote); err == nil {
+		t.Fatalf("expected owner role to be immutable")
+	}
+
+	staleRemoval := Event{EntityType: "board", Type: BoardMemberRemoved, UserID: "u1", BoardID: "b1", EntityID: "b1", Data: json.RawMessage(`{"userId":"u2"}`), Timestamp: 2}
+	if err := orch.Apply(ctx, staleRemoval); err == nil {
+		t.Fatalf("expected error for stale removal")
+	}
+	if _, ok := fs.members["b1/u2"]; !ok {
+		t.Fatalf("stale removal must keep the member")
+	}
+
+	removed := Event{EntityType: "board", Type: BoardMemberRemoved, UserID: "u1", BoardID: "b1", EntityID: "b1", Data: json.RawMessage(`{"userId":"u2"}`), Timestamp: 5}
+	if err := orch.Apply(ctx, removed); err != nil {
+		t.Fatalf("apply removal: %v", err)
+	}
+	if _, ok := fs.members["b1/u2"]; ok {
+		t.Fatalf("expected member to be removed")
+	}
+	recipients, err := NewBoardService(fs).Recipients(ctx, removed)
+	if err != nil {
+		t.Fatalf("recipients: %v", err)
+	}
+	if len(recipients) != 2 || recipients[0] != "u1" || recipients[1] != "u2" {
+		t.Fatalf("expected remaining members and removed user, got %v", recipients)
+	}
+}
+
+func TestApplyBoardEventWithoutBoardsIsDropped(t *testing.T) {
+	fs := &fakeStore{}
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(nil))
+	ev := Event{EntityType: "board", Type: BoardCreated, UserID: "u1", BoardID: "b1", EntityID: "b1", Data: json.RawMessage(`{"name":"Team"}`), Timestamp: 1}
+	if err := orch.Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(fs.members) != 0 {
+		t.Fatalf("expected no memberships, got %#v", fs.members)
+	}
+}
+
+func TestApplyTasksReorderedUpdatesListedTasksInOneBatch(t *testing.T) {
+	fs := &fakeStore{tasks: map[string]TaskEntity{
+		"t1": {Entity: Entity{PartitionKey: "b1", RowKey: "t1"}, Title: "a", Category: "normal", Order: 0, EventTimestamp: 1},
+		"t2": {Entity: Entity{PartitionKey: "b1", RowKey: "t2"}, Title: "b", Category: "normal", Order: 1, EventTimestamp: 1},
+		"t3": {Entity: Entity{PartitionKey: "b1", RowKey: "t3"}, Title: "c", Category: "normal", Order: 2, EventTimestamp: 9},
+	}}
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
+	ev := Event{EntityType: "task", Type: TasksReordered, UserID: "u1", EntityID: "b1", BoardID: "b1", Timestamp: 5,
+		Data: json.RawMessage(`{"category":"urgent","ids":["t2","missing","t1","t3"]}`)}
+	if err := orch.Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if fs.batches != 1 {
+		t.Fatalf("expected one batch, got %d", fs.batches)
+	}
+	if t2 := fs.tasks["t2"]; t2.Order != 0 || t2.Category != "urgent" || t2.EventTimestamp != 5 {
+		t.Fatalf("unexpected t2: %#v", t2)
+	}
+	if t1 := fs.tasks["t1"]; t1.Order != 2 || t1.Category != "urgent" || t1.Title != "a" {
+		t.Fatalf("unexpected t1: %#v", t1)
+	}
+	if t1, t2 := fs.tasks["t1"], fs.tasks["t2"]; t2.Rank == "" || t2.Rank >= t1.Rank {
+		t.Fatalf("expected ranks in list order, got %q and %q", t2.Rank, t1.Rank)
+	}
+	if t3 := fs.tasks["t3"]; t3.Order != 2 || t3.Category != "normal" {
+		t.Fatalf("stale reorder must not change t3: %#v", t3)
+	}
+	if _, ok := fs.tasks["missing"]; ok {
+		t.Fatal("reorder must not create missing tasks")
+	}
+}
+
+func TestApplyTasksReorderedDropsReorderOfChangedTasks(t *testing.T) {
+	fs := &fakeStore{tasks: map[string]TaskEntity{
+		"t1": {Entity: Entity{PartitionKey: "u1", RowKey: "t1"}, Title: "a", Category: "normal", Order: 0, EventTimestamp: 1},
+		"t2": {Entity: Entity{PartitionKey: "u1", RowKey: "t2"}, Title: "b", Category: "normal", Order: 1, EventTimestamp: 4},
+	}}
+	orch := NewOrchestrator(NewTaskService(fs, nil), NewUserService(fs), NewBoardService(fs))
+	// t2 moved after the rebalancer read it at timestamp 2.
+	ev := Event{EntityType: "task", Type: TasksReordered, UserID: "u1", EntityID: "u1", Timestamp: 5,
+		Data: json.RawMessage(`{"category":"normal","ids":["t2","t1"],"expected":{"t1":1,"t2":2}}`)}
+	if err := orch.Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if t1, t2 := fs.tasks["t1"], fs.tasks["t2"]; t1.EventTimestamp != 1 || t2.EventTimestamp != 4 || t2.Order != 1 {
+		t.Fatalf("expected the reorder to be dropped, got %#v and %#v", t1, t2)
+	}
+}
+
+func TestApplyBatchCommitsEventsOfOnePartitionTogether(t *testing.T) {
+	fs := &fakeStore{tasks: map[string]TaskEntity{
+		"t1": {Entity: Entity{PartitionKey: "u1", RowKey: "t1"}, Title: "a", Category: "normal", EventTimestamp: 1, ETag: "e1"},
+	}, conflicts: 1}
+	svc := NewTaskService(fs, nil)
+	events := []Event{
+		{EntityType: "task", Type: TaskCreated, UserID: "u1", EntityID: "t2", Timestamp: 2, Data: json.RawMessage(`{"title":"b","category":"fun","order":0}`)},
+		{EntityType: "task", Type: TaskUpdated, UserID: "u1", EntityID: "t2", Timestamp: 3, Data: json.RawMessage(`{"title":"b2"}`)},
+		{EntityType: "task", Type: TaskCompleted, UserID: "u1", EntityID: "t1", Timestamp: 4},
+		{EntityType: "task", Type: TaskUpdated, UserID: "u1", EntityID: "t1", Timestamp: 5, Data: json.RawMessage(`{"notes":"n"}`)},
+	}
+	if err := svc.ApplyBatch(context.Background(), events); err != nil {
+		t.Fatalf("apply batch: %v", err)
+	}
+	if fs.batches != 2 {
+		t.Fatalf("expected the conflicting commit to be retried once, got %d commits", fs.batches)
+	}
+	if t2 := fs.tasks["t2"]; t2.Title != "b2" || t2.Category != "fun" || t2.EventTimestamp != 3 {
+		t.Fatalf("expected the update folded into the insert, got %#v", t2)
+	}
+	if t1 := fs.tasks["t1"]; !t1.Done || t1.Notes != "n" || t1.Title != "a" || t1.EventTimestamp != 5 {
+		t.Fatalf("unexpected t1: %#v", t1)
+	}
+}
+
+func TestApplyBatchStoresNothingWhenAnEventIsRejected(t *testing.T) {
+	fs := &fakeStore{tasks: map[string]TaskEntity{}}
+	svc := NewTaskService(fs, nil)
+	events := []Event{
+		{EntityType: "task", Type: TaskCreated, UserID: "u1", EntityID: "t1", Timestamp: 2, Data: json.RawMessage(`{"title":"a"}`)},
+		{EntityType: "task", Type: TaskUpdated, UserID: "u1", EntityID: "missing", Timestamp: 3, Data: json.RawMessage(`{"title":"b"}`)},
+	}
+	if err := svc.ApplyBatch(context.Background(), events); err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+	if fs.batches != 0 || len(fs.tasks) != 0 {
+		t.Fatalf("expected nothing stored, got %#v", fs.tasks)
+	}
+
+	mixed := []Event{events[0], {EntityType: "task", Type: TaskCreated, UserID: "u2", EntityID: "t2", Timestamp: 2, Data: json.RawMessage(`{"title":"b"}`)}}
+	if err := svc.ApplyBatch(context.Background(), mixed); err == nil {
+		t.Fatal("expected a batch spanning partitions to fail")
+	}
+}
+
+type fakeIndex map[string]TaskEventIndexEntity
+
+func (f fakeIndex) IndexTaskEvent(ctx context.Context, ent TaskEventIndexEntity) error {
+	f[ent.PartitionKey+"/"+ent.RowKey] = ent
+	return nil
+}
+
+func TestApplyIndexesTaskEventsByPartition(t *testing.T) {
+	fs := &fakeStore{tasks: map[string]TaskEntity{}}
+	index := fakeIndex{}
+	svc := NewTaskService(fs, index)
+	created := Event{ID: "e1", EntityType: "task", Type: TaskCreated, UserID: "u1", BoardID: "b1", EntityID: "t1", Timestamp: 2, Sequence: 7, IdempotencyKey: "k1", Data: json.RawMessage(`{"title":"a"}`)}
+	if err := svc.Apply(context.Background(), created); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	// A redelivered event is rejected but still indexed once.
+	if err := svc.Apply(context.Background(), created); err == nil {
+		t.Fatal("expected the duplicate to be rejected")
+	}
+	personal := Event{ID: "e2", EntityType: "task", Type: TaskUpdated, UserID: "u1", EntityID: "t9", Timestamp: 3, Data: json.RawMessage(`{"title":"b"}`)}
+	if err := svc.Apply(context.Background(), personal); err == nil {
+		t.Fatal("expected the update of a missing task to be rejected")
+	}
+
+	reordered := Event{ID: "e3", EntityType: "task", Type: TasksReordered, UserID: "u1", EntityID: "u1", Timestamp: 4, IdempotencyKey: "k3", Data: json.RawMessage(`{"category":"normal","ids":["t9"]}`)}
+	if err := svc.Apply(context.Background(), reordered); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	createdRow := TaskEventIndexEntity{Entity: Entity{PartitionKey: "b1", RowKey: "0000000000000000002_e1"}, TaskID: "t1", EventID: "e1", Type: TaskCreated, EventTimestamp: 2, EventSequence: 7, UserID: "u1", IdempotencyKey: "k1", BoardID: "b1", Data: `{"title":"a"}`}
+	byKey := createdRow
+	byKey.PartitionKey = "key:k1"
+	reorderRow := TaskEventIndexEntity{Entity: Entity{PartitionKey: "u1", RowKey: "0000000000000000004_e3"}, TaskID: "u1", EventID: "e3", Type: TasksReordered, EventTimestamp: 4, UserID: "u1", IdempotencyKey: "k3", Data: `{"category":"normal","ids":["t9"]}`}
+	reorderByKey, reorderByTask := reorderRow, reorderRow
+	reorderByKey.PartitionKey, reorderByTask.PartitionKey = "key:k3", "task:t9"
+	want := fakeIndex{
+		"b1/0000000000000000002_e1":      createdRow,
+		"key:k1/0000000000000000002_e1":  byKey,
+		"u1/0000000000000000003_e2":      {Entity: Entity{PartitionKey: "u1", RowKey: "0000000000000000003_e2"}, TaskID: "t9", EventID: "e2", Type: TaskUpdated, EventTimestamp: 3, UserID: "u1", Data: `{"title":"b"}`},
+		"u1/0000000000000000004_e3":      reorderRow,
+		"key:k3/0000000000000000004_e3":  reorderByKey,
+		"task:t9/0000000000000000004_e3": reorderByTask,
+	}
+	if !reflect.DeepEqual(index, want) {
+		t.Fatalf("expected index %#v, got %#v", want, index)
+	}
+}
+
+func TestApplyUserSettingsUpdatedRereadsAfterConflict(t *testing.T) {
+	stored := UserSettingsEntity{Entity: Entity{PartitionKey: "u1", RowKey: "u1"}, TasksPerCategory: 3, EventTimestamp: 1, ETag: "e1"}
+	cases := []struct {
+		name    string
+		raceTS  int64
+		wantErr bool
+		wantTPC int
+	}{
+		{"newer event still applies", 2, false, 7},
+		{"older event is rejected", 9, true, 5},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			race := UserSettingsEntity{Entity: stored.Entity, TasksPerCategory: 5, EventTimestamp: tc.raceTS, ETag: "e2"}
+			fs := &fakeStore{settings: map[string]UserSettingsEntity{"u1": stored}, settingsRace: &race}
+			tpc := 7
+			payload, _ := json.Marshal(UserSettingsUpdatedEventData{TasksPerCategory: &tpc})
+			ev := Event{EntityType: "user-settings", Type: UserSettingsUpdated, UserID: "u1", EntityID: "u1", Data: payload, Timestamp: 4}
+			err := NewUserService(fs).Apply(context.Background(), ev)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if got := fs.settings["u1"].TasksPerCategory; got != tc.wantTPC {
+				t.Fatalf("expected %d tasks per category, got %d", tc.wantTPC, got)
+			}
+		})
+	}
+}
+
+func TestApplyUserSettingsCreatedRejectsDuplicates(t *testing.T) {
+	fs := &fakeStore{settings: map[string]UserSettingsEntity{}}
+	svc := NewUserService(fs)
+	payload, _ := json.Marshal(UserSettingsEventData{TasksPerCategory: 3})
+	ev := Event{EntityType: "user-settings", Type: UserSettingsCreated, UserID: "u1", EntityID: "u1", Data: payload, Timestamp: 1}
+	if err := svc.Apply(context.Background(), ev); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if err := svc.Apply(context.Background(), ev); err == nil {
+		t.Fatal("expected the second creation to be rejected")
+	}
+}
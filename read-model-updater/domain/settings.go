@@ -0,0 +1,80 @@
+package domain
+
+import "settings"
+
+// Upgrade migrates settings written before settings.Version in place by
+// giving the fields they lack their defaults.
+func (e *UserSettingsEntity) Upgrade() {
+	settings.Upgrade(&e.Theme, &e.DefaultCategory, &e.Timezone, &e.WeekStart)
+	if e.Categories == "" {
+		e.Categories = settings.DefaultCategoriesColumn
+	}
+	e.SettingsVersion = settings.Version
+}
+
+// CategoryList decodes the user's categories.
+func (e UserSettingsEntity) CategoryList() ([]settings.Category, error) {
+	return settings.DecodeCategories(e.Categories)
+}
+
+// migrate completes an update of settings written before settings.Version so
+// that the same write also upgrades them. Fields the update sets are kept.
+func (u *UserSettingsUpdate) migrate(cur UserSettingsEntity) {
+	cur.Upgrade()
+	if u.Theme == nil {
+		u.Theme = &cur.Theme
+	}
+	if u.DefaultCategory == nil {
+		u.DefaultCategory = &cur.DefaultCategory
+	}
+	if u.Categories == nil {
+		u.Categories = &cur.Categories
+	}
+	if u.Timezone == nil {
+		u.Timezone = &cur.Timezone
+	}
+	if u.WeekStart == nil {
+		u.WeekStart = &cur.WeekStart
+	}
+	u.SettingsVersion = &cur.SettingsVersion
+}
+
+// entity turns an update of settings that do not exist yet into the row to
+// insert; fields the update does not set get their defaults.
+func (u UserSettingsUpdate) entity() UserSettingsEntity {
+	ent := UserSettingsEntity{Entity: u.Entity}
+	if u.TasksPerCategory != nil {
+		ent.TasksPerCategory = *u.TasksPerCategory
+	}
+	if u.ShowDoneTasks != nil {
+		ent.ShowDoneTasks = *u.ShowDoneTasks
+	}
+	if u.Theme != nil {
+		ent.Theme = *u.Theme
+	}
+	if u.DefaultCategory != nil {
+		ent.DefaultCategory = *u.DefaultCategory
+	}
+	if u.Categories != nil {
+		ent.Categories = *u.Categories
+	}
+	if u.Timezone != nil {
+		ent.Timezone = *u.Timezone
+	}
+	if u.WeekStart != nil {
+		ent.WeekStart = *u.WeekStart
+	}
+	if u.EventTimestamp != nil {
+		ent.EventTimestamp = *u.EventTimestamp
+	}
+	if u.EventSequence != nil {
+		ent.EventSequence = *u.EventSequence
+	}
+	ent.Upgrade()
+	return ent
+}
+
+func (d UserSettingsUpdatedEventData) empty() bool {
+	return d.TasksPerCategory == nil && d.ShowDoneTasks == nil && d.Theme == nil &&
+		d.DefaultCategory == nil && d.Categories == nil && d.Timezone == nil && d.WeekStart == nil
+}
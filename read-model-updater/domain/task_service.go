@@ -2,182 +2,248 @@ package domain
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
+
+	"taskstate"
 )
 
 // TaskStorage defines methods required for updating task read models.
 type TaskStorage interface {
 	GetTask(ctx context.Context, pk, rk string) (*TaskEntity, error)
-	InsertTask(ctx context.Context, ent TaskEntity) error
-	UpdateTask(ctx context.Context, ent TaskUpdate, etag string) error
+	// CommitTasks stores writes to tasks of one partition atomically. It
+	// returns ErrConcurrencyConflict when a task changed since it was read or
+	// a new task already exists.
+	CommitTasks(ctx context.Context, writes []TaskWrite) error
+}
+
+// TaskEventIndex stores the rows of the task event index. Writing a row twice
+// leaves a single row, so redelivered events are indexed once.
+type TaskEventIndex interface {
+	IndexTaskEvent(ctx context.Context, ent TaskEventIndexEntity) error
 }
 
 // TaskService processes task events.
-type TaskService struct{ st TaskStorage }
+type TaskService struct {
+	st    TaskStorage
+	index TaskEventIndex
+}
 
-func NewTaskService(st TaskStorage) TaskService { return TaskService{st: st} }
+// NewTaskService returns a TaskService writing to st. Task events are also
+// recorded in index unless it is nil.
+func NewTaskService(st TaskStorage, index TaskEventIndex) TaskService {
+	return TaskService{st: st, index: index}
+}
 
-// Apply updates the read model for task related events.
+// Apply updates the read model for task related events. The new state is
+// computed by the shared taskstate reducer; this method only loads and stores
+// entities and retries on concurrency conflicts.
 func (s TaskService) Apply(ctx context.Context, ev Event) error {
-	pk := ev.UserID
-	rk := ev.EntityID
-	switch ev.Type {
-	case TaskCreated:
-		var eventData TaskCreatedEventData
-		if err := json.Unmarshal(ev.Data, &eventData); err != nil {
-			return err
-		}
-		ent, err := s.st.GetTask(ctx, pk, rk)
-		if err != nil {
-			return err
-		}
-		if ent != nil {
-			log.WithFields(log.Fields{"task": rk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("duplicate task-created event")
-			return fmt.Errorf("task %s already exists", rk)
-		}
-		ent = &TaskEntity{
-			Entity:         Entity{PartitionKey: pk, RowKey: rk},
-			Title:          eventData.Title,
-			Notes:          eventData.Notes,
-			Category:       eventData.Category,
-			Order:          eventData.Order,
-			Done:           false,
-			EventTimestamp: ev.Timestamp,
-		}
-		return s.st.InsertTask(ctx, *ent)
-	case TaskUpdated:
-		var eventData TaskUpdatedEventData
-		if err := json.Unmarshal(ev.Data, &eventData); err != nil {
-			return err
-		}
-		ent, err := s.st.GetTask(ctx, pk, rk)
-		if err != nil {
-			return err
-		}
-		if ent == nil {
-			log.WithField("task", rk).Error("task-updated event for missing task")
-			return fmt.Errorf("task %s not found", rk)
-		}
-		upd := TaskUpdate{Entity: Entity{PartitionKey: pk, RowKey: rk}}
-		if eventData.Title != nil {
-			upd.Title = eventData.Title
-		}
-		if eventData.Notes != nil {
-			upd.Notes = eventData.Notes
-		}
-		if eventData.Category != nil {
-			upd.Category = eventData.Category
-		}
-		if eventData.Order != nil {
-			upd.Order = eventData.Order
-		}
-		if eventData.Done != nil {
-			upd.Done = eventData.Done
-		}
-		upd.EventTimestamp = &ev.Timestamp
-		if upd.Title == nil && upd.Notes == nil && upd.Category == nil && upd.Order == nil && upd.Done == nil {
-			return fmt.Errorf("task %s update had no fields", rk)
+	return s.ApplyBatch(ctx, []Event{ev})
+}
+
+// ApplyBatch applies task events of one partition, in order, as a single unit
+// of work: either all of their writes reach the tasks table or none does. A
+// rejected event fails the whole batch. The batch is rebuilt from fresh reads
+// when another writer changed one of its tasks in the meantime.
+func (s TaskService) ApplyBatch(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	pk := events[0].Partition()
+	for _, ev := range events[1:] {
+		if ev.Partition() != pk {
+			return fmt.Errorf("batch spans partitions %s and %s", pk, ev.Partition())
 		}
-		for {
-			if ev.Timestamp <= ent.EventTimestamp {
-				log.WithFields(log.Fields{"task": rk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("stale task-updated event")
-				return fmt.Errorf("task %s received stale update", rk)
-			}
-			if err := s.st.UpdateTask(ctx, upd, ent.ETag); err != nil {
-				if !errors.Is(err, ErrConcurrencyConflict) {
-					return err
-				}
-				ent, err = s.st.GetTask(ctx, pk, rk)
-				if err != nil {
-					return err
-				}
-				if ent == nil {
-					log.WithField("task", rk).Error("task-updated event lost entity during retry")
-					return fmt.Errorf("task %s not found", rk)
+	}
+	// Events are indexed before they are applied, so a rejected event is still
+	// listed; replays reject it in the same way.
+	if s.index != nil {
+		for _, ev := range events {
+			for _, ent := range taskEventIndexEntities(ev) {
+				if err := s.index.IndexTaskEvent(ctx, ent); err != nil {
+					return fmt.Errorf("index task event %s: %w", ev.ID, err)
 				}
-				continue
 			}
-			return nil
 		}
-	case TaskCompleted:
-		ent, err := s.st.GetTask(ctx, pk, rk)
-		if err != nil {
-			return err
-		}
-		if ent == nil {
-			log.WithField("task", rk).Error("task-completed event for missing task")
-			return fmt.Errorf("task %s not found", rk)
-		}
-		done := true
-		ts := ev.Timestamp
-		upd := TaskUpdate{
-			Entity:         Entity{PartitionKey: pk, RowKey: rk},
-			Done:           &done,
-			EventTimestamp: &ts,
-		}
-		for {
-			if ev.Timestamp <= ent.EventTimestamp {
-				log.WithFields(log.Fields{"task": rk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("stale task-completed event")
-				return fmt.Errorf("task %s received stale completion", rk)
+	}
+	for {
+		uow := NewUnitOfWork(s.st, pk)
+		for _, ev := range events {
+			if err := s.stage(ctx, uow, ev); err != nil {
+				return err
 			}
-			if err := s.st.UpdateTask(ctx, upd, ent.ETag); err != nil {
-				if !errors.Is(err, ErrConcurrencyConflict) {
-					return err
-				}
-				ent, err = s.st.GetTask(ctx, pk, rk)
-				if err != nil {
-					return err
-				}
-				if ent == nil {
-					log.WithField("task", rk).Error("task-completed retry lost entity")
-					return fmt.Errorf("task %s not found", rk)
-				}
+		}
+		if err := uow.Commit(ctx); err != nil {
+			if errors.Is(err, ErrConcurrencyConflict) {
 				continue
 			}
-			return nil
-		}
-	case TaskReopened:
-		ent, err := s.st.GetTask(ctx, pk, rk)
-		if err != nil {
 			return err
 		}
-		if ent == nil {
-			log.WithField("task", rk).Error("task-reopened event for missing task")
-			return fmt.Errorf("task %s not found", rk)
-		}
-		done := false
-		ts := ev.Timestamp
-		upd := TaskUpdate{
+		return nil
+	}
+}
+
+func (s TaskService) stage(ctx context.Context, uow *UnitOfWork, ev Event) error {
+	if ev.Type == TasksReordered {
+		return s.stageReorder(ctx, uow, ev)
+	}
+	pk := ev.Partition()
+	rk := ev.EntityID
+	ent, err := uow.Get(ctx, rk)
+	if err != nil {
+		return err
+	}
+	next, change, err := taskstate.Apply(ent.state(), ev.state())
+	if err != nil {
+		logRejected(ent, rk, ev, err)
+		return fmt.Errorf("task %s: %w", rk, err)
+	}
+	if ev.Type == TaskCreated {
+		uow.Insert(TaskEntity{
 			Entity:         Entity{PartitionKey: pk, RowKey: rk},
-			Done:           &done,
-			EventTimestamp: &ts,
+			Title:          next.Title,
+			Notes:          next.Notes,
+			Category:       next.Category,
+			Order:          next.Order,
+			Rank:           next.Rank,
+			Done:           next.Done,
+			EventTimestamp: next.EventTimestamp,
+			EventSequence:  next.EventSequence,
+		})
+		return nil
+	}
+	uow.Update(taskUpdate(pk, rk, change, next))
+	return nil
+}
+
+// stageReorder stages the orders of a tasks-reordered event, so readers never
+// see a partly applied move. Listed tasks that are missing or already hold a
+// newer event are left out. A reorder planned against tasks that changed
+// since is dropped as a whole.
+func (s TaskService) stageReorder(ctx context.Context, uow *UnitOfWork, ev Event) error {
+	pk := ev.Partition()
+	updates, err := taskstate.SplitReorder(ev.state())
+	if err != nil {
+		return err
+	}
+	current := make(map[string]*TaskEntity, len(updates))
+	for _, u := range updates {
+		ent, err := uow.Get(ctx, u.TaskID)
+		if err != nil {
+			return err
 		}
-		for {
-			if ev.Timestamp <= ent.EventTimestamp {
-				log.WithFields(log.Fields{"task": rk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("stale task-reopened event")
-				return fmt.Errorf("task %s received stale reopen", rk)
-			}
-			if err := s.st.UpdateTask(ctx, upd, ent.ETag); err != nil {
-				if !errors.Is(err, ErrConcurrencyConflict) {
-					return err
-				}
-				ent, err = s.st.GetTask(ctx, pk, rk)
-				if err != nil {
-					return err
-				}
-				if ent == nil {
-					log.WithField("task", rk).Error("task-reopened retry lost entity")
-					return fmt.Errorf("task %s not found", rk)
-				}
+		current[u.TaskID] = ent
+	}
+	if !taskstate.ReorderCurrent(updates, func(id string) *taskstate.Task { return current[id].state() }) {
+		log.WithFields(log.Fields{"partition": pk, "ts": ev.Timestamp, "seq": ev.Sequence}).Warn("dropped reorder of changed tasks")
+		return nil
+	}
+	for _, u := range updates {
+		ent := current[u.TaskID]
+		next, change, err := taskstate.Apply(ent.state(), u.Event)
+		if err != nil {
+			logRejected(ent, u.TaskID, ev, err)
+			if errors.Is(err, taskstate.ErrNotFound) || errors.Is(err, taskstate.ErrStale) {
 				continue
 			}
-			return nil
+			return fmt.Errorf("task %s: %w", u.TaskID, err)
+		}
+		uow.Update(taskUpdate(pk, u.TaskID, change, next))
+	}
+	return nil
+}
+
+// TaskEventIndexKey returns the row key of an event in the task event index:
+// its timestamp, zero-padded so that row keys sort by time, and its ID.
+func TaskEventIndexKey(ts int64, eventID string) string {
+	return fmt.Sprintf("%019d_%s", ts, eventID)
+}
+
+// Besides the read model partition, an event is indexed under its command's
+// idempotency key, which undo looks events up by, and a tasks-reordered event
+// under each task it lists, as the event store keeps it under the partition.
+const (
+	TaskEventIndexCommandPrefix = "key:"
+	TaskEventIndexTaskPrefix    = "task:"
+)
+
+// taskEventIndexEntities returns the index rows of ev, one per partition it is
+// listed in.
+func taskEventIndexEntities(ev Event) []TaskEventIndexEntity {
+	row := TaskEventIndexEntity{
+		Entity:         Entity{PartitionKey: ev.Partition(), RowKey: TaskEventIndexKey(ev.Timestamp, ev.ID)},
+		TaskID:         ev.EntityID,
+		EventID:        ev.ID,
+		Type:           ev.Type,
+		EventTimestamp: ev.Timestamp,
+		EventSequence:  ev.Sequence,
+		UserID:         ev.UserID,
+		IdempotencyKey: ev.IdempotencyKey,
+		BoardID:        ev.BoardID,
+		Data:           string(ev.Data),
+	}
+	rows := []TaskEventIndexEntity{row}
+	if ev.IdempotencyKey != "" {
+		row.PartitionKey = TaskEventIndexCommandPrefix + ev.IdempotencyKey
+		rows = append(rows, row)
+	}
+	if ev.Type == TasksReordered {
+		// A malformed reorder lists no task; the reducer rejects it anyway.
+		updates, _ := taskstate.SplitReorder(ev.state())
+		for _, u := range updates {
+			row.PartitionKey = TaskEventIndexTaskPrefix + u.TaskID
+			rows = append(rows, row)
 		}
-	default:
-		return fmt.Errorf("unknown task event %s", ev.Type)
+	}
+	return rows
+}
+
+// state returns the reducer state of a stored task; nil when it does not exist.
+func (ent *TaskEntity) state() *taskstate.Task {
+	if ent == nil {
+		return nil
+	}
+	return &taskstate.Task{
+		Title:          ent.Title,
+		Notes:          ent.Notes,
+		Category:       ent.Category,
+		Order:          ent.Order,
+		Rank:           ent.Rank,
+		Done:           ent.Done,
+		EventTimestamp: ent.EventTimestamp,
+		EventSequence:  ent.EventSequence,
+	}
+}
+
+func taskUpdate(pk, rk string, change taskstate.Change, next taskstate.Task) TaskUpdate {
+	return TaskUpdate{
+		Entity:         Entity{PartitionKey: pk, RowKey: rk},
+		Title:          change.Title,
+		Notes:          change.Notes,
+		Category:       change.Category,
+		Order:          change.Order,
+		Rank:           change.Rank,
+		Done:           change.Done,
+		EventTimestamp: &next.EventTimestamp,
+		EventSequence:  &next.EventSequence,
+	}
+}
+
+func logRejected(ent *TaskEntity, taskID string, ev Event, err error) {
+	fields := log.Fields{"task": taskID, "ts": ev.Timestamp, "seq": ev.Sequence, "type": ev.Type}
+	if ent != nil {
+		fields["current"] = ent.EventTimestamp
+		fields["currentSeq"] = ent.EventSequence
+	}
+	switch {
+	case errors.Is(err, taskstate.ErrExists):
+		log.WithFields(fields).Error("duplicate task-created event")
+	case errors.Is(err, taskstate.ErrNotFound):
+		log.WithFields(fields).Error("task event for missing task")
+	case errors.Is(err, taskstate.ErrStale):
+		log.WithFields(fields).Error("stale task event")
 	}
 }
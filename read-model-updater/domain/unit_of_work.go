@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MaxTaskWrites is the most rows a unit of work may write, the operation limit
+// of one entity group transaction.
+const MaxTaskWrites = 100
+
+// ErrTooManyWrites is returned when a unit of work writes more rows than one
+// transaction holds.
+var ErrTooManyWrites = errors.New("too many writes for one transaction")
+
+// UnitOfWork stages writes to the tasks of one read model partition and
+// commits them all-or-nothing. Reads go through the unit, so later events in
+// the same unit see the writes of earlier ones. A unit is not safe for
+// concurrent use and is discarded after Commit.
+type UnitOfWork struct {
+	st   TaskStorage
+	pk   string
+	rows map[string]*stagedTask
+	keys []string
+}
+
+type stagedTask struct {
+	current *TaskEntity
+	insert  bool
+	changes *TaskUpdate
+	etag    string
+}
+
+// NewUnitOfWork starts a unit of work on the partition pk.
+func NewUnitOfWork(st TaskStorage, pk string) *UnitOfWork {
+	return &UnitOfWork{st: st, pk: pk, rows: map[string]*stagedTask{}}
+}
+
+// Get returns the task with the staged writes applied, or nil when it does
+// not exist. Stored tasks are loaded once; their ETag guards the commit.
+func (u *UnitOfWork) Get(ctx context.Context, rk string) (*TaskEntity, error) {
+	if row, ok := u.rows[rk]; ok {
+		return row.current, nil
+	}
+	ent, err := u.st.GetTask(ctx, u.pk, rk)
+	if err != nil {
+		return nil, err
+	}
+	row := &stagedTask{current: ent}
+	if ent != nil {
+		row.etag = ent.ETag
+	}
+	u.add(rk, row)
+	return ent, nil
+}
+
+// Insert stages a new task.
+func (u *UnitOfWork) Insert(ent TaskEntity) {
+	row, ok := u.rows[ent.RowKey]
+	if !ok {
+		row = &stagedTask{}
+		u.add(ent.RowKey, row)
+	}
+	row.current, row.insert, row.changes = &ent, true, nil
+}
+
+// Update stages changes to a task. Several updates of the same task are
+// merged into one write, as a transaction may touch each row only once.
+func (u *UnitOfWork) Update(upd TaskUpdate) {
+	row, ok := u.rows[upd.RowKey]
+	if !ok {
+		row = &stagedTask{}
+		u.add(upd.RowKey, row)
+	}
+	if row.current != nil {
+		next := *row.current
+		next.merge(upd)
+		row.current = &next
+	}
+	if row.insert {
+		return
+	}
+	if row.changes == nil {
+		row.changes = &TaskUpdate{Entity: upd.Entity}
+	}
+	row.changes.merge(upd)
+}
+
+// Commit stores the staged writes in one transaction. ErrConcurrencyConflict
+// means another writer changed a task the unit read and nothing was stored;
+// callers start a new unit from fresh reads.
+func (u *UnitOfWork) Commit(ctx context.Context) error {
+	writes := make([]TaskWrite, 0, len(u.keys))
+	for _, rk := range u.keys {
+		row := u.rows[rk]
+		switch {
+		case row.insert:
+			writes = append(writes, TaskWrite{Insert: row.current})
+		case row.changes != nil:
+			writes = append(writes, TaskWrite{Update: row.changes, ETag: row.etag})
+		}
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	if len(writes) > MaxTaskWrites {
+		return fmt.Errorf("%w: %d rows", ErrTooManyWrites, len(writes))
+	}
+	return u.st.CommitTasks(ctx, writes)
+}
+
+func (u *UnitOfWork) add(rk string, row *stagedTask) {
+	u.rows[rk] = row
+	u.keys = append(u.keys, rk)
+}
+
+func (ent *TaskEntity) merge(upd TaskUpdate) {
+	if upd.Title != nil {
+		ent.Title = *upd.Title
+	}
+	if upd.Notes != nil {
+		ent.Notes = *upd.Notes
+	}
+	if upd.Category != nil {
+		ent.Category = *upd.Category
+	}
+	if upd.Order != nil {
+		ent.Order = *upd.Order
+	}
+	if upd.Rank != nil {
+		ent.Rank = *upd.Rank
+	}
+	if upd.Done != nil {
+		ent.Done = *upd.Done
+	}
+	if upd.EventTimestamp != nil {
+		ent.EventTimestamp = *upd.EventTimestamp
+	}
+	if upd.EventSequence != nil {
+		ent.EventSequence = *upd.EventSequence
+	}
+}
+
+func (u *TaskUpdate) merge(next TaskUpdate) {
+	if next.Title != nil {
+		u.Title = next.Title
+	}
+	if next.Notes != nil {
+		u.Notes = next.Notes
+	}
+	if next.Category != nil {
+		u.Category = next.Category
+	}
+	if next.Order != nil {
+		u.Order = next.Order
+	}
+	if next.Rank != nil {
+		u.Rank = next.Rank
+	}
+	if next.Done != nil {
+		u.Done = next.Done
+	}
+	if next.EventTimestamp != nil {
+		u.EventTimestamp = next.EventTimestamp
+	}
+	if next.EventSequence != nil {
+		u.EventSequence = next.EventSequence
+	}
+}
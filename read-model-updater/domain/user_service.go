@@ -3,17 +3,24 @@ package domain
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
+
+	"settings"
 )
 
 // UserStorage defines methods required for updating user read models.
 type UserStorage interface {
 	UpsertUser(ctx context.Context, ent UserEntity) error
 	GetUserSettings(ctx context.Context, id string) (*UserSettingsEntity, error)
-	UpsertUserSettings(ctx context.Context, ent UserSettingsEntity) error
-	UpdateUserSettings(ctx context.Context, ent UserSettingsUpdate) error
+	// InsertUserSettings adds settings and returns ErrConcurrencyConflict
+	// when the user already has some.
+	InsertUserSettings(ctx context.Context, ent UserSettingsEntity) error
+	// UpdateUserSettings merges changes into the settings if they still have
+	// the ETag, and returns ErrConcurrencyConflict otherwise.
+	UpdateUserSettings(ctx context.Context, ent UserSettingsUpdate, etag string) error
 }
 
 // UserService processes user and settings events.
@@ -40,68 +47,106 @@ func (s UserService) Apply(ctx context.Context, ev Event) error {
 		log.Infof("User logged in. UserID: %s", ev.UserID)
 	case UserLoggedOut:
 		log.Infof("User logged out. UserID: %s", ev.UserID)
-	case UserSettingsCreated:
-		var sEvent UserSettingsEventData
-		if err := json.Unmarshal(ev.Data, &sEvent); err != nil {
-			return err
-		}
+	case UserSettingsCreated, UserSettingsUpdated:
+		return s.applySettings(ctx, rk, ev)
+	default:
+		return fmt.Errorf("unknown user event %s", ev.Type)
+	}
+	return nil
+}
+
+// applySettings stores a settings event like TaskService.Apply stores task
+// events: every write is conditional on the state it was computed from, and a
+// conflict re-reads the settings and checks the event against them again. A
+// replica holding an older event can therefore no longer overwrite a newer
+// one written in between.
+func (s UserService) applySettings(ctx context.Context, rk string, ev Event) error {
+	var created UserSettingsEventData
+	var updated UserSettingsUpdatedEventData
+	data := any(&updated)
+	if ev.Type == UserSettingsCreated {
+		data = &created
+	}
+	if err := json.Unmarshal(ev.Data, data); err != nil {
+		return err
+	}
+	for {
 		ent, err := s.st.GetUserSettings(ctx, rk)
 		if err != nil {
 			return err
 		}
-		if ent != nil {
-			log.WithFields(log.Fields{"settings": rk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("duplicate settings-created event")
-			return fmt.Errorf("settings %s already exists", rk)
-		}
-		ent = &UserSettingsEntity{
-			Entity:           Entity{PartitionKey: rk, RowKey: rk},
-			TasksPerCategory: sEvent.TasksPerCategory,
-			ShowDoneTasks:    sEvent.ShowDoneTasks,
-			EventTimestamp:   ev.Timestamp,
+		if ev.Type == UserSettingsCreated {
+			err = s.createSettings(ctx, rk, ev, created, ent)
+		} else {
+			err = s.updateSettings(ctx, rk, ev, updated, ent)
 		}
-		return s.st.UpsertUserSettings(ctx, *ent)
-	case UserSettingsUpdated:
-		var sUpd UserSettingsUpdatedEventData
-		if err := json.Unmarshal(ev.Data, &sUpd); err != nil {
-			return err
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
 		}
-		ent, err := s.st.GetUserSettings(ctx, rk)
+		return err
+	}
+}
+
+func (s UserService) createSettings(ctx context.Context, rk string, ev Event, data UserSettingsEventData, ent *UserSettingsEntity) error {
+	if ent != nil {
+		log.WithFields(log.Fields{"settings": rk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("duplicate settings-created event")
+		return fmt.Errorf("settings %s already exists", rk)
+	}
+	categories, err := settings.EncodeCategories(data.Categories)
+	if err != nil {
+		return err
+	}
+	newEnt := UserSettingsEntity{
+		Entity:           Entity{PartitionKey: rk, RowKey: rk},
+		TasksPerCategory: data.TasksPerCategory,
+		ShowDoneTasks:    data.ShowDoneTasks,
+		Theme:            data.Theme,
+		DefaultCategory:  data.DefaultCategory,
+		Categories:       categories,
+		Timezone:         data.Timezone,
+		WeekStart:        data.WeekStart,
+		EventTimestamp:   ev.Timestamp,
+		EventSequence:    ev.Sequence,
+	}
+	// Events from before settings version 2 lack the newer fields.
+	newEnt.Upgrade()
+	return s.st.InsertUserSettings(ctx, newEnt)
+}
+
+// updateSettings merges the fields the event sets into the stored settings and
+// leaves the others alone. Settings stored before settings.Version are upgraded
+// by the same write.
+func (s UserService) updateSettings(ctx context.Context, rk string, ev Event, data UserSettingsUpdatedEventData, ent *UserSettingsEntity) error {
+	if ent != nil && !ev.after(ent.EventSequence, ent.EventTimestamp) {
+		log.WithFields(log.Fields{"settings": rk, "ts": ev.Timestamp, "seq": ev.Sequence, "current": ent.EventTimestamp, "currentSeq": ent.EventSequence}).Error("stale settings-updated event")
+		return fmt.Errorf("settings %s received stale update", rk)
+	}
+	if ent != nil && data.empty() {
+		return fmt.Errorf("settings %s update had no fields", rk)
+	}
+	upd := UserSettingsUpdate{
+		Entity:           Entity{PartitionKey: rk, RowKey: rk},
+		TasksPerCategory: data.TasksPerCategory,
+		ShowDoneTasks:    data.ShowDoneTasks,
+		Theme:            data.Theme,
+		DefaultCategory:  data.DefaultCategory,
+		Timezone:         data.Timezone,
+		WeekStart:        data.WeekStart,
+		EventTimestamp:   &ev.Timestamp,
+		EventSequence:    &ev.Sequence,
+	}
+	if data.Categories != nil {
+		categories, err := settings.EncodeCategories(*data.Categories)
 		if err != nil {
 			return err
 		}
-		if ent == nil {
-			newEnt := UserSettingsEntity{
-				Entity:           Entity{PartitionKey: rk, RowKey: rk},
-				TasksPerCategory: 0,
-				ShowDoneTasks:    false,
-				EventTimestamp:   ev.Timestamp,
-			}
-			if sUpd.TasksPerCategory != nil {
-				newEnt.TasksPerCategory = *sUpd.TasksPerCategory
-			}
-			if sUpd.ShowDoneTasks != nil {
-				newEnt.ShowDoneTasks = *sUpd.ShowDoneTasks
-			}
-			return s.st.UpsertUserSettings(ctx, newEnt)
-		}
-		if ev.Timestamp <= ent.EventTimestamp {
-			log.WithFields(log.Fields{"settings": rk, "ts": ev.Timestamp, "current": ent.EventTimestamp}).Error("stale settings-updated event")
-			return fmt.Errorf("settings %s received stale update", rk)
-		}
-		upd := UserSettingsUpdate{Entity: Entity{PartitionKey: rk, RowKey: rk}}
-		if sUpd.TasksPerCategory != nil {
-			upd.TasksPerCategory = sUpd.TasksPerCategory
-		}
-		if sUpd.ShowDoneTasks != nil {
-			upd.ShowDoneTasks = sUpd.ShowDoneTasks
-		}
-		upd.EventTimestamp = &ev.Timestamp
-		if upd.TasksPerCategory != nil || upd.ShowDoneTasks != nil {
-			return s.st.UpdateUserSettings(ctx, upd)
-		}
-		return fmt.Errorf("settings %s update had no fields", rk)
-	default:
-		return fmt.Errorf("unknown user event %s", ev.Type)
+		upd.Categories = &categories
 	}
-	return nil
+	if ent == nil {
+		return s.st.InsertUserSettings(ctx, upd.entity())
+	}
+	if ent.SettingsVersion < settings.Version {
+		upd.migrate(*ent)
+	}
+	return s.st.UpdateUserSettings(ctx, upd, ent.ETag)
 }
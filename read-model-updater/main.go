@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
@@ -15,6 +18,7 @@ import (
 
 	"read-model-updater/domain"
 	"read-model-updater/storage"
+	"tracing"
 )
 
 type queueMessage struct {
@@ -33,20 +37,53 @@ func main() {
 	if dbg, err := strconv.ParseBool(os.Getenv("DEBUG")); err == nil && dbg {
 		log.SetLevel(log.DebugLevel)
 	}
+	shutdownTracing, err := tracing.Setup(context.Background(), "read-model-updater")
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.WithError(err).Warn("tracing shutdown failed")
+		}
+	}()
+
 	connStr := os.Getenv("STORAGE_CONNECTION_STRING")
 	eventsQueue := os.Getenv("DOMAIN_EVENTS_QUEUE")
 	tasksTable := os.Getenv("TASKS_TABLE")
 	usersTable := os.Getenv("USERS_TABLE")
 	settingsTable := os.Getenv("SETTINGS_TABLE")
+	boardsTable := os.Getenv("BOARDS_TABLE")
+	taskEventIndexTable := os.Getenv("TASK_EVENT_INDEX_TABLE")
 	if connStr == "" || eventsQueue == "" || tasksTable == "" || usersTable == "" || settingsTable == "" {
 		log.Fatal("missing storage config")
 	}
 
-	st, err := storage.New(connStr, eventsQueue, tasksTable, usersTable, settingsTable)
+	st, err := storage.New(connStr, eventsQueue, tasksTable, usersTable, settingsTable, boardsTable, taskEventIndexTable)
 	if err != nil {
 		log.Fatalf("storage: %v", err)
 	}
-	orch := domain.NewOrchestrator(domain.NewTaskService(st), domain.NewUserService(st))
+	// Shared boards are optional: without BOARDS_TABLE board events are
+	// dropped and board task events only reach their issuer.
+	var boardStore domain.BoardStorage
+	var boards recipientResolver
+	if boardsTable != "" {
+		boardStore = st
+	} else {
+		log.Info("BOARDS_TABLE is empty; shared boards are disabled")
+	}
+	boardService := domain.NewBoardService(boardStore)
+	if boardStore != nil {
+		boards = boardService
+	}
+	// The task event index serves the Prism API's point-in-time view; without
+	// TASK_EVENT_INDEX_TABLE it is not kept.
+	var taskIndex domain.TaskEventIndex
+	if taskEventIndexTable != "" {
+		taskIndex = st
+	}
+	orch := domain.NewOrchestrator(domain.NewTaskService(st, taskIndex), domain.NewUserService(st), boardService)
 	redisConn := os.Getenv("REDIS_CONNECTION_STRING")
 	if redisConn == "" {
 		log.Fatal("missing redis config")
@@ -111,6 +148,38 @@ func main() {
 		log.Fatal("missing redis channel config")
 	}
 
+	handleEvent := func(ctx context.Context, eventPayload string) error {
+		var ev domain.Event
+		if err := json.Unmarshal([]byte(eventPayload), &ev); err != nil {
+			eventErrors.WithLabelValues("unknown", "parse").Inc()
+			return fmt.Errorf("parse event: %w", err)
+		}
+		return processEvent(ctx, orch, cache, boards, rc, taskUpdatesChannel, settingsUpdatesChannel, ev, eventPayload)
+	}
+
+	switch transport := os.Getenv("DOMAIN_EVENTS_TRANSPORT"); transport {
+	case "", "azure":
+	case "redis":
+		group := os.Getenv("DOMAIN_EVENTS_GROUP")
+		if group == "" {
+			group = "read-model-updater"
+		}
+		consumerName, err := os.Hostname()
+		if err != nil || consumerName == "" {
+			consumerName = "read-model-updater"
+		}
+		// DOMAIN_EVENTS_QUEUE names the stream the domain service appends events to.
+		consumer := newStreamConsumer(rc, eventsQueue, group, consumerName, handleEvent)
+		go func() {
+			if err := consumer.Run(context.Background()); err != nil {
+				log.Fatalf("domain events stream: %v", err)
+			}
+		}()
+		log.Infof("consuming domain events from redis stream %s as %s/%s", eventsQueue, group, consumerName)
+	default:
+		log.Fatalf("invalid DOMAIN_EVENTS_TRANSPORT: %s", transport)
+	}
+
 	e := echo.New()
 	handler := func(c echo.Context) error {
 		var msg queueMessage
@@ -127,14 +196,7 @@ func main() {
 			log.Debugf("unable to unquote event payload: %v", err)
 		}
 
-		var ev domain.Event
-		if err := json.Unmarshal([]byte(eventPayload), &ev); err != nil {
-			log.Errorf("Unable to parse message JSON, error: %v", err)
-			return c.NoContent(http.StatusBadRequest)
-		}
-
-		ctx := c.Request().Context()
-		if err := processEvent(ctx, orch, cache, rc, taskUpdatesChannel, settingsUpdatesChannel, ev, eventPayload); err != nil {
+		if err := handleEvent(c.Request().Context(), eventPayload); err != nil {
 			log.Errorf("Unable to process message, error: %v", err)
 			return c.NoContent(http.StatusBadRequest)
 		}
@@ -142,9 +204,26 @@ func main() {
 		return c.JSON(http.StatusOK, azFuncResponse{Outputs: map[string]any{}})
 	}
 
+	e.Use(observeRequests)
 	e.POST("/update-model", handler)
 	e.POST("/api/domain-events", handler)
 
+	// Metrics are served on a separate port, as the custom handler port is
+	// balanced across instances by HAProxy.
+	if port := os.Getenv("INTERNAL_PORT"); port != "" {
+		internal := echo.New()
+		internal.HideBanner = true
+		internal.HidePort = true
+		internal.GET(metricsPath, metricsHandler())
+		go func() {
+			if err := internal.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("internal server: %v", err)
+			}
+		}()
+	} else {
+		log.Info("INTERNAL_PORT is empty; metrics are not served")
+	}
+
 	listenAddr := ":8080"
 	if val, ok := os.LookupEnv("FUNCTIONS_CUSTOMHANDLER_PORT"); ok {
 		listenAddr = ":" + val
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsPath = "/metrics"
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "read_model_updater",
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	eventApplyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "read_model_updater",
+		Name:      "event_apply_duration_seconds",
+		Help:      "Time spent applying a domain event to the read model, by event type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"event_type"})
+
+	eventErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "read_model_updater",
+		Name:      "event_errors_total",
+		Help:      "Domain events that failed, by event type and error class (parse, apply, publish).",
+	}, []string{"event_type", "class"})
+)
+
+func observeRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		route := c.Path()
+		if route == metricsPath {
+			return err
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Response().Status
+		if he, ok := err.(*echo.HTTPError); ok && !c.Response().Committed {
+			status = he.Code
+		}
+		requestDuration.WithLabelValues(route, c.Request().Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func metricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
@@ -2,25 +2,58 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"read-model-updater/domain"
 
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type eventApplier interface {
 	Apply(ctx context.Context, ev domain.Event) error
 }
 
-func processEvent(ctx context.Context, h eventApplier, cache cacheRefresher, rc *redis.Client, taskChannel, settingsChannel string, ev domain.Event, payload string) error {
+type recipientResolver interface {
+	Recipients(ctx context.Context, ev domain.Event) ([]string, error)
+}
+
+// processEvent applies the event to the read model, refreshes the cache and
+// publishes the event to stream-service. It runs in the trace of the command that
+// produced the event; the published payload carries this span as its traceparent.
+// Events on a shared board are addressed to all of its members.
+func processEvent(ctx context.Context, h eventApplier, cache cacheRefresher, boards recipientResolver, rc *redis.Client, taskChannel, settingsChannel string, ev domain.Event, payload string) error {
+	ctx, span := otel.Tracer("read-model-updater").Start(contextWithTraceParent(ctx, ev.TraceParent), "process "+ev.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("prism.event.type", ev.Type),
+			attribute.String("prism.event.entity_type", ev.EntityType),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
 	if err := h.Apply(ctx, ev); err != nil {
+		eventErrors.WithLabelValues(ev.Type, "apply").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
+	eventApplyDuration.WithLabelValues(ev.Type).Observe(time.Since(start).Seconds())
 	if cache != nil {
 		switch ev.EntityType {
 		case "task":
-			cache.RefreshTasks(ctx, ev.UserID, ev.EntityID, ev.Timestamp)
+			entityID := ev.EntityID
+			if ev.Type == domain.TasksReordered {
+				// The event names the partition, not a task.
+				entityID = ""
+			}
+			cache.RefreshTasks(ctx, ev.Partition(), entityID, ev.Timestamp)
 		case "user-settings":
 			cache.RefreshSettings(ctx, ev.UserID, ev.Timestamp)
 		}
@@ -29,7 +62,28 @@ func processEvent(ctx context.Context, h eventApplier, cache cacheRefresher, rc
 	if ev.EntityType == "user-settings" {
 		channel = settingsChannel
 	}
+	changed := false
+	if tp := traceParent(ctx); tp != "" && tp != ev.TraceParent {
+		ev.TraceParent = tp
+		changed = true
+	}
+	if ev.BoardID != "" && boards != nil {
+		recipients, err := boards.Recipients(ctx, ev)
+		if err != nil {
+			eventErrors.WithLabelValues(ev.Type, "recipients").Inc()
+			log.WithError(err).WithField("board", ev.BoardID).Error("Unable to resolve board members")
+		} else {
+			ev.Recipients = recipients
+			changed = true
+		}
+	}
+	if changed {
+		if data, err := json.Marshal(ev); err == nil {
+			payload = string(data)
+		}
+	}
 	if err := rc.Publish(ctx, channel, payload).Err(); err != nil {
+		eventErrors.WithLabelValues(ev.Type, "publish").Inc()
 		log.Errorf("Unable to publish updates for %s to %s", ev.EntityType, channel)
 	}
 	return nil
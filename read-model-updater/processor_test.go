@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
 	miniredis "github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"read-model-updater/domain"
 )
@@ -21,10 +25,18 @@ func (f *fakeOrchestrator) Apply(ctx context.Context, ev domain.Event) error {
 type fakeCache struct {
 	tasksRefreshed    bool
 	settingsRefreshed bool
+	tasksPartition    string
 }
 
 func (f *fakeCache) RefreshTasks(ctx context.Context, userID string, entityID string, lastUpdated int64) {
 	f.tasksRefreshed = true
+	f.tasksPartition = userID
+}
+
+type fakeRecipients []string
+
+func (f fakeRecipients) Recipients(ctx context.Context, ev domain.Event) ([]string, error) {
+	return f, nil
 }
 
 func (f *fakeCache) RefreshSettings(ctx context.Context, userID string, lastUpdated int64) {
@@ -55,7 +67,7 @@ func TestProcessEventPublishesUpdate(t *testing.T) {
 
 	ev := domain.Event{EntityType: "task", Type: domain.TaskCreated}
 	payload := `{"entityType":"task"}`
-	if err := processEvent(ctx, orch, cache, rc, "tasks", "settings", ev, payload); err != nil {
+	if err := processEvent(ctx, orch, cache, nil, rc, "tasks", "settings", ev, payload); err != nil {
 		t.Fatalf("processEvent: %v", err)
 	}
 	select {
@@ -96,7 +108,7 @@ func TestProcessEventRefreshesSettingsCache(t *testing.T) {
 
 	ev := domain.Event{EntityType: "user-settings", Type: domain.UserSettingsUpdated}
 	payload := `{"entityType":"user-settings"}`
-	if err := processEvent(ctx, orch, cache, rc, "tasks", "settings", ev, payload); err != nil {
+	if err := processEvent(ctx, orch, cache, nil, rc, "tasks", "settings", ev, payload); err != nil {
 		t.Fatalf("processEvent: %v", err)
 	}
 
@@ -107,3 +119,87 @@ func TestProcessEventRefreshesSettingsCache(t *testing.T) {
 		t.Fatalf("unexpected tasks cache refresh")
 	}
 }
+
+func TestProcessEventPublishesChildTraceParent(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		_ = tp.Shutdown(context.Background())
+	})
+
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer m.Close()
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	ctx := context.Background()
+
+	pubsub := rc.Subscribe(ctx, "tasks")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ev := domain.Event{EntityType: "task", Type: domain.TaskCreated, UserID: "u1", TraceParent: parent}
+	if err := processEvent(ctx, &fakeOrchestrator{}, nil, nil, rc, "tasks", "settings", ev, `{}`); err != nil {
+		t.Fatalf("processEvent: %v", err)
+	}
+	var msg *redis.Message
+	select {
+	case msg = <-pubsub.Channel():
+	case <-time.After(time.Second):
+		t.Fatalf("no message received")
+	}
+	var published domain.Event
+	if err := json.Unmarshal([]byte(msg.Payload), &published); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if published.UserID != "u1" {
+		t.Fatalf("expected event fields to be preserved, got %+v", published)
+	}
+	if !strings.HasPrefix(published.TraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || published.TraceParent == parent {
+		t.Fatalf("expected a child span of %s, got %q", parent, published.TraceParent)
+	}
+}
+
+func TestProcessEventAddressesBoardMembers(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer m.Close()
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	ctx := context.Background()
+	cache := &fakeCache{}
+
+	pubsub := rc.Subscribe(ctx, "tasks")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	ev := domain.Event{EntityType: "task", Type: domain.TaskCreated, UserID: "u1", BoardID: "b1", EntityID: "t1"}
+	if err := processEvent(ctx, &fakeOrchestrator{}, cache, fakeRecipients{"u1", "u2"}, rc, "tasks", "settings", ev, `{}`); err != nil {
+		t.Fatalf("processEvent: %v", err)
+	}
+	if cache.tasksPartition != "b1" {
+		t.Fatalf("expected board cache refresh, got %q", cache.tasksPartition)
+	}
+	var msg *redis.Message
+	select {
+	case msg = <-pubsub.Channel():
+	case <-time.After(time.Second):
+		t.Fatalf("no message received")
+	}
+	var published domain.Event
+	if err := json.Unmarshal([]byte(msg.Payload), &published); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if published.BoardID != "b1" || len(published.Recipients) != 2 || published.Recipients[1] != "u2" {
+		t.Fatalf("expected board members as recipients, got %+v", published)
+	}
+}
@@ -1,15 +1,22 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
 
@@ -22,9 +29,11 @@ type Storage struct {
 	taskTable     *aztables.Client
 	userTable     *aztables.Client
 	settingsTable *aztables.Client
+	boardTable    *aztables.Client
+	eventIndex    *aztables.Client
 }
 
-var taskListSelectClause = "PartitionKey,RowKey,Title,Notes,Category,Order,Done,EventTimestamp"
+var taskListSelectClause = "PartitionKey,RowKey,Title,Notes,Category,Order,Rank,Done,EventTimestamp,EventSequence"
 
 func parseTimestamp(raw json.RawMessage) int64 {
 	var i int64
@@ -43,8 +52,9 @@ func parseTimestamp(raw json.RawMessage) int64 {
 	return 0
 }
 
-// New creates a Storage from connection parameters.
-func New(connStr, eventsQueue, tasksTable, usersTable, settingsTable string) (*Storage, error) {
+// New creates a Storage from connection parameters. The task event index is
+// only written when taskEventIndexTable is set.
+func New(connStr, eventsQueue, tasksTable, usersTable, settingsTable, boardsTable, taskEventIndexTable string) (*Storage, error) {
 	queueClientOptions := azqueue.ClientOptions{
 		ClientOptions: azcore.ClientOptions{
 			Retry: policy.RetryOptions{
@@ -78,7 +88,12 @@ func New(connStr, eventsQueue, tasksTable, usersTable, settingsTable string) (*S
 	taskClient := svc.NewClient(tasksTable)
 	userClient := svc.NewClient(usersTable)
 	settingsClient := svc.NewClient(settingsTable)
-	return &Storage{queue: queue, taskTable: taskClient, userTable: userClient, settingsTable: settingsClient}, nil
+	boardClient := svc.NewClient(boardsTable)
+	st := &Storage{queue: queue, taskTable: taskClient, userTable: userClient, settingsTable: settingsClient, boardTable: boardClient}
+	if taskEventIndexTable != "" {
+		st.eventIndex = svc.NewClient(taskEventIndexTable)
+	}
+	return st, nil
 }
 
 // Dequeue retrieves a single message from the events queue.
@@ -116,8 +131,10 @@ func (s *Storage) GetTask(ctx context.Context, pk, rk string) (*domain.TaskEntit
 		Notes          string          `json:"Notes,omitempty"`
 		Category       string          `json:"Category,omitempty"`
 		Order          int             `json:"Order"`
+		Rank           string          `json:"Rank,omitempty"`
 		Done           bool            `json:"Done"`
 		EventTimestamp json.RawMessage `json:"EventTimestamp"`
+		EventSequence  json.RawMessage `json:"EventSequence"`
 	}
 	if err := json.Unmarshal(ent.Value, &raw); err != nil {
 		return nil, err
@@ -128,23 +145,17 @@ func (s *Storage) GetTask(ctx context.Context, pk, rk string) (*domain.TaskEntit
 		Notes:          raw.Notes,
 		Category:       raw.Category,
 		Order:          raw.Order,
+		Rank:           raw.Rank,
 		Done:           raw.Done,
 		EventTimestamp: parseTimestamp(raw.EventTimestamp),
+		EventSequence:  parseTimestamp(raw.EventSequence),
 	}
 	task.ETag = string(ent.ETag)
 	return &task, nil
 }
 
-// InsertTask adds a new task entity if it does not already exist.
-func (s *Storage) InsertTask(ctx context.Context, ent domain.TaskEntity) error {
-	payload, err := json.Marshal(ent)
-	if err == nil {
-		_, err = s.taskTable.AddEntity(ctx, payload, nil)
-	}
-	return err
-}
-
-// ListTasksPage returns up to limit tasks for the given user ordered by partition and row key.
+// ListTasksPage returns up to limit tasks of the given partition (a user or a
+// board) ordered by partition and row key.
 func (s *Storage) ListTasksPage(ctx context.Context, userID string, limit int32, nextPartitionKey, nextRowKey *string) ([]domain.TaskEntity, *string, *string, error) {
 	if limit <= 0 {
 		limit = 1
@@ -170,8 +181,10 @@ func (s *Storage) ListTasksPage(ctx context.Context, userID string, limit int32,
 			Notes          string          `json:"Notes,omitempty"`
 			Category       string          `json:"Category,omitempty"`
 			Order          int             `json:"Order"`
+			Rank           string          `json:"Rank,omitempty"`
 			Done           bool            `json:"Done"`
 			EventTimestamp json.RawMessage `json:"EventTimestamp"`
+			EventSequence  json.RawMessage `json:"EventSequence"`
 		}
 		if err := json.Unmarshal(e, &raw); err != nil {
 			return nil, nil, nil, err
@@ -182,31 +195,124 @@ func (s *Storage) ListTasksPage(ctx context.Context, userID string, limit int32,
 			Notes:          raw.Notes,
 			Category:       raw.Category,
 			Order:          raw.Order,
+			Rank:           raw.Rank,
 			Done:           raw.Done,
 			EventTimestamp: parseTimestamp(raw.EventTimestamp),
+			EventSequence:  parseTimestamp(raw.EventSequence),
 		})
 	}
 
 	return tasks, resp.NextPartitionKey, resp.NextRowKey, nil
 }
 
-// UpdateTask merges changes into an existing task entity.
-func (s *Storage) UpdateTask(ctx context.Context, ent domain.TaskUpdate, etag string) error {
-	payload, err := json.Marshal(ent)
-	if err != nil {
-		return err
+// CommitTasks stores the writes of a unit of work, all in one partition. A
+// single write goes straight to the table; several are submitted as one entity
+// group transaction, so either every write is stored or none is. Failed ETag
+// conditions and tasks that already exist are reported as
+// ErrConcurrencyConflict.
+func (s *Storage) CommitTasks(ctx context.Context, writes []domain.TaskWrite) error {
+	actions := make([]aztables.TransactionAction, 0, len(writes))
+	for _, w := range writes {
+		action, err := taskAction(w)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, action)
 	}
+	var err error
+	if len(actions) == 1 {
+		a := actions[0]
+		if a.ActionType == aztables.TransactionTypeAdd {
+			_, err = s.taskTable.AddEntity(ctx, a.Entity, nil)
+		} else {
+			_, err = s.taskTable.UpdateEntity(ctx, a.Entity, &aztables.UpdateEntityOptions{IfMatch: a.IfMatch, UpdateMode: aztables.UpdateModeMerge})
+		}
+	} else {
+		_, err = s.taskTable.SubmitTransaction(ctx, actions, nil)
+	}
+	if isConcurrencyConflict(err) {
+		return domain.ErrConcurrencyConflict
+	}
+	return err
+}
+
+func taskAction(w domain.TaskWrite) (aztables.TransactionAction, error) {
+	if w.Insert != nil {
+		payload, err := json.Marshal(w.Insert)
+		return aztables.TransactionAction{ActionType: aztables.TransactionTypeAdd, Entity: payload}, err
+	}
+	payload, err := json.Marshal(w.Update)
 	match := azcore.ETagAny
-	if etag != "" {
-		match = azcore.ETag(etag)
+	if w.ETag != "" {
+		match = azcore.ETag(w.ETag)
 	}
-	_, err = s.taskTable.UpdateEntity(ctx, payload, &aztables.UpdateEntityOptions{IfMatch: &match, UpdateMode: aztables.UpdateModeMerge})
+	return aztables.TransactionAction{ActionType: aztables.TransactionTypeUpdateMerge, Entity: payload, IfMatch: &match}, err
+}
+
+// isConcurrencyConflict reports whether err is a failed ETag condition or an
+// insert of an existing entity. A failed transaction is answered with 202 and
+// the response of the rejected operation in the multipart body, whose status
+// is checked instead.
+func isConcurrencyConflict(err error) bool {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	status := respErr.StatusCode
+	if status == http.StatusAccepted && respErr.RawResponse != nil {
+		status = rejectedOperationStatus(respErr.RawResponse)
+	}
+	return status == http.StatusPreconditionFailed || status == http.StatusConflict
+}
+
+// rejectedOperationStatus returns the status of the first failed operation in
+// the multipart response to a transaction, or 0 when there is none.
+func rejectedOperationStatus(resp *http.Response) int {
+	body, err := runtime.Payload(resp)
 	if err != nil {
-		var respErr *azcore.ResponseError
-		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusPreconditionFailed {
-			return domain.ErrConcurrencyConflict
+		return 0
+	}
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return 0
+	}
+	return multipartStatus(bytes.NewReader(body), params["boundary"])
+}
+
+// multipartStatus walks a batch response, whose change set is a nested
+// multipart body of HTTP responses.
+func multipartStatus(r io.Reader, boundary string) int {
+	parts := multipart.NewReader(r, boundary)
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			return 0
+		}
+		mediaType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(mediaType, "multipart/"):
+			if status := multipartStatus(part, params["boundary"]); status != 0 {
+				return status
+			}
+		case mediaType == "application/http":
+			inner, err := http.ReadResponse(bufio.NewReader(part), nil)
+			if err == nil && inner.StatusCode >= http.StatusBadRequest {
+				return inner.StatusCode
+			}
 		}
 	}
+}
+
+// IndexTaskEvent writes a row of the task event index. Rows are replaced, so
+// a redelivered event leaves the row as it was.
+func (s *Storage) IndexTaskEvent(ctx context.Context, ent domain.TaskEventIndexEntity) error {
+	payload, err := json.Marshal(ent)
+	if err == nil {
+		_, err = s.eventIndex.UpsertEntity(ctx, payload, &aztables.UpsertEntityOptions{UpdateMode: aztables.UpdateModeReplace})
+	}
 	return err
 }
 
@@ -232,35 +338,161 @@ func (s *Storage) GetUserSettings(ctx context.Context, id string) (*domain.UserS
 	var raw struct {
 		PartitionKey     string          `json:"PartitionKey"`
 		RowKey           string          `json:"RowKey"`
+		SettingsVersion  int             `json:"SettingsVersion"`
 		TasksPerCategory int             `json:"TasksPerCategory"`
 		ShowDoneTasks    bool            `json:"ShowDoneTasks"`
+		Theme            string          `json:"Theme"`
+		DefaultCategory  string          `json:"DefaultCategory"`
+		Categories       string          `json:"Categories"`
+		Timezone         string          `json:"Timezone"`
+		WeekStart        string          `json:"WeekStart"`
 		EventTimestamp   json.RawMessage `json:"EventTimestamp"`
+		EventSequence    json.RawMessage `json:"EventSequence"`
 	}
 	if err := json.Unmarshal(ent.Value, &raw); err != nil {
 		return nil, err
 	}
 	sEnt := domain.UserSettingsEntity{
 		Entity:           domain.Entity{PartitionKey: raw.PartitionKey, RowKey: raw.RowKey},
+		SettingsVersion:  raw.SettingsVersion,
 		TasksPerCategory: raw.TasksPerCategory,
 		ShowDoneTasks:    raw.ShowDoneTasks,
+		Theme:            raw.Theme,
+		DefaultCategory:  raw.DefaultCategory,
+		Categories:       raw.Categories,
+		Timezone:         raw.Timezone,
+		WeekStart:        raw.WeekStart,
 		EventTimestamp:   parseTimestamp(raw.EventTimestamp),
+		EventSequence:    parseTimestamp(raw.EventSequence),
+		ETag:             string(ent.ETag),
 	}
 	return &sEnt, nil
 }
 
-func (s *Storage) UpsertUserSettings(ctx context.Context, ent domain.UserSettingsEntity) error {
+// InsertUserSettings adds the user's settings; existing settings are reported
+// as ErrConcurrencyConflict.
+func (s *Storage) InsertUserSettings(ctx context.Context, ent domain.UserSettingsEntity) error {
 	payload, err := json.Marshal(ent)
 	if err == nil {
-		_, err = s.settingsTable.UpsertEntity(ctx, payload, nil)
+		_, err = s.settingsTable.AddEntity(ctx, payload, nil)
+	}
+	if isConcurrencyConflict(err) {
+		return domain.ErrConcurrencyConflict
 	}
 	return err
 }
 
-func (s *Storage) UpdateUserSettings(ctx context.Context, ent domain.UserSettingsUpdate) error {
+// UpdateUserSettings merges changes into the settings if they still carry the
+// ETag; an empty ETag matches any version.
+func (s *Storage) UpdateUserSettings(ctx context.Context, ent domain.UserSettingsUpdate, etag string) error {
 	payload, err := json.Marshal(ent)
-	if err == nil {
-		et := azcore.ETagAny
-		_, err = s.settingsTable.UpdateEntity(ctx, payload, &aztables.UpdateEntityOptions{IfMatch: &et, UpdateMode: aztables.UpdateModeMerge})
+	if err != nil {
+		return err
+	}
+	match := azcore.ETagAny
+	if etag != "" {
+		match = azcore.ETag(etag)
+	}
+	_, err = s.settingsTable.UpdateEntity(ctx, payload, &aztables.UpdateEntityOptions{IfMatch: &match, UpdateMode: aztables.UpdateModeMerge})
+	if isConcurrencyConflict(err) {
+		return domain.ErrConcurrencyConflict
 	}
 	return err
 }
+
+type boardMemberRaw struct {
+	PartitionKey   string          `json:"PartitionKey"`
+	RowKey         string          `json:"RowKey"`
+	Name           string          `json:"Name,omitempty"`
+	Role           string          `json:"Role"`
+	EventTimestamp json.RawMessage `json:"EventTimestamp"`
+	EventSequence  json.RawMessage `json:"EventSequence"`
+}
+
+func (r boardMemberRaw) entity() domain.BoardMemberEntity {
+	return domain.BoardMemberEntity{
+		Entity:         domain.Entity{PartitionKey: r.PartitionKey, RowKey: r.RowKey},
+		Name:           r.Name,
+		Role:           r.Role,
+		EventTimestamp: parseTimestamp(r.EventTimestamp),
+		EventSequence:  parseTimestamp(r.EventSequence),
+	}
+}
+
+// GetBoardMember retrieves the membership of userID on boardID if present.
+func (s *Storage) GetBoardMember(ctx context.Context, boardID, userID string) (*domain.BoardMemberEntity, error) {
+	ent, err := s.boardTable.GetEntity(ctx, boardID, userID, nil)
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == 404 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var raw boardMemberRaw
+	if err := json.Unmarshal(ent.Value, &raw); err != nil {
+		return nil, err
+	}
+	member := raw.entity()
+	return &member, nil
+}
+
+// boardIndexPrefix starts the partition key of the rows indexing a user's
+// memberships, so the boards of a user are listed from a single partition.
+// Board IDs are GUIDs and never start with it.
+const boardIndexPrefix = "member:"
+
+// UpsertBoardMember creates or replaces a board membership and its row in the
+// member's index. The index row is written first: an event retried after a
+// partial write finds no membership and writes both again.
+func (s *Storage) UpsertBoardMember(ctx context.Context, ent domain.BoardMemberEntity) error {
+	index := ent
+	index.PartitionKey, index.RowKey = boardIndexPrefix+ent.RowKey, ent.PartitionKey
+	for _, e := range []domain.BoardMemberEntity{index, ent} {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := s.boardTable.UpsertEntity(ctx, payload, &aztables.UpsertEntityOptions{UpdateMode: aztables.UpdateModeReplace}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBoardMember removes a board membership and its index row; missing rows
+// are ignored. The index row goes first for the same reason as in
+// UpsertBoardMember.
+func (s *Storage) DeleteBoardMember(ctx context.Context, boardID, userID string) error {
+	for _, key := range [][2]string{{boardIndexPrefix + userID, boardID}, {boardID, userID}} {
+		if _, err := s.boardTable.DeleteEntity(ctx, key[0], key[1], nil); err != nil {
+			var respErr *azcore.ResponseError
+			if !(errors.As(err, &respErr) && respErr.StatusCode == 404) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListBoardMembers returns every membership of the board.
+func (s *Storage) ListBoardMembers(ctx context.Context, boardID string) ([]domain.BoardMemberEntity, error) {
+	filter := "PartitionKey eq '" + strings.ReplaceAll(boardID, "'", "''") + "'"
+	format := aztables.MetadataFormatNone
+	pager := s.boardTable.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter, Format: &format})
+	members := []domain.BoardMemberEntity{}
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range resp.Entities {
+			var raw boardMemberRaw
+			if err := json.Unmarshal(e, &raw); err != nil {
+				return nil, err
+			}
+			members = append(members, raw.entity())
+		}
+	}
+	return members, nil
+}
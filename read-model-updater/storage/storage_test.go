@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// transactionResponse is the shape of the service's answer to a transaction
+// whose change set was rejected with status.
+func transactionResponse(status string) *http.Response {
+	body := "--batchresponse_1\r\n" +
+		"Content-Type: multipart/mixed; boundary=changesetresponse_1\r\n\r\n" +
+		"--changesetresponse_1\r\n" +
+		"Content-Type: application/http\r\n" +
+		"Content-Transfer-Encoding: binary\r\n\r\n" +
+		"HTTP/1.1 " + status + "\r\n" +
+		"Content-Type: application/json;odata=minimalmetadata\r\n\r\n" +
+		"{\"odata.error\":{\"code\":\"UpdateConditionNotSatisfied\"}}\r\n" +
+		"--changesetresponse_1--\r\n" +
+		"--batchresponse_1--\r\n"
+	header := http.Header{}
+	header.Set("Content-Type", "multipart/mixed; boundary=batchresponse_1")
+	return &http.Response{StatusCode: http.StatusAccepted, Header: header, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestIsConcurrencyConflict(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"precondition failed", &azcore.ResponseError{StatusCode: http.StatusPreconditionFailed}, true},
+		{"entity exists", &azcore.ResponseError{StatusCode: http.StatusConflict}, true},
+		{"throttled", &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable}, false},
+		{"rejected change set", runtime.NewResponseError(transactionResponse("412 Precondition Failed")), true},
+		{"failed change set", runtime.NewResponseError(transactionResponse("400 Bad Request")), false},
+		{"other error", errors.New("connection reset"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isConcurrencyConflict(tc.err); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
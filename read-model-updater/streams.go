@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamPayloadField is the Redis Streams entry field carrying the serialized event.
+const streamPayloadField = "payload"
+
+const (
+	defaultStreamBatchSize     = 32
+	defaultStreamBlock         = 2 * time.Second
+	defaultStreamClaimIdle     = 30 * time.Second
+	defaultStreamMaxDeliveries = 5
+	streamErrorBackoff         = time.Second
+	deadLetterSuffix           = ":dead-letter"
+	// deadLetterMaxLen caps the dead-letter stream, which nothing consumes.
+	deadLetterMaxLen = 10000
+)
+
+type streamClient interface {
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+	XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd
+	XPendingExt(ctx context.Context, a *redis.XPendingExtArgs) *redis.XPendingExtCmd
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	XDel(ctx context.Context, stream string, ids ...string) *redis.IntCmd
+}
+
+// streamConsumer reads domain events from a Redis stream through a consumer group.
+// Messages are acknowledged only after they were applied successfully; failed
+// messages stay pending and are reclaimed once idle, mirroring queue visibility
+// timeouts. After maxDeliveries attempts a message is moved to a dead-letter stream.
+// Acknowledged messages are deleted, so the stream only holds unhandled ones.
+type streamConsumer struct {
+	client        streamClient
+	stream        string
+	group         string
+	consumer      string
+	batchSize     int64
+	block         time.Duration
+	claimIdle     time.Duration
+	maxDeliveries int64
+	handle        func(ctx context.Context, payload string) error
+	lastReclaim   time.Time
+}
+
+func newStreamConsumer(client streamClient, stream, group, consumer string, handle func(ctx context.Context, payload string) error) *streamConsumer {
+	return &streamConsumer{
+		client:        client,
+		stream:        stream,
+		group:         group,
+		consumer:      consumer,
+		batchSize:     defaultStreamBatchSize,
+		block:         defaultStreamBlock,
+		claimIdle:     defaultStreamClaimIdle,
+		maxDeliveries: defaultStreamMaxDeliveries,
+		handle:        handle,
+	}
+}
+
+// Run consumes the stream until ctx is cancelled.
+func (c *streamConsumer) Run(ctx context.Context) error {
+	if err := c.ensureGroup(ctx); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		if time.Since(c.lastReclaim) >= c.claimIdle/2 {
+			if err := c.reclaim(ctx); err != nil && ctx.Err() == nil {
+				log.WithError(err).WithField("stream", c.stream).Error("failed to reclaim pending stream messages")
+			}
+			c.lastReclaim = time.Now()
+		}
+		if err := c.readNew(ctx); err != nil && ctx.Err() == nil {
+			log.WithError(err).WithField("stream", c.stream).Error("failed to read stream messages")
+			select {
+			case <-ctx.Done():
+			case <-time.After(streamErrorBackoff):
+			}
+		}
+	}
+	return nil
+}
+
+func (c *streamConsumer) ensureGroup(ctx context.Context) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func (c *streamConsumer) readNew(ctx context.Context) error {
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, ">"},
+		Count:    c.batchSize,
+		Block:    c.block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		for _, msg := range s.Messages {
+			c.process(ctx, msg)
+		}
+	}
+	return nil
+}
+
+func (c *streamConsumer) reclaim(ctx context.Context) error {
+	start := "0-0"
+	for {
+		msgs, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.consumer,
+			MinIdle:  c.claimIdle,
+			Start:    start,
+			Count:    c.batchSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if c.exhausted(ctx, msg.ID) {
+				c.deadLetter(ctx, msg)
+				continue
+			}
+			c.process(ctx, msg)
+		}
+		if next == "" || next == "0-0" || len(msgs) == 0 {
+			return nil
+		}
+		start = next
+	}
+}
+
+func (c *streamConsumer) exhausted(ctx context.Context, id string) bool {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return false
+	}
+	return pending[0].RetryCount > c.maxDeliveries
+}
+
+func (c *streamConsumer) process(ctx context.Context, msg redis.XMessage) {
+	payload, ok := msg.Values[streamPayloadField].(string)
+	if !ok {
+		log.WithFields(log.Fields{"stream": c.stream, "id": msg.ID}).Error("stream message has no payload")
+		c.deadLetter(ctx, msg)
+		return
+	}
+	if err := c.handle(ctx, payload); err != nil {
+		log.WithError(err).WithFields(log.Fields{"stream": c.stream, "id": msg.ID}).Error("unable to process stream message")
+		return
+	}
+	if err := c.acknowledge(ctx, msg.ID); err != nil {
+		log.WithError(err).WithFields(log.Fields{"stream": c.stream, "id": msg.ID}).Error("failed to acknowledge stream message")
+	}
+}
+
+// acknowledge acks a message and deletes it from the stream. The stream has
+// a single consumer group, so no other reader still needs the entry.
+func (c *streamConsumer) acknowledge(ctx context.Context, id string) error {
+	if err := c.client.XAck(ctx, c.stream, c.group, id).Err(); err != nil {
+		return err
+	}
+	return c.client.XDel(ctx, c.stream, id).Err()
+}
+
+func (c *streamConsumer) deadLetter(ctx context.Context, msg redis.XMessage) {
+	values := make([]any, 0, len(msg.Values)*2+2)
+	for k, v := range msg.Values {
+		values = append(values, k, v)
+	}
+	values = append(values, "sourceId", msg.ID)
+	if err := c.client.XAdd(ctx, &redis.XAddArgs{Stream: c.stream + deadLetterSuffix, MaxLen: deadLetterMaxLen, Approx: true, Values: values}).Err(); err != nil {
+		log.WithError(err).WithFields(log.Fields{"stream": c.stream, "id": msg.ID}).Error("failed to dead-letter stream message")
+		return
+	}
+	log.WithFields(log.Fields{"stream": c.stream, "id": msg.ID}).Warn("stream message moved to dead-letter stream")
+	if err := c.acknowledge(ctx, msg.ID); err != nil {
+		log.WithError(err).WithFields(log.Fields{"stream": c.stream, "id": msg.ID}).Error("failed to acknowledge dead-lettered message")
+	}
+}
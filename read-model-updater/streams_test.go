@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func setupStreamRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		rc.Close()
+		m.Close()
+	})
+	return m, rc
+}
+
+func TestStreamConsumerAcknowledgesProcessedMessages(t *testing.T) {
+	_, rc := setupStreamRedis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var got []string
+	consumer := newStreamConsumer(rc, "events", "rmu", "c1", func(ctx context.Context, payload string) error {
+		mu.Lock()
+		got = append(got, payload)
+		mu.Unlock()
+		return nil
+	})
+	consumer.block = 20 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		_ = consumer.Run(ctx)
+		close(done)
+	}()
+
+	for _, p := range []string{"first", "second"} {
+		if err := rc.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: []any{streamPayloadField, p}}).Err(); err != nil {
+			t.Fatalf("xadd: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 processed messages, got %d", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got[0] != "first" || got[1] != "second" {
+		t.Fatalf("unexpected processing order: %v", got)
+	}
+	pending, err := rc.XPending(context.Background(), "events", "rmu").Result()
+	if err != nil {
+		t.Fatalf("xpending: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("expected all messages acknowledged, pending: %d", pending.Count)
+	}
+	if n, err := rc.XLen(context.Background(), "events").Result(); err != nil || n != 0 {
+		t.Fatalf("expected acknowledged messages deleted, stream length %d: %v", n, err)
+	}
+}
+
+func TestStreamConsumerDeadLettersExhaustedMessages(t *testing.T) {
+	_, rc := setupStreamRedis(t)
+	ctx := context.Background()
+
+	attempts := 0
+	consumer := newStreamConsumer(rc, "events", "rmu", "c1", func(ctx context.Context, payload string) error {
+		attempts++
+		return errors.New("boom")
+	})
+	consumer.block = 10 * time.Millisecond
+	consumer.claimIdle = 0
+	consumer.maxDeliveries = 2
+
+	if err := consumer.ensureGroup(ctx); err != nil {
+		t.Fatalf("ensure group: %v", err)
+	}
+	if err := rc.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: []any{streamPayloadField, "poison"}}).Err(); err != nil {
+		t.Fatalf("xadd: %v", err)
+	}
+	if err := consumer.readNew(ctx); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := consumer.reclaim(ctx); err != nil {
+			t.Fatalf("reclaim: %v", err)
+		}
+	}
+
+	if attempts != 2 {
+		t.Fatalf("expected 2 delivery attempts, got %d", attempts)
+	}
+	pending, err := rc.XPending(ctx, "events", "rmu").Result()
+	if err != nil {
+		t.Fatalf("xpending: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("expected poison message to be acknowledged, pending: %d", pending.Count)
+	}
+	dead, err := rc.XRange(ctx, "events"+deadLetterSuffix, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("xrange: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Values[streamPayloadField] != "poison" {
+		t.Fatalf("unexpected dead-letter entries: %#v", dead)
+	}
+	if n, err := rc.XLen(ctx, "events").Result(); err != nil || n != 0 {
+		t.Fatalf("expected dead-lettered message deleted, stream length %d: %v", n, err)
+	}
+}
+
+func TestStreamConsumerEnsureGroupIsIdempotent(t *testing.T) {
+	_, rc := setupStreamRedis(t)
+	consumer := newStreamConsumer(rc, "events", "rmu", "c1", func(context.Context, string) error { return nil })
+	for i := 0; i < 2; i++ {
+		if err := consumer.ensureGroup(context.Background()); err != nil {
+			t.Fatalf("ensure group attempt %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var traceContext propagation.TraceContext
+
+// contextWithTraceParent returns ctx with the remote span context described by traceParent.
+func contextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
+// traceParent returns the W3C traceparent of the span in ctx, or "" without a valid span.
+func traceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier["traceparent"]
+}
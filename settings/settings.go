@@ -0,0 +1,102 @@
+// Package settings holds the rules of the settings document the Go services
+// share: the defaults of the fields added with version 2, how the settings
+// table stores categories and which categories may be the default one. The
+// domain service keeps its own copy in C#.
+package settings
+
+import "encoding/json"
+
+// Version is the version of the settings document the services write.
+// Version 1 only had TasksPerCategory and ShowDoneTasks.
+const Version = 2
+
+// Defaults of the settings added in version 2.
+const (
+	DefaultTheme     = "system"
+	DefaultCategory  = "normal"
+	DefaultTimezone  = "UTC"
+	DefaultWeekStart = "monday"
+	// DefaultCategoriesColumn is the Categories column of a user without
+	// categories of their own.
+	DefaultCategoriesColumn = "[]"
+)
+
+// BuiltinCategories are the task categories every user has.
+var BuiltinCategories = []string{"critical", "fun", "important", "normal"}
+
+// Category is a task category the user added to the built-in ones.
+type Category struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// Upgrade gives the version 2 fields of a settings document their defaults
+// where they are empty, as they are in documents stored before Version.
+// Categories are stored differently by each service and left to the caller.
+func Upgrade(theme, defaultCategory, timezone, weekStart *string) {
+	fill(theme, DefaultTheme)
+	fill(defaultCategory, DefaultCategory)
+	fill(timezone, DefaultTimezone)
+	fill(weekStart, DefaultWeekStart)
+}
+
+func fill(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// DefaultColumns returns the settings table columns of the version 2 fields
+// set to their defaults, which upgrade a row stored before Version when
+// merged into it.
+func DefaultColumns() map[string]any {
+	return map[string]any{
+		"SettingsVersion": Version,
+		"Theme":           DefaultTheme,
+		"DefaultCategory": DefaultCategory,
+		"Categories":      DefaultCategoriesColumn,
+		"Timezone":        DefaultTimezone,
+		"WeekStart":       DefaultWeekStart,
+	}
+}
+
+// DecodeCategories reads the Categories column; an empty column holds none.
+func DecodeCategories(column string) ([]Category, error) {
+	categories := []Category{}
+	if column == "" {
+		return categories, nil
+	}
+	if err := json.Unmarshal([]byte(column), &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// EncodeCategories stores a category list as the Categories column; nil
+// stays unset.
+func EncodeCategories(categories []Category) (string, error) {
+	if categories == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(categories)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// IsCategory reports whether name is a built-in category or one of the
+// user's categories, and may therefore be the default category.
+func IsCategory(name string, categories []Category) bool {
+	for _, builtin := range BuiltinCategories {
+		if name == builtin {
+			return true
+		}
+	}
+	for _, c := range categories {
+		if name == c.Name {
+			return true
+		}
+	}
+	return false
+}
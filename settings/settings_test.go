@@ -0,0 +1,41 @@
+package settings
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpgradeKeepsSetFields(t *testing.T) {
+	theme, category, timezone, weekStart := "dark", "", "", "sunday"
+	Upgrade(&theme, &category, &timezone, &weekStart)
+	if theme != "dark" || category != DefaultCategory || timezone != DefaultTimezone || weekStart != "sunday" {
+		t.Fatalf("unexpected upgrade %q %q %q %q", theme, category, timezone, weekStart)
+	}
+}
+
+func TestCategoriesRoundTrip(t *testing.T) {
+	categories := []Category{{Name: "work", Color: "#112233"}}
+	column, err := EncodeCategories(categories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeCategories(column)
+	if err != nil || !reflect.DeepEqual(decoded, categories) {
+		t.Fatalf("expected %v, got %v (%v)", categories, decoded, err)
+	}
+	if column, _ := EncodeCategories(nil); column != "" {
+		t.Fatalf("expected nil to stay unset, got %q", column)
+	}
+	if decoded, _ := DecodeCategories(""); decoded == nil || len(decoded) != 0 {
+		t.Fatalf("expected an empty list, got %v", decoded)
+	}
+}
+
+func TestIsCategory(t *testing.T) {
+	categories := []Category{{Name: "work", Color: "#112233"}}
+	for name, want := range map[string]bool{"normal": true, "critical": true, "work": true, "home": false, "": false} {
+		if got := IsCategory(name, categories); got != want {
+			t.Fatalf("IsCategory(%q): expected %v, got %v", name, want, got)
+		}
+	}
+}
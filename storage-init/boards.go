@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+// boardIndexPrefix starts the partition key of the rows indexing a user's board
+// memberships.
+const boardIndexPrefix = "member:"
+
+// indexBoardMembers adds the member index rows missing for memberships written
+// before the index existed and returns how many it added. Rows are only
+// inserted, never replaced, so an index row the read model updater wrote in the
+// meantime wins.
+func indexBoardMembers(ctx context.Context, connStr, table string) (int, error) {
+	svc, err := aztables.NewServiceClientFromConnectionString(connStr, nil)
+	if err != nil {
+		return 0, err
+	}
+	client := svc.NewClient(table)
+	pager := client.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Select: to.Ptr("PartitionKey,RowKey,Name,Role,EventTimestamp,EventSequence"),
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	})
+	indexed := 0
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return indexed, err
+		}
+		for _, data := range page.Entities {
+			var row map[string]any
+			if err := json.Unmarshal(data, &row); err != nil {
+				return indexed, err
+			}
+			board, _ := row["PartitionKey"].(string)
+			member, _ := row["RowKey"].(string)
+			if strings.HasPrefix(board, boardIndexPrefix) {
+				continue
+			}
+			row["PartitionKey"], row["RowKey"] = boardIndexPrefix+member, board
+			payload, err := json.Marshal(row)
+			if err != nil {
+				return indexed, err
+			}
+			if _, err := client.AddEntity(ctx, payload, nil); err != nil {
+				var respErr *azcore.ResponseError
+				if errors.As(err, &respErr) && respErr.StatusCode == http.StatusConflict {
+					continue
+				}
+				return indexed, err
+			}
+			indexed++
+		}
+	}
+	return indexed, nil
+}
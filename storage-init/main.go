@@ -10,6 +10,8 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azqueue"
 	log "github.com/sirupsen/logrus"
+
+	"settings"
 )
 
 func main() {
@@ -27,14 +29,42 @@ func main() {
 
 	if err := createTables(ctx, connStr, []string{
 		os.Getenv("TASK_EVENTS_TABLE"),
+		os.Getenv("TASK_EVENT_INDEX_TABLE"),
 		os.Getenv("USER_EVENTS_TABLE"),
 		os.Getenv("TASKS_TABLE"),
 		os.Getenv("USERS_TABLE"),
 		os.Getenv("SETTINGS_TABLE"),
+		os.Getenv("BOARDS_TABLE"),
+		os.Getenv("TOKENS_TABLE"),
+		os.Getenv("AUDIT_TABLE"),
 	}); err != nil {
 		log.Fatalf("create tables: %v", err)
 	}
 
+	if table := os.Getenv("SETTINGS_TABLE"); table != "" {
+		n, err := migrateSettings(ctx, connStr, table)
+		if err != nil {
+			log.Fatalf("migrate settings: %v", err)
+		}
+		log.Infof("migrated %d settings rows to version %d", n, settings.Version)
+	}
+
+	if table := os.Getenv("BOARDS_TABLE"); table != "" {
+		n, err := indexBoardMembers(ctx, connStr, table)
+		if err != nil {
+			log.Fatalf("index board members: %v", err)
+		}
+		log.Infof("indexed %d board members", n)
+	}
+
+	if events, index := os.Getenv("TASK_EVENTS_TABLE"), os.Getenv("TASK_EVENT_INDEX_TABLE"); events != "" && index != "" {
+		n, err := indexTaskEvents(ctx, connStr, events, index)
+		if err != nil {
+			log.Fatalf("index task events: %v", err)
+		}
+		log.Infof("indexed %d task events", n)
+	}
+
 	if err := createQueues(ctx, connStr, []string{
 		os.Getenv("COMMAND_QUEUE"),
 		os.Getenv("DOMAIN_EVENTS_QUEUE"),
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+
+	"settings"
+)
+
+// migrateSettings upgrades the settings rows written before settings.Version
+// and returns how many it changed. Every write is conditional on the row it
+// read: a row updated in the meantime was upgraded by the read model updater
+// and is skipped, so the migration can run while the services are up.
+func migrateSettings(ctx context.Context, connStr, table string) (int, error) {
+	svc, err := aztables.NewServiceClientFromConnectionString(connStr, nil)
+	if err != nil {
+		return 0, err
+	}
+	client := svc.NewClient(table)
+	pager := client.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Select: to.Ptr("PartitionKey,RowKey,SettingsVersion"),
+	})
+	migrated := 0
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return migrated, err
+		}
+		for _, data := range page.Entities {
+			var row struct {
+				ETag            string `json:"odata.etag"`
+				PartitionKey    string `json:"PartitionKey"`
+				RowKey          string `json:"RowKey"`
+				SettingsVersion int    `json:"SettingsVersion"`
+			}
+			if err := json.Unmarshal(data, &row); err != nil {
+				return migrated, err
+			}
+			if row.SettingsVersion >= settings.Version {
+				continue
+			}
+			ent := settings.DefaultColumns()
+			ent["PartitionKey"] = row.PartitionKey
+			ent["RowKey"] = row.RowKey
+			payload, err := json.Marshal(ent)
+			if err != nil {
+				return migrated, err
+			}
+			etag := azcore.ETag(row.ETag)
+			_, err = client.UpdateEntity(ctx, payload, &aztables.UpdateEntityOptions{IfMatch: &etag, UpdateMode: aztables.UpdateModeMerge})
+			if err != nil {
+				var respErr *azcore.ResponseError
+				if errors.As(err, &respErr) && (respErr.StatusCode == http.StatusPreconditionFailed || respErr.StatusCode == http.StatusNotFound) {
+					continue
+				}
+				return migrated, err
+			}
+			migrated++
+		}
+	}
+	return migrated, nil
+}
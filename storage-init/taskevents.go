@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+// taskEventRow is a task event as the domain service stores it: the task ID,
+// or the read model partition for reorders, is the partition key and the event
+// ID the row key.
+type taskEventRow struct {
+	PartitionKey   string `json:"PartitionKey"`
+	RowKey         string `json:"RowKey"`
+	Type           string `json:"Type"`
+	EventTimestamp int64  `json:"EventTimestamp,string"`
+	EventSequence  int64  `json:"EventSequence,string"`
+	UserID         string `json:"UserId"`
+	IdempotencyKey string `json:"IdempotencyKey,omitempty"`
+	EntityType     string `json:"EntityType"`
+	BoardID        string `json:"BoardId,omitempty"`
+	Data           string `json:"Data,omitempty"`
+}
+
+// taskEventIndexRow is a row the read-model updater writes to the task event
+// index for an event: under the event's read model partition, its command's
+// idempotency key and, for reorders, each task listed.
+type taskEventIndexRow struct {
+	PartitionKey   string `json:"PartitionKey"`
+	RowKey         string `json:"RowKey"`
+	TaskID         string `json:"TaskId"`
+	EventID        string `json:"EventId"`
+	Type           string `json:"Type"`
+	EventTimestamp int64  `json:"EventTimestamp,string"`
+	EventSequence  int64  `json:"EventSequence,string"`
+	UserID         string `json:"UserId"`
+	IdempotencyKey string `json:"IdempotencyKey,omitempty"`
+	BoardID        string `json:"BoardId,omitempty"`
+	Data           string `json:"Data,omitempty"`
+}
+
+// Prefixes of the index partitions listing events by command and by task.
+const (
+	taskEventIndexCommandPrefix = "key:"
+	taskEventIndexTaskPrefix    = "task:"
+)
+
+// indexTaskEvents adds the task event index rows missing for events stored
+// before the index existed and returns how many rows it added. Like
+// indexBoardMembers it only inserts, so rows the read model updater wrote in
+// the meantime are kept.
+func indexTaskEvents(ctx context.Context, connStr, eventsTable, indexTable string) (int, error) {
+	svc, err := aztables.NewServiceClientFromConnectionString(connStr, nil)
+	if err != nil {
+		return 0, err
+	}
+	events := svc.NewClient(eventsTable)
+	index := svc.NewClient(indexTable)
+	pager := events.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Select: to.Ptr("PartitionKey,RowKey,Type,EventTimestamp,EventSequence,UserId,IdempotencyKey,EntityType,BoardId,Data"),
+		Format: to.Ptr(aztables.MetadataFormatNone),
+	})
+	indexed := 0
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return indexed, err
+		}
+		for _, data := range page.Entities {
+			var ev taskEventRow
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return indexed, err
+			}
+			// Idempotency markers share the table and carry no event type.
+			if ev.Type == "" || (ev.EntityType != "" && ev.EntityType != "task") {
+				continue
+			}
+			partition := ev.BoardID
+			if partition == "" {
+				partition = ev.UserID
+			}
+			partitions := []string{partition}
+			if ev.IdempotencyKey != "" {
+				partitions = append(partitions, taskEventIndexCommandPrefix+ev.IdempotencyKey)
+			}
+			if ev.Type == "tasks-reordered" {
+				var reorder struct {
+					IDs []string `json:"ids"`
+				}
+				// A malformed reorder lists no task; the read model rejects it anyway.
+				_ = json.Unmarshal([]byte(ev.Data), &reorder)
+				for _, id := range reorder.IDs {
+					partitions = append(partitions, taskEventIndexTaskPrefix+id)
+				}
+			}
+			row := taskEventIndexRow{
+				RowKey:         fmt.Sprintf("%019d_%s", ev.EventTimestamp, ev.RowKey),
+				TaskID:         ev.PartitionKey,
+				EventID:        ev.RowKey,
+				Type:           ev.Type,
+				EventTimestamp: ev.EventTimestamp,
+				EventSequence:  ev.EventSequence,
+				UserID:         ev.UserID,
+				IdempotencyKey: ev.IdempotencyKey,
+				BoardID:        ev.BoardID,
+				Data:           ev.Data,
+			}
+			for _, pk := range partitions {
+				row.PartitionKey = pk
+				payload, err := json.Marshal(row)
+				if err != nil {
+					return indexed, err
+				}
+				if _, err := index.AddEntity(ctx, payload, nil); err != nil {
+					var respErr *azcore.ResponseError
+					if errors.As(err, &respErr) && respErr.StatusCode == http.StatusConflict {
+						continue
+					}
+					return indexed, err
+				}
+				indexed++
+			}
+		}
+	}
+	return indexed, nil
+}
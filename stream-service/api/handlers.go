@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"sync"
 	"time"
@@ -10,26 +11,39 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 
+	"auth"
 	"stream-service/domain"
 )
 
 type Authenticator interface {
-	UserIDFromAuthHeader(string) (string, error)
+	Authenticate(string) (auth.Principal, error)
 }
 
+// streamScope is the scope a token needs to open the stream.
+const streamScope = auth.ScopeTasksRead
+
 var (
 	clients   = map[string]map[chan []byte]struct{}{}
 	clientsMu sync.RWMutex
 )
 
+const streamPath = "/stream"
+
 // Register wires up stream endpoints on the given Echo instance.
-func Register(e *echo.Echo, rc *redis.Client, auth Authenticator, taskChannel, settingsChannel string) {
+func Register(e *echo.Echo, rc *redis.Client, authn Authenticator, taskChannel, settingsChannel string) {
 	go domain.SubscribeUpdates(context.Background(), e.Logger, rc, taskChannel, broadcast)
 	go domain.SubscribeUpdates(context.Background(), e.Logger, rc, settingsChannel, broadcast)
-	e.GET("/stream", stream(rc, auth))
+	e.Use(observeRequests)
+	e.GET(streamPath, stream(rc, authn))
 	e.GET("/healthz", healthz(rc))
 }
 
+// RegisterInternal wires up endpoints that must not be reachable through the
+// public port, such as metrics.
+func RegisterInternal(e *echo.Echo) {
+	e.GET(metricsPath, metricsHandler())
+}
+
 func healthz(rc *redis.Client) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		redisResp := rc.Ping(c.Request().Context())
@@ -48,12 +62,16 @@ func addClient(userID string, ch chan []byte) {
 		clients[userID] = make(map[chan []byte]struct{})
 	}
 	clients[userID][ch] = struct{}{}
+	sseConnections.Inc()
 }
 
 func removeClient(userID string, ch chan []byte) {
 	clientsMu.Lock()
 	defer clientsMu.Unlock()
 	if m, ok := clients[userID]; ok {
+		if _, found := m[ch]; found {
+			sseConnections.Dec()
+		}
 		delete(m, ch)
 		if len(m) == 0 {
 			delete(clients, userID)
@@ -67,12 +85,14 @@ func broadcast(userID string, msg []byte) {
 	for ch := range clients[userID] {
 		select {
 		case ch <- msg:
+			broadcastDelivered.Inc()
 		default:
+			broadcastDropped.Inc()
 		}
 	}
 }
 
-func stream(rc *redis.Client, auth Authenticator) echo.HandlerFunc {
+func stream(rc *redis.Client, authn Authenticator) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		// Auth
 		token := c.QueryParam("token")
@@ -80,10 +100,20 @@ func stream(rc *redis.Client, auth Authenticator) echo.HandlerFunc {
 		if authHeader == "" && token != "" {
 			authHeader = "Bearer " + token
 		}
-		userID, err := auth.UserIDFromAuthHeader(authHeader)
+		principal, err := authn.Authenticate(authHeader)
 		if err != nil {
+			// A token that could not be looked up may be valid, so the
+			// client is told to retry rather than to give it up.
+			if errors.Is(err, auth.ErrTooManyTokenLookups) {
+				c.Response().Header().Set("Retry-After", "1")
+				return c.String(http.StatusTooManyRequests, err.Error())
+			}
 			return c.String(http.StatusUnauthorized, err.Error())
 		}
+		if !principal.HasScope(streamScope) {
+			return c.String(http.StatusForbidden, "missing scope "+streamScope)
+		}
+		userID := principal.UserID
 
 		// SSE headers
 		res := c.Response()
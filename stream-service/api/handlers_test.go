@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,12 +12,15 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 
+	"auth"
 	"stream-service/domain"
 )
 
 type fakeAuth struct{}
 
-func (fakeAuth) UserIDFromAuthHeader(string) (string, error) { return "user1", nil }
+func (fakeAuth) Authenticate(string) (auth.Principal, error) {
+	return auth.Principal{UserID: "user1", Unrestricted: true}, nil
+}
 
 type flushRecorder struct{ *httptest.ResponseRecorder }
 
@@ -120,3 +124,49 @@ func TestStreamTasksUsesCachedPayload(t *testing.T) {
 		t.Fatalf("unexpected body %q", rec.Body.String())
 	}
 }
+
+func TestBroadcastMetricsCountDeliveredAndDropped(t *testing.T) {
+	clients = map[string]map[chan []byte]struct{}{}
+	ch := make(chan []byte, 1)
+	addClient("metrics-user", ch)
+	defer removeClient("metrics-user", ch)
+
+	broadcast("metrics-user", []byte("first"))
+	broadcast("metrics-user", []byte("second"))
+
+	e := echo.New()
+	e.GET(metricsPath, metricsHandler())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`stream_service_broadcast_messages_total{result="delivered"}`,
+		`stream_service_broadcast_messages_total{result="dropped"}`,
+		`stream_service_sse_connections 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics output missing %q", want)
+		}
+	}
+}
+
+// readlessAuth authenticates a token that only grants write access.
+type readlessAuth struct{}
+
+func (readlessAuth) Authenticate(string) (auth.Principal, error) {
+	return auth.Principal{UserID: "user1", Scopes: []string{auth.ScopeTasksWrite}}, nil
+}
+
+func TestStreamRequiresReadScope(t *testing.T) {
+	rc, cleanup := setupRedis(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	rec := flushRecorder{httptest.NewRecorder()}
+	if err := stream(rc, readlessAuth{})(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusForbidden || rec.Body.String() != "missing scope tasks:read" {
+		t.Fatalf("expected 403 missing scope, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsPath = "/metrics"
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "stream_service",
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code. Long-lived SSE streams are excluded.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	sseConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "stream_service",
+		Name:      "sse_connections",
+		Help:      "Open SSE connections on this node.",
+	})
+
+	broadcastMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "stream_service",
+		Name:      "broadcast_messages_total",
+		Help:      "Updates offered to SSE clients by result: delivered, or dropped because the client buffer was full.",
+	}, []string{"result"})
+	broadcastDelivered = broadcastMessages.WithLabelValues("delivered")
+	broadcastDropped   = broadcastMessages.WithLabelValues("dropped")
+)
+
+// observeRequests records request latency for short-lived routes.
+func observeRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		route := c.Path()
+		if route == metricsPath || route == streamPath {
+			return err
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Response().Status
+		if he, ok := err.(*echo.HTTPError); ok && !c.Response().Committed {
+			status = he.Code
+		}
+		requestDuration.WithLabelValues(route, c.Request().Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func metricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
@@ -7,11 +7,15 @@ const (
 	TaskUpdated         = "task-updated"
 	TaskCompleted       = "task-completed"
 	TaskReopened        = "task-reopened"
+	TasksReordered      = "tasks-reordered"
 	UserCreated         = "user-created"
 	UserLoggedIn        = "user-logged-in"
 	UserLoggedOut       = "user-logged-out"
 	UserSettingsCreated = "user-settings-created"
 	UserSettingsUpdated = "user-settings-updated"
+	BoardCreated        = "board-created"
+	BoardMemberAdded    = "board-member-added"
+	BoardMemberRemoved  = "board-member-removed"
 )
 
 type TaskCreatedEventData struct {
@@ -19,6 +23,7 @@ type TaskCreatedEventData struct {
 	Notes    string `json:"notes"`
 	Category string `json:"category"`
 	Order    int    `json:"order"`
+	Rank     string `json:"rank"`
 }
 
 type TaskUpdatedEventData struct {
@@ -26,12 +31,32 @@ type TaskUpdatedEventData struct {
 	Notes    *string `json:"notes"`
 	Category *string `json:"category"`
 	Order    *int    `json:"order"`
+	Rank     *string `json:"rank"`
 	Done     *bool   `json:"done"`
 }
 
+// TasksReorderedEventData lists the tasks of a category in their new order; each
+// task's order is its index and its rank the matching taskstate.SpreadRanks entry.
+type TasksReorderedEventData struct {
+	Category string   `json:"category"`
+	IDs      []string `json:"ids"`
+}
+
 type UserSettingsEventData struct {
-	TasksPerCategory *int  `json:"tasksPerCategory"`
-	ShowDoneTasks    *bool `json:"showDoneTasks"`
+	Version          *int                `json:"version"`
+	TasksPerCategory *int                `json:"tasksPerCategory"`
+	ShowDoneTasks    *bool               `json:"showDoneTasks"`
+	Theme            *string             `json:"theme"`
+	DefaultCategory  *string             `json:"defaultCategory"`
+	Categories       *[]SettingsCategory `json:"categories"`
+	Timezone         *string             `json:"timezone"`
+	WeekStart        *string             `json:"weekStart"`
+}
+
+type BoardEventData struct {
+	Name   string `json:"name"`
+	UserID string `json:"userId"`
+	Role   string `json:"role"`
 }
 
 type Event struct {
@@ -40,4 +65,11 @@ type Event struct {
 	Type       string          `json:"Type"`
 	Data       json.RawMessage `json:"Data"`
 	UserID     string          `json:"UserId"`
+	// TraceParent is the W3C traceparent of the read-model-updater span that published the event.
+	TraceParent string `json:"TraceParent,omitempty"`
+	// BoardID is set for board events and tasks on a shared board.
+	BoardID string `json:"BoardId,omitempty"`
+	// Recipients lists the board members the update is delivered to; events
+	// without recipients go to UserID.
+	Recipients []string `json:"Recipients,omitempty"`
 }
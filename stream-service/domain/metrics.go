@@ -0,0 +1,12 @@
+package domain
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var updateErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "stream_service",
+	Name:      "update_errors_total",
+	Help:      "Read model updates that could not be broadcast, by entity type and error class.",
+}, []string{"entity_type", "class"})
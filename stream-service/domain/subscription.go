@@ -6,9 +6,18 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"taskstate"
 )
 
+var traceContext propagation.TraceContext
+
 // SubscribeUpdates listens for read model updates and broadcasts tasks to clients.
+// Updates on a shared board are delivered to each of the board's members.
 func SubscribeUpdates(
 	ctx context.Context,
 	logger echo.Logger,
@@ -30,13 +39,16 @@ func SubscribeUpdates(
 			var ev Event
 			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
 				logger.Errorf("unable to parse update: %v", err)
+				updateErrors.WithLabelValues("unknown", "parse").Inc()
 				continue
 			}
 			var payload struct {
 				EntityType string `json:"entityType"`
+				BoardID    string `json:"boardId,omitempty"`
 				Data       any    `json:"data"`
 			}
 			payload.EntityType = ev.EntityType
+			payload.BoardID = ev.BoardID
 
 			switch ev.EntityType {
 			case "task":
@@ -46,6 +58,7 @@ func SubscribeUpdates(
 					var taskCreatedEvent TaskCreatedEventData
 					if err := json.Unmarshal(ev.Data, &taskCreatedEvent); err != nil {
 						logger.Errorf("parse task-created: %v", err)
+						updateErrors.WithLabelValues(ev.EntityType, "parse").Inc()
 						continue
 					}
 					tasks = append(tasks, Task{
@@ -54,11 +67,13 @@ func SubscribeUpdates(
 						Notes:    taskCreatedEvent.Notes,
 						Category: taskCreatedEvent.Category,
 						Order:    taskCreatedEvent.Order,
+						Rank:     taskCreatedEvent.Rank,
 					})
 				case TaskUpdated:
 					var taskUpdatedEvent TaskUpdatedEventData
 					if err := json.Unmarshal(ev.Data, &taskUpdatedEvent); err != nil {
 						logger.Errorf("parse task-updated: %v", err)
+						updateErrors.WithLabelValues(ev.EntityType, "parse").Inc()
 						continue
 					}
 					newTask := Task{ID: ev.EntityID}
@@ -74,6 +89,9 @@ func SubscribeUpdates(
 					if taskUpdatedEvent.Order != nil {
 						newTask.Order = *taskUpdatedEvent.Order
 					}
+					if taskUpdatedEvent.Rank != nil {
+						newTask.Rank = *taskUpdatedEvent.Rank
+					}
 					if taskUpdatedEvent.Done != nil {
 						newTask.Done = taskUpdatedEvent.Done
 					}
@@ -84,8 +102,22 @@ func SubscribeUpdates(
 				case TaskReopened:
 					done := false
 					tasks = append(tasks, Task{ID: ev.EntityID, Done: &done})
+				case TasksReordered:
+					// One delta carries every moved task, so clients never
+					// render a half-applied reorder.
+					var reordered TasksReorderedEventData
+					if err := json.Unmarshal(ev.Data, &reordered); err != nil {
+						logger.Errorf("parse tasks-reordered: %v", err)
+						updateErrors.WithLabelValues(ev.EntityType, "parse").Inc()
+						continue
+					}
+					ranks := taskstate.SpreadRanks(len(reordered.IDs))
+					for i, id := range reordered.IDs {
+						tasks = append(tasks, Task{ID: id, Category: reordered.Category, Order: i, Rank: ranks[i]})
+					}
 				default:
 					logger.Warnf("Received unknown task event of type %s in %s channel - ignoring it", ev.Type, readModelUpdatesChannel)
+					updateErrors.WithLabelValues(ev.EntityType, "unknown_type").Inc()
 					continue
 				}
 				payload.Data = tasks
@@ -93,22 +125,59 @@ func SubscribeUpdates(
 				var settingsEvent UserSettingsEventData
 				if err := json.Unmarshal(ev.Data, &settingsEvent); err != nil {
 					logger.Errorf("parse user-settings: %v", err)
+					updateErrors.WithLabelValues(ev.EntityType, "parse").Inc()
 					continue
 				}
-				settings := UserSettings{TasksPerCategory: settingsEvent.TasksPerCategory, ShowDoneTasks: settingsEvent.ShowDoneTasks}
-				payload.Data = settings
+				payload.Data = UserSettings(settingsEvent)
+			case "board":
+				switch ev.Type {
+				case BoardCreated, BoardMemberAdded, BoardMemberRemoved:
+				default:
+					logger.Warnf("Received unknown board event of type %s in %s channel - ignoring it", ev.Type, readModelUpdatesChannel)
+					updateErrors.WithLabelValues(ev.EntityType, "unknown_type").Inc()
+					continue
+				}
+				var boardEvent BoardEventData
+				if err := json.Unmarshal(ev.Data, &boardEvent); err != nil {
+					logger.Errorf("parse %s: %v", ev.Type, err)
+					updateErrors.WithLabelValues(ev.EntityType, "parse").Inc()
+					continue
+				}
+				payload.Data = BoardUpdate{ID: ev.EntityID, Type: ev.Type, Name: boardEvent.Name, UserID: boardEvent.UserID, Role: boardEvent.Role}
 			default:
 				logger.Warnf("Received unknown entity type %s in %s channel - ignoring it", ev.EntityType, readModelUpdatesChannel)
+				updateErrors.WithLabelValues("unknown", "unknown_entity").Inc()
 				continue
 			}
 
 			data, err := json.Marshal(payload)
 			if err != nil {
 				logger.Errorf("marshal payload: %v", err)
+				updateErrors.WithLabelValues(ev.EntityType, "marshal").Inc()
 				continue
 			}
 
-			broadcast(ev.UserID, data)
+			// The broadcast span closes the trace that started with the command request.
+			spanCtx := ctx
+			if ev.TraceParent != "" {
+				spanCtx = traceContext.Extract(ctx, propagation.MapCarrier{"traceparent": ev.TraceParent})
+			}
+			_, span := otel.Tracer("stream-service").Start(spanCtx, "broadcast "+ev.EntityType,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("prism.event.type", ev.Type),
+					attribute.String("messaging.destination.name", readModelUpdatesChannel),
+				),
+			)
+			recipients := ev.Recipients
+			if len(recipients) == 0 {
+				recipients = []string{ev.UserID}
+			}
+			span.SetAttributes(attribute.Int("prism.broadcast.recipients", len(recipients)))
+			for _, userID := range recipients {
+				broadcast(userID, data)
+			}
+			span.End()
 		}
 	}
 }
@@ -10,6 +10,9 @@ import (
 	miniredis "github.com/alicebob/miniredis/v2"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestSubscribeUpdates(t *testing.T) {
@@ -115,3 +118,149 @@ func TestSubscribeUpdatesReopen(t *testing.T) {
 		t.Fatal("SubscribeUpdates did not exit")
 	}
 }
+
+func TestSubscribeUpdatesContinuesTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	defer m.Close()
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer rc.Close()
+
+	delivered := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go SubscribeUpdates(ctx, echo.New().Logger, rc, "chan3", func(string, []byte) { delivered <- struct{}{} })
+	time.Sleep(50 * time.Millisecond)
+
+	payload := `{"EntityId":"t1","EntityType":"task","Type":"task-completed","UserId":"user1","TraceParent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`
+	if err := rc.Publish(context.Background(), "chan3", payload).Err(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("update was not broadcast")
+	}
+	// The span ends right after broadcast returns.
+	deadline := time.Now().Add(time.Second)
+	for len(exporter.GetSpans()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected one broadcast span, got %d", len(spans))
+	}
+	if got := spans[0].Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Fatalf("expected parent span 00f067aa0ba902b7, got %s", got)
+	}
+	if got := spans[0].SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected trace id %s", got)
+	}
+}
+
+func TestSubscribeUpdatesFansOutToBoardMembers(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	defer m.Close()
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer rc.Close()
+
+	delivered := make(chan string, 4)
+	var mu sync.Mutex
+	var gotData []byte
+	broadcast := func(uid string, data []byte) {
+		mu.Lock()
+		gotData = data
+		mu.Unlock()
+		delivered <- uid
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go SubscribeUpdates(ctx, echo.New().Logger, rc, "chan4", broadcast)
+	time.Sleep(50 * time.Millisecond)
+
+	payload := `{"EntityId":"t1","EntityType":"task","Type":"task-completed","UserId":"u1","BoardId":"b1","Recipients":["u1","u2"]}`
+	if err := rc.Publish(context.Background(), "chan4", payload).Err(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	var got []string
+	for len(got) < 2 {
+		select {
+		case uid := <-delivered:
+			got = append(got, uid)
+		case <-time.After(time.Second):
+			t.Fatalf("expected delivery to both members, got %v", got)
+		}
+	}
+	if got[0] != "u1" || got[1] != "u2" {
+		t.Fatalf("unexpected recipients %v", got)
+	}
+	mu.Lock()
+	data := gotData
+	mu.Unlock()
+	var payloadObj struct {
+		EntityType string `json:"entityType"`
+		BoardID    string `json:"boardId"`
+	}
+	if err := json.Unmarshal(data, &payloadObj); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if payloadObj.EntityType != "task" || payloadObj.BoardID != "b1" {
+		t.Fatalf("unexpected payload %s", data)
+	}
+}
+
+func TestSubscribeUpdatesSendsReorderAsOneDelta(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	defer m.Close()
+	rc := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer rc.Close()
+
+	delivered := make(chan []byte, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go SubscribeUpdates(ctx, echo.New().Logger, rc, "chan5", func(_ string, data []byte) { delivered <- data })
+	time.Sleep(50 * time.Millisecond)
+
+	payload := `{"EntityId":"u1","EntityType":"task","Type":"tasks-reordered","Data":{"category":"urgent","ids":["t2","t1"]},"UserId":"u1"}`
+	if err := rc.Publish(context.Background(), "chan5", payload).Err(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	var data []byte
+	select {
+	case data = <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("update was not broadcast")
+	}
+	var payloadObj struct {
+		Data []Task `json:"data"`
+	}
+	if err := json.Unmarshal(data, &payloadObj); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	got := payloadObj.Data
+	if len(got) != 2 || got[0].ID != "t2" || got[0].Order != 0 || got[1].ID != "t1" || got[1].Order != 1 || got[1].Category != "urgent" {
+		t.Fatalf("unexpected payload %s", data)
+	}
+	if got[0].Rank == "" || got[0].Rank >= got[1].Rank {
+		t.Fatalf("expected ascending ranks, got %s", data)
+	}
+	select {
+	case extra := <-delivered:
+		t.Fatalf("expected a single delta, got another %s", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -6,10 +6,33 @@ type Task struct {
         Notes    string `json:"notes,omitempty"`
         Category string `json:"category,omitempty"`
         Order    int    `json:"order"`
+        Rank     string `json:"rank,omitempty"`
         Done     *bool  `json:"done,omitempty"`
 }
 
+// UserSettings carries the settings an event changed; unset fields are omitted.
 type UserSettings struct {
-	TasksPerCategory *int  `json:"tasksPerCategory,omitempty"`
-	ShowDoneTasks    *bool `json:"showDoneTasks,omitempty"`
+	Version          *int                `json:"version,omitempty"`
+	TasksPerCategory *int                `json:"tasksPerCategory,omitempty"`
+	ShowDoneTasks    *bool               `json:"showDoneTasks,omitempty"`
+	Theme            *string             `json:"theme,omitempty"`
+	DefaultCategory  *string             `json:"defaultCategory,omitempty"`
+	Categories       *[]SettingsCategory `json:"categories,omitempty"`
+	Timezone         *string             `json:"timezone,omitempty"`
+	WeekStart        *string             `json:"weekStart,omitempty"`
+}
+
+// SettingsCategory is a category the user added to the built-in ones.
+type SettingsCategory struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// BoardUpdate tells a member that a board was created or that its membership changed.
+type BoardUpdate struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name,omitempty"`
+	UserID string `json:"userId,omitempty"`
+	Role   string `json:"role,omitempty"`
 }
@@ -1,25 +1,42 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"fmt"
+	"errors"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/MicahParks/keyfunc"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 
+	"auth"
 	"stream-service/api"
+	"tracing"
 )
 
 func main() {
 	if dbg, err := strconv.ParseBool(os.Getenv("DEBUG")); err == nil && dbg {
 		log.SetLevel(log.DebugLevel)
 	}
+	shutdownTracing, err := tracing.Setup(context.Background(), "stream-service")
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.WithError(err).Warn("tracing shutdown failed")
+		}
+	}()
+
 	redisConn := os.Getenv("REDIS_CONNECTION_STRING")
 	if redisConn == "" {
 		log.Fatal("missing redis config")
@@ -51,21 +68,28 @@ func main() {
 	}
 
 	testMode := os.Getenv("AUTH0_TEST_MODE") == "1"
-	var auth *api.Auth
+	var authenticator *auth.Authenticator
 	if testMode {
-		auth = api.NewAuth(nil, "", "")
+		authenticator = auth.New("", nil, nil)
 	} else {
-		jwtAudience := os.Getenv("AUTH0_AUDIENCE")
-		domain := os.Getenv("AUTH0_DOMAIN")
-		if jwtAudience == "" || domain == "" {
-			log.Fatal("missing Auth0 config")
+		oidcCfg, err := auth.ConfigFromEnv()
+		if err != nil {
+			log.Fatalf("missing OIDC config: %v", err)
 		}
-		jwksURL := fmt.Sprintf("https://%s/.well-known/jwks.json", domain)
-		jwks, err := keyfunc.Get(jwksURL, keyfunc.Options{})
+		authenticator, err = auth.NewOIDC(context.Background(), oidcCfg)
 		if err != nil {
-			log.Fatalf("jwks: %v", err)
+			log.Fatalf("oidc: %v", err)
 		}
-		auth = api.NewAuth(jwks, jwtAudience, "https://"+domain+"/")
+	}
+	defer authenticator.Close()
+	// Personal access tokens are read from the table the Prism API writes
+	// them to, so they open the stream like any other token.
+	if table := os.Getenv("TOKENS_TABLE"); table != "" {
+		svc, err := aztables.NewServiceClientFromConnectionString(os.Getenv("STORAGE_CONNECTION_STRING"), nil)
+		if err != nil {
+			log.Fatalf("tokens table: %v", err)
+		}
+		authenticator.AcceptPersonalTokens(auth.NewTableTokenStore(svc.NewClient(table)))
 	}
 
 	e := echo.New()
@@ -74,7 +98,22 @@ func main() {
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
 	}))
 
-	api.Register(e, rc, auth, taskUpdatesChannel, settingsUpdatesChannel)
+	api.Register(e, rc, authenticator, taskUpdatesChannel, settingsUpdatesChannel)
+	// Metrics are served on a separate port that is not published through
+	// the reverse proxy.
+	if port := os.Getenv("INTERNAL_PORT"); port != "" {
+		internal := echo.New()
+		internal.HideBanner = true
+		internal.HidePort = true
+		api.RegisterInternal(internal)
+		go func() {
+			if err := internal.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("internal server: %v", err)
+			}
+		}()
+	} else {
+		log.Info("INTERNAL_PORT is empty; metrics are not served")
+	}
 
 	listenAddr := ":9000"
 	if val, ok := os.LookupEnv("STREAM_SERVICE_PORT"); ok {
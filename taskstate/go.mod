@@ -0,0 +1,3 @@
+module taskstate
+
+go 1.24.0
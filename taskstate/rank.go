@@ -0,0 +1,123 @@
+package taskstate
+
+import (
+	"errors"
+	"strings"
+)
+
+// Ranks are strings over rankDigits compared byte by byte, like LexoRank: a
+// task moved between two others gets a rank between theirs, so no other task
+// has to change. Ranks never end in the lowest digit, which keeps room below
+// every rank.
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// MaxRankLength is the rank length past which a category should be
+// rebalanced with SpreadRanks. Each insertion at the same spot adds about one
+// digit every five moves.
+const MaxRankLength = 12
+
+// ErrInvalidRank is returned for ranks with other characters than digits and
+// lowercase letters, a trailing "0", or bounds out of order.
+var ErrInvalidRank = errors.New("invalid rank")
+
+// ValidRank reports whether r is a rank RankBetween accepts as a bound.
+func ValidRank(r string) bool {
+	if r == "" || r[len(r)-1] == rankDigits[0] {
+		return false
+	}
+	for i := 0; i < len(r); i++ {
+		if strings.IndexByte(rankDigits, r[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RankBetween returns the shortest rank sorting after a and before b. An empty
+// a means before every rank and an empty b after every rank.
+func RankBetween(a, b string) (string, error) {
+	if (a != "" && !ValidRank(a)) || (b != "" && !ValidRank(b)) || (a != "" && b != "" && a >= b) {
+		return "", ErrInvalidRank
+	}
+	return midpoint(a, b), nil
+}
+
+// midpoint expects valid bounds with a < b; an empty b is unbounded.
+func midpoint(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && rankDigit(a, n) == strings.IndexByte(rankDigits, b[n]) {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(tail(a, n), b[n:])
+		}
+	}
+	lo := rankDigit(a, 0)
+	hi := len(rankDigits)
+	if b != "" {
+		hi = strings.IndexByte(rankDigits, b[0])
+	}
+	if hi-lo > 1 {
+		return string(rankDigits[(lo+hi)/2])
+	}
+	// The first digits are adjacent: b's first digit alone fits when b goes on,
+	// otherwise keep a's digit and go one level deeper.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(rankDigits[lo]) + midpoint(tail(a, 1), "")
+}
+
+// rankDigit returns the value of r's i-th digit, padding r with zeros.
+func rankDigit(r string, i int) int {
+	if i >= len(r) {
+		return 0
+	}
+	return strings.IndexByte(rankDigits, r[i])
+}
+
+func tail(r string, n int) string {
+	if n >= len(r) {
+		return ""
+	}
+	return r[n:]
+}
+
+// SpreadRanks returns n ascending ranks of equal length spaced evenly over the
+// rank space, leaving room for a few dozen insertions between neighbours
+// before they grow. The result depends on n alone, so every service ranks a
+// reorder the same way.
+func SpreadRanks(n int) []string {
+	base := len(rankDigits)
+	width, space := 1, base
+	for space < (n+1)*base {
+		width++
+		space *= base
+	}
+	ranks := make([]string, n)
+	buf := make([]byte, width)
+	for i := range ranks {
+		v := (i + 1) * space / (n + 1)
+		for j := width - 1; j >= 0; j-- {
+			buf[j] = rankDigits[v%base]
+			v /= base
+		}
+		ranks[i] = strings.TrimRight(string(buf), rankDigits[:1])
+	}
+	return ranks
+}
+
+// Before reports whether a sorts before b within a category. Ranked tasks sort
+// by rank ahead of unranked ones, which keep sorting by order until a reorder
+// ranks them.
+func Before(a, b Task) bool {
+	switch {
+	case a.Rank != "" && b.Rank != "":
+		return a.Rank < b.Rank
+	case a.Rank != "" || b.Rank != "":
+		return a.Rank != ""
+	default:
+		return a.Order < b.Order
+	}
+}
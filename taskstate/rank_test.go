@@ -0,0 +1,72 @@
+package taskstate
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestRankBetweenSortsBetweenItsBounds(t *testing.T) {
+	cases := []struct{ a, b string }{
+		{"", ""},
+		{"", "1"},
+		{"", "01"},
+		{"a", ""},
+		{"a", "b"},
+		{"a", "a5"},
+		{"ab", "ac"},
+		{"zz", ""},
+		{"i", "i1"},
+	}
+	for _, tc := range cases {
+		got, err := RankBetween(tc.a, tc.b)
+		if err != nil {
+			t.Fatalf("RankBetween(%q, %q): %v", tc.a, tc.b, err)
+		}
+		if !ValidRank(got) || got <= tc.a || (tc.b != "" && got >= tc.b) {
+			t.Fatalf("RankBetween(%q, %q) = %q", tc.a, tc.b, got)
+		}
+	}
+}
+
+func TestRankBetweenRejectsInvalidBounds(t *testing.T) {
+	for _, tc := range []struct{ a, b string }{{"b", "a"}, {"a", "a"}, {"a0", ""}, {"", "A"}} {
+		if _, err := RankBetween(tc.a, tc.b); !errors.Is(err, ErrInvalidRank) {
+			t.Fatalf("RankBetween(%q, %q): expected ErrInvalidRank, got %v", tc.a, tc.b, err)
+		}
+	}
+}
+
+func TestRepeatedInsertionsGrowRanksSlowly(t *testing.T) {
+	first := "i"
+	for i := 1; i <= 50; i++ {
+		r, err := RankBetween("", first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r) > 1+i/4 {
+			t.Fatalf("rank %q after %d insertions at the top", r, i)
+		}
+		first = r
+	}
+}
+
+func TestSpreadRanksAreAscendingAndDeterministic(t *testing.T) {
+	for _, n := range []int{1, 2, 35, 100} {
+		ranks := SpreadRanks(n)
+		if len(ranks) != n || !sort.StringsAreSorted(ranks) {
+			t.Fatalf("SpreadRanks(%d) = %v", n, ranks)
+		}
+		for i, r := range ranks {
+			if !ValidRank(r) || (i > 0 && r == ranks[i-1]) {
+				t.Fatalf("SpreadRanks(%d) has invalid rank %q", n, r)
+			}
+			if _, err := RankBetween(r, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if again := SpreadRanks(n); again[n-1] != ranks[n-1] {
+			t.Fatalf("SpreadRanks(%d) is not deterministic", n)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package taskstate folds task events into task state. The read-model updater
+// uses it to maintain the tasks table and the Prism API to replay the event
+// store, so both agree on what an event does.
+package taskstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Task event types.
+const (
+	Created   = "task-created"
+	Updated   = "task-updated"
+	Completed = "task-completed"
+	Reopened  = "task-reopened"
+	// Reordered is stored once per read model partition and lists several
+	// tasks; SplitReorder expands it into per-task updates for Apply.
+	Reordered = "tasks-reordered"
+)
+
+var (
+	// ErrExists is returned for a task-created event of an existing task.
+	ErrExists = errors.New("task already exists")
+	// ErrNotFound is returned for changes to a task that was never created.
+	ErrNotFound = errors.New("task not found")
+	// ErrStale is returned for events not newer than the task's last event.
+	ErrStale = errors.New("stale event")
+	// ErrNoFields is returned for a task-updated event without any field.
+	ErrNoFields = errors.New("update had no fields")
+	// ErrUnknownEvent is returned for event types that are not task events.
+	ErrUnknownEvent = errors.New("unknown task event")
+	// ErrReorderRange is returned for a tasks-reordered event whose tasks do
+	// not fit the positions it claims.
+	ErrReorderRange = errors.New("reorder out of range")
+)
+
+// Task is the state of a task after its latest event. Rank is empty for tasks
+// that were never ranked; see Before. EventSequence is zero when the latest
+// event was not sequenced.
+type Task struct {
+	Title          string
+	Notes          string
+	Category       string
+	Order          int
+	Rank           string
+	Done           bool
+	EventTimestamp int64
+	EventSequence  int64
+}
+
+// Event is the part of a task event the reducer needs. Sequence is the
+// per-partition number the Prism API stamps on commands when its sequencer is
+// enabled, zero otherwise.
+type Event struct {
+	Type      string
+	Data      []byte
+	Timestamp int64
+	Sequence  int64
+}
+
+// After reports whether ev comes after the event that produced t. Sequences
+// are compared when both carry one; the timestamp only decides for events
+// issued without a sequencer, whose order depends on the API nodes' clocks.
+// Timestamps are hybrid logical clock values ending in the issuing node's ID,
+// so the events of two nodes never tie and only a redelivered event compares
+// equal.
+func (ev Event) After(t Task) bool {
+	if ev.Sequence > 0 && t.EventSequence > 0 {
+		return ev.Sequence > t.EventSequence
+	}
+	return ev.Timestamp > t.EventTimestamp
+}
+
+// Change lists the fields an event sets. Nil fields are left unchanged.
+type Change struct {
+	Title    *string
+	Notes    *string
+	Category *string
+	Order    *int
+	Rank     *string
+	Done     *bool
+}
+
+type createdData struct {
+	Title    string `json:"title"`
+	Notes    string `json:"notes"`
+	Category string `json:"category"`
+	Order    int    `json:"order"`
+	Rank     string `json:"rank"`
+}
+
+// reorderedData lists tasks in their new order. A category too large for one
+// event is reordered by several, each listing the tasks from Offset on out of
+// Total. Expected holds the event timestamp each task had when the reorder was
+// planned; see ReorderCurrent.
+type reorderedData struct {
+	Category string           `json:"category"`
+	IDs      []string         `json:"ids"`
+	Offset   int              `json:"offset"`
+	Total    int              `json:"total"`
+	Expected map[string]int64 `json:"expected"`
+}
+
+// TaskUpdate is the event a tasks-reordered event applies to one task.
+// Expected is the event timestamp the task held when the reorder was planned,
+// zero for reorders that apply regardless.
+type TaskUpdate struct {
+	TaskID   string
+	Event    Event
+	Expected int64
+}
+
+// SplitReorder returns one task-updated event per task listed by a
+// tasks-reordered event, moving it to the event's category with its position
+// as order and the matching rank from SpreadRanks. Positions count from the
+// event's offset within its total, so the events reordering one category in
+// parts rank it as a single event would.
+func SplitReorder(ev Event) ([]TaskUpdate, error) {
+	if ev.Type != Reordered {
+		return nil, fmt.Errorf("%w %s", ErrUnknownEvent, ev.Type)
+	}
+	var data reorderedData
+	if err := json.Unmarshal(ev.Data, &data); err != nil {
+		return nil, err
+	}
+	total := data.Total
+	if total == 0 {
+		total = len(data.IDs)
+	}
+	if data.Offset < 0 || data.Offset+len(data.IDs) > total {
+		return nil, ErrReorderRange
+	}
+	ranks := SpreadRanks(total)
+	updates := make([]TaskUpdate, 0, len(data.IDs))
+	for i, id := range data.IDs {
+		pos := data.Offset + i
+		payload, err := json.Marshal(struct {
+			Category string `json:"category"`
+			Order    int    `json:"order"`
+			Rank     string `json:"rank"`
+		}{data.Category, pos, ranks[pos]})
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, TaskUpdate{
+			TaskID:   id,
+			Event:    Event{Type: Updated, Data: payload, Timestamp: ev.Timestamp, Sequence: ev.Sequence},
+			Expected: data.Expected[id],
+		})
+	}
+	return updates, nil
+}
+
+// ReorderCurrent reports whether every task of a split reorder still holds
+// the event it held when the reorder was planned. lookup returns nil for
+// tasks that do not exist. A reorder that is not current was planned from a
+// state another change has replaced since and must be dropped as a whole:
+// applying it would undo that change.
+func ReorderCurrent(updates []TaskUpdate, lookup func(taskID string) *Task) bool {
+	for _, u := range updates {
+		if u.Expected == 0 {
+			continue
+		}
+		if t := lookup(u.TaskID); t == nil || t.EventTimestamp != u.Expected {
+			return false
+		}
+	}
+	return true
+}
+
+type updatedData struct {
+	Title    *string `json:"title"`
+	Notes    *string `json:"notes"`
+	Category *string `json:"category"`
+	Order    *int    `json:"order"`
+	Rank     *string `json:"rank"`
+	Done     *bool   `json:"done"`
+}
+
+// Apply returns the task after ev together with the fields ev set. cur is nil
+// when the task does not exist yet. Apply does not modify cur.
+func Apply(cur *Task, ev Event) (Task, Change, error) {
+	switch ev.Type {
+	case Created:
+		var data createdData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return Task{}, Change{}, err
+		}
+		if cur != nil {
+			return *cur, Change{}, ErrExists
+		}
+		// A task is always created open.
+		done := false
+		change := Change{Title: &data.Title, Notes: &data.Notes, Category: &data.Category, Order: &data.Order, Done: &done}
+		if data.Rank != "" {
+			change.Rank = &data.Rank
+		}
+		return change.apply(Task{}, ev), change, nil
+	case Updated:
+		var data updatedData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return Task{}, Change{}, err
+		}
+		change := Change(data)
+		if change.Title == nil && change.Notes == nil && change.Category == nil && change.Order == nil && change.Rank == nil && change.Done == nil {
+			return Task{}, change, ErrNoFields
+		}
+		return applyChange(cur, ev, change)
+	case Completed, Reopened:
+		done := ev.Type == Completed
+		return applyChange(cur, ev, Change{Done: &done})
+	default:
+		return Task{}, Change{}, fmt.Errorf("%w %s", ErrUnknownEvent, ev.Type)
+	}
+}
+
+func applyChange(cur *Task, ev Event, change Change) (Task, Change, error) {
+	if cur == nil {
+		return Task{}, change, ErrNotFound
+	}
+	if !ev.After(*cur) {
+		return *cur, change, ErrStale
+	}
+	return change.apply(*cur, ev), change, nil
+}
+
+func (c Change) apply(t Task, ev Event) Task {
+	if c.Title != nil {
+		t.Title = *c.Title
+	}
+	if c.Notes != nil {
+		t.Notes = *c.Notes
+	}
+	if c.Category != nil {
+		t.Category = *c.Category
+	}
+	if c.Order != nil {
+		t.Order = *c.Order
+	}
+	if c.Rank != nil {
+		t.Rank = *c.Rank
+	}
+	if c.Done != nil {
+		t.Done = *c.Done
+	}
+	t.EventTimestamp = ev.Timestamp
+	t.EventSequence = ev.Sequence
+	return t
+}
@@ -0,0 +1,165 @@
+package taskstate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyFoldsTaskEvents(t *testing.T) {
+	created, change, err := Apply(nil, Event{Type: Created, Data: []byte(`{"title":"Buy milk","category":"normal","order":3}`), Timestamp: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != (Task{Title: "Buy milk", Category: "normal", Order: 3, EventTimestamp: 1}) || change.Done == nil || *change.Done {
+		t.Fatalf("unexpected task %+v", created)
+	}
+
+	updated, change, err := Apply(&created, Event{Type: Updated, Data: []byte(`{"title":"Buy oat milk","done":true}`), Timestamp: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "Buy oat milk" || !updated.Done || updated.Category != "normal" || updated.EventTimestamp != 2 {
+		t.Fatalf("unexpected task %+v", updated)
+	}
+	if change.Category != nil || change.Title == nil {
+		t.Fatalf("expected only the sent fields in the change, got %+v", change)
+	}
+	if created.Title != "Buy milk" {
+		t.Fatal("Apply must not modify the current task")
+	}
+
+	reopened, _, err := Apply(&updated, Event{Type: Reopened, Timestamp: 3})
+	if err != nil || reopened.Done {
+		t.Fatalf("expected reopened task, got %+v (%v)", reopened, err)
+	}
+	completed, _, err := Apply(&reopened, Event{Type: Completed, Timestamp: 4})
+	if err != nil || !completed.Done {
+		t.Fatalf("expected completed task, got %+v (%v)", completed, err)
+	}
+}
+
+func TestApplyRejectsEventsTheReadModelWouldReject(t *testing.T) {
+	existing := &Task{Title: "x", EventTimestamp: 5}
+	cases := []struct {
+		name string
+		cur  *Task
+		ev   Event
+		want error
+	}{
+		{"duplicate create", existing, Event{Type: Created, Data: []byte(`{"title":"y"}`), Timestamp: 6}, ErrExists},
+		{"update missing task", nil, Event{Type: Updated, Data: []byte(`{"title":"y"}`), Timestamp: 6}, ErrNotFound},
+		{"complete missing task", nil, Event{Type: Completed, Timestamp: 6}, ErrNotFound},
+		{"stale update", existing, Event{Type: Updated, Data: []byte(`{"title":"y"}`), Timestamp: 5}, ErrStale},
+		{"stale reopen", existing, Event{Type: Reopened, Timestamp: 4}, ErrStale},
+		{"empty update", existing, Event{Type: Updated, Data: []byte(`{}`), Timestamp: 6}, ErrNoFields},
+		{"unknown event", existing, Event{Type: "task-archived", Timestamp: 6}, ErrUnknownEvent},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := Apply(tc.cur, tc.ev); !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestApplyOrdersSequencedEventsBySequence(t *testing.T) {
+	existing := &Task{Title: "x", EventTimestamp: 50, EventSequence: 7}
+	cases := []struct {
+		name string
+		ev   Event
+		want error
+	}{
+		// The node that stamped the next sequence had a clock behind the last one.
+		{"later sequence, earlier clock", Event{Type: Completed, Timestamp: 10, Sequence: 8}, nil},
+		{"earlier sequence, later clock", Event{Type: Completed, Timestamp: 90, Sequence: 6}, ErrStale},
+		{"same sequence", Event{Type: Completed, Timestamp: 90, Sequence: 7}, ErrStale},
+		{"unsequenced event", Event{Type: Completed, Timestamp: 40}, ErrStale},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			next, _, err := Apply(existing, tc.ev)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+			if err == nil && (next.EventSequence != tc.ev.Sequence || next.EventTimestamp != tc.ev.Timestamp) {
+				t.Fatalf("expected the event's sequence and timestamp, got %+v", next)
+			}
+		})
+	}
+}
+
+func TestApplyBreaksClockTiesByNodeID(t *testing.T) {
+	// Two API nodes stamped the same microsecond and counter; the node ID in
+	// the low four bits decides.
+	const reading = int64(1_700_000_000_000_000_000) &^ 0x3FF
+	existing := &Task{Title: "x", EventTimestamp: reading | 2}
+	if _, _, err := Apply(existing, Event{Type: Completed, Timestamp: reading | 7}); err != nil {
+		t.Fatalf("expected the higher node to win, got %v", err)
+	}
+	if _, _, err := Apply(existing, Event{Type: Completed, Timestamp: reading | 1}); !errors.Is(err, ErrStale) {
+		t.Fatalf("expected the lower node to lose, got %v", err)
+	}
+	if _, _, err := Apply(existing, Event{Type: Completed, Timestamp: reading | 2}); !errors.Is(err, ErrStale) {
+		t.Fatalf("expected a redelivered event to be stale, got %v", err)
+	}
+}
+
+func TestSplitReorderUpdatesEachListedTask(t *testing.T) {
+	updates, err := SplitReorder(Event{Type: Reordered, Data: []byte(`{"category":"urgent","ids":["b","a"]}`), Timestamp: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[0].TaskID != "b" || updates[1].TaskID != "a" {
+		t.Fatalf("unexpected updates %+v", updates)
+	}
+	cur := Task{Title: "a", Category: "normal", Order: 0, EventTimestamp: 1}
+	next, change, err := Apply(&cur, updates[1].Event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Category != "urgent" || next.Order != 1 || next.EventTimestamp != 5 || change.Title != nil || change.Done != nil {
+		t.Fatalf("unexpected task %+v (%+v)", next, change)
+	}
+
+	if _, err := SplitReorder(Event{Type: Updated}); !errors.Is(err, ErrUnknownEvent) {
+		t.Fatalf("expected ErrUnknownEvent, got %v", err)
+	}
+}
+
+func TestSplitReorderRanksPartsLikeOneReorder(t *testing.T) {
+	whole, err := SplitReorder(Event{Type: Reordered, Data: []byte(`{"category":"normal","ids":["a","b","c"]}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := SplitReorder(Event{Type: Reordered, Data: []byte(`{"category":"normal","ids":["c"],"offset":2,"total":3}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(part) != 1 || string(part[0].Event.Data) != string(whole[2].Event.Data) {
+		t.Fatalf("expected %s, got %+v", whole[2].Event.Data, part)
+	}
+	if _, err := SplitReorder(Event{Type: Reordered, Data: []byte(`{"category":"normal","ids":["c","d"],"offset":2,"total":3}`)}); !errors.Is(err, ErrReorderRange) {
+		t.Fatalf("expected ErrReorderRange, got %v", err)
+	}
+}
+
+func TestReorderCurrentDropsReordersOfChangedTasks(t *testing.T) {
+	updates, err := SplitReorder(Event{Type: Reordered, Data: []byte(`{"category":"normal","ids":["a","b"],"expected":{"a":3,"b":4}}`), Timestamp: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := map[string]*Task{"a": {EventTimestamp: 3}, "b": {EventTimestamp: 4}}
+	lookup := func(id string) *Task { return tasks[id] }
+	if !ReorderCurrent(updates, lookup) {
+		t.Fatal("expected the reorder to apply to unchanged tasks")
+	}
+	tasks["b"] = &Task{EventTimestamp: 7}
+	if ReorderCurrent(updates, lookup) {
+		t.Fatal("expected the reorder to be dropped after b changed")
+	}
+	unconditional, _ := SplitReorder(Event{Type: Reordered, Data: []byte(`{"category":"normal","ids":["a","b"]}`), Timestamp: 9})
+	if !ReorderCurrent(unconditional, lookup) {
+		t.Fatal("expected a reorder without expectations to apply")
+	}
+}
@@ -69,30 +69,19 @@ func TestTaskOrderControls(t *testing.T) {
 		}
 	}
 
-	// swap the first two normal tasks to emulate the arrow controls
+	// swap the first two normal tasks to emulate the arrow controls, which
+	// renumber the whole lane with one reorder-tasks command
 	reorderKey := fmt.Sprintf("ik-%s-reorder", prefix)
-	commands := []command{
-		{
-			IdempotencyKey: reorderKey + "-up",
-			EntityType:     "task",
-			Type:           "update-task",
-			Data: map[string]any{
-				"id":    normalIDs[0],
-				"order": 1,
-			},
-		},
-		{
-			IdempotencyKey: reorderKey + "-down",
-			EntityType:     "task",
-			Type:           "update-task",
-			Data: map[string]any{
-				"id":    normalIDs[1],
-				"order": 0,
-			},
+	if resp, err := client.PostJSON("/api/commands", []command{{
+		IdempotencyKey: reorderKey,
+		EntityType:     "task",
+		Type:           "reorder-tasks",
+		Data: map[string]any{
+			"category": "normal",
+			"ids":      []string{normalIDs[1], normalIDs[0], normalIDs[2]},
 		},
-	}
-	if resp, err := client.PostJSON("/api/commands", commands, nil); err != nil || resp.StatusCode >= 300 {
-		t.Fatalf("reorder commands: status %d err %v", resp.StatusCode, err)
+	}}, nil); err != nil || resp.StatusCode >= 300 {
+		t.Fatalf("reorder command: status %d err %v", resp.StatusCode, err)
 	}
 
 	pollTasks(t, client, "normal tasks swapped", func(ts []task) bool {
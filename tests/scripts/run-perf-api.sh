@@ -55,8 +55,13 @@ if $AZURITE; then
 fi
 
 RESULT_DIR="tests/perf/results"
-SUMMARY_FILE_REL="$RESULT_DIR/task_request_metrics.json"
+SUMMARY_FILE_REL="$RESULT_DIR/request_metrics.json"
 SUMMARY_FILE="$(pwd)/$SUMMARY_FILE_REL"
+# PERF_BASELINE points at a request_metrics.json from an earlier run; when set, the
+# run fails if a latency percentile regressed by more than PERF_REGRESSION_THRESHOLD
+# percent.
+PERF_BASELINE="${PERF_BASELINE:-}"
+PERF_REGRESSION_THRESHOLD="${PERF_REGRESSION_THRESHOLD:-10}"
 ARTIFACT_DIR="${ARTIFACTS_DIR:-${CI_ARTIFACTS_DIR:-}}"
 
 ensure_artifact_dir() {
@@ -71,28 +76,40 @@ collect_logs_and_teardown() {
 
   if [[ ${#COMPOSE[@]} -gt 0 ]]; then
     if [[ -n "${SUMMARY_FILE:-}" ]]; then
-      echo "Collecting task request observability events..."
+      echo "Collecting request observability events..."
       if "${COMPOSE[@]}" logs --no-color --no-log-prefix prism-api-1 prism-api-2 prism-api-3 prism-api-4 prism-api-5 \
         | (cd tests/utils && go run ./cmd/collect-otel-events -out "$SUMMARY_FILE"); then
-        echo "Aggregated task metrics saved to $SUMMARY_FILE_REL"
+        echo "Aggregated request metrics saved to $SUMMARY_FILE_REL"
         if [[ -n "${ARTIFACT_DIR:-}" ]]; then
           ensure_artifact_dir
-          artifact_path="$ARTIFACT_DIR/task-request-metrics.json"
+          artifact_path="$ARTIFACT_DIR/request-metrics.json"
           if cp "$SUMMARY_FILE" "$artifact_path"; then
-            echo "Task metrics artifact copied to $artifact_path"
+            echo "Request metrics artifact copied to $artifact_path"
           else
-            echo "Failed to copy task metrics artifact to $artifact_path" >&2
+            echo "Failed to copy request metrics artifact to $artifact_path" >&2
+          fi
+        fi
+        if [[ -n "$PERF_BASELINE" ]]; then
+          echo "Comparing request latencies against $PERF_BASELINE (threshold ${PERF_REGRESSION_THRESHOLD}%)..."
+          if ! (cd tests/utils && go run ./cmd/collect-otel-events compare \
+            -baseline "$(realpath "$PERF_BASELINE")" \
+            -current "$SUMMARY_FILE" \
+            -threshold "$PERF_REGRESSION_THRESHOLD"); then
+            echo "Request latency regressed against the baseline" >&2
+            if [[ "$exit_code" -eq 0 ]]; then
+              exit_code=1
+            fi
           fi
         fi
       else
-        echo "Failed to collect task metrics from OpenTelemetry logs" >&2
+        echo "Failed to collect request metrics from OpenTelemetry logs" >&2
       fi
     fi
 
     "${COMPOSE[@]}" down -v
   fi
 
-  return "$exit_code"
+  exit "$exit_code"
 }
 
 trap collect_logs_and_teardown EXIT
@@ -8,20 +8,21 @@ import (
 )
 
 const (
-	tasksEventName   = "prism.api.tasks.request"
-	tasksEventDomain = "app"
-
-	attrHTTPStatusCode    = "http.status_code"
-	attrTotalMillis       = "prism.tasks.total_ms"
-	attrAuthMillis        = "prism.tasks.auth_ms"
-	attrFetchMillis       = "prism.tasks.fetch_ms"
-	attrEncodeMillis      = "prism.tasks.encode_ms"
-	attrTasksReturned     = "prism.tasks.tasks_returned"
-	attrPageTokenProvided = "prism.tasks.page_token_provided"
-	attrHasNextPage       = "prism.tasks.has_next_page"
-	attrErrorStage        = "prism.tasks.error_stage"
+	tasksEventName    = "prism.api.tasks.request"
+	settingsEventName = "prism.api.settings.request"
+	commandsEventName = "prism.api.commands.request"
+	enqueueEventName  = "prism.api.commands.enqueue"
+	tasksEventDomain  = "app"
+
+	attrHTTPStatusCode = "http.status_code"
+	attrErrorStage     = "error_stage"
+	attrRequestStart   = "request_start_ns"
+	durationSuffix     = "_ms"
 )
 
+// defaultEventNames are the observability events reported by the Prism API.
+var defaultEventNames = []string{tasksEventName, settingsEventName, commandsEventName, enqueueEventName}
+
 type logRecord struct {
 	EventName      string         `json:"event.name"`
 	EventDomain    string         `json:"event.domain"`
@@ -31,26 +32,54 @@ type logRecord struct {
 	Attributes     map[string]any `json:"attributes"`
 }
 
+// otelRecord is the subset of a record written by the OTel stdout log exporter,
+// which prism-api uses with OBSERVABILITY_EXPORTER=file.
+type otelRecord struct {
+	EventName    string
+	SeverityText string
+	Severity     int
+	Body         otelValue
+	Attributes   []struct {
+		Key   string
+		Value otelValue
+	}
+}
+
+type otelValue struct {
+	Type  string
+	Value any
+}
+
 type collector struct {
-	eventName   string
+	eventNames  []string
 	eventDomain string
-	stats       metricsSummary
+	events      map[string]*metricsSummary
 	skipped     int
 }
 
+// metricsSummary aggregates the events of one name. Event attributes are
+// namespaced as prism.<event>.<name>; names ending in _ms are stage durations,
+// other numbers, booleans and strings are aggregated under their name.
 type metricsSummary struct {
 	Count          int
 	SeverityCounts map[string]int
 	StatusCounts   map[int]int
 	Durations      map[string]*numericStats
-	Tasks          *numericStats
-	PageTokenTrue  int
-	PageTokenFalse int
-	HasNextTrue    int
-	HasNextFalse   int
+	Values         map[string]*numericStats
+	Flags          map[string]*boolCounts
+	Labels         map[string]map[string]int
 	ErrorStages    map[string]int
 	ErrorEvents    int
 	WarnEvents     int
+	ByStatus       map[int]*groupStats
+	ByErrorStage   map[string]*groupStats
+}
+
+// groupStats aggregates the stage durations of the events sharing a status code
+// or an error stage.
+type groupStats struct {
+	Count     int
+	Durations map[string]*numericStats
 }
 
 type numericStats struct {
@@ -58,6 +87,7 @@ type numericStats struct {
 	Sum   float64
 	Min   float64
 	Max   float64
+	hist  *histogram
 }
 
 type durationSummary struct {
@@ -65,6 +95,10 @@ type durationSummary struct {
 	Min   float64 `json:"min_ms"`
 	Max   float64 `json:"max_ms"`
 	Avg   float64 `json:"avg_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	P999  float64 `json:"p999_ms"`
 }
 
 type numericSummary struct {
@@ -72,6 +106,15 @@ type numericSummary struct {
 	Min   float64 `json:"min"`
 	Max   float64 `json:"max"`
 	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+}
+
+type groupSummary struct {
+	Count      int                        `json:"count"`
+	DurationMs map[string]durationSummary `json:"duration_ms"`
 }
 
 type boolCounts struct {
@@ -79,36 +122,52 @@ type boolCounts struct {
 	False int `json:"false"`
 }
 
-type paginationSummary struct {
-	PageToken boolCounts `json:"page_token_provided"`
-	HasNext   boolCounts `json:"has_next_page"`
-}
-
 type summaryOutput struct {
 	EventName      string                     `json:"event_name"`
 	EventDomain    string                     `json:"event_domain"`
 	TotalEvents    int                        `json:"total_events"`
 	SeverityCounts map[string]int             `json:"severity_counts"`
-	StatusCounts   map[string]int             `json:"status_counts"`
+	StatusCounts   map[string]int             `json:"status_counts,omitempty"`
 	DurationMs     map[string]durationSummary `json:"duration_ms"`
-	TasksReturned  numericSummary             `json:"tasks_returned"`
-	Pagination     paginationSummary          `json:"pagination"`
+	Values         map[string]numericSummary  `json:"values,omitempty"`
+	Flags          map[string]boolCounts      `json:"flags,omitempty"`
+	Labels         map[string]map[string]int  `json:"labels,omitempty"`
 	ErrorStages    map[string]int             `json:"error_stages,omitempty"`
 	ErrorEvents    int                        `json:"error_events"`
 	WarnEvents     int                        `json:"warn_events"`
-	SkippedLines   int                        `json:"skipped_lines"`
+	ByStatus       map[string]groupSummary    `json:"by_status,omitempty"`
+	ByErrorStage   map[string]groupSummary    `json:"by_error_stage,omitempty"`
 }
 
-func newCollector(eventName, eventDomain string) *collector {
-	return &collector{
-		eventName:   eventName,
+// report is the aggregated output: one summary per collected event name.
+type report struct {
+	Events       []summaryOutput `json:"events"`
+	SkippedLines int             `json:"skipped_lines"`
+}
+
+func newCollector(eventNames []string, eventDomain string) *collector {
+	c := &collector{
+		eventNames:  eventNames,
 		eventDomain: eventDomain,
-		stats: metricsSummary{
-			SeverityCounts: make(map[string]int),
-			StatusCounts:   make(map[int]int),
-			Durations:      make(map[string]*numericStats),
-			ErrorStages:    make(map[string]int),
-		},
+		events:      make(map[string]*metricsSummary, len(eventNames)),
+	}
+	for _, name := range eventNames {
+		c.events[name] = newMetricsSummary()
+	}
+	return c
+}
+
+func newMetricsSummary() *metricsSummary {
+	return &metricsSummary{
+		SeverityCounts: make(map[string]int),
+		StatusCounts:   make(map[int]int),
+		Durations:      make(map[string]*numericStats),
+		Values:         make(map[string]*numericStats),
+		Flags:          make(map[string]*boolCounts),
+		Labels:         make(map[string]map[string]int),
+		ErrorStages:    make(map[string]int),
+		ByStatus:       make(map[int]*groupStats),
+		ByErrorStage:   make(map[string]*groupStats),
 	}
 }
 
@@ -127,17 +186,25 @@ func (c *collector) ingest(line string) {
 		return
 	}
 
-	if rec.EventName != c.eventName {
+	stats, ok := c.events[rec.EventName]
+	if !ok {
 		return
 	}
 	if c.eventDomain != "" && rec.EventDomain != c.eventDomain {
 		return
 	}
 
-	c.addRecord(rec)
+	stats.add(rec)
 }
 
 func decodeRecord(raw string) (logRecord, error) {
+	var probe struct {
+		EventName string `json:"EventName"`
+	}
+	if err := json.Unmarshal([]byte(raw), &probe); err == nil && probe.EventName != "" {
+		return decodeOtelRecord(raw)
+	}
+
 	var rec logRecord
 	dec := json.NewDecoder(strings.NewReader(raw))
 	dec.UseNumber()
@@ -147,98 +214,169 @@ func decodeRecord(raw string) (logRecord, error) {
 	return rec, nil
 }
 
-func (c *collector) addRecord(rec logRecord) {
-	c.stats.Count++
+// decodeOtelRecord maps an OTel log record onto the logrus event layout.
+func decodeOtelRecord(raw string) (logRecord, error) {
+	var otel otelRecord
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&otel); err != nil {
+		return logRecord{}, err
+	}
+
+	rec := logRecord{
+		EventName:      otel.EventName,
+		SeverityText:   otel.SeverityText,
+		SeverityNumber: otel.Severity,
+		Body:           otel.Body.Value,
+		Attributes:     make(map[string]any, len(otel.Attributes)),
+	}
+	for _, kv := range otel.Attributes {
+		if kv.Key == "event.domain" {
+			rec.EventDomain, _ = asString(kv.Value.Value)
+			continue
+		}
+		rec.Attributes[kv.Key] = kv.Value.Value
+	}
+	return rec, nil
+}
+
+func (s *metricsSummary) add(rec logRecord) {
+	s.Count++
 
 	severity := strings.ToUpper(strings.TrimSpace(rec.SeverityText))
 	if severity == "" {
 		severity = "UNSPECIFIED"
 	}
-	c.stats.SeverityCounts[severity]++
+	s.SeverityCounts[severity]++
 
 	switch severity {
 	case "ERROR":
-		c.stats.ErrorEvents++
+		s.ErrorEvents++
 	case "WARN", "WARNING":
-		c.stats.WarnEvents++
-	}
-
-	if rec.Attributes == nil {
-		return
+		s.WarnEvents++
 	}
 
-	if raw, exists := rec.Attributes[attrHTTPStatusCode]; exists {
-		if status, ok := asInt(raw); ok {
-			c.stats.StatusCounts[status]++
+	groups := s.groupsFor(rec)
+	for key, raw := range rec.Attributes {
+		if key == attrHTTPStatusCode {
+			if status, ok := asInt(raw); ok {
+				s.StatusCounts[status]++
+			}
+			continue
 		}
-	}
-	if raw, exists := rec.Attributes[attrTotalMillis]; exists {
-		if v, ok := asFloat(raw); ok {
-			c.stats.addDuration("total", v)
+		name, ok := eventAttributeName(key)
+		if !ok || name == attrRequestStart {
+			continue
 		}
-	}
-	if raw, exists := rec.Attributes[attrAuthMillis]; exists {
-		if v, ok := asFloat(raw); ok {
-			c.stats.addDuration("auth", v)
+		switch {
+		case strings.HasSuffix(name, durationSuffix):
+			if v, ok := asFloat(raw); ok {
+				stage := strings.TrimSuffix(name, durationSuffix)
+				addStat(s.Durations, stage, v)
+				for _, g := range groups {
+					addStat(g.Durations, stage, v)
+				}
+			}
+		case name == attrErrorStage:
+			if stage, ok := asString(raw); ok && stage != "" {
+				s.ErrorStages[stage]++
+			}
+		default:
+			s.addValue(name, raw)
 		}
 	}
-	if raw, exists := rec.Attributes[attrFetchMillis]; exists {
-		if v, ok := asFloat(raw); ok {
-			c.stats.addDuration("fetch", v)
+}
+
+// groupsFor returns the status and error stage groups of rec, counting it in each.
+func (s *metricsSummary) groupsFor(rec logRecord) []*groupStats {
+	var groups []*groupStats
+	if status, ok := asInt(rec.Attributes[attrHTTPStatusCode]); ok {
+		g, exists := s.ByStatus[status]
+		if !exists {
+			g = newGroupStats()
+			s.ByStatus[status] = g
 		}
+		groups = append(groups, g)
 	}
-	if raw, exists := rec.Attributes[attrEncodeMillis]; exists {
-		if v, ok := asFloat(raw); ok {
-			c.stats.addDuration("encode", v)
+	for key, raw := range rec.Attributes {
+		if name, ok := eventAttributeName(key); !ok || name != attrErrorStage {
+			continue
 		}
-	}
-	if raw, exists := rec.Attributes[attrTasksReturned]; exists {
-		if v, ok := asFloat(raw); ok {
-			if c.stats.Tasks == nil {
-				c.stats.Tasks = newNumericStats()
+		if stage, ok := asString(raw); ok && stage != "" {
+			g, exists := s.ByErrorStage[stage]
+			if !exists {
+				g = newGroupStats()
+				s.ByErrorStage[stage] = g
 			}
-			c.stats.Tasks.add(v)
+			groups = append(groups, g)
 		}
 	}
-	if raw, exists := rec.Attributes[attrPageTokenProvided]; exists {
-		if b, ok := asBool(raw); ok {
-			if b {
-				c.stats.PageTokenTrue++
-			} else {
-				c.stats.PageTokenFalse++
-			}
-		}
+	for _, g := range groups {
+		g.Count++
 	}
-	if raw, exists := rec.Attributes[attrHasNextPage]; exists {
-		if b, ok := asBool(raw); ok {
-			if b {
-				c.stats.HasNextTrue++
-			} else {
-				c.stats.HasNextFalse++
-			}
-		}
+	return groups
+}
+
+func newGroupStats() *groupStats {
+	return &groupStats{Durations: make(map[string]*numericStats)}
+}
+
+func (g *groupStats) output() groupSummary {
+	return groupSummary{Count: g.Count, DurationMs: durationSummaries(g.Durations)}
+}
+
+// eventAttributeName strips the prism.<event>. namespace from an attribute key.
+func eventAttributeName(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, "prism.")
+	if !ok {
+		return "", false
 	}
-	if raw, exists := rec.Attributes[attrErrorStage]; exists {
-		if stage, ok := asString(raw); ok && stage != "" {
-			c.stats.ErrorStages[stage]++
+	_, name, ok := strings.Cut(rest, ".")
+	return name, ok && name != ""
+}
+
+func (s *metricsSummary) addValue(name string, raw any) {
+	switch v := raw.(type) {
+	case bool:
+		counts, ok := s.Flags[name]
+		if !ok {
+			counts = &boolCounts{}
+			s.Flags[name] = counts
+		}
+		if v {
+			counts.True++
+		} else {
+			counts.False++
+		}
+	case string:
+		labels, ok := s.Labels[name]
+		if !ok {
+			labels = make(map[string]int)
+			s.Labels[name] = labels
+		}
+		labels[v]++
+	default:
+		if f, ok := asFloat(raw); ok {
+			addStat(s.Values, name, f)
 		}
 	}
 }
 
-func (s *metricsSummary) addDuration(key string, value float64) {
-	stat, ok := s.Durations[key]
+func addStat(stats map[string]*numericStats, key string, value float64) {
+	stat, ok := stats[key]
 	if !ok {
 		stat = newNumericStats()
-		s.Durations[key] = stat
+		stats[key] = stat
 	}
 	stat.add(value)
 }
 
 func newNumericStats() *numericStats {
-	return &numericStats{Min: math.MaxFloat64}
+	return &numericStats{Min: math.MaxFloat64, hist: newHistogram()}
 }
 
 func (n *numericStats) add(value float64) {
+	n.hist.record(value)
 	n.Count++
 	n.Sum += value
 	if value < n.Min {
@@ -262,6 +400,10 @@ func (n *numericStats) toDurationSummary() durationSummary {
 		Min:   min,
 		Max:   n.Max,
 		Avg:   n.Sum / float64(n.Count),
+		P50:   n.hist.valueAt(50),
+		P90:   n.hist.valueAt(90),
+		P99:   n.hist.valueAt(99),
+		P999:  n.hist.valueAt(99.9),
 	}
 }
 
@@ -278,42 +420,122 @@ func (n *numericStats) toNumericSummary() numericSummary {
 		Min:   min,
 		Max:   n.Max,
 		Avg:   n.Sum / float64(n.Count),
+		P50:   n.hist.valueAt(50),
+		P90:   n.hist.valueAt(90),
+		P99:   n.hist.valueAt(99),
+		P999:  n.hist.valueAt(99.9),
 	}
 }
 
-func (c *collector) summary() summaryOutput {
-	durationMap := make(map[string]durationSummary, len(c.stats.Durations))
-	for key, stat := range c.stats.Durations {
-		durationMap[key] = stat.toDurationSummary()
+func durationSummaries(stats map[string]*numericStats) map[string]durationSummary {
+	out := make(map[string]durationSummary, len(stats))
+	for key, stat := range stats {
+		out[key] = stat.toDurationSummary()
 	}
+	return out
+}
 
-	statusCounts := make(map[string]int, len(c.stats.StatusCounts))
-	for status, count := range c.stats.StatusCounts {
-		statusCounts[strconv.Itoa(status)] = count
+func (c *collector) summary() report {
+	out := report{
+		Events:       make([]summaryOutput, 0, len(c.eventNames)),
+		SkippedLines: c.skipped,
+	}
+	for _, name := range c.eventNames {
+		out.Events = append(out.Events, c.events[name].output(name, c.eventDomain))
 	}
+	return out
+}
+
+func (s *metricsSummary) output(eventName, eventDomain string) summaryOutput {
+	durationMap := durationSummaries(s.Durations)
 
-	severity := make(map[string]int, len(c.stats.SeverityCounts))
-	for k, v := range c.stats.SeverityCounts {
+	var values map[string]numericSummary
+	if len(s.Values) > 0 {
+		values = make(map[string]numericSummary, len(s.Values))
+		for key, stat := range s.Values {
+			values[key] = stat.toNumericSummary()
+		}
+	}
+
+	var flags map[string]boolCounts
+	if len(s.Flags) > 0 {
+		flags = make(map[string]boolCounts, len(s.Flags))
+		for key, counts := range s.Flags {
+			flags[key] = *counts
+		}
+	}
+
+	var labels map[string]map[string]int
+	if len(s.Labels) > 0 {
+		labels = make(map[string]map[string]int, len(s.Labels))
+		for key, counts := range s.Labels {
+			labels[key] = compactStringIntMap(counts)
+		}
+	}
+
+	var statusCounts map[string]int
+	if len(s.StatusCounts) > 0 {
+		statusCounts = make(map[string]int, len(s.StatusCounts))
+		for status, count := range s.StatusCounts {
+			statusCounts[strconv.Itoa(status)] = count
+		}
+	}
+
+	severity := make(map[string]int, len(s.SeverityCounts))
+	for k, v := range s.SeverityCounts {
 		severity[k] = v
 	}
 
+	var byStatus map[string]groupSummary
+	if len(s.ByStatus) > 0 {
+		byStatus = make(map[string]groupSummary, len(s.ByStatus))
+		for status, g := range s.ByStatus {
+			byStatus[strconv.Itoa(status)] = g.output()
+		}
+	}
+	var byErrorStage map[string]groupSummary
+	if len(s.ByErrorStage) > 0 {
+		byErrorStage = make(map[string]groupSummary, len(s.ByErrorStage))
+		for stage, g := range s.ByErrorStage {
+			byErrorStage[stage] = g.output()
+		}
+	}
+
 	return summaryOutput{
-		EventName:      c.eventName,
-		EventDomain:    c.eventDomain,
-		TotalEvents:    c.stats.Count,
+		EventName:      eventName,
+		EventDomain:    eventDomain,
+		TotalEvents:    s.Count,
 		SeverityCounts: severity,
 		StatusCounts:   statusCounts,
 		DurationMs:     durationMap,
-		TasksReturned:  c.stats.Tasks.toNumericSummary(),
-		Pagination: paginationSummary{
-			PageToken: boolCounts{True: c.stats.PageTokenTrue, False: c.stats.PageTokenFalse},
-			HasNext:   boolCounts{True: c.stats.HasNextTrue, False: c.stats.HasNextFalse},
-		},
-		ErrorStages:  compactStringIntMap(c.stats.ErrorStages),
-		ErrorEvents:  c.stats.ErrorEvents,
-		WarnEvents:   c.stats.WarnEvents,
-		SkippedLines: c.skipped,
+		Values:         values,
+		Flags:          flags,
+		Labels:         labels,
+		ErrorStages:    compactStringIntMap(s.ErrorStages),
+		ErrorEvents:    s.ErrorEvents,
+		WarnEvents:     s.WarnEvents,
+		ByStatus:       byStatus,
+		ByErrorStage:   byErrorStage,
+	}
+}
+
+// event returns the summary of the named event.
+func (r report) event(name string) (summaryOutput, bool) {
+	for _, ev := range r.Events {
+		if ev.EventName == name {
+			return ev, true
+		}
+	}
+	return summaryOutput{}, false
+}
+
+// ShortString prints one line per event.
+func (r report) ShortString() string {
+	lines := make([]string, 0, len(r.Events))
+	for _, ev := range r.Events {
+		lines = append(lines, ev.ShortString())
 	}
+	return strings.Join(lines, "\n")
 }
 
 func compactStringIntMap(in map[string]int) map[string]int {
@@ -333,9 +555,10 @@ func (s summaryOutput) ShortString() string {
 	warn := s.WarnEvents
 	errCount := s.ErrorEvents
 	totalSummary, ok := s.DurationMs["total"]
-	var totalDur, maxDur float64
+	var totalDur, p99Dur, maxDur float64
 	if ok {
 		totalDur = totalSummary.Avg
+		p99Dur = totalSummary.P99
 		maxDur = totalSummary.Max
 	}
 	return strings.TrimSpace(strings.Join([]string{
@@ -346,6 +569,7 @@ func (s summaryOutput) ShortString() string {
 		"warn=" + strconv.Itoa(warn),
 		"error=" + strconv.Itoa(errCount),
 		"avg_total_ms=" + formatFloat(totalDur),
+		"p99_total_ms=" + formatFloat(p99Dur),
 		"max_total_ms=" + formatFloat(maxDur),
 	}, " "))
 }
@@ -1,9 +1,13 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"testing"
+)
 
 func TestCollectorAggregatesOtelEvents(t *testing.T) {
-	collector := newCollector(tasksEventName, tasksEventDomain)
+	collector := newCollector([]string{tasksEventName}, tasksEventDomain)
 
 	lines := []string{
 		`{"event.name":"prism.api.tasks.request","event.domain":"app","severity_text":"INFO","severity_number":9,"attributes":{"http.status_code":200,"prism.tasks.total_ms":40.5,"prism.tasks.auth_ms":5.0,"prism.tasks.fetch_ms":10.2,"prism.tasks.encode_ms":3.3,"prism.tasks.tasks_returned":12,"prism.tasks.page_token_provided":true,"prism.tasks.has_next_page":false}}`,
@@ -15,7 +19,7 @@ func TestCollectorAggregatesOtelEvents(t *testing.T) {
 		collector.ingest(line)
 	}
 
-	summary := collector.summary()
+	summary := tasksSummary(t, collector)
 
 	if summary.TotalEvents != 2 {
 		t.Fatalf("expected 2 events, got %d", summary.TotalEvents)
@@ -38,20 +42,122 @@ func TestCollectorAggregatesOtelEvents(t *testing.T) {
 		t.Fatalf("expected avg duration >0, got %f", totalStats.Avg)
 	}
 
-	if summary.TasksReturned.Count != 2 {
-		t.Fatalf("expected tasks returned count 2, got %d", summary.TasksReturned.Count)
+	if got := summary.Values["tasks_returned"]; got.Count != 2 || got.Max != 12 {
+		t.Fatalf("unexpected tasks returned: %#v", got)
 	}
-	if summary.Pagination.PageToken.True != 1 || summary.Pagination.PageToken.False != 1 {
-		t.Fatalf("unexpected page token counts: %#v", summary.Pagination.PageToken)
+	if got := summary.Flags["page_token_provided"]; got.True != 1 || got.False != 1 {
+		t.Fatalf("unexpected page token counts: %#v", got)
 	}
-	if summary.Pagination.HasNext.True != 1 || summary.Pagination.HasNext.False != 1 {
-		t.Fatalf("unexpected has next counts: %#v", summary.Pagination.HasNext)
+	if got := summary.Flags["has_next_page"]; got.True != 1 || got.False != 1 {
+		t.Fatalf("unexpected has next counts: %#v", got)
 	}
 	if summary.ErrorStages["storage"] != 1 {
 		t.Fatalf("expected storage error stage, got %#v", summary.ErrorStages)
 	}
+	if got := summary.ByStatus["429"]; got.Count != 1 || got.DurationMs["total"].Max != 60 {
+		t.Fatalf("unexpected 429 group: %#v", got)
+	}
+	if got := summary.ByStatus["200"]; got.Count != 1 || got.DurationMs["fetch"].Count != 1 {
+		t.Fatalf("unexpected 200 group: %#v", got)
+	}
+	if got := summary.ByErrorStage["storage"]; got.Count != 1 || got.DurationMs["total"].Count != 1 {
+		t.Fatalf("unexpected storage group: %#v", got)
+	}
 
+	if collector.summary().SkippedLines != 1 {
+		t.Fatalf("expected the non-json line to be skipped")
+	}
 	if summary.ShortString() == "" {
 		t.Fatal("expected short summary to be non-empty")
 	}
 }
+
+func TestCollectorReadsOtelStdoutRecords(t *testing.T) {
+	collector := newCollector([]string{tasksEventName}, tasksEventDomain)
+
+	lines := []string{
+		`{"Timestamp":"2025-01-01T00:00:00Z","EventName":"prism.api.tasks.request","Severity":13,"SeverityText":"WARN","Body":{"Type":"String","Value":"tasks request completed"},"Attributes":[{"Key":"event.domain","Value":{"Type":"String","Value":"app"}},{"Key":"http.status_code","Value":{"Type":"Int64","Value":429}},{"Key":"prism.tasks.total_ms","Value":{"Type":"Float64","Value":12.5}},{"Key":"prism.tasks.has_next_page","Value":{"Type":"Bool","Value":false}},{"Key":"prism.tasks.error_stage","Value":{"Type":"String","Value":"rate_limit"}}]}`,
+		`{"Resource":[],"ScopeMetrics":[]}`,
+	}
+	for _, line := range lines {
+		collector.ingest(line)
+	}
+
+	summary := tasksSummary(t, collector)
+	if summary.TotalEvents != 1 || summary.WarnEvents != 1 {
+		t.Fatalf("unexpected event counts: %#v", summary)
+	}
+	if summary.StatusCounts["429"] != 1 {
+		t.Fatalf("unexpected status counts: %#v", summary.StatusCounts)
+	}
+	if got := summary.DurationMs["total"]; got.Count != 1 || got.Max != 12.5 {
+		t.Fatalf("unexpected total duration: %#v", got)
+	}
+	if got := summary.Flags["has_next_page"]; got.False != 1 {
+		t.Fatalf("unexpected has next counts: %#v", got)
+	}
+	if summary.ErrorStages["rate_limit"] != 1 {
+		t.Fatalf("expected rate_limit error stage, got %#v", summary.ErrorStages)
+	}
+}
+
+func TestCollectorAggregatesCommandEvents(t *testing.T) {
+	collector := newCollector(defaultEventNames, tasksEventDomain)
+
+	for i := 1; i <= 10; i++ {
+		path := "handoff"
+		if i == 10 {
+			path = "inline"
+		}
+		collector.ingest(fmt.Sprintf(`{"event.name":"prism.api.commands.request","event.domain":"app","severity_text":"INFO","attributes":{"http.status_code":202,"prism.commands.total_ms":%d,"prism.commands.validate_ms":0.1,"prism.commands.command_count":%d,"prism.commands.enqueue_path":%q}}`, i, i%3+1, path))
+	}
+	collector.ingest(`{"event.name":"prism.api.commands.enqueue","event.domain":"app","severity_text":"ERROR","attributes":{"prism.enqueue.total_ms":30,"prism.enqueue.queue_wait_ms":25,"prism.enqueue.error_stage":"enqueue"}}`)
+
+	report := collector.summary()
+	if len(report.Events) != len(defaultEventNames) {
+		t.Fatalf("expected a summary per event name, got %d", len(report.Events))
+	}
+
+	commands, _ := report.event(commandsEventName)
+	if commands.TotalEvents != 10 || commands.StatusCounts["202"] != 10 {
+		t.Fatalf("unexpected commands summary: %#v", commands)
+	}
+	total := commands.DurationMs["total"]
+	if !near(total.P50, 5) || !near(total.P90, 9) || total.P99 != 10 || total.P999 != 10 {
+		t.Fatalf("unexpected total percentiles: %#v", total)
+	}
+	if _, ok := commands.DurationMs["validate"]; !ok {
+		t.Fatalf("expected validate stage, got %#v", commands.DurationMs)
+	}
+	if got := commands.Values["command_count"]; got.Count != 10 || got.Max != 3 {
+		t.Fatalf("unexpected command counts: %#v", got)
+	}
+	if got := commands.Labels["enqueue_path"]; got["handoff"] != 9 || got["inline"] != 1 {
+		t.Fatalf("unexpected enqueue paths: %#v", got)
+	}
+
+	enqueue, _ := report.event(enqueueEventName)
+	if enqueue.TotalEvents != 1 || enqueue.ErrorEvents != 1 || enqueue.ErrorStages["enqueue"] != 1 {
+		t.Fatalf("unexpected enqueue summary: %#v", enqueue)
+	}
+	if got := enqueue.DurationMs["queue_wait"]; got.Max != 25 {
+		t.Fatalf("unexpected queue wait: %#v", got)
+	}
+	if enqueue.StatusCounts != nil {
+		t.Fatalf("expected no status counts for jobs, got %#v", enqueue.StatusCounts)
+	}
+}
+
+func tasksSummary(t *testing.T, c *collector) summaryOutput {
+	t.Helper()
+	summary, ok := c.summary().event(tasksEventName)
+	if !ok {
+		t.Fatal("expected a tasks summary")
+	}
+	return summary
+}
+
+// near reports whether got is within the 0.1% histogram precision of want.
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= want/1000
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// compareOptions control which latencies of two reports are compared and when a
+// difference counts as a regression.
+type compareOptions struct {
+	thresholdPct float64
+	minDeltaMs   float64
+	minCount     int
+	percentiles  []string
+	stages       []string
+}
+
+type comparison struct {
+	Event      string  `json:"event"`
+	Stage      string  `json:"stage"`
+	Percentile string  `json:"percentile"`
+	Baseline   float64 `json:"baseline_ms"`
+	Current    float64 `json:"current_ms"`
+	ChangePct  float64 `json:"change_pct"`
+	Regressed  bool    `json:"regressed"`
+}
+
+// runCompare implements the compare subcommand. It exits with 1 when any
+// compared latency regressed beyond the threshold.
+func runCompare(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	var (
+		baselinePath string
+		currentPath  string
+		outPath      string
+		percentiles  string
+		stages       string
+		opts         compareOptions
+	)
+	fs.StringVar(&baselinePath, "baseline", "", "summary JSON of the baseline run")
+	fs.StringVar(&currentPath, "current", "", "summary JSON of the run to check")
+	fs.StringVar(&outPath, "out", "", "optional path to write the comparison JSON")
+	fs.Float64Var(&opts.thresholdPct, "threshold", 10, "allowed latency increase in percent")
+	fs.Float64Var(&opts.minDeltaMs, "min-delta-ms", 1, "ignore increases smaller than this many milliseconds")
+	fs.IntVar(&opts.minCount, "min-count", 20, "skip events with fewer samples in either run")
+	fs.StringVar(&percentiles, "percentiles", "p50,p90,p99", "comma-separated percentiles to compare (p50, p90, p99, p999)")
+	fs.StringVar(&stages, "stages", "total", "comma-separated stages to compare")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if baselinePath == "" || currentPath == "" {
+		fmt.Fprintln(os.Stderr, "-baseline and -current are required")
+		return 2
+	}
+	opts.percentiles = splitNames(percentiles)
+	opts.stages = splitNames(stages)
+	for _, p := range opts.percentiles {
+		if _, ok := percentileOf(durationSummary{}, p); !ok {
+			fmt.Fprintf(os.Stderr, "unknown percentile %q\n", p)
+			return 2
+		}
+	}
+
+	baseline, err := readReport(baselinePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read baseline: %v\n", err)
+		return 2
+	}
+	current, err := readReport(currentPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read current: %v\n", err)
+		return 2
+	}
+
+	results := compareReports(baseline, current, opts)
+	regressed := false
+	for _, r := range results {
+		status := "ok"
+		if r.Regressed {
+			status = "REGRESSION"
+			regressed = true
+		}
+		fmt.Fprintf(stdout, "%s event=%s stage=%s %s baseline=%s current=%s change=%s%%\n",
+			status, r.Event, r.Stage, r.Percentile, formatFloat(r.Baseline), formatFloat(r.Current), formatFloat(r.ChangePct))
+	}
+
+	if outPath != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err == nil {
+			err = os.WriteFile(outPath, data, 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write comparison: %v\n", err)
+			return 2
+		}
+	}
+	if regressed {
+		return 1
+	}
+	return 0
+}
+
+// compareReports compares the configured latency percentiles of every event and
+// stage present in both reports with enough samples.
+func compareReports(baseline, current report, opts compareOptions) []comparison {
+	var results []comparison
+	for _, base := range baseline.Events {
+		cur, ok := current.event(base.EventName)
+		if !ok || base.TotalEvents < opts.minCount || cur.TotalEvents < opts.minCount {
+			continue
+		}
+		for _, stage := range opts.stages {
+			b, okBase := base.DurationMs[stage]
+			c, okCur := cur.DurationMs[stage]
+			if !okBase || !okCur {
+				continue
+			}
+			for _, p := range opts.percentiles {
+				bv, _ := percentileOf(b, p)
+				cv, _ := percentileOf(c, p)
+				results = append(results, compareValue(base.EventName, stage, p, bv, cv, opts))
+			}
+		}
+	}
+	return results
+}
+
+func compareValue(event, stage, percentile string, baseline, current float64, opts compareOptions) comparison {
+	r := comparison{
+		Event:      event,
+		Stage:      stage,
+		Percentile: percentile,
+		Baseline:   baseline,
+		Current:    current,
+	}
+	if baseline > 0 {
+		r.ChangePct = (current - baseline) / baseline * 100
+	}
+	delta := current - baseline
+	r.Regressed = delta >= opts.minDeltaMs && delta > baseline*opts.thresholdPct/100
+	return r
+}
+
+func percentileOf(s durationSummary, name string) (float64, bool) {
+	switch strings.ToLower(name) {
+	case "p50":
+		return s.P50, true
+	case "p90":
+		return s.P90, true
+	case "p99":
+		return s.P99, true
+	case "p999":
+		return s.P999, true
+	default:
+		return 0, false
+	}
+}
+
+func readReport(path string) (report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report{}, err
+	}
+	var r report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return report{}, err
+	}
+	return r, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareReportsFlagsRegressions(t *testing.T) {
+	baseline := report{Events: []summaryOutput{
+		{EventName: tasksEventName, TotalEvents: 100, DurationMs: map[string]durationSummary{
+			"total": {P50: 10, P90: 20, P99: 40},
+			"fetch": {P50: 5, P90: 8, P99: 10},
+		}},
+		{EventName: commandsEventName, TotalEvents: 5, DurationMs: map[string]durationSummary{
+			"total": {P50: 1, P99: 2},
+		}},
+	}}
+	current := report{Events: []summaryOutput{
+		{EventName: tasksEventName, TotalEvents: 100, DurationMs: map[string]durationSummary{
+			"total": {P50: 10.5, P90: 20.5, P99: 60},
+			"fetch": {P50: 5, P90: 8, P99: 30},
+		}},
+		{EventName: commandsEventName, TotalEvents: 5, DurationMs: map[string]durationSummary{
+			"total": {P50: 10, P99: 20},
+		}},
+	}}
+	opts := compareOptions{
+		thresholdPct: 10,
+		minDeltaMs:   1,
+		minCount:     20,
+		percentiles:  []string{"p50", "p90", "p99"},
+		stages:       []string{"total"},
+	}
+
+	results := compareReports(baseline, current, opts)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 comparisons (commands has too few samples), got %#v", results)
+	}
+	for _, r := range results {
+		want := r.Percentile == "p99"
+		if r.Regressed != want {
+			t.Fatalf("unexpected regression flag for %s: %#v", r.Percentile, r)
+		}
+	}
+	if results[2].ChangePct != 50 {
+		t.Fatalf("expected a 50%% change, got %v", results[2].ChangePct)
+	}
+}
+
+func TestRunCompareExitCode(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, p99 float64) string {
+		r := report{Events: []summaryOutput{{EventName: tasksEventName, TotalEvents: 50, DurationMs: map[string]durationSummary{
+			"total": {P50: 10, P90: 15, P99: p99},
+		}}}}
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.json", 20)
+	same := write("same.json", 21)
+	slow := write("slow.json", 40)
+
+	var out bytes.Buffer
+	if code := runCompare([]string{"-baseline", base, "-current", same}, &out); code != 0 {
+		t.Fatalf("expected no regression, got exit %d: %s", code, out.String())
+	}
+	out.Reset()
+	if code := runCompare([]string{"-baseline", base, "-current", slow, "-threshold", "50"}, &out); code != 1 {
+		t.Fatalf("expected a regression, got exit %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "REGRESSION event=prism.api.tasks.request stage=total p99") {
+		t.Fatalf("unexpected output: %s", out.String())
+	}
+	if code := runCompare([]string{"-baseline", base}, &out); code != 2 {
+		t.Fatalf("expected a usage error, got exit %d", code)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// histogram is a log-linear (HDR style) histogram. Values are recorded in units
+// of histogramUnit and bucketed so that every bucket spans less than 1/1024 of
+// its lower bound; percentiles are accurate to three significant digits
+// regardless of the range of the recorded values.
+type histogram struct {
+	counts map[int]uint64
+	total  uint64
+	min    float64
+	max    float64
+}
+
+const (
+	// histogramUnit is the smallest distinguishable value: one microsecond for
+	// millisecond durations.
+	histogramUnit  = 0.001
+	subBucketBits  = 11
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+func newHistogram() *histogram {
+	return &histogram{counts: make(map[int]uint64), min: math.MaxFloat64}
+}
+
+func (h *histogram) record(value float64) {
+	if value < 0 || math.IsNaN(value) {
+		value = 0
+	}
+	h.counts[bucketIndex(toUnits(value))]++
+	h.total++
+	if value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+}
+
+// valueAt returns the value at percentile p, in [0, 100]. It reports the upper
+// bound of the bucket holding the value, clamped to the recorded range.
+func (h *histogram) valueAt(p float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	indexes := make([]int, 0, len(h.counts))
+	for idx := range h.counts {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	var seen uint64
+	for _, idx := range indexes {
+		seen += h.counts[idx]
+		if seen >= rank {
+			v := fromUnits(bucketUpperBound(idx))
+			return math.Min(math.Max(v, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+func toUnits(value float64) uint64 {
+	return uint64(math.Round(value / histogramUnit))
+}
+
+func fromUnits(units uint64) float64 {
+	return float64(units) * histogramUnit
+}
+
+// bucketIndex maps units below subBucketCount to their own bucket and larger
+// units to one of subBucketHalf buckets per power of two.
+func bucketIndex(units uint64) int {
+	if units < subBucketCount {
+		return int(units)
+	}
+	shift := bits.Len64(units) - subBucketBits
+	sub := units >> shift
+	return subBucketCount + (shift-1)*subBucketHalf + int(sub-subBucketHalf)
+}
+
+func bucketUpperBound(idx int) uint64 {
+	if idx < subBucketCount {
+		return uint64(idx)
+	}
+	shift := (idx-subBucketCount)/subBucketHalf + 1
+	sub := uint64((idx-subBucketCount)%subBucketHalf + subBucketHalf)
+	return (sub << shift) + (1 << shift) - 1
+}
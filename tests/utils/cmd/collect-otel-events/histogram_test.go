@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 100000; i++ {
+		h.record(float64(i) / 10)
+	}
+
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{50, 5000},
+		{90, 9000},
+		{99, 9900},
+		{99.9, 9990},
+		{100, 10000},
+	}
+	for _, tt := range tests {
+		got := h.valueAt(tt.p)
+		if math.Abs(got-tt.want)/tt.want > 0.001 {
+			t.Fatalf("p%v = %v, want %v within 0.1%%", tt.p, got, tt.want)
+		}
+	}
+	if got := h.valueAt(0); got != 0.1 {
+		t.Fatalf("p0 = %v, want the minimum", got)
+	}
+}
+
+func TestHistogramBucketsRoundTrip(t *testing.T) {
+	for _, units := range []uint64{0, 1, 2047, 2048, 2049, 4095, 4096, 1 << 20, 1<<40 + 12345} {
+		idx := bucketIndex(units)
+		upper := bucketUpperBound(idx)
+		if upper < units {
+			t.Fatalf("bucket %d upper bound %d below value %d", idx, upper, units)
+		}
+		if units >= subBucketCount && float64(upper-units)/float64(units) > 1.0/subBucketHalf {
+			t.Fatalf("bucket %d too wide for %d: upper %d", idx, units, upper)
+		}
+		if idx > 0 && bucketUpperBound(idx-1) >= units {
+			t.Fatalf("value %d should fall in an earlier bucket than %d", units, idx)
+		}
+	}
+}
@@ -8,17 +8,22 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(runCompare(os.Args[2:], os.Stdout))
+	}
+
 	var (
 		outPath     string
-		eventName   string
+		eventNames  string
 		eventDomain string
 	)
 
 	flag.StringVar(&outPath, "out", "", "path to write aggregated metrics JSON")
-	flag.StringVar(&eventName, "event-name", tasksEventName, "observability event name to collect")
+	flag.StringVar(&eventNames, "event-name", strings.Join(defaultEventNames, ","), "comma-separated observability event names to collect")
 	flag.StringVar(&eventDomain, "event-domain", tasksEventDomain, "observability event domain to match")
 	flag.Parse()
 
@@ -27,7 +32,7 @@ func main() {
 		os.Exit(2)
 	}
 
-	collector := newCollector(eventName, eventDomain)
+	collector := newCollector(splitNames(eventNames), eventDomain)
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
@@ -67,3 +72,13 @@ func main() {
 
 	fmt.Println(summary.ShortString())
 }
+
+func splitNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}